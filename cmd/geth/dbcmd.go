@@ -17,6 +17,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -62,6 +63,7 @@ Remove blockchain and state databases`,
 			dbPutCmd,
 			dbGetSlotsCmd,
 			dbDumpFreezerIndex,
+			dbFreezerVerifyCmd,
 		},
 	}
 	dbInspectCmd = cli.Command{
@@ -203,6 +205,36 @@ WARNING: This is a low-level operation which may cause database corruption!`,
 		},
 		Description: "This command displays information about the freezer index.",
 	}
+	freezerRepairFlag = cli.BoolFlag{
+		Name:  "repair",
+		Usage: "Truncate the ancient store to the last intact block if corruption is found",
+	}
+	dbFreezerVerifyCmd = cli.Command{
+		Action:    utils.MigrateFlags(freezerVerify),
+		Name:      "freezer-verify",
+		Usage:     "Verify the integrity of the ancient store",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.SyncModeFlag,
+			utils.MainnetFlag,
+			utils.RopstenFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+			utils.SyscoinFlag,
+			utils.TanenbaumFlag,
+			freezerRepairFlag,
+		},
+		Description: `This command checks the data of all freezer tables against their item
+checksums and the frozen block hashes against the frozen headers. Items frozen
+before checksums were introduced are checksummed first, which takes a full pass
+over their data; the node must not be running.
+
+If corruption is found and --repair is given, the ancient store is truncated to
+the last intact block and the chain head is rewound onto it, so that the next
+sync re-fetches the dropped blocks from the network.`,
+	}
 )
 
 func removeDB(ctx *cli.Context) error {
@@ -515,3 +547,53 @@ func freezerInspect(ctx *cli.Context) error {
 	}
 	return nil
 }
+
+func freezerVerify(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	path := filepath.Join(stack.ResolvePath("chaindata"), "ancient")
+	if ancient := ctx.GlobalString(utils.AncientFlag.Name); ancient != "" {
+		path = stack.ResolvePath(ancient)
+	}
+	log.Info("Verifying freezer", "location", path)
+	start := time.Now()
+	bad, frozen, err := rawdb.VerifyFreezer(path)
+	if err != nil {
+		return err
+	}
+	if bad == frozen {
+		log.Info("Freezer data intact", "blocks", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+		return nil
+	}
+	log.Error("Freezer data corrupted", "number", bad, "frozen", frozen, "elapsed", common.PrettyDuration(time.Since(start)))
+	if !ctx.Bool(freezerRepairFlag.Name) {
+		return fmt.Errorf("corrupted freezer data from block #%d, rerun with --%s to truncate", bad, freezerRepairFlag.Name)
+	}
+	if bad == 0 {
+		return errors.New("genesis block corrupted, the chain needs to be resynced")
+	}
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	if err := db.TruncateAncients(bad); err != nil {
+		return err
+	}
+	rewindChainHead(db, bad-1)
+	log.Info("Truncated corrupted freezer data", "blocks", frozen-bad, "head", bad-1)
+	return nil
+}
+
+// rewindChainHead moves the chain head markers beyond the given block back onto
+// it, so that the next sync re-fetches the dropped blocks from the network.
+func rewindChainHead(db ethdb.Database, number uint64) {
+	hash := rawdb.ReadCanonicalHash(db, number)
+	rewind := func(head common.Hash, write func(ethdb.KeyValueWriter, common.Hash)) {
+		if n := rawdb.ReadHeaderNumber(db, head); n == nil || *n > number {
+			write(db, hash)
+		}
+	}
+	rewind(rawdb.ReadHeadHeaderHash(db), rawdb.WriteHeadHeaderHash)
+	rewind(rawdb.ReadHeadFastBlockHash(db), rawdb.WriteHeadFastBlockHash)
+	rewind(rawdb.ReadHeadBlockHash(db), rawdb.WriteHeadBlockHash)
+}
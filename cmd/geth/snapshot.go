@@ -25,11 +25,13 @@ import (
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/state/snapshot"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
@@ -144,6 +146,55 @@ verification. The default checking target is the HEAD state. It's basically iden
 to traverse-state, but the check granularity is smaller. 
 
 It's also usable without snapshot enabled.
+`,
+			},
+			{
+				Name:      "export",
+				Usage:     "Export the snapshot of the given state root into a file",
+				ArgsUsage: "<file> [<root>]",
+				Action:    utils.MigrateFlags(exportSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+				},
+				Description: `
+geth snapshot export <file> [<state-root>]
+will write the flat accounts and storages of the specified snapshot, along with
+the referenced contract codes and the Syscoin NEVM block mappings, into a compact
+checksummed binary file. The default export target is the HEAD state, which is
+exported together with the head block.
+`,
+			},
+			{
+				Name:      "import",
+				Usage:     "Import a snapshot exported by 'geth snapshot export'",
+				ArgsUsage: "<file>",
+				Action:    utils.MigrateFlags(importSnapshot),
+				Category:  "MISCELLANEOUS COMMANDS",
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.RopstenFlag,
+					utils.RinkebyFlag,
+					utils.GoerliFlag,
+					utils.SyscoinFlag,
+					utils.TanenbaumFlag,
+				},
+				Description: `
+geth snapshot import <file>
+will load the flat state from the given export file as the local snapshot and
+rebuild the state trie from it, aborting if the rebuilt state root doesn't match
+the exported one. The Syscoin NEVM block mappings are imported too, and if the
+export carries the head block, it is set as the chain head, so a node can be
+bootstrapped from the file without peers. The ancestors of the head block are not
+imported. The genesis block of the selected network is written first if missing.
+
+The database must not contain a snapshot yet and must use the hash based state
+scheme, databases using the path scheme are rejected.
 `,
 			},
 			{
@@ -214,7 +265,7 @@ func verifyState(ctx *cli.Context) error {
 		log.Error("Failed to load head block")
 		return errors.New("no head block")
 	}
-	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root(), false, false, false)
+	snaptree, err := snapshot.New(chaindb, makeTrieDatabase(chaindb), 256, headBlock.Root(), false, false, false)
 	if err != nil {
 		log.Error("Failed to open snapshot tree", "err", err)
 		return err
@@ -271,7 +322,11 @@ func traverseState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := makeTrieDatabase(chaindb)
+	if triedb.Scheme() == rawdb.BinaryScheme {
+		log.Error("State traversal is not supported by the binary trie")
+		return errors.New("unsupported state scheme")
+	}
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -293,7 +348,7 @@ func traverseState(ctx *cli.Context) error {
 			return err
 		}
 		if acc.Root != emptyRoot {
-			storageTrie, err := trie.NewSecure(acc.Root, triedb)
+			storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.Key), acc.Root, triedb)
 			if err != nil {
 				log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 				return err
@@ -361,7 +416,11 @@ func traverseRawState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := makeTrieDatabase(chaindb)
+	if triedb.Scheme() == rawdb.BinaryScheme {
+		log.Error("State traversal is not supported by the binary trie")
+		return errors.New("unsupported state scheme")
+	}
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -380,9 +439,9 @@ func traverseRawState(ctx *cli.Context) error {
 		nodes += 1
 		node := accIter.Hash()
 
-		if node != (common.Hash{}) {
+		if node != (common.Hash{}) && triedb.Scheme() == rawdb.HashScheme {
 			// Check the present for non-empty hash node(embedded node doesn't
-			// have their own hash).
+			// have their own hash). Path based nodes are verified on resolution.
 			blob := rawdb.ReadTrieNode(chaindb, node)
 			if len(blob) == 0 {
 				log.Error("Missing trie node(account)", "hash", node)
@@ -399,7 +458,7 @@ func traverseRawState(ctx *cli.Context) error {
 				return errors.New("invalid account")
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
 				if err != nil {
 					log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 					return errors.New("missing storage trie")
@@ -411,7 +470,7 @@ func traverseRawState(ctx *cli.Context) error {
 
 					// Check the present for non-empty hash node(embedded node doesn't
 					// have their own hash).
-					if node != (common.Hash{}) {
+					if node != (common.Hash{}) && triedb.Scheme() == rawdb.HashScheme {
 						blob := rawdb.ReadTrieNode(chaindb, node)
 						if len(blob) == 0 {
 							log.Error("Missing trie node(storage)", "hash", node)
@@ -466,7 +525,7 @@ func dumpState(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, root, false, false, false)
+	snaptree, err := snapshot.New(db, makeTrieDatabase(db), 256, root, false, false, false)
 	if err != nil {
 		return err
 	}
@@ -527,3 +586,94 @@ func dumpState(ctx *cli.Context) error {
 		"elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
+
+func exportSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if ctx.NArg() < 1 || ctx.NArg() > 2 {
+		log.Error("Invalid arguments given")
+		return errors.New("invalid arguments")
+	}
+	chaindb := utils.MakeChainDatabase(ctx, stack, true)
+	headBlock := rawdb.ReadHeadBlock(chaindb)
+	if headBlock == nil {
+		log.Error("Failed to load head block")
+		return errors.New("no head block")
+	}
+	triedb := makeTrieDatabase(chaindb)
+	if triedb.Scheme() == rawdb.BinaryScheme {
+		log.Error("Snapshot export is not supported by the binary trie")
+		return errors.New("unsupported state scheme")
+	}
+	snaptree, err := snapshot.New(chaindb, triedb, 256, headBlock.Root(), false, false, false)
+	if err != nil {
+		log.Error("Failed to open snapshot tree", "err", err)
+		return err
+	}
+	var root = headBlock.Root()
+	if ctx.NArg() == 2 {
+		root, err = parseRoot(ctx.Args()[1])
+		if err != nil {
+			log.Error("Failed to resolve state root", "err", err)
+			return err
+		}
+	}
+	var head *snapshot.ExportHead
+	if root == headBlock.Root() {
+		head = &snapshot.ExportHead{
+			Block: headBlock,
+			TD:    rawdb.ReadTd(chaindb, headBlock.Hash(), headBlock.NumberU64()),
+		}
+		if head.TD == nil {
+			log.Error("Failed to load head block total difficulty")
+			return errors.New("no head total difficulty")
+		}
+	} else {
+		log.Warn("Exporting state without its block, the import will not set a chain head", "root", root)
+	}
+	out, err := os.Create(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	if err := snapshot.Export(snaptree, root, head, chaindb, out); err != nil {
+		out.Close()
+		log.Error("Failed to export snapshot", "root", root, "err", err)
+		return err
+	}
+	return out.Close()
+}
+
+func importSnapshot(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	if ctx.NArg() != 1 {
+		log.Error("Invalid arguments given")
+		return errors.New("invalid arguments")
+	}
+	in, err := os.Open(ctx.Args()[0])
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, false)
+	if _, _, err := core.SetupGenesisBlock(chaindb, utils.MakeGenesis(ctx)); err != nil {
+		log.Error("Failed to set up the genesis block", "err", err)
+		return err
+	}
+	root, err := snapshot.Import(chaindb, in)
+	if err != nil {
+		log.Error("Failed to import snapshot", "err", err)
+		return err
+	}
+	log.Info("Imported the state", "root", root)
+	return nil
+}
+
+// makeTrieDatabase opens a trie database on top of the chain database, using the
+// trie node storage scheme recorded in it.
+func makeTrieDatabase(db ethdb.Database) *trie.Database {
+	return trie.NewDatabaseWithConfig(db, &trie.Config{Scheme: rawdb.ReadStateScheme(db)})
+}
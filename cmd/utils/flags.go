@@ -47,6 +47,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -113,10 +114,18 @@ var (
 		Usage: "Data directory for the databases and keystore",
 		Value: DirectoryString(node.DefaultDataDir()),
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble'), defaults to the one of the existing database",
+	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	AncientReadOnlyFlag = cli.BoolFlag{
+		Name:  "datadir.ancient.readonly",
+		Usage: "Open the ancient chain segments read-only, following another node writing them (full sync only)",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -225,6 +234,18 @@ var (
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode (default = enable)`,
 	}
+	StatePruneIntervalFlag = cli.DurationFlag{
+		Name:  "pruning.interval",
+		Usage: "Time between two online state pruning rounds, pruning stale state while the node is running (0 = disabled)",
+	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Trie node storage scheme of a new database ("hash" or "path"), existing databases keep their scheme`,
+	}
+	StateHistoryFlag = cli.Uint64Flag{
+		Name:  "state.history",
+		Usage: "Number of recent blocks to keep flat state history for, serving historical state queries (0 = disabled)",
+	}
 	TxLookupLimitFlag = cli.Uint64Flag{
 		Name:  "txlookuplimit",
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
@@ -382,6 +403,16 @@ var (
 		Usage: "Maximum amount of time non-executable transaction are queued",
 		Value: ethconfig.Defaults.TxPool.Lifetime,
 	}
+	TxPoolDropHistoryFlag = cli.Uint64Flag{
+		Name:  "txpool.drophistory",
+		Usage: "Number of dropped transactions to remember the drop reason of (0 = disabled)",
+		Value: ethconfig.Defaults.TxPool.DropHistory,
+	}
+	TxPoolPrivateLifetimeFlag = cli.DurationFlag{
+		Name:  "txpool.privatelifetime",
+		Usage: "Default amount of time private transactions are withheld from the network",
+		Value: ethconfig.Defaults.TxPool.PrivateLifetime,
+	}
 	// Performance tuning settings
 	CacheFlag = cli.IntFlag{
 		Name:  "cache",
@@ -581,6 +612,10 @@ var (
 		Usage: "Comma separated list of virtual hostnames from which to accept requests (server enforced). Accepts '*' wildcard.",
 		Value: strings.Join(node.DefaultConfig.GraphQLVirtualHosts, ","),
 	}
+	GraphQLTracingFlag = cli.BoolFlag{
+		Name:  "graphql.tracing",
+		Usage: "Enable the call traces of transactions on GraphQL (re-executes the blocks queried)",
+	}
 	WSEnabledFlag = cli.BoolFlag{
 		Name:  "ws",
 		Usage: "Enable the WS-RPC server",
@@ -610,6 +645,25 @@ var (
 		Usage: "HTTP path prefix on which JSON-RPC is served. Use '/' to serve on all paths.",
 		Value: "",
 	}
+	BinaryEnabledFlag = cli.BoolFlag{
+		Name:  "binary",
+		Usage: "Enable the binary RPC server (length-prefixed RLP framing over TCP)",
+	}
+	BinaryListenAddrFlag = cli.StringFlag{
+		Name:  "binary.addr",
+		Usage: "Binary RPC server listening interface",
+		Value: node.DefaultBinaryHost,
+	}
+	BinaryPortFlag = cli.IntFlag{
+		Name:  "binary.port",
+		Usage: "Binary RPC server listening port",
+		Value: node.DefaultBinaryPort,
+	}
+	BinaryApiFlag = cli.StringFlag{
+		Name:  "binary.api",
+		Usage: "API's offered over the binary RPC interface",
+		Value: "",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -622,6 +676,26 @@ var (
 		Name:  "rpc.allow-unprotected-txs",
 		Usage: "Allow for unprotected (non EIP155 signed) transactions to be submitted via RPC",
 	}
+	RPCBatchLimitFlag = cli.IntFlag{
+		Name:  "rpc.batchlimit",
+		Usage: "Maximum number of calls in an RPC batch request (0 = unlimited)",
+		Value: node.DefaultConfig.RPCExecutionLimits.BatchItems,
+	}
+	RPCResponseLimitFlag = cli.IntFlag{
+		Name:  "rpc.responselimit",
+		Usage: "Maximum size in bytes of an RPC response or batch response (0 = unlimited)",
+		Value: node.DefaultConfig.RPCExecutionLimits.ResponseBytes,
+	}
+	RPCCallTimeoutFlag = cli.DurationFlag{
+		Name:  "rpc.calltimeout",
+		Usage: "Maximum execution time of an RPC call (0 = unlimited)",
+		Value: node.DefaultConfig.RPCExecutionLimits.CallTimeout,
+	}
+	RPCSlowThresholdFlag = cli.DurationFlag{
+		Name:  "rpc.slowthreshold",
+		Usage: "Execution time above which RPC calls are logged as slow (0 = disabled)",
+		Value: node.DefaultConfig.RPCExecutionLimits.SlowThreshold,
+	}
 
 	// Network Settings
 	MaxPeersFlag = cli.IntFlag{
@@ -702,6 +776,21 @@ var (
 		Usage: "Gas price below which gpo will ignore transactions",
 		Value: ethconfig.Defaults.GPO.IgnorePrice.Int64(),
 	}
+	GpoStrategyFlag = cli.StringFlag{
+		Name:  "gpo.strategy",
+		Usage: "Tip estimation strategy of the gpo (percentile, timeweighted, mempool, inclusion)",
+		Value: ethconfig.Defaults.GPO.Strategy,
+	}
+	GpoHalfLifeFlag = cli.DurationFlag{
+		Name:  "gpo.halflife",
+		Usage: "Block age at which a sampled tip weighs half as much (timeweighted strategy)",
+		Value: ethconfig.Defaults.GPO.HalfLife,
+	}
+	GpoTargetBlocksFlag = cli.IntFlag{
+		Name:  "gpo.targetblocks",
+		Usage: "Number of blocks suggested tips should get included within (inclusion strategy)",
+		Value: ethconfig.Defaults.GPO.TargetBlocks,
+	}
 
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
@@ -1007,6 +1096,9 @@ func setGraphQL(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(GraphQLVirtualHostsFlag.Name) {
 		cfg.GraphQLVirtualHosts = SplitAndTrim(ctx.GlobalString(GraphQLVirtualHostsFlag.Name))
 	}
+	if ctx.GlobalIsSet(GraphQLTracingFlag.Name) {
+		cfg.GraphQLTracing = ctx.GlobalBool(GraphQLTracingFlag.Name)
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -1035,6 +1127,40 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	}
 }
 
+// setRPCExecutionLimits applies the RPC request limits and slow request logging
+// settings shared by the HTTP, WS and IPC servers to the node config.
+func setRPCExecutionLimits(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalIsSet(RPCBatchLimitFlag.Name) {
+		cfg.RPCExecutionLimits.BatchItems = ctx.GlobalInt(RPCBatchLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCResponseLimitFlag.Name) {
+		cfg.RPCExecutionLimits.ResponseBytes = ctx.GlobalInt(RPCResponseLimitFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCCallTimeoutFlag.Name) {
+		cfg.RPCExecutionLimits.CallTimeout = ctx.GlobalDuration(RPCCallTimeoutFlag.Name)
+	}
+	if ctx.GlobalIsSet(RPCSlowThresholdFlag.Name) {
+		cfg.RPCExecutionLimits.SlowThreshold = ctx.GlobalDuration(RPCSlowThresholdFlag.Name)
+	}
+}
+
+// setBinary creates the binary RPC listener interface string from the set
+// command line flags, returning empty if the binary endpoint is disabled.
+func setBinary(ctx *cli.Context, cfg *node.Config) {
+	if ctx.GlobalBool(BinaryEnabledFlag.Name) && cfg.BinaryHost == "" {
+		cfg.BinaryHost = "127.0.0.1"
+		if ctx.GlobalIsSet(BinaryListenAddrFlag.Name) {
+			cfg.BinaryHost = ctx.GlobalString(BinaryListenAddrFlag.Name)
+		}
+	}
+	if ctx.GlobalIsSet(BinaryPortFlag.Name) {
+		cfg.BinaryPort = ctx.GlobalInt(BinaryPortFlag.Name)
+	}
+	if ctx.GlobalIsSet(BinaryApiFlag.Name) {
+		cfg.BinaryModules = SplitAndTrim(ctx.GlobalString(BinaryApiFlag.Name))
+	}
+}
+
 // setIPC creates an IPC path configuration from the set command line flags,
 // returning an empty string if IPC was explicitly disabled, or the set path.
 func setIPC(ctx *cli.Context, cfg *node.Config) {
@@ -1241,10 +1367,23 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setHTTP(ctx, cfg)
 	setGraphQL(ctx, cfg)
 	setWS(ctx, cfg)
+	setBinary(ctx, cfg)
+	setRPCExecutionLimits(ctx, cfg)
 	setNodeUserIdent(ctx, cfg)
 	setDataDir(ctx, cfg)
 	setSmartCard(ctx, cfg)
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		engine := ctx.GlobalString(DBEngineFlag.Name)
+		if engine != rawdb.DBLeveldb && engine != rawdb.DBPebble {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", engine)
+		}
+		cfg.DBEngine = engine
+	}
+	if ctx.GlobalIsSet(AncientReadOnlyFlag.Name) {
+		cfg.AncientReadOnly = ctx.GlobalBool(AncientReadOnlyFlag.Name)
+	}
+
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
 		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
 	}
@@ -1336,6 +1475,15 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config, light bool) {
 	if ctx.GlobalIsSet(GpoIgnoreGasPriceFlag.Name) {
 		cfg.IgnorePrice = big.NewInt(ctx.GlobalInt64(GpoIgnoreGasPriceFlag.Name))
 	}
+	if ctx.GlobalIsSet(GpoStrategyFlag.Name) {
+		cfg.Strategy = ctx.GlobalString(GpoStrategyFlag.Name)
+	}
+	if ctx.GlobalIsSet(GpoHalfLifeFlag.Name) {
+		cfg.HalfLife = ctx.GlobalDuration(GpoHalfLifeFlag.Name)
+	}
+	if ctx.GlobalIsSet(GpoTargetBlocksFlag.Name) {
+		cfg.TargetBlocks = ctx.GlobalInt(GpoTargetBlocksFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -1379,6 +1527,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolDropHistoryFlag.Name) {
+		cfg.DropHistory = ctx.GlobalUint64(TxPoolDropHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolPrivateLifetimeFlag.Name) {
+		cfg.PrivateLifetime = ctx.GlobalDuration(TxPoolPrivateLifetimeFlag.Name)
+	}
 }
 
 func setEthash(ctx *cli.Context, cfg *ethconfig.Config) {
@@ -1549,6 +1703,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(SyncModeFlag.Name) {
 		cfg.SyncMode = *GlobalTextMarshaler(ctx, SyncModeFlag.Name).(*downloader.SyncMode)
 	}
+	if stack.Config().AncientReadOnly && ctx.GlobalIsSet(SyncModeFlag.Name) && cfg.SyncMode != downloader.FullSync {
+		Fatalf("--%s requires --%s=full, have %v", AncientReadOnlyFlag.Name, SyncModeFlag.Name, cfg.SyncMode)
+	}
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
@@ -1578,6 +1735,16 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.GlobalString(StateSchemeFlag.Name)
+	}
+	if ctx.GlobalIsSet(StateHistoryFlag.Name) {
+		cfg.StateHistory = ctx.GlobalUint64(StateHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(StatePruneIntervalFlag.Name) {
+		cfg.StatePruneInterval = ctx.GlobalDuration(StatePruneIntervalFlag.Name)
+		cfg.StatePruneBloomSize = ctx.GlobalUint64(BloomFilterSizeFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1776,7 +1943,9 @@ func RegisterEthStatsService(stack *node.Node, backend ethapi.Backend, url strin
 
 // RegisterGraphQLService is a utility function to construct a new service and register it against a node.
 func RegisterGraphQLService(stack *node.Node, backend ethapi.Backend, cfg node.Config) {
-	if err := graphql.New(stack, backend, cfg.GraphQLCors, cfg.GraphQLVirtualHosts); err != nil {
+	_, lightMode := backend.(*les.LesApiBackend)
+	events := filters.NewEventSystem(backend, lightMode)
+	if err := graphql.New(stack, backend, events, cfg.GraphQLCors, cfg.GraphQLVirtualHosts, cfg.GraphQLTracing); err != nil {
 		Fatalf("Failed to register the GraphQL service: %v", err)
 	}
 }
@@ -130,6 +130,8 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	StateScheme         string        // Trie node storage scheme, taken from the database if empty
+	StateHistory        uint64        // Number of recent blocks to keep flat state history for (0 = disabled)
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -181,6 +183,7 @@ type BlockChain struct {
 	chainHeadFeed event.Feed
 	logsFeed      event.Feed
 	blockProcFeed event.Feed
+	nevmFeed      event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -226,6 +229,10 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 	txLookupCache, _ := lru.New(txLookupCacheLimit)
 	futureBlocks, _ := lru.New(maxFutureBlocks)
 
+	scheme := cacheConfig.StateScheme
+	if scheme == "" {
+		scheme = rawdb.ReadStateScheme(db)
+	}
 	bc := &BlockChain{
 		chainConfig: chainConfig,
 		cacheConfig: cacheConfig,
@@ -235,6 +242,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			Cache:     cacheConfig.TrieCleanLimit,
 			Journal:   cacheConfig.TrieCleanJournal,
 			Preimages: cacheConfig.Preimages,
+			Scheme:    scheme,
 		}),
 		quit:           make(chan struct{}),
 		shouldPreserve: shouldPreserve,
@@ -521,6 +529,12 @@ func (bc *BlockChain) SetHeadBeyondRoot(head uint64, root common.Hash) (uint64,
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
+					// Roll the path based state back if the block state was flushed over
+					if triedb := bc.stateCache.TrieDB(); triedb.Scheme() == rawdb.PathScheme && !triedb.Available(newHeadBlock.Root()) && triedb.Recoverable(newHeadBlock.Root()) {
+						if err := triedb.Recover(newHeadBlock.Root()); err != nil {
+							log.Error("Failed to roll back state", "number", newHeadBlock.NumberU64(), "root", newHeadBlock.Root(), "err", err)
+						}
+					}
 					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
@@ -672,6 +686,27 @@ func (bc *BlockChain) CurrentFastBlock() *types.Block {
 	return bc.currentFastBlock.Load().(*types.Block)
 }
 
+// CurrentFinalizedBlock retrieves the latest block finalized by a Syscoin
+// chainlock, or nil if no block has been finalized yet.
+func (bc *BlockChain) CurrentFinalizedBlock() *types.Block {
+	if header := bc.hc.CurrentFinalizedHeader(); header != nil {
+		return bc.GetBlock(header.Hash(), header.Number.Uint64())
+	}
+	return nil
+}
+
+// CurrentFinalizedHeader retrieves the header of the latest block finalized by a
+// Syscoin chainlock, or nil if no block has been finalized yet.
+func (bc *BlockChain) CurrentFinalizedHeader() *types.Header {
+	return bc.hc.CurrentFinalizedHeader()
+}
+
+// SetFinalized marks the given header as the latest block finalized by a Syscoin
+// chainlock.
+func (bc *BlockChain) SetFinalized(header *types.Header) {
+	bc.hc.SetFinalized(header)
+}
+
 // Validator returns the current validator.
 func (bc *BlockChain) Validator() Validator {
 	return bc.validator
@@ -1012,9 +1047,15 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
-		triedb := bc.stateCache.TrieDB()
-
+	if triedb := bc.stateCache.TrieDB(); triedb.Scheme() == rawdb.PathScheme {
+		// The path based state can only hold a single state on disk, older ones
+		// are reachable through the reverse diffs.
+		recent := bc.CurrentBlock()
+		log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+		if err := triedb.Commit(recent.Root(), true, nil); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
 			if number := bc.CurrentBlock().NumberU64(); number > offset {
 				recent := bc.GetBlockByNumber(number - offset)
@@ -1477,10 +1518,20 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	if err != nil {
 		return NonStatTy, err
 	}
+	// Record the flat state changes for serving historical state, if requested
+	if bc.cacheConfig.StateHistory > 0 {
+		bc.writeStateHistory(block, bc.GetHeader(block.ParentHash(), block.NumberU64()-1))
+	}
 	triedb := bc.stateCache.TrieDB()
 
-	// If we're running an archive node, always flush
-	if bc.cacheConfig.TrieDirtyDisabled {
+	// Path based state keeps the recent states as layers in memory, flushing the
+	// older ones to disk along with their reverse diffs. Otherwise, if we're
+	// running an archive node, always flush
+	if triedb.Scheme() == rawdb.PathScheme {
+		if err := triedb.CapLayers(root, TriesInMemory); err != nil {
+			return NonStatTy, err
+		}
+	} else if bc.cacheConfig.TrieDirtyDisabled {
 		if err := triedb.Commit(root, false, nil); err != nil {
 			return NonStatTy, err
 		}
@@ -2470,6 +2521,14 @@ func (bc *BlockChain) WriteNEVMMappings(sysBlockhash string, nevmBlockhash commo
 	bc.hc.WriteNEVMMappings(sysBlockhash, nevmBlockhash, n)
 }
 
+// PostNEVMMappingEvent announces a NEVM mapping once Syscoin's connection or
+// disconnection of the block is final, i.e. after any block insertion depending
+// on the mapping succeeded. Mappings are written ahead of insertion because
+// header verification depends on them, so they are not announced when stored.
+func (bc *BlockChain) PostNEVMMappingEvent(ev NEVMMappingEvent) {
+	bc.nevmFeed.Send(ev)
+}
+
 // HasHeader checks if a block header is present in the database or not, caching
 // it if present.
 func (bc *BlockChain) HasHeader(hash common.Hash, number uint64) bool {
@@ -2554,3 +2613,8 @@ func (bc *BlockChain) SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscript
 func (bc *BlockChain) SubscribeBlockProcessingEvent(ch chan<- bool) event.Subscription {
 	return bc.scope.Track(bc.blockProcFeed.Subscribe(ch))
 }
+
+// SubscribeNEVMMappingEvent registers a subscription of NEVMMappingEvent.
+func (bc *BlockChain) SubscribeNEVMMappingEvent(ch chan<- NEVMMappingEvent) event.Subscription {
+	return bc.scope.Track(bc.nevmFeed.Subscribe(ch))
+}
@@ -17,6 +17,8 @@
 package core
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -37,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 )
 
@@ -3275,3 +3278,180 @@ func TestEIP1559Transition(t *testing.T) {
 		t.Fatalf("sender balance incorrect: expected %d, got %d", expected, actual)
 	}
 }
+
+// Tests that a chain using the path based state scheme keeps the recent states
+// available, persists the head state on shutdown and rolls the disk state back
+// when rewinding the chain.
+func TestPathSchemeChain(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(1000000000000000)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{addr: {Balance: funds}}}
+		signer  = types.LatestSigner(gspec.Config)
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 2*TriesInMemory, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{byte(i)}, big.NewInt(1000), params.TxGas, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+	})
+	db := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+	gspec.MustCommit(db)
+
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	if scheme := chain.StateCache().TrieDB().Scheme(); scheme != rawdb.PathScheme {
+		t.Fatalf("state scheme mismatch: have %s, want %s", scheme, rawdb.PathScheme)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	// Only the most recent states are available
+	for i, block := range blocks {
+		_, err := chain.StateAt(block.Root())
+		if i < len(blocks)-TriesInMemory-1 && err == nil {
+			t.Fatalf("block %d: stale state available", block.NumberU64())
+		}
+		if i >= len(blocks)-TriesInMemory-1 && err != nil {
+			t.Fatalf("block %d: recent state unavailable: %v", block.NumberU64(), err)
+		}
+	}
+	// Restart the chain and ensure the head state was persisted
+	chain.Stop()
+
+	chain, err = NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to recreate tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if head := chain.CurrentBlock().NumberU64(); head != uint64(len(blocks)) {
+		t.Fatalf("head block mismatch: have %d, want %d", head, len(blocks))
+	}
+	state, err := chain.State()
+	if err != nil {
+		t.Fatalf("head state unavailable: %v", err)
+	}
+	if nonce := state.GetNonce(addr); nonce != uint64(len(blocks)) {
+		t.Fatalf("nonce mismatch: have %d, want %d", nonce, len(blocks))
+	}
+	// Rewind the chain and ensure the disk state is rolled back
+	if err := chain.SetHead(1); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != 1 {
+		t.Fatalf("rewound head block mismatch: have %d, want 1", head)
+	}
+	if state, err = chain.State(); err != nil {
+		t.Fatalf("rewound state unavailable: %v", err)
+	}
+	if nonce := state.GetNonce(addr); nonce != 1 {
+		t.Fatalf("rewound nonce mismatch: have %d, want 1", nonce)
+	}
+}
+
+// Tests that a chain enabling the binary trie at genesis processes blocks on
+// top of it, keeps the snapshot in sync with it and serves state proofs.
+func TestBinaryTrieChain(t *testing.T) {
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		funds    = big.NewInt(1000000000000000)
+		config   = *params.TestChainConfig
+	)
+	config.BinaryTrieBlock = big.NewInt(0)
+
+	var (
+		gspec = &Genesis{Config: &config, Alloc: GenesisAlloc{
+			addr: {Balance: funds},
+			// NUMBER NUMBER SSTORE STOP: stores the block number under itself
+			contract: {Balance: common.Big0, Code: []byte{byte(vm.NUMBER), byte(vm.NUMBER), byte(vm.SSTORE), byte(vm.STOP)}},
+		}}
+		signer  = types.LatestSigner(gspec.Config)
+		engine  = ethash.NewFaker()
+		gendb   = rawdb.NewMemoryDatabase()
+		genesis = gspec.MustCommit(gendb)
+	)
+	// The same genesis without the binary trie must commit to a different root
+	plain := *gspec
+	plain.Config = params.TestChainConfig
+	if plain.ToBlock(nil).Root() == genesis.Root() {
+		t.Fatalf("binary trie genesis root matches the merkle patricia one")
+	}
+	blocks, _ := GenerateChain(gspec.Config, genesis, engine, gendb, 10, func(i int, b *BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{byte(i + 1)}, big.NewInt(1000), params.TxGas, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+		tx, _ = types.SignTx(types.NewTransaction(b.TxNonce(addr), contract, common.Big0, 50000, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+	})
+	db := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(db)
+	if scheme := rawdb.ReadStateScheme(db); scheme != rawdb.BinaryScheme {
+		t.Fatalf("state scheme mismatch: have %s, want %s", scheme, rawdb.BinaryScheme)
+	}
+	chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	head := chain.CurrentBlock()
+	if err := chain.Snapshots().Verify(head.Root()); err != nil {
+		t.Fatalf("snapshot mismatch: %v", err)
+	}
+	statedb, err := chain.State()
+	if err != nil {
+		t.Fatalf("head state unavailable: %v", err)
+	}
+	if nonce := statedb.GetNonce(addr); nonce != 2*uint64(len(blocks)) {
+		t.Fatalf("nonce mismatch: have %d, want %d", nonce, 2*len(blocks))
+	}
+	slot := common.BigToHash(head.Number())
+	if value := statedb.GetState(contract, slot); value != slot {
+		t.Fatalf("storage mismatch: have %x, want %x", value, slot)
+	}
+	// Verify the account and storage proofs of the contract
+	proofDb := func(proof [][]byte) ethdb.KeyValueStore {
+		db := rawdb.NewMemoryDatabase()
+		for _, blob := range proof {
+			hash := sha256.Sum256(blob)
+			db.Put(hash[:], blob)
+		}
+		return db
+	}
+	proof, err := statedb.GetProof(contract)
+	if err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	blob, err := trie.VerifyBinaryProof(head.Root(), crypto.Keccak256(contract.Bytes()), proofDb(proof))
+	if err != nil {
+		t.Fatalf("failed to verify account proof: %v", err)
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(blob, &account); err != nil {
+		t.Fatalf("failed to decode proven account: %v", err)
+	}
+	if !bytes.Equal(account.CodeHash, crypto.Keccak256(statedb.GetCode(contract))) {
+		t.Fatalf("proven code hash mismatch")
+	}
+	proof, err = statedb.GetStorageProof(contract, slot)
+	if err != nil {
+		t.Fatalf("failed to prove storage: %v", err)
+	}
+	blob, err = trie.VerifyBinaryProof(account.Root, crypto.Keccak256(slot.Bytes()), proofDb(proof))
+	if err != nil {
+		t.Fatalf("failed to verify storage proof: %v", err)
+	}
+	if _, content, _, _ := rlp.Split(blob); common.BytesToHash(content) != slot {
+		t.Fatalf("proven storage mismatch: have %x, want %x", content, slot)
+	}
+}
@@ -24,6 +24,9 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// DroppedTxsEvent is posted when a batch of transactions leave the transaction pool.
+type DroppedTxsEvent struct{ Drops []*TxDropEvent }
+
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
 
@@ -41,3 +44,13 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// NEVMMappingEvent is posted when the mapping between a Syscoin block and the NEVM
+// block it connects is written or, if Removed is set, deleted.
+type NEVMMappingEvent struct {
+	SysBlockHash  string
+	NEVMBlockHash common.Hash
+	Number        uint64
+	Removed       bool
+	Header        *types.Header // Header of the NEVM block if already imported
+}
@@ -180,7 +180,7 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 	// We have the genesis block in database(perhaps in ancient database)
 	// but the corresponding state is missing.
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil {
+	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, &trie.Config{Scheme: rawdb.ReadStateScheme(db)}), nil); err != nil {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
@@ -263,7 +263,11 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 	if db == nil {
 		db = rawdb.NewMemoryDatabase()
 	}
-	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	scheme := rawdb.ReadStateScheme(db)
+	if g.Config != nil && g.Config.IsBinaryTrie(common.Big0) {
+		scheme = rawdb.BinaryScheme
+	}
+	statedb, err := state.New(common.Hash{}, state.NewDatabaseWithConfig(db, &trie.Config{Preimages: true, Scheme: scheme}), nil)
 	if err != nil {
 		panic(err)
 	}
@@ -312,6 +316,9 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 // Commit writes the block and state of a genesis specification to the database.
 // The block is committed as the canonical head block.
 func (g *Genesis) Commit(db ethdb.Database) (*types.Block, error) {
+	if err := g.commitStateScheme(db); err != nil {
+		return nil, err
+	}
 	block := g.ToBlock(db)
 	if block.Number().Sign() != 0 {
 		return nil, fmt.Errorf("can't commit genesis block with number > 0")
@@ -334,6 +341,31 @@ func (g *Genesis) Commit(db ethdb.Database) (*types.Block, error) {
 	return block, nil
 }
 
+// commitStateScheme records the binary trie storage scheme in the database if the
+// genesis enables it, refusing databases already holding a different kind of state.
+func (g *Genesis) commitStateScheme(db ethdb.Database) error {
+	stored := rawdb.ReadStateScheme(db)
+	if g.Config == nil || !g.Config.IsBinaryTrie(common.Big0) {
+		if stored == rawdb.BinaryScheme {
+			return errors.New("binary trie database requires a binary trie genesis")
+		}
+		return nil
+	}
+	switch stored {
+	case rawdb.BinaryScheme:
+		return nil
+	case "", rawdb.HashScheme:
+		// The hash scheme is the default of empty databases too
+		if rawdb.ReadHeadHeaderHash(db) != (common.Hash{}) {
+			return fmt.Errorf("binary trie genesis on database with %s state scheme", stored)
+		}
+		rawdb.WriteStateScheme(db, rawdb.BinaryScheme)
+		return nil
+	default:
+		return fmt.Errorf("binary trie genesis incompatible with %s state scheme", stored)
+	}
+}
+
 // MustCommit writes the genesis block and state to db, panicking on error.
 // The block is committed as the canonical head block.
 func (g *Genesis) MustCommit(db ethdb.Database) *types.Block {
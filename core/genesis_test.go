@@ -202,3 +202,30 @@ func TestGenesisHashes(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the binary trie genesis records its state scheme and refuses
+// databases holding a different kind of state.
+func TestBinaryTrieGenesisScheme(t *testing.T) {
+	config := *params.TestChainConfig
+	config.BinaryTrieBlock = big.NewInt(0)
+
+	binary := &Genesis{Config: &config}
+	plain := &Genesis{Config: params.TestChainConfig}
+
+	db := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(db, rawdb.HashScheme)
+	if _, err := binary.Commit(db); err != nil {
+		t.Fatalf("failed to commit binary trie genesis: %v", err)
+	}
+	if scheme := rawdb.ReadStateScheme(db); scheme != rawdb.BinaryScheme {
+		t.Fatalf("state scheme mismatch: have %s, want %s", scheme, rawdb.BinaryScheme)
+	}
+	if _, err := plain.Commit(db); err == nil {
+		t.Fatalf("committed merkle patricia genesis on binary trie database")
+	}
+	db = rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(db, rawdb.PathScheme)
+	if _, err := binary.Commit(db); err == nil {
+		t.Fatalf("committed binary trie genesis on path scheme database")
+	}
+}
@@ -74,6 +74,7 @@ type HeaderChain struct {
 	SYSCache      *lru.Cache // Cache for SYS mapping to NEVM block hash
 	NEVMLatestCache common.Hash
 	SYSHashCache  *lru.Cache // Cache for NEVM hash to SYS blocks mappings
+	currentFinalized atomic.Value // Latest header finalized by a Syscoin chainlock (nil if none)
 	procInterrupt func() bool
 
 	rand   *mrand.Rand
@@ -126,6 +127,10 @@ func NewHeaderChain(chainDb ethdb.Database, config *params.ChainConfig, engine c
 	hc.currentHeaderHash = hc.CurrentHeader().Hash()
 	// SYSCOIN
 	hc.NEVMLatestCache = common.Hash{}
+	hc.currentFinalized.Store((*types.Header)(nil))
+	if hash := rawdb.ReadFinalizedBlockHash(chainDb); hash != (common.Hash{}) {
+		hc.currentFinalized.Store(hc.GetHeaderByHash(hash))
+	}
 	headHeaderGauge.Update(hc.CurrentHeader().Number.Int64())
 
 	return hc, nil
@@ -641,6 +646,19 @@ func (hc *HeaderChain) CurrentHeader() *types.Header {
 	return hc.currentHeader.Load().(*types.Header)
 }
 
+// CurrentFinalizedHeader retrieves the header of the latest block finalized by a
+// Syscoin chainlock, or nil if no block has been finalized yet.
+func (hc *HeaderChain) CurrentFinalizedHeader() *types.Header {
+	return hc.currentFinalized.Load().(*types.Header)
+}
+
+// SetFinalized marks the given header as the latest block finalized by a Syscoin
+// chainlock, persisting the marker across restarts.
+func (hc *HeaderChain) SetFinalized(header *types.Header) {
+	rawdb.WriteFinalizedBlockHash(hc.chainDb, header.Hash())
+	hc.currentFinalized.Store(header)
+}
+
 // SetCurrentHeader sets the in-memory head header marker of the canonical chan
 // as the given header.
 func (hc *HeaderChain) SetCurrentHeader(head *types.Header) {
@@ -745,6 +763,11 @@ func (hc *HeaderChain) SetHead(head uint64, updateFn UpdateHeadBlocksCallback, d
 	hc.SYSCache.Purge()
 	hc.SYSHashCache.Purge()
 	hc.NEVMLatestCache = common.Hash{}
+	// Drop the finalized marker if the block it points to was rewound
+	if finalized := hc.CurrentFinalizedHeader(); finalized != nil && finalized.Number.Uint64() > head {
+		rawdb.WriteFinalizedBlockHash(hc.chainDb, common.Hash{})
+		hc.currentFinalized.Store((*types.Header)(nil))
+	}
 }
 
 // SetGenesis sets a new genesis block header for the chain
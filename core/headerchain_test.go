@@ -23,6 +23,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -114,3 +115,43 @@ func TestHeaderInsertion(t *testing.T) {
 	// And B becomes even longer
 	testInsert(t, hc, chainB[107:128], CanonStatTy, nil)
 }
+
+// Tests that the block finalized by a Syscoin chainlock survives restarts, and is
+// forgotten once the chain is rewound below it.
+func TestFinalizedHeader(t *testing.T) {
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		genesis = (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	)
+	hc, err := NewHeaderChain(db, params.AllEthashProtocolChanges, ethash.NewFaker(), func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := hc.CurrentFinalizedHeader(); header != nil {
+		t.Fatalf("finalized header before any chainlock: %d", header.Number)
+	}
+	chain := makeHeaderChain(genesis.Header(), 16, ethash.NewFaker(), db, 10)
+	testInsert(t, hc, chain, CanonStatTy, nil)
+	hc.SetFinalized(chain[9])
+
+	// Reopen the chain and check the marker was persisted
+	hc, err = NewHeaderChain(db, params.AllEthashProtocolChanges, ethash.NewFaker(), func() bool { return false })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header := hc.CurrentFinalizedHeader(); header == nil || header.Hash() != chain[9].Hash() {
+		t.Fatalf("finalized header not restored: have %v, want %d", header, chain[9].Number)
+	}
+	// Rewinding above the finalized block keeps it, rewinding below drops it
+	hc.SetHead(12, nil, nil)
+	if header := hc.CurrentFinalizedHeader(); header == nil || header.Hash() != chain[9].Hash() {
+		t.Fatalf("finalized header lost by rewind above it")
+	}
+	hc.SetHead(5, nil, nil)
+	if header := hc.CurrentFinalizedHeader(); header != nil {
+		t.Fatalf("finalized header %d kept after rewind below it", header.Number)
+	}
+	if hash := rawdb.ReadFinalizedBlockHash(db); hash != (common.Hash{}) {
+		t.Fatalf("finalized marker %x kept after rewind below it", hash)
+	}
+}
@@ -19,6 +19,7 @@ package rawdb
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math/big"
 	"sort"
 
@@ -188,6 +189,24 @@ func WriteHeadFastBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
 	}
 }
 
+// ReadFinalizedBlockHash retrieves the hash of the latest block finalized by a
+// Syscoin chainlock.
+func ReadFinalizedBlockHash(db ethdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(headFinalizedBlockKey)
+	if len(data) == 0 {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteFinalizedBlockHash stores the hash of the latest block finalized by a
+// Syscoin chainlock.
+func WriteFinalizedBlockHash(db ethdb.KeyValueWriter, hash common.Hash) {
+	if err := db.Put(headFinalizedBlockKey, hash.Bytes()); err != nil {
+		log.Crit("Failed to store last finalized block's hash", "err", err)
+	}
+}
+
 // ReadLastPivotNumber retrieves the number of the last pivot block. If the node
 // full synced, the last pivot will always be nil.
 func ReadLastPivotNumber(db ethdb.KeyValueReader) *uint64 {
@@ -762,6 +781,64 @@ func ReadSYSHash(db ethdb.Reader, n uint64) []byte {
 	return data
 }
 
+// isNEVMMappingKey reports whether the given database key is one of the NEVM
+// block mapping entries, the latest mapping marker included. The single byte
+// prefixes are shared with legacy trie nodes, which are told apart by length.
+func isNEVMMappingKey(key []byte) bool {
+	switch {
+	case bytes.Equal(key, latestNEVMPrefix):
+		return true
+	case bytes.HasPrefix(key, nevmToSysPrefix):
+		return len(key) == len(nevmToSysPrefix)+common.HashLength
+	case bytes.HasPrefix(key, sysToNEVMPrefix):
+		return len(key) > len(sysToNEVMPrefix) && len(key) != common.HashLength
+	case bytes.HasPrefix(key, blockNumToSysKeyPrefix):
+		if len(key) == len(blockNumToSysKeyPrefix) || len(key) == common.HashLength {
+			return false
+		}
+		for _, c := range key[len(blockNumToSysKeyPrefix):] {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// IterateNEVMMappings invokes fn with the raw key and value of every NEVM block
+// mapping entry in the database, the latest mapping marker included, stopping
+// at the first error returned by fn.
+func IterateNEVMMappings(db ethdb.Iteratee, fn func(key, value []byte) error) error {
+	for _, prefix := range [][]byte{nevmToSysPrefix, sysToNEVMPrefix, blockNumToSysKeyPrefix, latestNEVMPrefix} {
+		it := db.NewIterator(prefix, nil)
+		for it.Next() {
+			if !isNEVMMappingKey(it.Key()) {
+				continue
+			}
+			if err := fn(it.Key(), it.Value()); err != nil {
+				it.Release()
+				return err
+			}
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteNEVMMappingEntry stores a raw NEVM block mapping entry, as iterated by
+// IterateNEVMMappings, rejecting keys outside of the mappings.
+func WriteNEVMMappingEntry(db ethdb.KeyValueWriter, key, value []byte) error {
+	if !isNEVMMappingKey(key) {
+		return fmt.Errorf("not a NEVM mapping key: %x", key)
+	}
+	return db.Put(key, value)
+}
+
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
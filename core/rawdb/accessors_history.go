@@ -0,0 +1,126 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReadStateHistoryTail retrieves the number of the oldest block with flat state
+// history, or nil if no history was ever recorded.
+func ReadStateHistoryTail(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(stateHistoryTailKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteStateHistoryTail stores the number of the oldest block with flat state
+// history.
+func WriteStateHistoryTail(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(stateHistoryTailKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store state history tail", "err", err)
+	}
+}
+
+// ReadStateHistory retrieves the RLP encoded flat state diff of the given block.
+func ReadStateHistory(db ethdb.KeyValueReader, number uint64, hash common.Hash) []byte {
+	data, _ := db.Get(stateHistoryKey(number, hash))
+	return data
+}
+
+// WriteStateHistory stores the RLP encoded flat state diff of the given block.
+func WriteStateHistory(db ethdb.KeyValueWriter, number uint64, hash common.Hash, blob []byte) {
+	if err := db.Put(stateHistoryKey(number, hash), blob); err != nil {
+		log.Crit("Failed to store state history", "err", err)
+	}
+}
+
+// DeleteStateHistory deletes the flat state diff of the given block.
+func DeleteStateHistory(db ethdb.KeyValueWriter, number uint64, hash common.Hash) {
+	if err := db.Delete(stateHistoryKey(number, hash)); err != nil {
+		log.Crit("Failed to delete state history", "err", err)
+	}
+}
+
+// WriteAccountHistoryIndex marks the given account as changed in the block with
+// the given number.
+func WriteAccountHistoryIndex(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64) {
+	if err := db.Put(accountHistoryKey(accountHash, number), nil); err != nil {
+		log.Crit("Failed to store account history index", "err", err)
+	}
+}
+
+// DeleteAccountHistoryIndex removes the change marker of the given account in
+// the block with the given number.
+func DeleteAccountHistoryIndex(db ethdb.KeyValueWriter, accountHash common.Hash, number uint64) {
+	if err := db.Delete(accountHistoryKey(accountHash, number)); err != nil {
+		log.Crit("Failed to delete account history index", "err", err)
+	}
+}
+
+// WriteStorageHistoryIndex marks the given storage slot as changed in the block
+// with the given number.
+func WriteStorageHistoryIndex(db ethdb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64) {
+	if err := db.Put(storageHistoryKey(accountHash, storageHash, number), nil); err != nil {
+		log.Crit("Failed to store storage history index", "err", err)
+	}
+}
+
+// DeleteStorageHistoryIndex removes the change marker of the given storage slot
+// in the block with the given number.
+func DeleteStorageHistoryIndex(db ethdb.KeyValueWriter, accountHash, storageHash common.Hash, number uint64) {
+	if err := db.Delete(storageHistoryKey(accountHash, storageHash, number)); err != nil {
+		log.Crit("Failed to delete storage history index", "err", err)
+	}
+}
+
+// IterateAccountHistory invokes fn with the numbers of the blocks marked as
+// changing the given account, in ascending order starting from the given number,
+// until fn returns false.
+func IterateAccountHistory(db ethdb.Iteratee, accountHash common.Hash, from uint64, fn func(number uint64) bool) {
+	prefix := append(accountHistoryPrefix, accountHash.Bytes()...)
+	iterateHistoryIndex(db, prefix, from, fn)
+}
+
+// IterateStorageHistory invokes fn with the numbers of the blocks marked as
+// changing the given storage slot, in ascending order starting from the given
+// number, until fn returns false.
+func IterateStorageHistory(db ethdb.Iteratee, accountHash, storageHash common.Hash, from uint64, fn func(number uint64) bool) {
+	prefix := append(append(storageHistoryPrefix, accountHash.Bytes()...), storageHash.Bytes()...)
+	iterateHistoryIndex(db, prefix, from, fn)
+}
+
+// iterateHistoryIndex walks the block numbers of a history index.
+func iterateHistoryIndex(db ethdb.Iteratee, prefix []byte, from uint64, fn func(number uint64) bool) {
+	it := db.NewIterator(prefix, encodeBlockNumber(from))
+	defer it.Release()
+
+	for it.Next() {
+		if key := it.Key(); len(key) == len(prefix)+8 {
+			if !fn(binary.BigEndian.Uint64(key[len(prefix):])) {
+				return
+			}
+		}
+	}
+}
@@ -33,6 +33,13 @@ import (
 func ReadTxLookupEntry(db ethdb.Reader, hash common.Hash) *uint64 {
 	data, _ := db.Get(txLookupKey(hash))
 	if len(data) == 0 {
+		// Lookups of the blocks below the index tail have been unindexed, try
+		// the frozen index for those
+		if tail := ReadTxIndexTail(db); tail != nil && *tail > 0 {
+			if number, err := db.AncientTxLookup(hash[:], *tail); err == nil {
+				return &number
+			}
+		}
 		return nil
 	}
 	// Database v6 tx lookup just stores the block number
@@ -20,7 +20,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -104,6 +107,11 @@ func (db *nofreezedb) AncientSize(kind string) (uint64, error) {
 	return 0, errNotSupported
 }
 
+// AncientTxLookup returns an error as we don't have a backing chain freezer.
+func (db *nofreezedb) AncientTxLookup(hash []byte, limit uint64) (uint64, error) {
+	return 0, errNotSupported
+}
+
 // AppendAncient returns an error as we don't have a backing chain freezer.
 func (db *nofreezedb) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
 	return errNotSupported
@@ -131,11 +139,70 @@ func NewDatabase(db ethdb.KeyValueStore) ethdb.Database {
 // value data store with a freezer moving immutable chain segments into cold
 // storage.
 func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, readonly bool) (ethdb.Database, error) {
+	return newDatabaseWithFreezer(db, freezer, namespace, readonly, false)
+}
+
+// newDatabaseWithFreezer creates a high level database on top of a given key-value
+// data store with a freezer. If shared is set, the freezer is opened read only
+// on top of a writable key-value store, following the blocks frozen by another
+// process and wiping them from the key-value store.
+func newDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace string, readonly bool, shared bool) (ethdb.Database, error) {
 	// Create the idle freezer instance
-	frdb, err := newFreezer(freezer, namespace, readonly)
+	frdb, err := newFreezer(freezer, namespace, readonly || shared)
 	if err != nil {
 		return nil, err
 	}
+	if err := validateAncients(db, frdb); err != nil {
+		frdb.Close()
+		return nil, err
+	}
+	// Freezer is consistent with the key-value database, permit combining the two
+	if !frdb.readonly {
+		frdb.wg.Add(2)
+		go func() {
+			frdb.freeze(db)
+			frdb.wg.Done()
+		}()
+		go func() {
+			frdb.index()
+			frdb.wg.Done()
+		}()
+	} else {
+		// Read only freezers follow the process writing them, wiping the frozen
+		// blocks from the key-value store only if it's writable
+		var kvdb ethdb.KeyValueStore
+		if shared {
+			kvdb = db
+		}
+		frdb.wg.Add(1)
+		go func() {
+			frdb.tail(kvdb)
+			frdb.wg.Done()
+		}()
+	}
+	return &freezerdb{
+		KeyValueStore: db,
+		AncientStore:  frdb,
+	}, nil
+}
+
+// NewDatabaseWithAncientStore creates a high level database on top of a given
+// key-value data store and a custom ancient store, e.g. one shared by several
+// nodes. Chain segments are not moved from the key-value store into the custom
+// store, it's expected to be filled via its own means.
+func NewDatabaseWithAncientStore(db ethdb.KeyValueStore, ancients ethdb.AncientStore) (ethdb.Database, error) {
+	if err := validateAncients(db, ancients); err != nil {
+		return nil, err
+	}
+	return &freezerdb{
+		KeyValueStore: db,
+		AncientStore:  ancients,
+	}, nil
+}
+
+// validateAncients ensures that the given ancient store can be combined with the
+// key-value store.
+func validateAncients(db ethdb.KeyValueStore, frdb ethdb.AncientReader) error {
 	// Since the freezer can be stored separately from the user's key-value database,
 	// there's a fairly high probability that the user requests invalid combinations
 	// of the freezer and database. Ensure that we don't shoot ourselves in the foot
@@ -165,9 +232,9 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 			// the freezer and the key-value store.
 			frgenesis, err := frdb.Ancient(freezerHashTable, 0)
 			if err != nil {
-				return nil, fmt.Errorf("failed to retrieve genesis from ancient %v", err)
+				return fmt.Errorf("failed to retrieve genesis from ancient %v", err)
 			} else if !bytes.Equal(kvgenesis, frgenesis) {
-				return nil, fmt.Errorf("genesis mismatch: %#x (leveldb) != %#x (ancients)", kvgenesis, frgenesis)
+				return fmt.Errorf("genesis mismatch: %#x (leveldb) != %#x (ancients)", kvgenesis, frgenesis)
 			}
 			// Key-value store and freezer belong to the same network. Ensure that they
 			// are contiguous, otherwise we might end up with a non-functional freezer.
@@ -175,7 +242,7 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 				// Subsequent header after the freezer limit is missing from the database.
 				// Reject startup is the database has a more recent head.
 				if *ReadHeaderNumber(db, ReadHeadHeaderHash(db)) > frozen-1 {
-					return nil, fmt.Errorf("gap (#%d) in the chain between ancients and leveldb", frozen)
+					return fmt.Errorf("gap (#%d) in the chain between ancients and leveldb", frozen)
 				}
 				// Database contains only older data than the freezer, this happens if the
 				// state was wiped and reinited from an existing freezer.
@@ -192,7 +259,7 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 				// Key-value store contains more data than the genesis block, make sure we
 				// didn't freeze anything yet.
 				if kvblob, _ := db.Get(headerHashKey(1)); len(kvblob) == 0 {
-					return nil, errors.New("ancient chain segments already extracted, please set --datadir.ancient to the correct path")
+					return errors.New("ancient chain segments already extracted, please set --datadir.ancient to the correct path")
 				}
 				// Block #1 is still in the database, we're allowed to init a new feezer
 			}
@@ -200,18 +267,7 @@ func NewDatabaseWithFreezer(db ethdb.KeyValueStore, freezer string, namespace st
 			// feezer.
 		}
 	}
-	// Freezer is consistent with the key-value database, permit combining the two
-	if !frdb.readonly {
-		frdb.wg.Add(1)
-		go func() {
-			frdb.freeze(db)
-			frdb.wg.Done()
-		}()
-	}
-	return &freezerdb{
-		KeyValueStore: db,
-		AncientStore:  frdb,
-	}, nil
+	return nil
 }
 
 // NewMemoryDatabase creates an ephemeral in-memory key-value database without a
@@ -252,6 +308,122 @@ func NewLevelDBDatabaseWithFreezer(file string, cache int, handles int, freezer
 	return frdb, nil
 }
 
+// NewPebbleDBDatabase creates a persistent key-value database backed by pebble,
+// without a freezer moving immutable chain segments into cold storage.
+func NewPebbleDBDatabase(file string, cache int, handles int, namespace string, readonly bool) (ethdb.Database, error) {
+	db, err := newPebbleKeyValueStore(file, cache, handles, namespace, readonly)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase(db), nil
+}
+
+// NewPebbleDBDatabaseWithFreezer creates a persistent key-value database backed
+// by pebble, with a freezer moving immutable chain segments into cold storage.
+func NewPebbleDBDatabaseWithFreezer(file string, cache int, handles int, freezer string, namespace string, readonly bool) (ethdb.Database, error) {
+	kvdb, err := newPebbleKeyValueStore(file, cache, handles, namespace, readonly)
+	if err != nil {
+		return nil, err
+	}
+	frdb, err := NewDatabaseWithFreezer(kvdb, freezer, namespace, readonly)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
+const (
+	// DBLeveldb is the identifier of the leveldb database engine.
+	DBLeveldb = "leveldb"
+
+	// DBPebble is the identifier of the pebble database engine.
+	DBPebble = "pebble"
+
+	// dbEngineFile is the file recording the engine of a persistent database,
+	// stored inside the database directory.
+	dbEngineFile = "ENGINE"
+)
+
+// OpenOptions contains the options to apply when opening a persistent database.
+type OpenOptions struct {
+	Type              string // Engine of the database, empty to use the recorded one (or leveldb for new databases)
+	Directory         string // Directory of the key-value store
+	AncientsDirectory string // Directory of the freezer, empty to open the database without one
+	Namespace         string // Namespace for database metrics
+	Cache             int    // Memory allowance (MB) to use for caching data
+	Handles           int    // Number of files handles to allocate to the database
+	ReadOnly          bool   // Whether the database is opened read-only
+	AncientsReadOnly  bool   // Whether only the freezer is opened read-only, following its writer
+}
+
+// PreexistingDatabase returns the engine of the database in the given directory,
+// or an empty string if there is no database there.
+func PreexistingDatabase(path string) string {
+	if blob, err := ioutil.ReadFile(filepath.Join(path, dbEngineFile)); err == nil {
+		return strings.TrimSpace(string(blob))
+	}
+	// Databases created before the engine was recorded are all leveldb ones
+	if _, err := os.Stat(filepath.Join(path, "CURRENT")); err == nil {
+		return DBLeveldb
+	}
+	return ""
+}
+
+// Open opens a persistent database with the requested engine, recording the engine
+// in the database directory. It refuses to open an existing database with a
+// different engine than the one it was created with.
+func Open(o OpenOptions) (ethdb.Database, error) {
+	existing := PreexistingDatabase(o.Directory)
+	engine := o.Type
+	switch {
+	case engine == "" && existing != "":
+		engine = existing
+	case engine == "":
+		engine = DBLeveldb
+	case existing != "" && existing != engine:
+		return nil, fmt.Errorf("database %s was created with engine %q, can't open it with %q", o.Directory, existing, engine)
+	}
+	var (
+		kvdb ethdb.KeyValueStore
+		err  error
+	)
+	switch engine {
+	case DBLeveldb:
+		log.Info("Using leveldb as the backing database")
+		kvdb, err = leveldb.New(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	case DBPebble:
+		log.Info("Using pebble as the backing database")
+		kvdb, err = newPebbleKeyValueStore(o.Directory, o.Cache, o.Handles, o.Namespace, o.ReadOnly)
+	default:
+		return nil, fmt.Errorf("unknown database engine %q", engine)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !o.ReadOnly {
+		path := filepath.Join(o.Directory, dbEngineFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := ioutil.WriteFile(path, []byte(engine+"\n"), 0644); err != nil {
+				kvdb.Close()
+				return nil, err
+			}
+		}
+	}
+	if !o.ReadOnly {
+		kvdb = newStatsDatabase(kvdb, o.Namespace)
+	}
+	if o.AncientsDirectory == "" {
+		return NewDatabase(kvdb), nil
+	}
+	frdb, err := newDatabaseWithFreezer(kvdb, o.AncientsDirectory, o.Namespace, o.ReadOnly, o.AncientsReadOnly && !o.ReadOnly)
+	if err != nil {
+		kvdb.Close()
+		return nil, err
+	}
+	return frdb, nil
+}
+
 type counter uint64
 
 func (c counter) String() string {
@@ -349,6 +521,8 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 			hashNumPairings.Add(size)
 		case len(key) == common.HashLength:
 			tries.Add(size)
+		case bytes.HasPrefix(key, binaryTrieNodePrefix) && len(key) == (len(binaryTrieNodePrefix)+common.HashLength):
+			tries.Add(size)
 		case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
 			codes.Add(size)
 		case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
@@ -378,10 +552,10 @@ func InspectDatabase(db ethdb.Database, keyPrefix, keyStart []byte) error {
 		default:
 			var accounted bool
 			for _, meta := range [][]byte{
-				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, lastPivotKey,
+				databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, headFinalizedBlockKey, lastPivotKey,
 				fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
 				snapshotGeneratorKey, snapshotRecoveryKey, txIndexTailKey, fastTxLookupLimitKey,
-				uncleanShutdownKey, badBlockKey,
+				uncleanShutdownKey, badBlockKey, databaseStatsKey,
 			} {
 				if bytes.Equal(key, meta) {
 					metadata.Add(size)
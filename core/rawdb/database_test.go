@@ -15,3 +15,41 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests that the engine of a database is recorded on creation and that the
+// database can't be reopened with another engine.
+func TestDatabaseEngineRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rawdb-engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if engine := PreexistingDatabase(dir); engine != "" {
+		t.Fatalf("unexpected engine for empty directory: %q", engine)
+	}
+	db, err := Open(OpenOptions{Type: DBLeveldb, Directory: dir, Cache: 16, Handles: 16})
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	if engine := PreexistingDatabase(dir); engine != DBLeveldb {
+		t.Fatalf("recorded engine mismatch: have %q, want %q", engine, DBLeveldb)
+	}
+	if _, err := Open(OpenOptions{Type: DBPebble, Directory: dir, Cache: 16, Handles: 16}); err == nil {
+		t.Fatal("opened leveldb database with pebble")
+	}
+	// Reopening without an explicit engine picks the recorded one
+	db, err = Open(OpenOptions{Directory: dir, Cache: 16, Handles: 16})
+	if err != nil {
+		t.Fatalf("failed to reopen database: %v", err)
+	}
+	db.Close()
+}
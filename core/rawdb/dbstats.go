@@ -0,0 +1,430 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// statsPersistInterval is the time interval between two consecutive persistences
+// of the database statistics, limiting the amount lost on a crash.
+const statsPersistInterval = 5 * time.Minute
+
+// statSampleRate is the ratio of writes to the overwritten categories checked
+// against the database for an existing entry, each sampled write standing in
+// for the unsampled ones around it.
+const statSampleRate = 64
+
+// statCategory is a category of key-value store data tracked by the statistics.
+type statCategory int
+
+const (
+	statHeaders statCategory = iota
+	statBodies
+	statReceipts
+	statDifficulties
+	statNumHashPairings
+	statHashNumPairings
+	statTxLookups
+	statBloomBits
+	statCodes
+	statTrieNodes
+	statPathNodes
+	statReverseDiffs
+	statPreimages
+	statAccountSnaps
+	statStorageSnaps
+	statStateHistory
+	statNEVMToSys
+	statSysToNEVM
+	statBlockNumToSys
+	statCliqueSnaps
+	statLightClient
+	statMetadata
+	statUnaccounted
+	statCategories // Number of categories, must be last
+)
+
+// statNames are the names of the categories, used for metrics and persistence.
+var statNames = [statCategories]string{
+	"headers", "bodies", "receipts", "difficulties", "numhash", "hashnum",
+	"txlookups", "bloombits", "codes", "trienodes", "pathnodes", "reversediffs",
+	"preimages", "accountsnaps", "storagesnaps", "statehistory", "nevmtosys",
+	"systonevm", "blocknumtosys", "cliquesnaps", "lightclient", "metadata",
+	"unaccounted",
+}
+
+// statOverwritten marks the categories whose entries are commonly updated in
+// place. Only a sample of the writes to them are accounted, checking for an
+// existing entry to avoid counting updates as growth, the rest are assumed to
+// be written once.
+var statOverwritten = [statCategories]bool{
+	statPathNodes:     true,
+	statAccountSnaps:  true,
+	statStorageSnaps:  true,
+	statBlockNumToSys: true,
+	statMetadata:      true,
+}
+
+// keyCategory returns the data category the given database key belongs to.
+func keyCategory(key []byte) statCategory {
+	switch {
+	case bytes.HasPrefix(key, headerPrefix) && len(key) == (len(headerPrefix)+8+common.HashLength):
+		return statHeaders
+	case bytes.HasPrefix(key, blockBodyPrefix) && len(key) == (len(blockBodyPrefix)+8+common.HashLength):
+		return statBodies
+	case bytes.HasPrefix(key, blockReceiptsPrefix) && len(key) == (len(blockReceiptsPrefix)+8+common.HashLength):
+		return statReceipts
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerTDSuffix):
+		return statDifficulties
+	case bytes.HasPrefix(key, headerPrefix) && bytes.HasSuffix(key, headerHashSuffix):
+		return statNumHashPairings
+	case bytes.HasPrefix(key, headerNumberPrefix) && len(key) == (len(headerNumberPrefix)+common.HashLength):
+		return statHashNumPairings
+	case len(key) == common.HashLength:
+		return statTrieNodes
+	case bytes.HasPrefix(key, CodePrefix) && len(key) == len(CodePrefix)+common.HashLength:
+		return statCodes
+	case bytes.HasPrefix(key, txLookupPrefix) && len(key) == (len(txLookupPrefix)+common.HashLength):
+		return statTxLookups
+	case bytes.HasPrefix(key, SnapshotAccountPrefix) && len(key) == (len(SnapshotAccountPrefix)+common.HashLength):
+		return statAccountSnaps
+	case bytes.HasPrefix(key, SnapshotStoragePrefix) && len(key) == (len(SnapshotStoragePrefix)+2*common.HashLength):
+		return statStorageSnaps
+	case bytes.HasPrefix(key, preimagePrefix) && len(key) == (len(preimagePrefix)+common.HashLength):
+		return statPreimages
+	case bytes.HasPrefix(key, configPrefix) && len(key) == (len(configPrefix)+common.HashLength):
+		return statMetadata
+	case bytes.HasPrefix(key, bloomBitsPrefix) && len(key) == (len(bloomBitsPrefix)+10+common.HashLength):
+		return statBloomBits
+	case bytes.HasPrefix(key, BloomBitsIndexPrefix):
+		return statBloomBits
+	case bytes.HasPrefix(key, nevmToSysPrefix) && len(key) == (len(nevmToSysPrefix)+common.HashLength):
+		return statNEVMToSys
+	case bytes.HasPrefix(key, sysToNEVMPrefix):
+		return statSysToNEVM
+	case bytes.HasPrefix(key, blockNumToSysKeyPrefix):
+		return statBlockNumToSys
+	case bytes.HasPrefix(key, binaryTrieNodePrefix) && len(key) == (len(binaryTrieNodePrefix)+common.HashLength):
+		return statTrieNodes
+	case bytes.HasPrefix(key, TrieNodeAccountPrefix) || bytes.HasPrefix(key, TrieNodeStoragePrefix):
+		return statPathNodes
+	case bytes.HasPrefix(key, reverseDiffPrefix) || bytes.HasPrefix(key, reverseDiffRootPrefix):
+		return statReverseDiffs
+	case bytes.HasPrefix(key, stateHistoryPrefix) || bytes.HasPrefix(key, accountHistoryPrefix) || bytes.HasPrefix(key, storageHistoryPrefix):
+		return statStateHistory
+	case bytes.HasPrefix(key, []byte("clique-")) && len(key) == 7+common.HashLength:
+		return statCliqueSnaps
+	case bytes.HasPrefix(key, []byte("cht-")) ||
+		bytes.HasPrefix(key, []byte("chtIndexV2-")) ||
+		bytes.HasPrefix(key, []byte("chtRootV2-")) ||
+		bytes.HasPrefix(key, []byte("blt-")) ||
+		bytes.HasPrefix(key, []byte("bltIndex-")) ||
+		bytes.HasPrefix(key, []byte("bltRoot-")):
+		return statLightClient
+	}
+	for _, meta := range [][]byte{
+		databaseVersionKey, headHeaderKey, headBlockKey, headFastBlockKey, headFinalizedBlockKey, lastPivotKey,
+		fastTrieProgressKey, snapshotDisabledKey, snapshotRootKey, snapshotJournalKey,
+		snapshotGeneratorKey, snapshotRecoveryKey, snapshotSyncStatusKey, txIndexTailKey, fastTxLookupLimitKey,
+		uncleanShutdownKey, badBlockKey, stateSchemeKey, reverseDiffHeadKey, stateHistoryTailKey,
+		latestNEVMPrefix, databaseStatsKey,
+	} {
+		if bytes.Equal(key, meta) {
+			return statMetadata
+		}
+	}
+	return statUnaccounted
+}
+
+// statDelta is the change of the statistics caused by a set of writes.
+type statDelta [statCategories]struct {
+	size  int64
+	count int64
+}
+
+// DatabaseStat is the estimated size and number of entries of a data category.
+type DatabaseStat struct {
+	Category string
+	Size     uint64
+	Count    uint64
+}
+
+// statsDatabase is a key-value store wrapper maintaining an estimate of the size
+// and the number of entries of each data category, updated incrementally as the
+// data is written, without ever iterating the database.
+//
+// The estimates are persisted into the database itself, so they are carried over
+// restarts. They are not seeded from the existing content: on a database created
+// before the statistics were introduced, they only count the changes made since
+// the first startup tracking them. Deleted entries are assumed to be of the
+// average size of their category, in-place updates of entries in categories
+// written only once are counted as growth, and the overwritten categories are
+// extrapolated from a sample of their writes.
+type statsDatabase struct {
+	ethdb.KeyValueStore
+
+	sizes   [statCategories]int64 // Estimated total size of each category, accessed atomically
+	counts  [statCategories]int64 // Estimated number of entries in each category, accessed atomically
+	samples uint64                // Number of writes to the overwritten categories, accessed atomically
+
+	sizeGauges  [statCategories]metrics.Gauge // Gauges exporting the size estimates
+	countGauges [statCategories]metrics.Gauge // Gauges exporting the count estimates
+
+	quit chan struct{}
+	term chan struct{}
+}
+
+// newStatsDatabase wraps a key-value store with size accounting, loading the
+// previously persisted statistics and registering the metrics under the given
+// namespace.
+func newStatsDatabase(db ethdb.KeyValueStore, namespace string) *statsDatabase {
+	s := &statsDatabase{
+		KeyValueStore: db,
+		quit:          make(chan struct{}),
+		term:          make(chan struct{}),
+	}
+	for i, name := range statNames {
+		s.sizeGauges[i] = metrics.GetOrRegisterGauge(namespace+"stats/"+name+"/size", nil)
+		s.countGauges[i] = metrics.GetOrRegisterGauge(namespace+"stats/"+name+"/count", nil)
+	}
+	stats := ReadDatabaseStats(db)
+	if stats == nil && ReadHeadHeaderHash(db) != (common.Hash{}) {
+		log.Info("Database statistics not found, counting only changes from now on")
+	}
+	for _, stat := range stats {
+		for i, name := range statNames {
+			if name == stat.Category {
+				s.sizes[i], s.counts[i] = int64(stat.Size), int64(stat.Count)
+				break
+			}
+		}
+	}
+	s.report()
+	go s.loop()
+	return s
+}
+
+// loop periodically persists the statistics until the database is closed.
+func (s *statsDatabase) loop() {
+	defer close(s.term)
+
+	ticker := time.NewTicker(statsPersistInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.persist(); err != nil {
+				log.Warn("Failed to persist database statistics", "err", err)
+			}
+		case <-s.quit:
+			return
+		}
+	}
+}
+
+// persist writes the current statistics into the database.
+func (s *statsDatabase) persist() error {
+	stats := make([]DatabaseStat, 0, statCategories)
+	for i, name := range statNames {
+		stats = append(stats, DatabaseStat{
+			Category: name,
+			Size:     uint64(atomic.LoadInt64(&s.sizes[i])),
+			Count:    uint64(atomic.LoadInt64(&s.counts[i])),
+		})
+	}
+	blob, err := rlp.EncodeToBytes(stats)
+	if err != nil {
+		return err
+	}
+	// Bypass the accounting, the statistics entry itself is never counted
+	return s.KeyValueStore.Put(databaseStatsKey, blob)
+}
+
+// report updates the exported metrics from the current statistics.
+func (s *statsDatabase) report() {
+	for i := range statNames {
+		s.sizeGauges[i].Update(atomic.LoadInt64(&s.sizes[i]))
+		s.countGauges[i].Update(atomic.LoadInt64(&s.counts[i]))
+	}
+}
+
+// put accumulates the effect of inserting the given key into the delta.
+func (s *statsDatabase) put(delta *statDelta, key []byte, value []byte) {
+	var (
+		category = keyCategory(key)
+		weight   = int64(1)
+	)
+	if statOverwritten[category] {
+		if !s.sample() {
+			return
+		}
+		if has, _ := s.KeyValueStore.Has(key); has {
+			return
+		}
+		weight = statSampleRate
+	}
+	delta[category].size += weight * int64(len(key)+len(value))
+	delta[category].count += weight
+}
+
+// delete accumulates the effect of removing the given key into the delta.
+func (s *statsDatabase) delete(delta *statDelta, key []byte) {
+	var (
+		category = keyCategory(key)
+		weight   = int64(1)
+	)
+	if statOverwritten[category] {
+		if !s.sample() {
+			return
+		}
+		if has, _ := s.KeyValueStore.Has(key); !has {
+			return
+		}
+		weight = statSampleRate
+	}
+	var (
+		size  = atomic.LoadInt64(&s.sizes[category])
+		count = atomic.LoadInt64(&s.counts[category])
+	)
+	if count > 0 {
+		delta[category].size -= weight * (size / count)
+	}
+	delta[category].count -= weight
+}
+
+// sample reports whether the current write to an overwritten category should
+// be accounted.
+func (s *statsDatabase) sample() bool {
+	return atomic.AddUint64(&s.samples, 1)%statSampleRate == 0
+}
+
+// apply adds a delta of written data to the statistics.
+func (s *statsDatabase) apply(delta *statDelta) {
+	for i := range delta {
+		if delta[i].count == 0 && delta[i].size == 0 {
+			continue
+		}
+		size := atomic.AddInt64(&s.sizes[i], delta[i].size)
+		if size < 0 {
+			atomic.CompareAndSwapInt64(&s.sizes[i], size, 0)
+		}
+		count := atomic.AddInt64(&s.counts[i], delta[i].count)
+		if count < 0 {
+			atomic.CompareAndSwapInt64(&s.counts[i], count, 0)
+		}
+	}
+	s.report()
+}
+
+// Put inserts the given value into the key-value store, updating the statistics.
+func (s *statsDatabase) Put(key []byte, value []byte) error {
+	var delta statDelta
+	s.put(&delta, key, value)
+	if err := s.KeyValueStore.Put(key, value); err != nil {
+		return err
+	}
+	s.apply(&delta)
+	return nil
+}
+
+// Delete removes the key from the key-value store, updating the statistics.
+func (s *statsDatabase) Delete(key []byte) error {
+	var delta statDelta
+	s.delete(&delta, key)
+	if err := s.KeyValueStore.Delete(key); err != nil {
+		return err
+	}
+	s.apply(&delta)
+	return nil
+}
+
+// NewBatch creates a write-only database batch accumulating the effect of its
+// writes on the statistics, applied when the batch is written.
+func (s *statsDatabase) NewBatch() ethdb.Batch {
+	return &statsBatch{Batch: s.KeyValueStore.NewBatch(), db: s}
+}
+
+// Close persists the statistics and closes the underlying key-value store.
+func (s *statsDatabase) Close() error {
+	close(s.quit)
+	<-s.term
+
+	if err := s.persist(); err != nil {
+		log.Warn("Failed to persist database statistics", "err", err)
+	}
+	return s.KeyValueStore.Close()
+}
+
+// statsBatch is a batch of a statsDatabase, tracking the effect of its writes.
+type statsBatch struct {
+	ethdb.Batch
+	db    *statsDatabase
+	delta statDelta
+}
+
+// Put inserts the given value into the batch.
+func (b *statsBatch) Put(key []byte, value []byte) error {
+	b.db.put(&b.delta, key, value)
+	return b.Batch.Put(key, value)
+}
+
+// Delete inserts a key removal into the batch.
+func (b *statsBatch) Delete(key []byte) error {
+	b.db.delete(&b.delta, key)
+	return b.Batch.Delete(key)
+}
+
+// Write flushes the batch to the database and applies its statistics.
+func (b *statsBatch) Write() error {
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	b.db.apply(&b.delta)
+	b.delta = statDelta{}
+	return nil
+}
+
+// Reset resets the batch for reuse.
+func (b *statsBatch) Reset() {
+	b.Batch.Reset()
+	b.delta = statDelta{}
+}
+
+// ReadDatabaseStats retrieves the last persisted estimates of the size of each
+// data category in the key-value store, or nil if none were persisted yet.
+func ReadDatabaseStats(db ethdb.KeyValueReader) []DatabaseStat {
+	blob, err := db.Get(databaseStatsKey)
+	if err != nil || len(blob) == 0 {
+		return nil
+	}
+	var stats []DatabaseStat
+	if err := rlp.DecodeBytes(blob, &stats); err != nil {
+		log.Warn("Failed to decode database statistics", "err", err)
+		return nil
+	}
+	return stats
+}
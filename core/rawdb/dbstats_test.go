@@ -0,0 +1,102 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// Tests that the database statistics track the writes of each category, both
+// direct and batched, and are carried over reopening the database.
+func TestDatabaseStats(t *testing.T) {
+	var (
+		kvdb = memorydb.New()
+		db   = newStatsDatabase(kvdb, "")
+		hash = common.HexToHash("0x01")
+	)
+	check := func(db *statsDatabase, category statCategory, size, count int64) {
+		t.Helper()
+		if have := db.sizes[category]; have != size {
+			t.Errorf("%s size mismatch: have %d, want %d", statNames[category], have, size)
+		}
+		if have := db.counts[category]; have != count {
+			t.Errorf("%s count mismatch: have %d, want %d", statNames[category], have, count)
+		}
+	}
+	// Direct writes and deletions
+	WriteTxLookupEntries(db, 1, []common.Hash{hash, common.HexToHash("0x02")})
+	check(db, statTxLookups, 2*(1+32+1), 2)
+	DeleteTxLookupEntry(db, hash)
+	check(db, statTxLookups, 1+32+1, 1)
+
+	// Batched writes are only accounted once written
+	batch := db.NewBatch()
+	WriteNEVMMappings(batch, "sysblockhash", hash, 1)
+	check(db, statNEVMToSys, 0, 0)
+	if err := batch.Write(); err != nil {
+		t.Fatalf("Failed to write batch: %v", err)
+	}
+	if db.counts[statNEVMToSys] != 1 || db.counts[statSysToNEVM] != 1 {
+		t.Fatalf("NEVM mappings not accounted: %v %v", db.counts[statNEVMToSys], db.counts[statSysToNEVM])
+	}
+	// Discarded batches are not accounted
+	batch = db.NewBatch()
+	WriteCode(batch, hash, []byte{0x1, 0x2})
+	batch.Reset()
+	batch.Write()
+	check(db, statCodes, 0, 0)
+
+	// Overwritten categories are extrapolated from a sample of the writes, and
+	// updates of them are not counted as growth
+	for i := 0; i < statSampleRate; i++ {
+		WriteAccountSnapshot(db, common.BigToHash(big.NewInt(int64(i))), []byte{0x1})
+	}
+	check(db, statAccountSnaps, statSampleRate*(1+32+1), statSampleRate)
+	for i := 0; i < statSampleRate; i++ {
+		WriteAccountSnapshot(db, common.BigToHash(big.NewInt(int64(i))), []byte{0x1})
+	}
+	check(db, statAccountSnaps, statSampleRate*(1+32+1), statSampleRate)
+
+	// Path-scheme trie nodes are rewritten in place at the same path, the
+	// rewrites are not counted as growth either
+	for i := 0; i < statSampleRate; i++ {
+		WriteAccountTrieNode(db, []byte{byte(i)}, []byte{0x1, 0x2})
+	}
+	check(db, statPathNodes, statSampleRate*(1+1+2), statSampleRate)
+	for i := 0; i < statSampleRate; i++ {
+		WriteAccountTrieNode(db, []byte{byte(i)}, []byte{0x3, 0x4})
+	}
+	check(db, statPathNodes, statSampleRate*(1+1+2), statSampleRate)
+	check(db, statTrieNodes, 0, 0)
+
+	// Reopen the database and ensure the statistics are retained
+	close(db.quit)
+	<-db.term
+	if err := db.persist(); err != nil {
+		t.Fatalf("Failed to persist statistics: %v", err)
+	}
+	db = newStatsDatabase(kvdb, "")
+	defer db.Close()
+
+	check(db, statTxLookups, 1+32+1, 1)
+	check(db, statAccountSnaps, statSampleRate*(1+32+1), statSampleRate)
+	check(db, statPathNodes, statSampleRate*(1+1+2), statSampleRate)
+}
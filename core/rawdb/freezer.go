@@ -27,10 +27,13 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/prometheus/tsdb/fileutil"
 )
 
@@ -58,6 +61,10 @@ const (
 	// storage.
 	freezerRecheckInterval = time.Minute
 
+	// freezerTailInterval is the frequency for read only freezers to check for
+	// blocks frozen by the process writing the freezer.
+	freezerTailInterval = 3 * time.Second
+
 	// freezerBatchLimit is the maximum number of blocks to freeze in one batch
 	// before doing an fsync and deleting it from the key-value store.
 	freezerBatchLimit = 30000
@@ -79,6 +86,7 @@ type freezer struct {
 
 	readonly     bool
 	tables       map[string]*freezerTable // Data tables for storing everything
+	txindex      *freezerTxIndex          // Hash sorted transaction lookups of the frozen blocks
 	instanceLock fileutil.Releaser        // File-system lock to prevent double opens
 
 	trigger chan chan struct{} // Manual blocking freeze trigger, test determinism
@@ -105,10 +113,21 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 		}
 	}
 	// Leveldb uses LOCK as the filelock filename. To prevent the
-	// name collision, we use FLOCK as the lock name.
-	lock, _, err := fileutil.Flock(filepath.Join(datadir, "FLOCK"))
-	if err != nil {
-		return nil, err
+	// name collision, we use FLOCK as the lock name. Read only freezers don't
+	// take the lock, so they can follow the process writing the freezer.
+	var (
+		lock fileutil.Releaser
+		err  error
+	)
+	if !readonly {
+		if lock, _, err = fileutil.Flock(filepath.Join(datadir, "FLOCK")); err != nil {
+			return nil, err
+		}
+	}
+	release := func() {
+		if lock != nil {
+			lock.Release()
+		}
 	}
 	// Open all the supported data tables
 	freezer := &freezer{
@@ -120,12 +139,12 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 		quit:         make(chan struct{}),
 	}
 	for name, disableSnappy := range FreezerNoSnappy {
-		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy)
+		table, err := newTable(datadir, name, readMeter, writeMeter, sizeGauge, disableSnappy, readonly)
 		if err != nil {
 			for _, table := range freezer.tables {
 				table.Close()
 			}
-			lock.Release()
+			release()
 			return nil, err
 		}
 		freezer.tables[name] = table
@@ -134,9 +153,21 @@ func newFreezer(datadir string, namespace string, readonly bool) (*freezer, erro
 		for _, table := range freezer.tables {
 			table.Close()
 		}
-		lock.Release()
+		release()
 		return nil, err
 	}
+	if freezer.txindex, err = newFreezerTxIndex(filepath.Join(datadir, "txindex"), readonly); err != nil {
+		for _, table := range freezer.tables {
+			table.Close()
+		}
+		release()
+		return nil, err
+	}
+	if !readonly {
+		if err := freezer.txindex.truncate(freezer.frozen); err != nil {
+			log.Warn("Failed to truncate frozen transaction index", "err", err)
+		}
+	}
 	log.Info("Opened ancient database", "database", datadir, "readonly", readonly)
 	return freezer, nil
 }
@@ -153,9 +184,14 @@ func (f *freezer) Close() error {
 				errs = append(errs, err)
 			}
 		}
-		if err := f.instanceLock.Release(); err != nil {
+		if err := f.txindex.close(); err != nil {
 			errs = append(errs, err)
 		}
+		if f.instanceLock != nil {
+			if err := f.instanceLock.Release(); err != nil {
+				errs = append(errs, err)
+			}
+		}
 	})
 	if errs != nil {
 		return fmt.Errorf("%v", errs)
@@ -205,6 +241,13 @@ func (f *freezer) AncientSize(kind string) (uint64, error) {
 	return 0, errUnknownTable
 }
 
+// AncientTxLookup retrieves the number of the frozen block containing the
+// transaction with the given hash from the frozen transaction index, only
+// searching the blocks below limit.
+func (f *freezer) AncientTxLookup(hash []byte, limit uint64) (uint64, error) {
+	return f.txindex.lookup(hash, limit)
+}
+
 // AppendAncient injects all binary blobs belong to block at the end of the
 // append-only immutable table files.
 //
@@ -269,7 +312,7 @@ func (f *freezer) TruncateAncients(items uint64) error {
 		}
 	}
 	atomic.StoreUint64(&f.frozen, items)
-	return nil
+	return f.txindex.truncate(items)
 }
 
 // Sync flushes all data tables to disk.
@@ -480,7 +523,202 @@ func (f *freezer) freeze(db ethdb.KeyValueStore) {
 	}
 }
 
-// repair truncates all data tables to the same length.
+// index is a background thread sealing the frozen transaction index of the
+// fully frozen block ranges. It runs apart from the freeze loop, so backfilling
+// the index of an existing ancient store doesn't hold up freezing.
+func (f *freezer) index() {
+	ticker := time.NewTicker(freezerRecheckInterval)
+	defer ticker.Stop()
+
+	for {
+		f.indexTransactions()
+
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+	}
+}
+
+// indexTransactions seals the frozen transaction index segments of all frozen
+// block ranges not indexed yet.
+func (f *freezer) indexTransactions() {
+	for {
+		first, gen := f.txindex.next(), f.txindex.generation()
+		if first+freezerTxIndexSegment > atomic.LoadUint64(&f.frozen) {
+			return
+		}
+		select {
+		case <-f.quit:
+			return
+		default:
+		}
+		var (
+			start   = time.Now()
+			entries []txIndexEntry
+		)
+		for number := first; number < first+freezerTxIndexSegment; number++ {
+			blob, err := f.Ancient(freezerBodiesTable, number)
+			if err != nil {
+				log.Error("Failed to retrieve frozen block body", "number", number, "err", err)
+				return
+			}
+			var body types.Body
+			if err := rlp.DecodeBytes(blob, &body); err != nil {
+				log.Error("Invalid frozen block body RLP", "number", number, "err", err)
+				return
+			}
+			for _, tx := range body.Transactions {
+				entries = append(entries, txIndexEntry{hash: tx.Hash(), number: number})
+			}
+		}
+		if err := f.txindex.add(first, gen, entries); err != nil {
+			if err == errTxIndexTruncated {
+				log.Debug("Discarded frozen transaction index of truncated blocks", "first", first)
+				continue
+			}
+			log.Error("Failed to seal frozen transaction index", "first", first, "err", err)
+			return
+		}
+		log.Info("Sealed frozen transaction index", "blocks", freezerTxIndexSegment, "txs", len(entries),
+			"first", first, "last", first+freezerTxIndexSegment-1, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+}
+
+// verify checks the integrity of the frozen chain data starting from the given
+// block: the stored items of all tables against their checksums and the frozen
+// hashes against the frozen headers. It returns the number of the first block
+// with corrupted data, or the number of frozen blocks if all of them are intact.
+func (f *freezer) verify(from uint64) (uint64, error) {
+	first := atomic.LoadUint64(&f.frozen)
+	for name, table := range f.tables {
+		bad, err := table.verify(from)
+		if err != nil {
+			return 0, fmt.Errorf("failed to verify table %s: %v", name, err)
+		}
+		if bad < first {
+			log.Error("Corrupted freezer table", "table", name, "number", bad)
+			first = bad
+		}
+	}
+	// Cross-check the canonical hashes against the headers of the intact range
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := from; number < first; number++ {
+		header, err := f.tables[freezerHeaderTable].Retrieve(number)
+		if err != nil {
+			return 0, err
+		}
+		hash, err := f.tables[freezerHashTable].Retrieve(number)
+		if err != nil {
+			return 0, err
+		}
+		if have := crypto.Keccak256Hash(header); have != common.BytesToHash(hash) {
+			log.Error("Frozen header hash mismatch", "number", number, "have", have, "want", common.BytesToHash(hash))
+			return number, nil
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Verifying frozen header hashes", "number", number, "limit", first, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return first, nil
+}
+
+// VerifyFreezer opens the freezer in the given directory and checks the integrity
+// of its data. It returns the number of the first block with corrupted data and
+// the number of frozen blocks, the two being equal if all data is intact.
+//
+// The freezer is opened writable, checksumming the items predating the item
+// checksums first, so it must not be in use by another process.
+func VerifyFreezer(datadir string) (uint64, uint64, error) {
+	f, err := newFreezer(datadir, "", false)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	for name, table := range f.tables {
+		if err := table.backfillChecksums(); err != nil {
+			return 0, 0, fmt.Errorf("failed to checksum table %s: %v", name, err)
+		}
+	}
+	bad, err := f.verify(0)
+	if err != nil {
+		return 0, 0, err
+	}
+	return bad, atomic.LoadUint64(&f.frozen), nil
+}
+
+// refresh updates a read only freezer to the blocks frozen by the process writing
+// the freezer since the last refresh.
+func (f *freezer) refresh() error {
+	for name, table := range f.tables {
+		if err := table.refresh(); err != nil {
+			return fmt.Errorf("failed to refresh table %s: %v", name, err)
+		}
+	}
+	if err := f.repair(); err != nil {
+		return err
+	}
+	f.txindex.refresh(atomic.LoadUint64(&f.frozen))
+	return nil
+}
+
+// tail is a background thread of read only freezers, following the blocks frozen
+// by the process writing the freezer. If a key-value store is given, the copies
+// of the newly frozen canonical blocks are wiped from it, like the freezer of the
+// writing process does with its own.
+func (f *freezer) tail(db ethdb.KeyValueStore) {
+	var (
+		nfdb   = &nofreezedb{KeyValueStore: db}
+		wiped  = atomic.LoadUint64(&f.frozen)
+		ticker = time.NewTicker(freezerTailInterval)
+	)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-f.quit:
+			return
+		}
+		if err := f.refresh(); err != nil {
+			log.Error("Failed to follow ancient store", "err", err)
+			continue
+		}
+		frozen := atomic.LoadUint64(&f.frozen)
+		if db == nil || frozen <= wiped {
+			wiped = frozen
+			continue
+		}
+		batch := db.NewBatch()
+		for number := wiped; number < frozen; number++ {
+			// Always keep the genesis block in active database
+			hash := ReadCanonicalHash(nfdb, number)
+			if number == 0 || hash == (common.Hash{}) {
+				continue
+			}
+			if blob, err := f.Ancient(freezerHashTable, number); err != nil || common.BytesToHash(blob) != hash {
+				continue
+			}
+			DeleteBlockWithoutNumber(batch, hash, number)
+			DeleteCanonicalHash(batch, number)
+		}
+		if err := batch.Write(); err != nil {
+			log.Error("Failed to delete frozen canonical blocks", "err", err)
+			continue
+		}
+		log.Debug("Followed ancient store", "blocks", frozen-wiped, "number", frozen-1)
+		wiped = frozen
+	}
+}
+
+// repair truncates all data tables to the same length. Read only freezers only
+// track the common length, their tables are owned by another process.
 func (f *freezer) repair() error {
 	min := uint64(math.MaxUint64)
 	for _, table := range f.tables {
@@ -489,6 +727,10 @@ func (f *freezer) repair() error {
 			min = items
 		}
 	}
+	if f.readonly {
+		atomic.StoreUint64(&f.frozen, min)
+		return nil
+	}
 	for _, table := range f.tables {
 		if err := table.truncate(min); err != nil {
 			return err
@@ -17,14 +17,19 @@
 package rawdb
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
@@ -45,6 +50,33 @@ var (
 	errNotSupported = errors.New("this operation is not supported")
 )
 
+const (
+	// checksumHeaderSize is the size of the checksum file header: a magic marker,
+	// the version of the checksum format and the number of the first item
+	// checksummed.
+	checksumHeaderSize = 16
+
+	// checksumSize is the size of a single item checksum (CRC32-C).
+	checksumSize = 4
+
+	// checksumVersion is the current version of the checksum file format. Tables
+	// without a checksum file, or with one of an older version, start checksumming
+	// the items appended from then on.
+	checksumVersion = 2
+
+	// checksumBatchItems is the number of items checksummed in one go while
+	// backfilling or verifying a table.
+	checksumBatchItems = 1024
+)
+
+var (
+	// checksumMagic is the marker heading the checksum file of a freezer table.
+	checksumMagic = []byte("FCRC")
+
+	// checksumTable is the CRC32 polynomial table used for the item checksums.
+	checksumTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
 // offset within the file to the end of the data
 // In serialized form, the filenum is stored as uint16.
@@ -94,6 +126,7 @@ type freezerTable struct {
 
 	noCompression bool   // if true, disables snappy compression. Note: does not work retroactively
 	maxFileSize   uint32 // Max file size for data-files
+	readonly      bool   // if true, the table follows the files written by another process
 	name          string
 	path          string
 
@@ -103,6 +136,9 @@ type freezerTable struct {
 	tailId uint32              // number of the earliest file
 	index  *os.File            // File descriptor for the indexEntry file of the table
 
+	checksums    *os.File // File descriptor for the item checksums of the table
+	checksumBase uint64   // Number of the first item checksummed, older ones predate checksums
+
 	// In the case that old items are deleted (from the tail), we use itemOffset
 	// to count how many historic items have gone missing.
 	itemOffset uint32 // Offset (number of discarded items)
@@ -118,12 +154,12 @@ type freezerTable struct {
 
 // NewFreezerTable opens the given path as a freezer table.
 func NewFreezerTable(path, name string, disableSnappy bool) (*freezerTable, error) {
-	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, disableSnappy)
+	return newTable(path, name, metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, disableSnappy, false)
 }
 
 // newTable opens a freezer table with default settings - 2G files
-func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, disableSnappy bool) (*freezerTable, error) {
-	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, disableSnappy)
+func newTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, disableSnappy bool, readonly bool) (*freezerTable, error) {
+	return newCustomTable(path, name, readMeter, writeMeter, sizeGauge, 2*1000*1000*1000, disableSnappy, readonly)
 }
 
 // openFreezerFileForAppend opens a freezer table file and seeks to the end
@@ -167,10 +203,15 @@ func truncateFreezerFile(file *os.File, size int64) error {
 // newCustomTable opens a freezer table, creating the data and index files if they are
 // non existent. Both files are truncated to the shortest common length to ensure
 // they don't go out of sync.
-func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool) (*freezerTable, error) {
+//
+// Read only tables are never modified, they follow the files written by the process
+// owning them instead, which is expected to have created them already.
+func newCustomTable(path string, name string, readMeter metrics.Meter, writeMeter metrics.Meter, sizeGauge metrics.Gauge, maxFilesize uint32, noCompression bool, readonly bool) (*freezerTable, error) {
 	// Ensure the containing directory exists and open the indexEntry file
-	if err := os.MkdirAll(path, 0755); err != nil {
-		return nil, err
+	if !readonly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
 	}
 	var idxName string
 	if noCompression {
@@ -180,13 +221,39 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 		// Compressed idx
 		idxName = fmt.Sprintf("%s.cidx", name)
 	}
-	offsets, err := openFreezerFileForAppend(filepath.Join(path, idxName))
-	if err != nil {
-		return nil, err
+	// The checksum file follows the naming of the index file (.rsum or .csum)
+	sumName := strings.TrimSuffix(idxName, "idx") + "sum"
+
+	var (
+		offsets   *os.File
+		checksums *os.File
+		err       error
+	)
+	if readonly {
+		if offsets, err = openFreezerFileForReadOnly(filepath.Join(path, idxName)); err != nil {
+			return nil, err
+		}
+		// Tables written by older versions may lack checksums, leave them out
+		if checksums, err = openFreezerFileForReadOnly(filepath.Join(path, sumName)); err != nil {
+			if !os.IsNotExist(err) {
+				offsets.Close()
+				return nil, err
+			}
+			checksums = nil
+		}
+	} else {
+		if offsets, err = openFreezerFileForAppend(filepath.Join(path, idxName)); err != nil {
+			return nil, err
+		}
+		if checksums, err = openFreezerFileForAppend(filepath.Join(path, sumName)); err != nil {
+			offsets.Close()
+			return nil, err
+		}
 	}
 	// Create the table and repair any past inconsistency
 	tab := &freezerTable{
 		index:         offsets,
+		checksums:     checksums,
 		files:         make(map[uint32]*os.File),
 		readMeter:     readMeter,
 		writeMeter:    writeMeter,
@@ -196,8 +263,14 @@ func newCustomTable(path string, name string, readMeter metrics.Meter, writeMete
 		logger:        log.New("database", path, "table", name),
 		noCompression: noCompression,
 		maxFileSize:   maxFilesize,
+		readonly:      readonly,
+	}
+	if readonly {
+		err = tab.refresh()
+	} else {
+		err = tab.repair()
 	}
-	if err := tab.repair(); err != nil {
+	if err != nil {
 		tab.Close()
 		return nil, err
 	}
@@ -320,10 +393,394 @@ func (t *freezerTable) repair() error {
 	if err := t.preopen(); err != nil {
 		return err
 	}
+	// Bring the item checksums in sync with the repaired table
+	if err := t.repairChecksums(); err != nil {
+		return err
+	}
 	t.logger.Debug("Chain freezer table opened", "items", t.items, "size", common.StorageSize(t.headBytes))
 	return nil
 }
 
+// repairChecksums brings the checksum file in sync with the items of the table.
+//
+// Tables predating item checksums, or using an older checksum format, aren't
+// checksummed here as it would take a full pass over their stored data. Their
+// checksums start at the next appended item instead, the older ones are only
+// computed on request by the freezer verification (see backfillChecksums).
+//
+// Checksums missing for the last items, lost in a crash before they were synced,
+// are treated like a short index: the table is truncated to the checksummed items.
+func (t *freezerTable) repairChecksums() error {
+	stat, err := t.checksums.Stat()
+	if err != nil {
+		return err
+	}
+	version, base, err := readChecksumHeader(t.checksums)
+	if err != nil {
+		return err
+	}
+	if version > checksumVersion {
+		return fmt.Errorf("unsupported checksum version %d", version)
+	}
+	items := atomic.LoadUint64(&t.items)
+	if version < checksumVersion || base > items {
+		if items > uint64(t.itemOffset) {
+			t.logger.Info("Freezer table items predate checksums, verify the freezer to checksum them", "items", items-uint64(t.itemOffset))
+		}
+		return t.resetChecksums(items)
+	}
+	t.checksumBase = base
+
+	have := base + uint64(stat.Size()-checksumHeaderSize)/checksumSize
+	if have > items {
+		t.logger.Warn("Truncating dangling checksums", "items", items, "checksums", have)
+		if err := truncateFreezerFile(t.checksums, checksumHeaderSize+int64(items-base)*checksumSize); err != nil {
+			return err
+		}
+	}
+	if have < uint64(t.itemOffset) {
+		// The checksums end before the table tail, none of the remaining items
+		// are covered, so start checksumming afresh from the head
+		t.logger.Info("Freezer table items predate checksums, verify the freezer to checksum them", "items", items-uint64(t.itemOffset))
+		return t.resetChecksums(items)
+	}
+	if have < items {
+		t.logger.Warn("Truncating freezer table to checksummed items", "items", items, "checksums", have)
+		return t.truncate(have)
+	}
+	return nil
+}
+
+// readChecksumHeader parses the header of a checksum file, returning the version
+// of its format and the number of the first item checksummed. Files without a
+// valid header are reported with a zero version.
+func readChecksumHeader(file *os.File) (uint32, uint64, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if stat.Size() < checksumHeaderSize {
+		return 0, 0, nil
+	}
+	header := make([]byte, checksumHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return 0, 0, err
+	}
+	if !bytes.Equal(header[:len(checksumMagic)], checksumMagic) {
+		return 0, 0, nil
+	}
+	version := binary.BigEndian.Uint32(header[len(checksumMagic):])
+	base := binary.BigEndian.Uint64(header[len(checksumMagic)+4:])
+	return version, base, nil
+}
+
+// checksumHeader creates the header of a checksum file starting at the given item.
+func checksumHeader(base uint64) []byte {
+	header := make([]byte, checksumHeaderSize)
+	copy(header, checksumMagic)
+	binary.BigEndian.PutUint32(header[len(checksumMagic):], checksumVersion)
+	binary.BigEndian.PutUint64(header[len(checksumMagic)+4:], base)
+	return header
+}
+
+// resetChecksums drops all checksums, restarting them from the given item.
+func (t *freezerTable) resetChecksums(base uint64) error {
+	if err := truncateFreezerFile(t.checksums, 0); err != nil {
+		return err
+	}
+	if _, err := t.checksums.Write(checksumHeader(base)); err != nil {
+		return err
+	}
+	t.checksumBase = base
+	return t.checksums.Sync()
+}
+
+// backfillChecksums checksums the stored data of the items predating the checksum
+// file, rewriting it to cover the whole table. It's a full pass over the data of
+// these items, so it's only done on request by the freezer verification, while
+// the table isn't written to.
+//
+// Note, the checksums of backfilled items only protect against corruption from
+// the time of the backfill onwards.
+func (t *freezerTable) backfillChecksums() error {
+	first, base := uint64(t.itemOffset), t.checksumBase
+	if base <= first {
+		return nil
+	}
+	t.logger.Info("Checksumming freezer items predating checksums", "items", base-first)
+
+	path := t.checksums.Name()
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path + ".tmp")
+
+	if _, err := file.Write(checksumHeader(first)); err != nil {
+		file.Close()
+		return err
+	}
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := first; number < base; {
+		count := base - number
+		if count > checksumBatchItems {
+			count = checksumBatchItems
+		}
+		sums, err := t.checksumItems(number, count)
+		if err != nil {
+			// The item is unreadable, store a placeholder for it to be flagged by
+			// the verification instead of aborting.
+			t.logger.Error("Failed to checksum freezer item", "number", number+uint64(len(sums)), "err", err)
+			sums = append(sums, 0)
+		}
+		blob := make([]byte, len(sums)*checksumSize)
+		for i, sum := range sums {
+			binary.BigEndian.PutUint32(blob[i*checksumSize:], sum)
+		}
+		if _, err := file.Write(blob); err != nil {
+			file.Close()
+			return err
+		}
+		number += uint64(len(sums))
+
+		if time.Since(logged) > 8*time.Second {
+			t.logger.Info("Checksumming freezer table", "items", number-first, "total", base-first, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	// Carry over the checksums of the items appended since, then swap the files
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.checksums == nil {
+		file.Close()
+		return errClosed
+	}
+	if _, err := io.Copy(file, io.NewSectionReader(t.checksums, checksumHeaderSize, math.MaxInt64)); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	t.checksums.Close()
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	if t.checksums, err = openFreezerFileForAppend(path); err != nil {
+		return err
+	}
+	t.checksumBase = first
+	return nil
+}
+
+// checksumItems computes the checksums of the stored data of a range of items,
+// stopping at the first item which cannot be read.
+func (t *freezerTable) checksumItems(from, count uint64) ([]uint32, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	if t.index == nil || t.head == nil {
+		return nil, errClosed
+	}
+	indices, err := t.getIndices(from, count)
+	if err != nil {
+		return nil, err
+	}
+	sums := make([]uint32, 0, count)
+	for i := 0; i < len(indices)-1; i++ {
+		blob, err := t.readRaw(indices[i], indices[i+1])
+		if err != nil {
+			return sums, err
+		}
+		sums = append(sums, crc32.Checksum(blob, checksumTable))
+	}
+	return sums, nil
+}
+
+// readRaw reads the stored, potentially compressed, data of the item delimited
+// by the two given index entries. It assumes the read lock is held by the caller.
+func (t *freezerTable) readRaw(start, end *indexEntry) ([]byte, error) {
+	if end.filenum < start.filenum {
+		return nil, fmt.Errorf("index file numbers out of order: %d > %d", start.filenum, end.filenum)
+	}
+	offset1, offset2, fileId := start.bounds(end)
+	if offset2 < offset1 || offset2 > t.maxFileSize {
+		return nil, fmt.Errorf("invalid item bounds: %d - %d", offset1, offset2)
+	}
+	dataFile, exist := t.files[fileId]
+	if !exist {
+		return nil, fmt.Errorf("missing data file %d", fileId)
+	}
+	blob := make([]byte, offset2-offset1)
+	if _, err := dataFile.ReadAt(blob, int64(offset1)); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// verify checks the stored data of the items starting from the given number
+// against their checksums. It returns the number of the first item failing the
+// check, or the number of items in the table if all of them are intact. Items
+// predating the checksums are skipped.
+func (t *freezerTable) verify(from uint64) (uint64, error) {
+	t.lock.RLock()
+	if t.index == nil {
+		t.lock.RUnlock()
+		return 0, errClosed
+	}
+	if t.checksums == nil {
+		t.lock.RUnlock()
+		return 0, errNotSupported
+	}
+	version, base, err := readChecksumHeader(t.checksums)
+	tail := uint64(t.itemOffset)
+	t.lock.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	if version != checksumVersion {
+		return 0, errNotSupported
+	}
+	if from < base {
+		from = base
+	}
+	if from < tail {
+		from = tail
+	}
+	var (
+		items  = atomic.LoadUint64(&t.items)
+		start  = time.Now()
+		logged = time.Now()
+	)
+	for number := from; number < items; {
+		count := items - number
+		if count > checksumBatchItems {
+			count = checksumBatchItems
+		}
+		stored := make([]byte, count*checksumSize)
+		t.lock.RLock()
+		if t.index == nil {
+			t.lock.RUnlock()
+			return 0, errClosed
+		}
+		if t.checksums == nil {
+			t.lock.RUnlock()
+			return 0, errNotSupported
+		}
+		_, err := t.checksums.ReadAt(stored, checksumHeaderSize+int64(number-base)*checksumSize)
+		t.lock.RUnlock()
+		if err != nil {
+			return 0, err
+		}
+		sums, err := t.checksumItems(number, count)
+		for i, sum := range sums {
+			if sum != binary.BigEndian.Uint32(stored[i*checksumSize:]) {
+				t.logger.Warn("Freezer item checksum mismatch", "number", number+uint64(i))
+				return number + uint64(i), nil
+			}
+		}
+		if err != nil {
+			t.logger.Warn("Unreadable freezer item", "number", number+uint64(len(sums)), "err", err)
+			return number + uint64(len(sums)), nil
+		}
+		number += count
+
+		if time.Since(logged) > 8*time.Second {
+			t.logger.Info("Verifying freezer table", "items", number, "total", items, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	return items, nil
+}
+
+// refresh updates a read only table to the items written by the process owning
+// its files, opening the new data files and reopening the ones replaced after a
+// truncation. Index entries pointing beyond the written data are ignored, their
+// items are still being written.
+func (t *freezerTable) refresh() error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.index == nil {
+		return errClosed
+	}
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size() - stat.Size()%indexEntrySize
+	if size == 0 {
+		return errors.New("freezer table not initialized")
+	}
+	// Drop the data files replaced since they were opened
+	for num, f := range t.files {
+		opened, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if current, err := os.Stat(f.Name()); err != nil || !os.SameFile(opened, current) {
+			t.releaseFile(num)
+		}
+	}
+	// Find the last item with its data fully written
+	var (
+		buffer     = make([]byte, indexEntrySize)
+		firstIndex indexEntry
+		lastIndex  indexEntry
+	)
+	if _, err := t.index.ReadAt(buffer, 0); err != nil {
+		return err
+	}
+	firstIndex.unmarshalBinary(buffer)
+
+	for ; ; size -= indexEntrySize {
+		if _, err := t.index.ReadAt(buffer, size-indexEntrySize); err != nil {
+			return err
+		}
+		lastIndex.unmarshalBinary(buffer)
+		if size == indexEntrySize {
+			// Empty table, the head is the tail file
+			lastIndex = indexEntry{filenum: firstIndex.filenum}
+			break
+		}
+		head, err := t.openFile(lastIndex.filenum, openFreezerFileForReadOnly)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if stat, err = head.Stat(); err != nil {
+			return err
+		}
+		if int64(lastIndex.offset) <= stat.Size() {
+			break
+		}
+	}
+	// Open all the data files up to the head and release the truncated ones
+	t.releaseFilesAfter(lastIndex.filenum, false)
+	for i := firstIndex.filenum; i <= lastIndex.filenum; i++ {
+		if _, err := t.openFile(i, openFreezerFileForReadOnly); err != nil {
+			return err
+		}
+	}
+	t.tailId = firstIndex.filenum
+	t.itemOffset = firstIndex.offset
+	t.head = t.files[lastIndex.filenum]
+	atomic.StoreUint32(&t.headId, lastIndex.filenum)
+	atomic.StoreUint32(&t.headBytes, lastIndex.offset)
+	atomic.StoreUint64(&t.items, uint64(t.itemOffset)+uint64(size/indexEntrySize-1))
+	return nil
+}
+
 // preopen opens all files that the freezer will need. This method should be called from an init-context,
 // since it assumes that it doesn't have to bother with locking
 // The rationale for doing preopen is to not have to do it from within Retrieve, thus not needing to ever
@@ -366,6 +823,13 @@ func (t *freezerTable) truncate(items uint64) error {
 	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
 		return err
 	}
+	if items < t.checksumBase {
+		if err := t.resetChecksums(items); err != nil {
+			return err
+		}
+	} else if err := truncateFreezerFile(t.checksums, checksumHeaderSize+int64(items-t.checksumBase)*checksumSize); err != nil {
+		return err
+	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
 	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
@@ -417,6 +881,12 @@ func (t *freezerTable) Close() error {
 	}
 	t.index = nil
 
+	if t.checksums != nil {
+		if err := t.checksums.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		t.checksums = nil
+	}
 	for _, f := range t.files {
 		if err := f.Close(); err != nil {
 			errs = append(errs, err)
@@ -509,7 +979,7 @@ func (t *freezerTable) append(item uint64, encodedBlob []byte, wlock bool) (bool
 		defer t.lock.RUnlock()
 	}
 	// Ensure the table is still accessible
-	if t.index == nil || t.head == nil {
+	if t.index == nil || t.head == nil || t.checksums == nil {
 		return false, errClosed
 	}
 	// Ensure only the next item can be written, nothing else
@@ -549,11 +1019,17 @@ func (t *freezerTable) append(item uint64, encodedBlob []byte, wlock bool) (bool
 		filenum: atomic.LoadUint32(&t.headId),
 		offset:  newOffset,
 	}
-	// Write indexEntry
+	// Write indexEntry and the checksum of the item
 	t.index.Write(idx.marshallBinary())
 
-	t.writeMeter.Mark(int64(bLen + indexEntrySize))
-	t.sizeGauge.Inc(int64(bLen + indexEntrySize))
+	sum := make([]byte, checksumSize)
+	binary.BigEndian.PutUint32(sum, crc32.Checksum(encodedBlob, checksumTable))
+	if _, err := t.checksums.Write(sum); err != nil {
+		return false, err
+	}
+
+	t.writeMeter.Mark(int64(bLen + indexEntrySize + checksumSize))
+	t.sizeGauge.Inc(int64(bLen + indexEntrySize + checksumSize))
 
 	atomic.AddUint64(&t.items, 1)
 	return false, nil
@@ -760,6 +1236,13 @@ func (t *freezerTable) sizeNolock() (uint64, error) {
 		return 0, err
 	}
 	total := uint64(t.maxFileSize)*uint64(t.headId-t.tailId) + uint64(t.headBytes) + uint64(stat.Size())
+	if t.checksums != nil {
+		sums, err := t.checksums.Stat()
+		if err != nil {
+			return 0, err
+		}
+		total += uint64(sums.Size())
+	}
 	return total, nil
 }
 
@@ -769,6 +1252,11 @@ func (t *freezerTable) Sync() error {
 	if err := t.index.Sync(); err != nil {
 		return err
 	}
+	if t.checksums != nil {
+		if err := t.checksums.Sync(); err != nil {
+			return err
+		}
+	}
 	return t.head.Sync()
 }
 
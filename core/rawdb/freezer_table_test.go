@@ -25,9 +25,12 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/metrics"
 )
 
@@ -51,7 +54,7 @@ func TestFreezerBasics(t *testing.T) {
 	// set cutoff at 50 bytes
 	f, err := newCustomTable(os.TempDir(),
 		fmt.Sprintf("unittest-%d", rand.Uint64()),
-		metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true)
+		metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge(), 50, true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -98,7 +101,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 		f          *freezerTable
 		err        error
 	)
-	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -107,7 +110,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 		data := getChunk(15, x)
 		f.Append(uint64(x), data)
 		f.Close()
-		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -124,7 +127,7 @@ func TestFreezerBasicsClosing(t *testing.T) {
 			t.Fatalf("test %d, got \n%x != \n%x", y, got, exp)
 		}
 		f.Close()
-		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -138,7 +141,7 @@ func TestFreezerRepairDanglingHead(t *testing.T) {
 	fname := fmt.Sprintf("dangling_headtest-%d", rand.Uint64())
 
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -167,7 +170,7 @@ func TestFreezerRepairDanglingHead(t *testing.T) {
 	idxFile.Close()
 	// Now open it again
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -189,7 +192,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	fname := fmt.Sprintf("dangling_headtest-%d", rand.Uint64())
 
 	{ // Fill a table and close it
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -215,7 +218,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	idxFile.Close()
 	// Now open it again
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -236,7 +239,7 @@ func TestFreezerRepairDanglingHeadLarge(t *testing.T) {
 	}
 	// And if we open it, we should now be able to read all of them (new values)
 	{
-		f, _ := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, _ := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		for y := 1; y < 255; y++ {
 			exp := getChunk(15, ^y)
 			got, err := f.Retrieve(uint64(y))
@@ -257,7 +260,7 @@ func TestSnappyDetection(t *testing.T) {
 	fname := fmt.Sprintf("snappytest-%d", rand.Uint64())
 	// Open with snappy
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -270,7 +273,7 @@ func TestSnappyDetection(t *testing.T) {
 	}
 	// Open without snappy
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, false)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, false, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -282,7 +285,7 @@ func TestSnappyDetection(t *testing.T) {
 
 	// Open with snappy
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -314,7 +317,7 @@ func TestFreezerRepairDanglingIndex(t *testing.T) {
 	fname := fmt.Sprintf("dangling_indextest-%d", rand.Uint64())
 
 	{ // Fill a table and close it
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -350,7 +353,7 @@ func TestFreezerRepairDanglingIndex(t *testing.T) {
 	// 45, 45, 15
 	// with 3+3+1 items
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -371,7 +374,7 @@ func TestFreezerTruncate(t *testing.T) {
 	fname := fmt.Sprintf("truncation-%d", rand.Uint64())
 
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -388,7 +391,7 @@ func TestFreezerTruncate(t *testing.T) {
 	}
 	// Reopen, truncate
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -413,7 +416,7 @@ func TestFreezerRepairFirstFile(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("truncationfirst-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -441,7 +444,7 @@ func TestFreezerRepairFirstFile(t *testing.T) {
 	}
 	// Reopen
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -469,7 +472,7 @@ func TestFreezerReadAndTruncate(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("read_truncate-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -486,7 +489,7 @@ func TestFreezerReadAndTruncate(t *testing.T) {
 	}
 	// Reopen and read all files
 	{
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -515,7 +518,7 @@ func TestOffset(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("offset-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -571,7 +574,7 @@ func TestOffset(t *testing.T) {
 	}
 	// Now open again
 	checkPresent := func(numDeleted uint64) {
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -656,7 +659,7 @@ func TestAppendTruncateParallel(t *testing.T) {
 	}
 	defer os.RemoveAll(dir)
 
-	f, err := newCustomTable(dir, "tmp", metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 8, true)
+	f, err := newCustomTable(dir, "tmp", metrics.NilMeter{}, metrics.NilMeter{}, metrics.NilGauge{}, 8, true, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -698,7 +701,7 @@ func TestSequentialRead(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("batchread-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -711,7 +714,7 @@ func TestSequentialRead(t *testing.T) {
 		f.Close()
 	}
 	{ // Open it, iterate, verify iteration
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -732,7 +735,7 @@ func TestSequentialRead(t *testing.T) {
 	}
 	{ // Open it, iterate, verify byte limit. The byte limit is less than item
 		// size, so each lookup should only return one item
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 40, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -761,7 +764,7 @@ func TestSequentialReadByteLimit(t *testing.T) {
 	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
 	fname := fmt.Sprintf("batchread-2-%d", rand.Uint64())
 	{ // Fill table
-		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 100, true)
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 100, true, false)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -786,7 +789,7 @@ func TestSequentialReadByteLimit(t *testing.T) {
 		{100, 109, 10},
 	} {
 		{
-			f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 100, true)
+			f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 100, true, false)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -807,3 +810,213 @@ func TestSequentialReadByteLimit(t *testing.T) {
 		}
 	}
 }
+
+// TestFreezerChecksums tests that silent data corruption is detected through the
+// item checksums, and that items predating the checksums are only checksummed
+// when backfilled.
+func TestFreezerChecksums(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("checksums-%d", rand.Uint64())
+	sums := filepath.Join(os.TempDir(), fmt.Sprintf("%s.rsum", fname))
+
+	{ // Fill table
+		f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Write 15 bytes 30 times
+		for x := 0; x < 30; x++ {
+			f.Append(uint64(x), getChunk(15, x))
+		}
+		f.Close()
+	}
+	// Reopen and verify, then flip a byte of item 7 in the third file
+	f, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad, err := f.verify(0); err != nil || bad != 30 {
+		t.Fatalf("intact table verification mismatch: have %d (%v), want %d", bad, err, 30)
+	}
+	file, err := os.OpenFile(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0002.rdat", fname)), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 20)
+	file.Close()
+
+	if bad, err := f.verify(0); err != nil || bad != 7 {
+		t.Fatalf("corrupted table verification mismatch: have %d (%v), want %d", bad, err, 7)
+	}
+	// Truncating to the last intact item drops the corrupted checksums too
+	f.truncate(7)
+	if bad, err := f.verify(0); err != nil || bad != 7 {
+		t.Fatalf("truncated table verification mismatch: have %d (%v), want %d", bad, err, 7)
+	}
+	if err := assertFileSize(sums, checksumHeaderSize+7*checksumSize); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// Drop the last checksum and ensure the table is truncated to the checksummed items
+	if err := os.Truncate(sums, checksumHeaderSize+6*checksumSize); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if items := atomic.LoadUint64(&f.items); items != 6 {
+		t.Fatalf("table not truncated to checksummed items: have %d, want %d", items, 6)
+	}
+	f.Close()
+
+	// Drop the checksums and ensure they are not recomputed on open, only the
+	// newly appended items are checksummed
+	os.Remove(sums)
+	if f, err = newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertFileSize(sums, checksumHeaderSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Append(6, getChunk(15, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertFileSize(sums, checksumHeaderSize+checksumSize); err != nil {
+		t.Fatal(err)
+	}
+	if bad, err := f.verify(0); err != nil || bad != 7 {
+		t.Fatalf("partially checksummed table verification mismatch: have %d (%v), want %d", bad, err, 7)
+	}
+	// Backfill the checksums of the older items, after which they're verified too
+	if err := f.backfillChecksums(); err != nil {
+		t.Fatal(err)
+	}
+	if err := assertFileSize(sums, checksumHeaderSize+7*checksumSize); err != nil {
+		t.Fatal(err)
+	}
+	file, err = os.OpenFile(filepath.Join(os.TempDir(), fmt.Sprintf("%s.0000.rdat", fname)), os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteAt([]byte{0xff}, 20)
+	file.Close()
+
+	if bad, err := f.verify(0); err != nil || bad != 1 {
+		t.Fatalf("backfilled table verification mismatch: have %d (%v), want %d", bad, err, 1)
+	}
+	f.Close()
+
+	// Ensure checksums of an unknown format are rejected
+	header := make([]byte, checksumHeaderSize)
+	copy(header, checksumMagic)
+	binary.BigEndian.PutUint32(header[len(checksumMagic):], checksumVersion+1)
+	if err := ioutil.WriteFile(sums, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newCustomTable(os.TempDir(), fname, rm, wm, sg, 50, true, false); err == nil {
+		t.Fatalf("table with unsupported checksum version opened")
+	}
+}
+
+// TestFreezerVerify tests that the freezer verification cross-checks the frozen
+// hashes against the headers.
+func TestFreezerVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	empty := common.FromHex("c2c0c0")
+	for number := uint64(0); number < 10; number++ {
+		header := []byte{byte(number)}
+		hash := crypto.Keccak256(header)
+		if number == 6 {
+			hash = crypto.Keccak256(nil)
+		}
+		if err := f.AppendAncient(number, hash, header, empty, nil, nil); err != nil {
+			t.Fatalf("failed to append block %d: %v", number, err)
+		}
+	}
+	f.Close()
+
+	bad, frozen, err := VerifyFreezer(dir)
+	if err != nil {
+		t.Fatalf("failed to verify freezer: %v", err)
+	}
+	if bad != 6 || frozen != 10 {
+		t.Fatalf("verification mismatch: have %d/%d, want %d/%d", bad, frozen, 6, 10)
+	}
+}
+
+// TestFreezerReadonlyFollow tests that a read only freezer, opened while another
+// one writes to the same directory, follows the appended and truncated blocks.
+func TestFreezerReadonlyFollow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writer, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	defer writer.Close()
+
+	appendBlocks := func(from, to uint64) {
+		t.Helper()
+		for number := from; number < to; number++ {
+			header := []byte{byte(number)}
+			if err := writer.AppendAncient(number, crypto.Keccak256(header), header, []byte{0xc0}, nil, nil); err != nil {
+				t.Fatalf("failed to append block %d: %v", number, err)
+			}
+		}
+		if err := writer.Sync(); err != nil {
+			t.Fatalf("failed to sync freezer: %v", err)
+		}
+	}
+	check := func(reader *freezer, frozen uint64) {
+		t.Helper()
+		if err := reader.refresh(); err != nil {
+			t.Fatalf("failed to refresh reader: %v", err)
+		}
+		if have, _ := reader.Ancients(); have != frozen {
+			t.Fatalf("frozen blocks mismatch: have %d, want %d", have, frozen)
+		}
+		for number := uint64(0); number < frozen; number++ {
+			if header, err := reader.Ancient(freezerHeaderTable, number); err != nil || !bytes.Equal(header, []byte{byte(number)}) {
+				t.Fatalf("block %d: header mismatch: have %x (%v)", number, header, err)
+			}
+		}
+		if _, err := reader.Ancient(freezerHeaderTable, frozen); err == nil {
+			t.Fatalf("block %d: unfrozen header available", frozen)
+		}
+	}
+	appendBlocks(0, 5)
+
+	reader, err := newFreezer(dir, "", true)
+	if err != nil {
+		t.Fatalf("failed to open read only freezer: %v", err)
+	}
+	defer reader.Close()
+	check(reader, 5)
+
+	appendBlocks(5, 10)
+	check(reader, 10)
+
+	if err := writer.TruncateAncients(3); err != nil {
+		t.Fatalf("failed to truncate freezer: %v", err)
+	}
+	check(reader, 3)
+
+	if err := reader.AppendAncient(3, nil, nil, nil, nil, nil); err != errReadOnly {
+		t.Fatalf("read only freezer append error mismatch: have %v, want %v", err, errReadOnly)
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// freezerTxIndexSegment is the number of frozen blocks whose transactions are
+	// indexed by a single segment of the frozen transaction index.
+	freezerTxIndexSegment = 16384
+
+	// txIndexFanoutSize is the size of the fan-out table heading each segment,
+	// holding the cumulative number of entries for each first hash byte.
+	txIndexFanoutSize = 256 * 4
+
+	// txIndexEntrySize is the size of a segment entry: a transaction hash and the
+	// number of the block including it.
+	txIndexEntrySize = common.HashLength + 8
+)
+
+// errTxNotIndexed is returned if a transaction is not covered by the frozen
+// transaction index.
+var errTxNotIndexed = errors.New("transaction not indexed")
+
+// errTxIndexTruncated is returned if a segment is sealed from frozen blocks that
+// were truncated meanwhile.
+var errTxIndexTruncated = errors.New("transaction index truncated")
+
+// txIndexEntry is a transaction lookup of the frozen transaction index.
+type txIndexEntry struct {
+	hash   common.Hash
+	number uint64
+}
+
+// txIndexSegment is an immutable file indexing the transactions of a range of
+// frozen blocks. The entries are sorted by hash, headed by a fan-out table to
+// narrow down the binary search:
+//
+//	fanout (256 x uint32) | entry 0 (hash + uint64 number) | entry 1 | ...
+type txIndexSegment struct {
+	first  uint64      // Number of the first block covered by the segment
+	file   *os.File    // File handle of the segment
+	fanout [256]uint32 // Number of entries with a first hash byte up to the index
+}
+
+// openTxIndexSegment opens the segment file at the given path, validating its
+// size against the fan-out table.
+func openTxIndexSegment(path string, first uint64) (*txIndexSegment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	segment := &txIndexSegment{first: first, file: file}
+
+	blob := make([]byte, txIndexFanoutSize)
+	if _, err := file.ReadAt(blob, 0); err != nil {
+		file.Close()
+		return nil, err
+	}
+	for i := range segment.fanout {
+		segment.fanout[i] = binary.BigEndian.Uint32(blob[i*4:])
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if want := int64(txIndexFanoutSize) + int64(segment.fanout[255])*txIndexEntrySize; stat.Size() != want {
+		file.Close()
+		return nil, fmt.Errorf("segment size mismatch: have %d, want %d", stat.Size(), want)
+	}
+	return segment, nil
+}
+
+// lookup binary searches the segment for the given transaction hash.
+func (s *txIndexSegment) lookup(hash []byte) (uint64, bool, error) {
+	var lo uint32
+	if hash[0] > 0 {
+		lo = s.fanout[hash[0]-1]
+	}
+	var (
+		entry = make([]byte, txIndexEntrySize)
+		err   error
+	)
+	hi := s.fanout[hash[0]]
+	pos := lo + uint32(sort.Search(int(hi-lo), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		if _, err = s.file.ReadAt(entry, int64(txIndexFanoutSize)+int64(lo+uint32(i))*txIndexEntrySize); err != nil {
+			return true
+		}
+		return bytes.Compare(entry[:common.HashLength], hash) >= 0
+	}))
+	if err != nil {
+		return 0, false, err
+	}
+	if pos == hi {
+		return 0, false, nil
+	}
+	if _, err := s.file.ReadAt(entry, int64(txIndexFanoutSize)+int64(pos)*txIndexEntrySize); err != nil {
+		return 0, false, err
+	}
+	if !bytes.Equal(entry[:common.HashLength], hash) {
+		return 0, false, nil
+	}
+	return binary.BigEndian.Uint64(entry[common.HashLength:]), true, nil
+}
+
+// freezerTxIndex is the frozen transaction index, made of consecutive segments
+// covering the frozen blocks from genesis in chunks of freezerTxIndexSegment.
+// It keeps hash based transaction lookups of ancient blocks available once
+// their entries are deleted from the key-value store.
+type freezerTxIndex struct {
+	path     string
+	segments []*txIndexSegment // Consecutive segments ordered by block number
+	gen      uint64            // Number of truncations, invalidating the segments built meanwhile
+	lock     sync.RWMutex
+}
+
+// newFreezerTxIndex opens the frozen transaction index in the given directory.
+// Leftovers of interrupted writes and segments not continuing the sequence are
+// discarded unless the index is opened read only, they'll get rebuilt.
+func newFreezerTxIndex(path string, readonly bool) (*freezerTxIndex, error) {
+	if !readonly {
+		if err := os.MkdirAll(path, 0755); err != nil {
+			return nil, err
+		}
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	firsts := make(map[uint64]string)
+	for _, file := range files {
+		name := file.Name()
+		if strings.HasSuffix(name, ".tmp") && !readonly {
+			os.Remove(filepath.Join(path, name))
+			continue
+		}
+		if !strings.HasSuffix(name, ".idx") {
+			continue
+		}
+		first, err := strconv.ParseUint(strings.TrimSuffix(name, ".idx"), 10, 64)
+		if err != nil {
+			continue
+		}
+		firsts[first] = filepath.Join(path, name)
+	}
+	index := &freezerTxIndex{path: path}
+	for first := uint64(0); ; first += freezerTxIndexSegment {
+		file, ok := firsts[first]
+		if !ok {
+			break
+		}
+		delete(firsts, first)
+
+		segment, err := openTxIndexSegment(file, first)
+		if err != nil {
+			log.Warn("Dropping invalid transaction index segment", "first", first, "err", err)
+			if !readonly {
+				os.Remove(file)
+			}
+			break
+		}
+		index.segments = append(index.segments, segment)
+	}
+	for _, file := range firsts {
+		if !readonly {
+			os.Remove(file)
+		}
+	}
+	return index, nil
+}
+
+// next returns the number of the first block not covered by the index.
+func (idx *freezerTxIndex) next() uint64 {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return uint64(len(idx.segments)) * freezerTxIndexSegment
+}
+
+// generation returns the number of truncations of the index. Segments built from
+// the frozen blocks of a previous generation are rejected.
+func (idx *freezerTxIndex) generation() uint64 {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return idx.gen
+}
+
+// lookup retrieves the number of the block containing the given transaction,
+// only searching the segments of the blocks below limit.
+func (idx *freezerTxIndex) lookup(hash []byte, limit uint64) (uint64, error) {
+	if len(hash) != common.HashLength {
+		return 0, errTxNotIndexed
+	}
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	for i := len(idx.segments) - 1; i >= 0; i-- {
+		if idx.segments[i].first >= limit {
+			continue
+		}
+		number, ok, err := idx.segments[i].lookup(hash)
+		if err != nil {
+			return 0, err
+		}
+		if ok && number < limit {
+			return number, nil
+		}
+	}
+	return 0, errTxNotIndexed
+}
+
+// add seals the transactions of the next block range into a new segment. The
+// segment is rejected if the index was truncated since the given generation.
+func (idx *freezerTxIndex) add(first uint64, gen uint64, entries []txIndexEntry) error {
+	if next := idx.next(); first != next {
+		return fmt.Errorf("segment out of order: have %d, want %d", first, next)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].hash[:], entries[j].hash[:]) < 0
+	})
+	blob := make([]byte, txIndexFanoutSize+len(entries)*txIndexEntrySize)
+	var fanout [256]uint32
+	for i, entry := range entries {
+		fanout[entry.hash[0]]++
+
+		pos := txIndexFanoutSize + i*txIndexEntrySize
+		copy(blob[pos:], entry.hash[:])
+		binary.BigEndian.PutUint64(blob[pos+common.HashLength:], entry.number)
+	}
+	var total uint32
+	for i, count := range fanout {
+		total += count
+		binary.BigEndian.PutUint32(blob[i*4:], total)
+	}
+	// Write the segment to a temporary file and move it in place once synced
+	path := filepath.Join(idx.path, fmt.Sprintf("%d.idx", first))
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(blob); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	segment, err := openTxIndexSegment(path, first)
+	if err != nil {
+		return err
+	}
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	if idx.gen != gen {
+		segment.file.Close()
+		os.Remove(path)
+		return errTxIndexTruncated
+	}
+	idx.segments = append(idx.segments, segment)
+	return nil
+}
+
+// truncate drops all segments covering blocks beyond the given number of frozen
+// items.
+func (idx *freezerTxIndex) truncate(items uint64) error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.gen++
+
+	for len(idx.segments) > 0 {
+		last := idx.segments[len(idx.segments)-1]
+		if last.first+freezerTxIndexSegment <= items {
+			break
+		}
+		last.file.Close()
+		if err := os.Remove(last.file.Name()); err != nil {
+			return err
+		}
+		idx.segments = idx.segments[:len(idx.segments)-1]
+	}
+	return nil
+}
+
+// refresh updates a read only index to the segments sealed by the process owning
+// it, covering up to the given number of frozen blocks.
+func (idx *freezerTxIndex) refresh(frozen uint64) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	for len(idx.segments) > 0 {
+		last := idx.segments[len(idx.segments)-1]
+		if last.first+freezerTxIndexSegment <= frozen {
+			break
+		}
+		last.file.Close()
+		idx.segments = idx.segments[:len(idx.segments)-1]
+	}
+	for {
+		first := uint64(len(idx.segments)) * freezerTxIndexSegment
+		if first+freezerTxIndexSegment > frozen {
+			return
+		}
+		segment, err := openTxIndexSegment(filepath.Join(idx.path, fmt.Sprintf("%d.idx", first)), first)
+		if err != nil {
+			return // Not sealed yet
+		}
+		idx.segments = append(idx.segments, segment)
+	}
+}
+
+// close releases all segment files.
+func (idx *freezerTxIndex) close() error {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	var errs []error
+	for _, segment := range idx.segments {
+		if err := segment.file.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	idx.segments = nil
+	if errs != nil {
+		return fmt.Errorf("%v", errs)
+	}
+	return nil
+}
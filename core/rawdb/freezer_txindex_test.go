@@ -0,0 +1,192 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// makeTxIndexEntries creates pseudo random index entries for the given segment.
+func makeTxIndexEntries(first uint64, count int) []txIndexEntry {
+	entries := make([]txIndexEntry, count)
+	for i := range entries {
+		number := first + uint64(i)%freezerTxIndexSegment
+		entries[i] = txIndexEntry{
+			hash:   crypto.Keccak256Hash(big.NewInt(int64(first)).Bytes(), big.NewInt(int64(i)).Bytes()),
+			number: number,
+		}
+	}
+	return entries
+}
+
+// Tests that the segments of the frozen transaction index serve the lookups of
+// their transactions, survive reopening and get truncated with the freezer.
+func TestFreezerTxIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "txindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	idx, err := newFreezerTxIndex(dir, false)
+	if err != nil {
+		t.Fatalf("failed to open index: %v", err)
+	}
+	first, second := makeTxIndexEntries(0, 1000), makeTxIndexEntries(freezerTxIndexSegment, 10)
+	if err := idx.add(freezerTxIndexSegment, idx.generation(), second); err == nil {
+		t.Fatalf("out of order segment added")
+	}
+	if err := idx.add(0, idx.generation(), first); err != nil {
+		t.Fatalf("failed to add segment: %v", err)
+	}
+	// Segments built before a truncation are rejected
+	gen := idx.generation()
+	if err := idx.truncate(2 * freezerTxIndexSegment); err != nil {
+		t.Fatalf("failed to truncate index: %v", err)
+	}
+	if err := idx.add(freezerTxIndexSegment, gen, second); err != errTxIndexTruncated {
+		t.Fatalf("stale segment error mismatch: have %v, want %v", err, errTxIndexTruncated)
+	}
+	if err := idx.add(freezerTxIndexSegment, idx.generation(), second); err != nil {
+		t.Fatalf("failed to add segment: %v", err)
+	}
+	check := func(idx *freezerTxIndex, entries []txIndexEntry, indexed bool) {
+		t.Helper()
+		for _, entry := range entries {
+			number, err := idx.lookup(entry.hash[:], math.MaxUint64)
+			if !indexed {
+				if err == nil {
+					t.Fatalf("transaction %x indexed", entry.hash)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("failed to look up transaction %x: %v", entry.hash, err)
+			}
+			if number != entry.number {
+				t.Fatalf("block number mismatch for %x: have %d, want %d", entry.hash, number, entry.number)
+			}
+		}
+	}
+	check(idx, first, true)
+	check(idx, second, true)
+	check(idx, makeTxIndexEntries(2*freezerTxIndexSegment, 10), false)
+
+	// Reopen the index with a leftover temporary and an orphan segment
+	idx.close()
+	ioutil.WriteFile(filepath.Join(dir, "32768.idx.tmp"), []byte{0x01}, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "65536.idx"), []byte{0x01}, 0644)
+
+	if idx, err = newFreezerTxIndex(dir, false); err != nil {
+		t.Fatalf("failed to reopen index: %v", err)
+	}
+	if next := idx.next(); next != 2*freezerTxIndexSegment {
+		t.Fatalf("next block mismatch: have %d, want %d", next, 2*freezerTxIndexSegment)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Fatalf("leftover files not removed: have %d files, want 2", len(files))
+	}
+	check(idx, first, true)
+	check(idx, second, true)
+
+	// Truncating into the second segment drops it
+	if err := idx.truncate(2*freezerTxIndexSegment - 1); err != nil {
+		t.Fatalf("failed to truncate index: %v", err)
+	}
+	check(idx, first, true)
+	check(idx, second, false)
+
+	// Lookups are limited to the blocks below the given limit
+	if _, err := idx.lookup(first[1].hash[:], first[1].number); err == nil {
+		t.Fatalf("transaction above the limit found")
+	}
+	if _, err := idx.lookup(first[1].hash[:], first[1].number+1); err != nil {
+		t.Fatalf("transaction below the limit not found: %v", err)
+	}
+	idx.close()
+}
+
+// Tests that the freezer seals the transaction index of fully frozen segments
+// and serves the transaction lookups from it.
+func TestFreezerTxIndexLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "freezer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := newFreezer(dir, "", false)
+	if err != nil {
+		t.Fatalf("failed to open freezer: %v", err)
+	}
+	defer f.Close()
+
+	var (
+		txs   = make(map[common.Hash]uint64)
+		empty = common.FromHex("c2c0c0")
+	)
+	for number := uint64(0); number < freezerTxIndexSegment+10; number++ {
+		body := empty
+		if number%1000 == 1 || number == freezerTxIndexSegment+5 {
+			tx := types.NewTransaction(number, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+			body, _ = rlp.EncodeToBytes(&types.Body{Transactions: types.Transactions{tx}})
+			txs[tx.Hash()] = number
+		}
+		if err := f.AppendAncient(number, common.Hash{}.Bytes(), nil, body, nil, nil); err != nil {
+			t.Fatalf("failed to append block %d: %v", number, err)
+		}
+	}
+	f.indexTransactions()
+
+	// Without unindexed blocks, the frozen index is not consulted
+	db := &freezerdb{KeyValueStore: NewMemoryDatabase(), AncientStore: f}
+	for hash := range txs {
+		if number := ReadTxLookupEntry(db, hash); number != nil {
+			t.Fatalf("transaction %x looked up without unindexed blocks", hash)
+		}
+	}
+	// Only the frozen transactions below the index tail are served
+	WriteTxIndexTail(db, 5000)
+	for hash, want := range txs {
+		if number := ReadTxLookupEntry(db, hash); (number != nil) != (want < 5000) {
+			t.Fatalf("lookup mismatch for %x below the tail: have %v, want %d", hash, number, want)
+		}
+	}
+	WriteTxIndexTail(db, freezerTxIndexSegment+10)
+	for hash, want := range txs {
+		number := ReadTxLookupEntry(db, hash)
+		if want >= freezerTxIndexSegment {
+			if number != nil {
+				t.Fatalf("transaction of unsealed segment indexed")
+			}
+			continue
+		}
+		if number == nil || *number != want {
+			t.Fatalf("lookup mismatch for %x: have %v, want %d", hash, number, want)
+		}
+	}
+}
@@ -41,6 +41,9 @@ var (
 	// headFastBlockKey tracks the latest known incomplete block's hash during fast sync.
 	headFastBlockKey = []byte("LastFast")
 
+	// headFinalizedBlockKey tracks the latest block finalized by a Syscoin chainlock.
+	headFinalizedBlockKey = []byte("LastFinalized")
+
 	// lastPivotKey tracks the last pivot block used by fast sync (to reenable on sethead).
 	lastPivotKey = []byte("LastPivot")
 
@@ -77,6 +80,18 @@ var (
 	// uncleanShutdownKey tracks the list of local crashes
 	uncleanShutdownKey = []byte("unclean-shutdown") // config prefix for the db
 
+	// stateSchemeKey tracks the storage scheme of the trie nodes.
+	stateSchemeKey = []byte("TrieScheme")
+
+	// reverseDiffHeadKey tracks the id of the latest reverse diff of the path based trie nodes.
+	reverseDiffHeadKey = []byte("LastReverseDiff")
+
+	// stateHistoryTailKey tracks the oldest block number with flat state history.
+	stateHistoryTailKey = []byte("StateHistoryTail")
+
+	// databaseStatsKey tracks the estimated size of each category of stored data.
+	databaseStatsKey = []byte("DatabaseStats")
+
 	// Data item prefixes (use single byte to avoid mixing data types, avoid `i`, used for indexes).
 	headerPrefix       = []byte("h") // headerPrefix + num (uint64 big endian) + hash -> header
 	headerTDSuffix     = []byte("t") // headerPrefix + num (uint64 big endian) + hash + headerTDSuffix -> td
@@ -91,6 +106,14 @@ var (
 	SnapshotAccountPrefix = []byte("a") // SnapshotAccountPrefix + account hash -> account trie value
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hexPath -> account trie node (path scheme)
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + account hash + hexPath -> storage trie node (path scheme)
+	binaryTrieNodePrefix  = []byte("X") // binaryTrieNodePrefix + hash -> binary trie node
+	reverseDiffPrefix     = []byte("R") // reverseDiffPrefix + id (uint64 big endian) -> reverse diff of path based trie nodes
+	reverseDiffRootPrefix = []byte("K") // reverseDiffRootPrefix + state root -> reverse diff id
+	stateHistoryPrefix    = []byte("Sh") // stateHistoryPrefix + num (uint64 big endian) + hash -> flat state diff of the block
+	accountHistoryPrefix  = []byte("Sa") // accountHistoryPrefix + account hash + num (uint64 big endian) -> empty, account changed in block
+	storageHistoryPrefix  = []byte("So") // storageHistoryPrefix + account hash + storage hash + num (uint64 big endian) -> empty, slot changed in block
 	nevmToSysPrefix       = []byte("x") // nevmToSysPrefix + nevm block hash -> nevmBlock
 	sysToNEVMPrefix       = []byte("y") // sysToNEVMPrefix + sys block hash -> nevm block hash
 	blockNumToSysKeyPrefix= []byte("z") // blockNumToSysKeyPrefix + block number -> SYS block hash
@@ -232,6 +255,46 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// accountTrieNodeKey = TrieNodeAccountPrefix + hexPath
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + accountHash + hexPath
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, accountHash.Bytes()...), path...)
+}
+
+// binaryTrieNodeKey = binaryTrieNodePrefix + hash
+func binaryTrieNodeKey(hash common.Hash) []byte {
+	return append(binaryTrieNodePrefix, hash.Bytes()...)
+}
+
+// reverseDiffKey = reverseDiffPrefix + id (uint64 big endian)
+func reverseDiffKey(id uint64) []byte {
+	return append(reverseDiffPrefix, encodeBlockNumber(id)...)
+}
+
+// reverseDiffRootKey = reverseDiffRootPrefix + root
+func reverseDiffRootKey(root common.Hash) []byte {
+	return append(reverseDiffRootPrefix, root.Bytes()...)
+}
+
+// stateHistoryKey = stateHistoryPrefix + num (uint64 big endian) + hash
+func stateHistoryKey(number uint64, hash common.Hash) []byte {
+	return append(append(stateHistoryPrefix, encodeBlockNumber(number)...), hash.Bytes()...)
+}
+
+// accountHistoryKey = accountHistoryPrefix + account hash + num (uint64 big endian)
+func accountHistoryKey(accountHash common.Hash, number uint64) []byte {
+	return append(append(accountHistoryPrefix, accountHash.Bytes()...), encodeBlockNumber(number)...)
+}
+
+// storageHistoryKey = storageHistoryPrefix + account hash + storage hash + num (uint64 big endian)
+func storageHistoryKey(accountHash, storageHash common.Hash, number uint64) []byte {
+	return append(append(append(storageHistoryPrefix, accountHash.Bytes()...), storageHash.Bytes()...), encodeBlockNumber(number)...)
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
@@ -80,6 +80,12 @@ func (t *table) AncientSize(kind string) (uint64, error) {
 	return t.db.AncientSize(kind)
 }
 
+// AncientTxLookup is a noop passthrough that just forwards the request to the
+// underlying database.
+func (t *table) AncientTxLookup(hash []byte, limit uint64) (uint64, error) {
+	return t.db.AncientTxLookup(hash, limit)
+}
+
 // AppendAncient is a noop passthrough that just forwards the request to the underlying
 // database.
 func (t *table) AppendAncient(number uint64, hash, header, body, receipts, td []byte) error {
@@ -162,6 +168,17 @@ func (t *table) Compact(start []byte, limit []byte) error {
 	return t.db.Compact(start, limit)
 }
 
+// NewSnapshot creates a database snapshot based on the current state.
+// The created snapshot will not be affected by all following mutations
+// happened on the database.
+func (t *table) NewSnapshot() (ethdb.Snapshot, error) {
+	snap, err := t.db.NewSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &tableSnapshot{snap: snap, prefix: t.prefix}, nil
+}
+
 // NewBatch creates a write-only database that buffers changes to its host db
 // until a final write is called, each operation prefixing all keys with the
 // pre-configured string.
@@ -225,6 +242,39 @@ func (b *tableBatch) Replay(w ethdb.KeyValueWriter) error {
 	return b.batch.Replay(&tableReplayer{w: w, prefix: b.prefix})
 }
 
+// tableSnapshot is a wrapper around a database snapshot that prefixes each key
+// access with a pre-configured string.
+type tableSnapshot struct {
+	snap   ethdb.Snapshot
+	prefix string
+}
+
+// Has retrieves if a prefixed version of a key is present in the snapshot.
+func (snap *tableSnapshot) Has(key []byte) (bool, error) {
+	return snap.snap.Has(append([]byte(snap.prefix), key...))
+}
+
+// Get retrieves the given prefixed key if it's present in the snapshot.
+func (snap *tableSnapshot) Get(key []byte) ([]byte, error) {
+	return snap.snap.Get(append([]byte(snap.prefix), key...))
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset of the
+// snapshot content with a particular key prefix, starting at a particular
+// initial key (or after, if it does not exist).
+func (snap *tableSnapshot) NewIterator(prefix []byte, start []byte) ethdb.Iterator {
+	return &tableIterator{
+		iter:   snap.snap.NewIterator(append([]byte(snap.prefix), prefix...), start),
+		prefix: snap.prefix,
+	}
+}
+
+// Release releases associated resources. Release should always succeed and can
+// be called multiple times without causing error.
+func (snap *tableSnapshot) Release() {
+	snap.snap.Release()
+}
+
 // tableIterator is a wrapper around a database iterator that prefixes each key access
 // with a pre-configured string.
 type tableIterator struct {
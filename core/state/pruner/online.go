@@ -0,0 +1,388 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// onlineBloomFilePrefix is the filename prefix of the state bloom filter of
+	// an online pruning, distinguishing it from the one of an offline pruning.
+	onlineBloomFilePrefix = "onlinebloom"
+
+	// onlinePruneDepth is the number of blocks the chain has to progress after
+	// the pruning started tracking flushed nodes before a target is picked. It
+	// matches the number of snapshot diff layers, so that every node of the
+	// states above the target is either part of the target or tracked.
+	onlinePruneDepth = 128
+
+	// onlinePruneBatch is the number of stale trie nodes deleted at once.
+	onlinePruneBatch = 1024
+
+	// onlinePruneThrottle is the default pause between two deletion batches.
+	onlinePruneThrottle = 50 * time.Millisecond
+)
+
+// errPruneStopped is returned if the online pruner is stopped mid-round.
+var errPruneStopped = errors.New("pruning stopped")
+
+// OnlineChain defines the blockchain methods needed by the online pruner.
+type OnlineChain interface {
+	// CurrentBlock retrieves the current head block of the canonical chain.
+	CurrentBlock() *types.Block
+
+	// GetHeaderByNumber retrieves a block header from the database by number.
+	GetHeaderByNumber(number uint64) *types.Header
+
+	// StateCache returns the caching database underpinning the blockchain.
+	StateCache() state.Database
+
+	// Snapshots returns the blockchain snapshot tree.
+	Snapshots() *snapshot.Tree
+}
+
+// OnlineConfig contains the settings of the online pruner.
+type OnlineConfig struct {
+	Interval  time.Duration // Time between the start of two pruning rounds
+	BloomSize uint64        // Megabytes of memory allocated to the state bloom
+	Throttle  time.Duration // Pause between two deletion batches
+}
+
+// OnlinePruner deletes stale state while the node is running, with the help of
+// the snapshot. The workflow of a pruning round is:
+//
+// - start tracking all trie nodes flushed to disk in the state bloom
+// - wait until the chain progressed enough for the snapshot disk layer to be
+//   newer than the start of the tracking
+// - pin the disk layer with a database snapshot, iterate it, mark the relevant
+//   state in the state bloom and persist the nodes missing from disk
+// - iterate the database, delete in throttled batches all trie nodes which are
+//   neither marked nor tracked
+//
+// Every state from the target up is either part of the target state or was
+// flushed after the tracking started, so it's never touched by the deletion.
+// The deletions are serialized with the node flushes of the trie database to
+// avoid deleting nodes written concurrently.
+//
+// The state bloom is committed to disk before deleting anything. If the node
+// crashes midway, RecoverPruning finishes the pruning offline on the next start,
+// rewinding the chain to the target state which was fully persisted.
+type OnlinePruner struct {
+	chain   OnlineChain
+	db      ethdb.Database
+	datadir string
+	config  OnlineConfig
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewOnlinePruner creates the online pruner instance.
+func NewOnlinePruner(chain OnlineChain, db ethdb.Database, datadir string, config OnlineConfig) *OnlinePruner {
+	// Sanitize the bloom filter size if it's too small.
+	if config.BloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", config.BloomSize, "updated(MB)", 256)
+		config.BloomSize = 256
+	}
+	if config.Throttle <= 0 {
+		config.Throttle = onlinePruneThrottle
+	}
+	return &OnlinePruner{
+		chain:   chain,
+		db:      db,
+		datadir: datadir,
+		config:  config,
+		quit:    make(chan struct{}),
+	}
+}
+
+// Start launches the background pruning loop.
+func (p *OnlinePruner) Start() {
+	p.wg.Add(1)
+	go p.loop()
+}
+
+// Stop terminates the background pruning loop, waiting for the marking of the
+// target state to finish if it's running. An interrupted round is discarded, the
+// nodes deleted until then were all stale.
+func (p *OnlinePruner) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// loop runs a pruning round at every configured interval.
+func (p *OnlinePruner) loop() {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(p.config.Interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			if err := p.Prune(); err != nil && err != errPruneStopped {
+				log.Warn("Online state pruning failed", "err", err)
+			}
+			timer.Reset(p.config.Interval)
+		case <-p.quit:
+			return
+		}
+	}
+}
+
+// Prune runs a single online pruning round, blocking until it's done.
+func (p *OnlinePruner) Prune() error {
+	snaptree := p.chain.Snapshots()
+	if snaptree == nil {
+		return errors.New("snapshot not available")
+	}
+	triedb := p.chain.StateCache().TrieDB()
+
+	stateBloom, err := newStateBloomWithSize(p.config.BloomSize)
+	if err != nil {
+		return err
+	}
+	// Track the nodes flushed from now on, then wait for the snapshot layers
+	// to be fully replaced by newer ones.
+	triedb.SetPruneMarker(func(hash common.Hash) { stateBloom.Put(hash.Bytes(), nil) })
+	defer triedb.SetPruneMarker(nil)
+
+	start := p.chain.CurrentBlock().NumberU64()
+	log.Info("Started online state pruning", "number", start)
+	if err := p.waitChain(start + onlinePruneDepth); err != nil {
+		return err
+	}
+	// Pin the disk layer as the target. The pinned view is a database snapshot,
+	// so the diff layers keep being flattened while the target is marked.
+	root, view, number, err := p.pinTarget(snaptree, start)
+	if err != nil {
+		return err
+	}
+	log.Info("Selecting snapshot disk layer as the online pruning target", "root", root, "height", number)
+
+	// Traverse the target state, marking it in the bloom filter and persisting
+	// its nodes, so that it is complete on disk if the pruning has to be recovered.
+	marker := &markWriter{bloom: stateBloom, db: p.db, batch: p.db.NewBatch()}
+	mstart := time.Now()
+	err = snapshot.GenerateDiskTrie(view, root, p.db, marker)
+	view.Release()
+	if err != nil {
+		return err
+	}
+	if err := marker.flush(); err != nil {
+		return err
+	}
+	if err := extractGenesis(p.db, stateBloom); err != nil {
+		return err
+	}
+	log.Info("Marked online pruning target", "root", root, "persisted", marker.persisted, "elapsed", common.PrettyDuration(time.Since(mstart)))
+
+	filterName := onlineBloomFilterName(p.datadir, root)
+	if err := stateBloom.Commit(filterName, filterName+stateBloomFileTempSuffix); err != nil {
+		return err
+	}
+	if err := p.deleteStale(stateBloom, mstart); err != nil {
+		// All deleted nodes were stale, so there's nothing to recover
+		os.RemoveAll(filterName)
+		return err
+	}
+	// Deleting the state bloom marks the end of the pruning, there's nothing
+	// left to recover from this point.
+	os.RemoveAll(filterName)
+	return nil
+}
+
+// waitChain blocks until the chain reaches the given block number.
+func (p *OnlinePruner) waitChain(number uint64) error {
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	for p.chain.CurrentBlock().NumberU64() < number {
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return errPruneStopped
+		}
+	}
+	return nil
+}
+
+// pinTarget pins the snapshot disk layer once it moved past the given block,
+// from which on the flushed nodes are tracked. It returns the root and number
+// of the pinned state along with the view of the disk layer, which has to be
+// released by the caller.
+func (p *OnlinePruner) pinTarget(snaptree *snapshot.Tree, start uint64) (common.Hash, ethdb.Snapshot, uint64, error) {
+	ticker := time.NewTicker(3 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		root, view, err := snaptree.PinDisk()
+		if err != nil {
+			return common.Hash{}, nil, 0, err
+		}
+		// Only accept the disk layer if it's the state of a block since the start
+		head := p.chain.CurrentBlock().NumberU64()
+		for number := start; number <= head; number++ {
+			header := p.chain.GetHeaderByNumber(number)
+			if header == nil {
+				break
+			}
+			if header.Root == root {
+				return root, view, number, nil
+			}
+		}
+		view.Release()
+
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return common.Hash{}, nil, 0, errPruneStopped
+		}
+	}
+}
+
+// deleteStale iterates the database and deletes in throttled batches all trie
+// nodes which are neither part of the target state nor flushed since the start
+// of the round.
+func (p *OnlinePruner) deleteStale(stateBloom *stateBloom, start time.Time) error {
+	var (
+		count   int
+		pstart  = time.Now()
+		logged  = time.Now()
+		triedb  = p.chain.StateCache().TrieDB()
+		iter    = p.db.NewIterator(nil, nil)
+		pending = make([]common.Hash, 0, onlinePruneBatch)
+	)
+	keep := func(hash common.Hash) bool {
+		ok, _ := stateBloom.Contain(hash.Bytes())
+		return ok
+	}
+	defer func() { iter.Release() }()
+
+	for iter.Next() {
+		// Only trie nodes are pruned, contract codes are left untouched as
+		// they're written outside of the trie database.
+		key := iter.Key()
+		if len(key) != common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key)
+		if keep(hash) {
+			continue
+		}
+		pending = append(pending, hash)
+		if len(pending) < onlinePruneBatch {
+			continue
+		}
+		deleted, err := triedb.DeleteNodes(pending, keep)
+		if err != nil {
+			return err
+		}
+		count += deleted
+		pending = pending[:0]
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data online", "nodes", count, "elapsed", common.PrettyDuration(time.Since(pstart)))
+			logged = time.Now()
+		}
+		// Recreate the iterator after every batch in order to allow the underlying
+		// compactor to delete the entries, yielding to the live node meanwhile.
+		iter.Release()
+		select {
+		case <-time.After(p.config.Throttle):
+		case <-p.quit:
+			return errPruneStopped
+		}
+		iter = p.db.NewIterator(nil, key)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		deleted, err := triedb.DeleteNodes(pending, keep)
+		if err != nil {
+			return err
+		}
+		count += deleted
+	}
+	log.Info("Pruned state data online", "nodes", count, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// markWriter is a key-value writer marking the nodes of a generated state in the
+// state bloom, persisting the ones missing from disk.
+type markWriter struct {
+	bloom     *stateBloom
+	db        ethdb.KeyValueStore
+	batch     ethdb.Batch
+	persisted int
+	lock      sync.Mutex
+}
+
+// Put marks the entry, persisting trie nodes missing from the database. Contract
+// codes are read from the database, so they are already present.
+func (w *markWriter) Put(key []byte, value []byte) error {
+	if err := w.bloom.Put(key, value); err != nil {
+		return err
+	}
+	if len(key) != common.HashLength {
+		return nil
+	}
+	if ok, _ := w.db.Has(key); ok {
+		return nil
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.persisted++
+	if err := w.batch.Put(key, value); err != nil {
+		return err
+	}
+	if w.batch.ValueSize() >= ethdb.IdealBatchSize {
+		if err := w.batch.Write(); err != nil {
+			return err
+		}
+		w.batch.Reset()
+	}
+	return nil
+}
+
+// Delete implements the KeyValueWriter interface, deletions are never generated.
+func (w *markWriter) Delete(key []byte) error { panic("not supported") }
+
+// flush writes out the pending persisted nodes.
+func (w *markWriter) flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := w.batch.Write(); err != nil {
+		return err
+	}
+	w.batch.Reset()
+	return nil
+}
@@ -86,6 +86,13 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	// Path based state doesn't accumulate stale nodes, there's nothing to prune
+	switch rawdb.ReadStateScheme(db) {
+	case rawdb.PathScheme:
+		return nil, errors.New("state pruning is not supported by the path state scheme")
+	case rawdb.BinaryScheme:
+		return nil, errors.New("state pruning is not supported by the binary trie")
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("Failed to load head block")
@@ -189,15 +196,20 @@ func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, sta
 	// Pruning is done, now drop the "useless" layers from the snapshot.
 	// Firstly, flushing the target layer into the disk. After that all
 	// diff layers below the target will all be merged into the disk.
-	if err := snaptree.Cap(root, 0); err != nil {
-		return err
-	}
-	// Secondly, flushing the snapshot journal into the disk. All diff
-	// layers upon are dropped silently. Eventually the entire snapshot
-	// tree is converted into a single disk layer with the pruning target
-	// as the root.
-	if _, err := snaptree.Journal(root); err != nil {
-		return err
+	//
+	// If no snapshot is available for the target (recovered online pruning),
+	// it's regenerated by the chain when rewinding to the target instead.
+	if snaptree != nil {
+		if err := snaptree.Cap(root, 0); err != nil {
+			return err
+		}
+		// Secondly, flushing the snapshot journal into the disk. All diff
+		// layers upon are dropped silently. Eventually the entire snapshot
+		// tree is converted into a single disk layer with the pruning target
+		// as the root.
+		if _, err := snaptree.Journal(root); err != nil {
+			return err
+		}
 	}
 	// Delete the state bloom, it marks the entire pruning procedure is
 	// finished. If any crashes or manual exit happens before this,
@@ -237,7 +249,7 @@ func (p *Pruner) Prune(root common.Hash) error {
 	// reuse it for pruning instead of generating a new one. It's
 	// mandatory because a part of state may already be deleted,
 	// the recovery procedure is necessary.
-	_, stateBloomRoot, err := findBloomFilter(p.datadir)
+	_, stateBloomRoot, err := findBloomFilter(p.datadir, stateBloomFilePrefix)
 	if err != nil {
 		return err
 	}
@@ -344,7 +356,12 @@ func (p *Pruner) Prune(root common.Hash) error {
 // pruning **has to be resumed**. Otherwise a lot of dangling nodes may be left
 // in the disk.
 func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) error {
-	stateBloomPath, stateBloomRoot, err := findBloomFilter(datadir)
+	// An interrupted online pruning is finished first, it's unrelated to
+	// the offline one.
+	if err := recoverOnlinePruning(datadir, db, trieCachePath); err != nil {
+		return err
+	}
+	stateBloomPath, stateBloomRoot, err := findBloomFilter(datadir, stateBloomFilePrefix)
 	if err != nil {
 		return err
 	}
@@ -400,6 +417,58 @@ func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) err
 	return prune(snaptree, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now())
 }
 
+// recoverOnlinePruning finishes an online pruning interrupted by a crash. The
+// nodes flushed while it was running are not contained in the committed state
+// bloom, so the pruning is finished like an offline one: all the canonical state
+// roots above the target are forcibly deleted and the chain is rewound to the
+// target, which was fully persisted before the deletion started.
+func recoverOnlinePruning(datadir string, db ethdb.Database, trieCachePath string) error {
+	stateBloomPath, stateBloomRoot, err := findBloomFilter(datadir, onlineBloomFilePrefix)
+	if err != nil {
+		return err
+	}
+	if stateBloomPath == "" {
+		return nil // nothing to recover
+	}
+	headBlock := rawdb.ReadHeadBlock(db)
+	if headBlock == nil {
+		return errors.New("Failed to load head block")
+	}
+	stateBloom, err := NewStateBloomFromDisk(stateBloomPath)
+	if err != nil {
+		return err
+	}
+	log.Info("Loaded online state bloom filter", "path", stateBloomPath)
+
+	// Before start the pruning, delete the clean trie cache first, it might
+	// contain the deleted state roots.
+	deleteCleanTrieCache(trieCachePath)
+
+	var (
+		found       bool
+		middleRoots = make(map[common.Hash]struct{})
+	)
+	for number := headBlock.NumberU64(); ; number-- {
+		header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, number), number)
+		if header == nil {
+			break
+		}
+		if header.Root == stateBloomRoot {
+			found = true
+			break
+		}
+		middleRoots[header.Root] = struct{}{}
+		if number == 0 {
+			break
+		}
+	}
+	if !found {
+		log.Error("Online pruning target state is not canonical", "root", stateBloomRoot)
+		return errors.New("non-existent target state")
+	}
+	return prune(nil, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now())
+}
+
 // extractGenesis loads the genesis state and commits all the state entries
 // into the given bloomfilter.
 func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
@@ -458,22 +527,26 @@ func bloomFilterName(datadir string, hash common.Hash) string {
 	return filepath.Join(datadir, fmt.Sprintf("%s.%s.%s", stateBloomFilePrefix, hash.Hex(), stateBloomFileSuffix))
 }
 
-func isBloomFilter(filename string) (bool, common.Hash) {
+func onlineBloomFilterName(datadir string, hash common.Hash) string {
+	return filepath.Join(datadir, fmt.Sprintf("%s.%s.%s", onlineBloomFilePrefix, hash.Hex(), stateBloomFileSuffix))
+}
+
+func isBloomFilter(prefix string, filename string) (bool, common.Hash) {
 	filename = filepath.Base(filename)
-	if strings.HasPrefix(filename, stateBloomFilePrefix) && strings.HasSuffix(filename, stateBloomFileSuffix) {
-		return true, common.HexToHash(filename[len(stateBloomFilePrefix)+1 : len(filename)-len(stateBloomFileSuffix)-1])
+	if strings.HasPrefix(filename, prefix+".") && strings.HasSuffix(filename, stateBloomFileSuffix) {
+		return true, common.HexToHash(filename[len(prefix)+1 : len(filename)-len(stateBloomFileSuffix)-1])
 	}
 	return false, common.Hash{}
 }
 
-func findBloomFilter(datadir string) (string, common.Hash, error) {
+func findBloomFilter(datadir string, prefix string) (string, common.Hash, error) {
 	var (
 		stateBloomPath string
 		stateBloomRoot common.Hash
 	)
 	if err := filepath.Walk(datadir, func(path string, info os.FileInfo, err error) error {
 		if info != nil && !info.IsDir() {
-			ok, root := isBloomFilter(path)
+			ok, root := isBloomFilter(prefix, path)
 			if ok {
 				stateBloomPath = path
 				stateBloomRoot = root
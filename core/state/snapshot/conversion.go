@@ -71,6 +71,26 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 	}
 	defer acctIt.Release()
 
+	return generateTrie(root, acctIt, func(account common.Hash) (StorageIterator, error) {
+		return snaptree.StorageIterator(root, account, common.Hash{})
+	}, src, dst)
+}
+
+// GenerateDiskTrie is like GenerateTrie, but traverses a disk layer pinned by
+// Tree.PinDisk instead of the live snapshot tree.
+func GenerateDiskTrie(view ethdb.Snapshot, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter) error {
+	acctIt := &diskAccountIterator{it: view.NewIterator(rawdb.SnapshotAccountPrefix, nil)}
+	defer acctIt.Release()
+
+	return generateTrie(root, acctIt, func(account common.Hash) (StorageIterator, error) {
+		prefix := append(append([]byte{}, rawdb.SnapshotStoragePrefix...), account.Bytes()...)
+		return &diskStorageIterator{account: account, it: view.NewIterator(prefix, nil)}, nil
+	}, src, dst)
+}
+
+// generateTrie regenerates the whole state from the given account iterator and
+// the storage iterators opened along the way, checking the resulting root.
+func generateTrie(root common.Hash, acctIt AccountIterator, storageIter func(account common.Hash) (StorageIterator, error), src ethdb.Database, dst ethdb.KeyValueWriter) error {
 	got, err := generateTrieRoot(dst, acctIt, common.Hash{}, stackTrieGenerate, func(dst ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
 		// Migrate the code first, commit the contract code into the tmp db.
 		if codeHash != emptyCode {
@@ -81,7 +101,7 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 			rawdb.WriteCode(dst, codeHash, code)
 		}
 		// Then migrate all storage trie nodes into the tmp db.
-		storageIt, err := snaptree.StorageIterator(root, accountHash, common.Hash{})
+		storageIt, err := storageIter(accountHash)
 		if err != nil {
 			return common.Hash{}, err
 		}
@@ -373,3 +393,13 @@ func stackTrieGenerate(db ethdb.KeyValueWriter, in chan trieKV, out chan common.
 	}
 	out <- root
 }
+
+// binaryTrieGenerate computes the root of the binary trie holding the leaves.
+// The whole trie is built in memory and the nodes are never written to db.
+func binaryTrieGenerate(db ethdb.KeyValueWriter, in chan trieKV, out chan common.Hash) {
+	t, _ := trie.NewBinary(common.Hash{}, nil)
+	for leaf := range in {
+		t.TryUpdateHashed(leaf.key, leaf.value)
+	}
+	out <- t.Hash()
+}
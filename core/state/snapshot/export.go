@@ -0,0 +1,507 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// The export format is a header, followed by a stream of records and closed by
+// a sha256 digest of all the preceding bytes:
+//
+//	header:  magic (4 bytes) | version (uint32) | state root (32 bytes)
+//	head:    0x04 | length (uvarint) | RLP of the head block and total difficulty
+//	code:    0x03 | length (uvarint) | code
+//	account: 0x01 | account hash (32 bytes) | length (uvarint) | slim account RLP
+//	storage: 0x02 | slot hash (32 bytes) | length (uvarint) | slot value
+//	mapping: 0x05 | key length (uvarint) | key | length (uvarint) | value
+//	end:     0x00 | accounts (uvarint) | slots (uvarint) | mappings (uvarint) | digest (32 bytes)
+//
+// The optional head record comes first. Accounts are ordered by hash, each one
+// followed by its storage slots ordered by hash. Contract codes are written once,
+// before the first account using them. The raw NEVM block mapping entries follow
+// the state.
+const (
+	exportVersion = 1
+
+	exportEnd     = 0x00
+	exportAccount = 0x01
+	exportStorage = 0x02
+	exportCode    = 0x03
+	exportHead    = 0x04
+	exportMapping = 0x05
+)
+
+// exportMagic is the marker heading the exported flat state.
+var exportMagic = []byte("GSNP")
+
+// ExportHead is the block whose state is exported, carried along so that the
+// import can set it as the chain head.
+type ExportHead struct {
+	Block *types.Block
+	TD    *big.Int
+}
+
+// Export writes the flat state of the snapshot with the given root into w in a
+// portable binary format, which can be imported into another database. The head
+// block, if given, must be the one with the exported state root. The NEVM block
+// mappings of the database are exported along with the state.
+func Export(snaptree *Tree, root common.Hash, head *ExportHead, db ethdb.KeyValueStore, w io.Writer) error {
+	if head != nil && head.Block.Root() != root {
+		return fmt.Errorf("head block %x has state root %x, want %x", head.Block.Hash(), head.Block.Root(), root)
+	}
+	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
+	if err != nil {
+		return err // The required snapshot might not exist.
+	}
+	defer acctIt.Release()
+
+	var (
+		buf    = bufio.NewWriter(w)
+		hasher = sha256.New()
+		out    = io.MultiWriter(buf, hasher)
+		codes  = make(map[common.Hash]struct{})
+		start  = time.Now()
+		logged = time.Now()
+
+		accounts, slots, mappings uint64
+	)
+	header := make([]byte, len(exportMagic)+4)
+	copy(header, exportMagic)
+	binary.BigEndian.PutUint32(header[len(exportMagic):], exportVersion)
+	if _, err := out.Write(append(header, root.Bytes()...)); err != nil {
+		return err
+	}
+	if head != nil {
+		blob, err := rlp.EncodeToBytes(head)
+		if err != nil {
+			return err
+		}
+		if err := writeExportRecord(out, exportHead, nil, blob); err != nil {
+			return err
+		}
+	}
+	for acctIt.Next() {
+		account, err := FullAccount(acctIt.Account())
+		if err != nil {
+			return err
+		}
+		if codeHash := common.BytesToHash(account.CodeHash); codeHash != emptyCode {
+			if _, ok := codes[codeHash]; !ok {
+				code := rawdb.ReadCode(db, codeHash)
+				if len(code) == 0 {
+					return fmt.Errorf("missing code %x of account %x", codeHash, acctIt.Hash())
+				}
+				if err := writeExportRecord(out, exportCode, nil, code); err != nil {
+					return err
+				}
+				codes[codeHash] = struct{}{}
+			}
+		}
+		if err := writeExportRecord(out, exportAccount, acctIt.Hash().Bytes(), acctIt.Account()); err != nil {
+			return err
+		}
+		accounts++
+
+		if !bytes.Equal(account.Root, emptyRoot[:]) {
+			storageIt, err := snaptree.StorageIterator(root, acctIt.Hash(), common.Hash{})
+			if err != nil {
+				return err
+			}
+			for storageIt.Next() {
+				if err := writeExportRecord(out, exportStorage, storageIt.Hash().Bytes(), storageIt.Slot()); err != nil {
+					storageIt.Release()
+					return err
+				}
+				slots++
+			}
+			err = storageIt.Error()
+			storageIt.Release()
+			if err != nil {
+				return err
+			}
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Exporting snapshot", "at", acctIt.Hash(), "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := acctIt.Error(); err != nil {
+		return err
+	}
+	err = rawdb.IterateNEVMMappings(db, func(key, value []byte) error {
+		mappings++
+		return writeExportRecord(out, exportMapping, append(appendUvarint(nil, uint64(len(key))), key...), value)
+	})
+	if err != nil {
+		return err
+	}
+	trailer := []byte{exportEnd}
+	trailer = appendUvarint(trailer, accounts)
+	trailer = appendUvarint(trailer, slots)
+	trailer = appendUvarint(trailer, mappings)
+	if _, err := out.Write(trailer); err != nil {
+		return err
+	}
+	if _, err := buf.Write(hasher.Sum(nil)); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	log.Info("Exported snapshot", "root", root, "head", head != nil, "accounts", accounts, "slots", slots, "codes", len(codes), "mappings", mappings, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// writeExportRecord writes a single record of the export format.
+func writeExportRecord(w io.Writer, kind byte, key []byte, value []byte) error {
+	record := append([]byte{kind}, key...)
+	record = appendUvarint(record, uint64(len(value)))
+	if _, err := w.Write(record); err != nil {
+		return err
+	}
+	_, err := w.Write(value)
+	return err
+}
+
+// appendUvarint appends the uvarint encoding of the given number.
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// exportReader reads the export format, hashing everything read.
+type exportReader struct {
+	r *bufio.Reader
+	h hash.Hash
+}
+
+func (r *exportReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.h.Write(p[:n])
+	return n, err
+}
+
+func (r *exportReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+// readFull reads exactly n bytes.
+func (r *exportReader) readFull(n uint64) ([]byte, error) {
+	if n > 1<<30 {
+		return nil, fmt.Errorf("oversized record: %d bytes", n)
+	}
+	blob := make([]byte, n)
+	if _, err := io.ReadFull(r, blob); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
+
+// readValue reads a length prefixed value.
+func (r *exportReader) readValue() ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	return r.readFull(size)
+}
+
+// Import reads flat state written by Export from r, storing it into the database
+// as the snapshot of its root, together with the contract codes and the account
+// and storage tries rebuilt from it. The rebuilt state root, along with all the
+// storage roots, is verified against the exported one before the snapshot gets
+// activated. The database must not contain a snapshot yet and must be using the
+// hash based trie node storage scheme. A failed import may leave data behind, but
+// the snapshot is only activated once everything checked out.
+//
+// The exported NEVM block mappings are stored as they are, and if the export
+// carries a head block, it is written and set as the head of the chain, without
+// any of its ancestors. The genesis block must have been written beforehand, or
+// its setup on startup resets the head.
+func Import(db ethdb.KeyValueStore, r io.Reader) (common.Hash, error) {
+	if rawdb.ReadSnapshotRoot(db) != (common.Hash{}) {
+		return common.Hash{}, errors.New("database already contains a snapshot")
+	}
+	if scheme := rawdb.ReadStateScheme(db); scheme == rawdb.PathScheme {
+		return common.Hash{}, fmt.Errorf("snapshot import is not supported with the %s scheme", scheme)
+	}
+	in := &exportReader{r: bufio.NewReader(r), h: sha256.New()}
+
+	header, err := in.readFull(uint64(len(exportMagic)) + 4 + common.HashLength)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if !bytes.Equal(header[:len(exportMagic)], exportMagic) {
+		return common.Hash{}, errors.New("not a snapshot export")
+	}
+	if version := binary.BigEndian.Uint32(header[len(exportMagic):]); version != exportVersion {
+		return common.Hash{}, fmt.Errorf("unsupported export version %d", version)
+	}
+	root := common.BytesToHash(header[len(exportMagic)+4:])
+
+	var (
+		batch    = db.NewBatch()
+		acctTrie = trie.NewStackTrie(batch)
+		codes    = make(map[common.Hash]struct{})
+		start    = time.Now()
+		logged   = time.Now()
+
+		account     *Account    // Account whose storage slots are being imported
+		accountHash common.Hash // Hash of the account being imported
+		accountData []byte      // Slim RLP of the account being imported
+		storageTrie *trie.StackTrie
+		lastSlot    common.Hash
+
+		head *ExportHead // Head block of the exported state, if any
+
+		accounts, slots, mappings uint64
+	)
+	// finishAccount verifies the storage of the last imported account and inserts
+	// it into the account trie.
+	finishAccount := func() error {
+		if account == nil {
+			return nil
+		}
+		if !bytes.Equal(account.Root, emptyRoot[:]) {
+			if have, err := storageTrie.Commit(); err != nil {
+				return err
+			} else if have != common.BytesToHash(account.Root) {
+				return fmt.Errorf("storage root mismatch of account %x: have %x, want %x", accountHash, have, account.Root)
+			}
+		}
+		blob, err := FullAccountRLP(accountData)
+		if err != nil {
+			return err
+		}
+		acctTrie.Update(accountHash.Bytes(), blob)
+		account = nil
+		return nil
+	}
+	for {
+		kind, err := in.ReadByte()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if kind == exportEnd {
+			break
+		}
+		switch kind {
+		case exportHead:
+			if head != nil || accounts > 0 || len(codes) > 0 || mappings > 0 {
+				return common.Hash{}, errors.New("misplaced head block")
+			}
+			blob, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			head = new(ExportHead)
+			if err := rlp.DecodeBytes(blob, head); err != nil {
+				return common.Hash{}, fmt.Errorf("invalid head block: %v", err)
+			}
+			if err := verifyExportHead(head, root); err != nil {
+				return common.Hash{}, err
+			}
+
+		case exportCode:
+			code, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			codeHash := crypto.Keccak256Hash(code)
+			rawdb.WriteCode(batch, codeHash, code)
+			codes[codeHash] = struct{}{}
+
+		case exportAccount:
+			if err := finishAccount(); err != nil {
+				return common.Hash{}, err
+			}
+			key, err := in.readFull(common.HashLength)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			hash := common.BytesToHash(key)
+			if accounts > 0 && bytes.Compare(hash[:], accountHash[:]) <= 0 {
+				return common.Hash{}, fmt.Errorf("account %x out of order", hash)
+			}
+			data, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			full, err := FullAccount(data)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if codeHash := common.BytesToHash(full.CodeHash); codeHash != emptyCode {
+				if _, ok := codes[codeHash]; !ok && len(rawdb.ReadCode(db, codeHash)) == 0 {
+					return common.Hash{}, fmt.Errorf("missing code %x of account %x", codeHash, hash)
+				}
+			}
+			rawdb.WriteAccountSnapshot(batch, hash, data)
+			account, accountHash, accountData, lastSlot = &full, hash, data, common.Hash{}
+			storageTrie = trie.NewStackTrie(batch)
+			accounts++
+
+		case exportStorage:
+			if account == nil {
+				return common.Hash{}, errors.New("storage slot without account")
+			}
+			key, err := in.readFull(common.HashLength)
+			if err != nil {
+				return common.Hash{}, err
+			}
+			hash := common.BytesToHash(key)
+			if lastSlot != (common.Hash{}) && bytes.Compare(hash[:], lastSlot[:]) <= 0 {
+				return common.Hash{}, fmt.Errorf("storage slot %x of account %x out of order", hash, accountHash)
+			}
+			value, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			rawdb.WriteStorageSnapshot(batch, accountHash, hash, value)
+			storageTrie.Update(hash.Bytes(), value)
+			lastSlot = hash
+			slots++
+
+		case exportMapping:
+			if err := finishAccount(); err != nil {
+				return common.Hash{}, err
+			}
+			key, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			value, err := in.readValue()
+			if err != nil {
+				return common.Hash{}, err
+			}
+			if err := rawdb.WriteNEVMMappingEntry(batch, key, value); err != nil {
+				return common.Hash{}, err
+			}
+			mappings++
+
+		default:
+			return common.Hash{}, fmt.Errorf("unknown record type %d", kind)
+		}
+		if batch.ValueSize() > ethdb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return common.Hash{}, err
+			}
+			batch.Reset()
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Importing snapshot", "at", accountHash, "accounts", accounts, "slots", slots, "elapsed", common.PrettyDuration(time.Since(start)))
+			logged = time.Now()
+		}
+	}
+	if err := finishAccount(); err != nil {
+		return common.Hash{}, err
+	}
+	// Verify the trailer and the digest of the whole export
+	wantAccounts, err := binary.ReadUvarint(in)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	wantSlots, err := binary.ReadUvarint(in)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	wantMappings, err := binary.ReadUvarint(in)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if wantAccounts != accounts || wantSlots != slots || wantMappings != mappings {
+		return common.Hash{}, fmt.Errorf("item count mismatch: have %d accounts, %d slots and %d mappings, want %d, %d and %d", accounts, slots, mappings, wantAccounts, wantSlots, wantMappings)
+	}
+	digest := in.h.Sum(nil)
+	if have, err := in.r.Peek(sha256.Size); err != nil {
+		return common.Hash{}, err
+	} else if !bytes.Equal(have, digest) {
+		return common.Hash{}, errors.New("export checksum mismatch")
+	}
+	have, err := acctTrie.Commit()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if have != root {
+		return common.Hash{}, fmt.Errorf("state root mismatch: have %x, want %x", have, root)
+	}
+	// Everything verified, activate the imported snapshot and chain head
+	journalProgress(batch, nil, nil)
+	rawdb.WriteSnapshotRoot(batch, root)
+	rawdb.DeleteSnapshotDisabled(batch)
+	rawdb.DeleteSnapshotRecoveryNumber(batch)
+	if head != nil {
+		hash, number := head.Block.Hash(), head.Block.NumberU64()
+		rawdb.WriteTd(batch, hash, number, head.TD)
+		rawdb.WriteBlock(batch, head.Block)
+		rawdb.WriteCanonicalHash(batch, hash, number)
+		rawdb.WriteHeadHeaderHash(batch, hash)
+		rawdb.WriteHeadBlockHash(batch, hash)
+		rawdb.WriteHeadFastBlockHash(batch, hash)
+	}
+	if err := batch.Write(); err != nil {
+		return common.Hash{}, err
+	}
+	context := []interface{}{"root", root, "accounts", accounts, "slots", slots, "codes", len(codes), "mappings", mappings}
+	if head != nil {
+		context = append(context, "number", head.Block.NumberU64(), "hash", head.Block.Hash())
+	}
+	log.Info("Imported snapshot", append(context, "elapsed", common.PrettyDuration(time.Since(start)))...)
+	return root, nil
+}
+
+// verifyExportHead checks that the exported head block is consistent, with the
+// body matching its header, and holds the exported state root.
+func verifyExportHead(head *ExportHead, root common.Hash) error {
+	block := head.Block
+	if block.Root() != root {
+		return fmt.Errorf("head block %x has state root %x, want %x", block.Hash(), block.Root(), root)
+	}
+	if hash := types.DeriveSha(block.Transactions(), trie.NewStackTrie(nil)); hash != block.TxHash() {
+		return fmt.Errorf("head block transaction root mismatch: have %x, want %x", hash, block.TxHash())
+	}
+	if hash := types.CalcUncleHash(block.Uncles()); hash != block.UncleHash() {
+		return fmt.Errorf("head block uncle root mismatch: have %x, want %x", hash, block.UncleHash())
+	}
+	if head.TD == nil || head.TD.Cmp(block.Difficulty()) < 0 {
+		return fmt.Errorf("invalid head block total difficulty %v", head.TD)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package snapshot
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// Tests that a snapshot exported from one database can be imported into another,
+// rebuilding the same state trie along with the head block and the NEVM block
+// mappings, and that corrupted exports are rejected.
+func TestExportImport(t *testing.T) {
+	var (
+		helper = newHelper()
+		code   = []byte{0x60, 0x00, 0x60, 0x00, 0xf3}
+		stRoot = helper.makeStorageTrie([]string{"key-1", "key-2", "key-3"}, []string{"val-1", "val-2", "val-3"})
+	)
+	rawdb.WriteCode(helper.diskdb, crypto.Keccak256Hash(code), code)
+
+	helper.addAccount("acc-1", &Account{Balance: big.NewInt(1), Root: stRoot, CodeHash: crypto.Keccak256(code)})
+	helper.addAccount("acc-2", &Account{Balance: big.NewInt(2), Root: emptyRoot.Bytes(), CodeHash: emptyCode.Bytes()})
+	helper.addAccount("acc-3", &Account{Balance: big.NewInt(3), Root: stRoot, CodeHash: crypto.Keccak256(code)})
+	helper.addSnapStorage("acc-1", []string{"key-1", "key-2", "key-3"}, []string{"val-1", "val-2", "val-3"})
+	helper.addSnapStorage("acc-3", []string{"key-1", "key-2", "key-3"}, []string{"val-1", "val-2", "val-3"})
+
+	root, snap := helper.Generate()
+	select {
+	case <-snap.genPending:
+	case <-time.After(3 * time.Second):
+		t.Fatalf("Snapshot generation failed")
+	}
+	snaps := &Tree{layers: map[common.Hash]snapshot{root: snap}}
+
+	// Export the state along with the block holding it and its NEVM mapping, and
+	// a 32 byte trie node sharing the prefix of the mappings
+	head := &ExportHead{
+		Block: types.NewBlock(&types.Header{Number: big.NewInt(10), Difficulty: big.NewInt(2), Root: root}, nil, nil, nil, trie.NewStackTrie(nil)),
+		TD:    big.NewInt(21),
+	}
+	rawdb.WriteNEVMMappings(helper.diskdb, "sysblockhash", head.Block.Hash(), 10)
+	helper.diskdb.Put(append([]byte("x"), make([]byte, common.HashLength-1)...), []byte{0x1})
+
+	if err := Export(snaps, common.Hash{0x1}, head, helper.diskdb, new(bytes.Buffer)); err == nil {
+		t.Fatalf("Export with a mismatching head block succeeded")
+	}
+	var export bytes.Buffer
+	if err := Export(snaps, root, head, helper.diskdb, &export); err != nil {
+		t.Fatalf("Failed to export snapshot: %v", err)
+	}
+	// Import the snapshot into a fresh database and check the rebuilt state
+	db := rawdb.NewDatabase(memorydb.New())
+	have, err := Import(db, bytes.NewReader(export.Bytes()))
+	if err != nil {
+		t.Fatalf("Failed to import snapshot: %v", err)
+	}
+	if have != root {
+		t.Fatalf("Root mismatch: have %x, want %x", have, root)
+	}
+	if rawdb.ReadSnapshotRoot(db) != root {
+		t.Fatalf("Snapshot root not activated")
+	}
+	if !bytes.Equal(rawdb.ReadCode(db, crypto.Keccak256Hash(code)), code) {
+		t.Fatalf("Contract code not imported")
+	}
+	accTrie, err := trie.NewSecure(root, trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("Failed to open imported state trie: %v", err)
+	}
+	stTrie, err := trie.NewSecure(common.BytesToHash(stRoot), trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("Failed to open imported storage trie: %v", err)
+	}
+	if val, err := stTrie.TryGet([]byte("key-2")); err != nil || !bytes.Equal(val, []byte("val-2")) {
+		t.Fatalf("Storage slot mismatch: have %x, err %v", val, err)
+	}
+	if val, err := accTrie.TryGet([]byte("acc-2")); err != nil || len(val) == 0 {
+		t.Fatalf("Account missing from imported trie: err %v", err)
+	}
+	// Check the chain head and the NEVM block mappings
+	if block := rawdb.ReadHeadBlock(db); block == nil || block.Hash() != head.Block.Hash() {
+		t.Fatalf("Head block not imported: %v", block)
+	}
+	if hash := rawdb.ReadHeadHeaderHash(db); hash != head.Block.Hash() {
+		t.Fatalf("Head header mismatch: have %x, want %x", hash, head.Block.Hash())
+	}
+	if td := rawdb.ReadTd(db, head.Block.Hash(), 10); td == nil || td.Cmp(head.TD) != 0 {
+		t.Fatalf("Head total difficulty mismatch: have %v, want %v", td, head.TD)
+	}
+	if !rawdb.HasNEVMMapping(db, head.Block.Hash()) || rawdb.ReadSYSMapping(db, "sysblockhash") != head.Block.Hash() {
+		t.Fatalf("NEVM block mapping not imported")
+	}
+	if string(rawdb.ReadSYSHash(db, 10)) != "sysblockhash" || rawdb.ReadLatestNEVMMappingHash(db) != head.Block.Hash() {
+		t.Fatalf("NEVM block number mapping not imported")
+	}
+	if has, _ := db.Has(append([]byte("x"), make([]byte, common.HashLength-1)...)); has {
+		t.Fatalf("Trie node exported as a NEVM mapping")
+	}
+	// A second import on top of the existing snapshot must be refused
+	if _, err := Import(db, bytes.NewReader(export.Bytes())); err == nil {
+		t.Fatalf("Import over existing snapshot succeeded")
+	}
+	// Corrupt a byte in the middle of the export and ensure it's detected
+	corrupt := common.CopyBytes(export.Bytes())
+	corrupt[len(corrupt)/2] ^= 0xff
+	if _, err := Import(memorydb.New(), bytes.NewReader(corrupt)); err == nil {
+		t.Fatalf("Corrupted import succeeded")
+	}
+	// Truncated exports must also be rejected
+	if _, err := Import(memorydb.New(), bytes.NewReader(export.Bytes()[:export.Len()-1])); err == nil {
+		t.Fatalf("Truncated import succeeded")
+	}
+	// State exported without its block is imported without setting a head
+	export.Reset()
+	if err := Export(snaps, root, nil, helper.diskdb, &export); err != nil {
+		t.Fatalf("Failed to export snapshot without head: %v", err)
+	}
+	db = rawdb.NewDatabase(memorydb.New())
+	if _, err := Import(db, bytes.NewReader(export.Bytes())); err != nil {
+		t.Fatalf("Failed to import snapshot without head: %v", err)
+	}
+	if hash := rawdb.ReadHeadBlockHash(db); hash != (common.Hash{}) {
+		t.Fatalf("Head block set without one exported: %x", hash)
+	}
+}
@@ -248,7 +248,7 @@ func (result *proofResult) forEach(callback func(key []byte, val []byte) error)
 //
 // The proof result will be returned if the range proving is finished, otherwise
 // the error will be returned to abort the entire procedure.
-func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix []byte, kind string, origin []byte, max int, valueConvertFn func([]byte) ([]byte, error)) (*proofResult, error) {
+func (dl *diskLayer) proveRange(stats *generatorStats, owner common.Hash, root common.Hash, prefix []byte, kind string, origin []byte, max int, valueConvertFn func([]byte) ([]byte, error)) (*proofResult, error) {
 	var (
 		keys     [][]byte
 		vals     [][]byte
@@ -306,11 +306,21 @@ func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix
 
 	// The snap state is exhausted, pass the entire key/val set for verification
 	if origin == nil && !diskMore {
-		stackTr := trie.NewStackTrie(nil)
-		for i, key := range keys {
-			stackTr.TryUpdate(key, vals[i])
+		var gotRoot common.Hash
+		if dl.triedb.Scheme() == rawdb.BinaryScheme {
+			binTr, _ := trie.NewBinary(common.Hash{}, nil)
+			for i, key := range keys {
+				binTr.TryUpdateHashed(common.BytesToHash(key), vals[i])
+			}
+			gotRoot = binTr.Hash()
+		} else {
+			stackTr := trie.NewStackTrie(nil)
+			for i, key := range keys {
+				stackTr.TryUpdate(key, vals[i])
+			}
+			gotRoot = stackTr.Hash()
 		}
-		if gotRoot := stackTr.Hash(); gotRoot != root {
+		if gotRoot != root {
 			return &proofResult{
 				keys:     keys,
 				vals:     vals,
@@ -319,8 +329,17 @@ func (dl *diskLayer) proveRange(stats *generatorStats, root common.Hash, prefix
 		}
 		return &proofResult{keys: keys, vals: vals}, nil
 	}
+	// Binary tries have no range proofs, the chunk is checked against the trie
+	if dl.triedb.Scheme() == rawdb.BinaryScheme {
+		return &proofResult{
+			keys:     keys,
+			vals:     vals,
+			diskMore: diskMore,
+			proofErr: errors.New("binary trie range proofs are not supported"),
+		}, nil
+	}
 	// Snap state is chunked, generate edge proofs for verification.
-	tr, err := trie.New(root, dl.triedb)
+	tr, err := trie.NewWithOwner(owner, root, dl.triedb)
 	if err != nil {
 		stats.Log("Trie missing, state snapshotting paused", dl.root, dl.genMarker)
 		return nil, errMissingTrie
@@ -381,9 +400,9 @@ type onStateCallback func(key []byte, val []byte, write bool, delete bool) error
 // generateRange generates the state segment with particular prefix. Generation can
 // either verify the correctness of existing state through rangeproof and skip
 // generation, or iterate trie to regenerate state on demand.
-func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string, origin []byte, max int, stats *generatorStats, onState onStateCallback, valueConvertFn func([]byte) ([]byte, error)) (bool, []byte, error) {
+func (dl *diskLayer) generateRange(owner common.Hash, root common.Hash, prefix []byte, kind string, origin []byte, max int, stats *generatorStats, onState onStateCallback, valueConvertFn func([]byte) ([]byte, error)) (bool, []byte, error) {
 	// Use range prover to check the validity of the flat state in the range
-	result, err := dl.proveRange(stats, root, prefix, kind, origin, max, valueConvertFn)
+	result, err := dl.proveRange(stats, owner, root, prefix, kind, origin, max, valueConvertFn)
 	if err != nil {
 		return false, nil, err
 	}
@@ -429,7 +448,7 @@ func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string,
 	// We use the snap data to build up a cache which can be used by the
 	// main account trie as a primary lookup when resolving hashes
 	var snapNodeCache ethdb.KeyValueStore
-	if len(result.keys) > 0 {
+	if len(result.keys) > 0 && dl.triedb.Scheme() != rawdb.BinaryScheme {
 		snapNodeCache = memorydb.New()
 		snapTrieDb := trie.NewDatabase(snapNodeCache)
 		snapTrie, _ := trie.New(common.Hash{}, snapTrieDb)
@@ -439,18 +458,27 @@ func (dl *diskLayer) generateRange(root common.Hash, prefix []byte, kind string,
 		root, _, _ := snapTrie.Commit(nil)
 		snapTrieDb.Commit(root, false, nil)
 	}
-	tr := result.tr
-	if tr == nil {
-		tr, err = trie.New(root, dl.triedb)
+	var nodeIt trie.NodeIterator
+	if dl.triedb.Scheme() == rawdb.BinaryScheme {
+		tr, err := trie.NewBinary(root, dl.triedb)
 		if err != nil {
 			stats.Log("Trie missing, state snapshotting paused", dl.root, dl.genMarker)
 			return false, nil, errMissingTrie
 		}
+		nodeIt = tr.NodeIterator(origin)
+	} else {
+		tr := result.tr
+		if tr == nil {
+			tr, err = trie.NewWithOwner(owner, root, dl.triedb)
+			if err != nil {
+				stats.Log("Trie missing, state snapshotting paused", dl.root, dl.genMarker)
+				return false, nil, errMissingTrie
+			}
+		}
+		nodeIt = tr.NodeIterator(origin)
 	}
-
 	var (
 		trieMore       bool
-		nodeIt         = tr.NodeIterator(origin)
 		iter           = trie.NewIterator(nodeIt)
 		kvkeys, kvvals = result.keys, result.vals
 
@@ -686,7 +714,7 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 			}
 			var storeOrigin = common.CopyBytes(storeMarker)
 			for {
-				exhausted, last, err := dl.generateRange(acc.Root, append(rawdb.SnapshotStoragePrefix, accountHash.Bytes()...), "storage", storeOrigin, storageCheckRange, stats, onStorage, nil)
+				exhausted, last, err := dl.generateRange(accountHash, acc.Root, append(rawdb.SnapshotStoragePrefix, accountHash.Bytes()...), "storage", storeOrigin, storageCheckRange, stats, onStorage, nil)
 				if err != nil {
 					return err
 				}
@@ -705,7 +733,7 @@ func (dl *diskLayer) generate(stats *generatorStats) {
 
 	// Global loop for regerating the entire state trie + all layered storage tries.
 	for {
-		exhausted, last, err := dl.generateRange(dl.root, rawdb.SnapshotAccountPrefix, "account", accOrigin, accountRange, stats, onAccount, FullAccountRLP)
+		exhausted, last, err := dl.generateRange(common.Hash{}, dl.root, rawdb.SnapshotAccountPrefix, "account", accOrigin, accountRange, stats, onAccount, FullAccountRLP)
 		// The procedure it aborted, either by external signal or internal error
 		if err != nil {
 			if abort == nil { // aborted by internal error, wait the signal
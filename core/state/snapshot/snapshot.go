@@ -325,6 +325,25 @@ func (t *Tree) Snapshots(root common.Hash, limits int, nodisk bool) []Snapshot {
 	return ret
 }
 
+// Diff retrieves the flat state changes of the diff layer belonging to the given
+// block root: the destructed accounts, the updated accounts and the updated
+// storage slots. The returned maps are shared with the layer and must not be
+// modified.
+func (t *Tree) Diff(blockRoot common.Hash) (map[common.Hash]struct{}, map[common.Hash][]byte, map[common.Hash]map[common.Hash][]byte, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+
+	layer := t.layers[blockRoot]
+	if layer == nil {
+		return nil, nil, nil, fmt.Errorf("snapshot [%#x] missing", blockRoot)
+	}
+	diff, ok := layer.(*diffLayer)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("snapshot [%#x] is not a diff layer", blockRoot)
+	}
+	return diff.destructSet, diff.accountData, diff.storageData, nil
+}
+
 // Update adds a new snapshot into the tree, if that can be linked to an existing
 // old parent. It is disallowed to insert a disk layer (the origin of all).
 func (t *Tree) Update(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) error {
@@ -637,6 +656,31 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	return res
 }
 
+// PinDisk returns the root of the current disk layer along with a database
+// snapshot pinning its content. Unlike the layer itself, the pinned view never
+// goes stale, so it can be iterated for long while diff layers keep being
+// flattened into the disk. The view has to be released once it's used up.
+func (t *Tree) PinDisk() (common.Hash, ethdb.Snapshot, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	layer := t.disklayer()
+	if layer == nil {
+		return common.Hash{}, nil, errors.New("disk layer is missing")
+	}
+	layer.lock.RLock()
+	defer layer.lock.RUnlock()
+
+	if layer.genMarker != nil {
+		return common.Hash{}, nil, errors.New("snapshot is not constructed")
+	}
+	view, err := layer.diskdb.NewSnapshot()
+	if err != nil {
+		return common.Hash{}, nil, err
+	}
+	return layer.root, view, nil
+}
+
 // Journal commits an entire diff hierarchy to disk into a single journal entry.
 // This is meant to be used during shutdown to persist the snapshot without
 // flattening everything down (bad for reorgs).
@@ -757,14 +801,18 @@ func (t *Tree) Verify(root common.Hash) error {
 	}
 	defer acctIt.Release()
 
-	got, err := generateTrieRoot(nil, acctIt, common.Hash{}, stackTrieGenerate, func(db ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
+	generatorFn := stackTrieGenerate
+	if t.triedb.Scheme() == rawdb.BinaryScheme {
+		generatorFn = binaryTrieGenerate
+	}
+	got, err := generateTrieRoot(nil, acctIt, common.Hash{}, generatorFn, func(db ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
 		storageIt, err := t.StorageIterator(root, accountHash, common.Hash{})
 		if err != nil {
 			return common.Hash{}, err
 		}
 		defer storageIt.Release()
 
-		hash, err := generateTrieRoot(nil, storageIt, accountHash, stackTrieGenerate, nil, stat, false)
+		hash, err := generateTrieRoot(nil, storageIt, accountHash, generatorFn, nil, stat, false)
 		if err != nil {
 			return common.Hash{}, err
 		}
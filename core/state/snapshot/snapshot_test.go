@@ -178,6 +178,58 @@ func TestDiskLayerExternalInvalidationPartialFlatten(t *testing.T) {
 	}
 }
 
+// Tests that a pinned disk layer keeps serving the pinned state after diff
+// layers were flattened into the disk.
+func TestPinDisk(t *testing.T) {
+	// Create an empty base layer and a snapshot tree out of it
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	root, view, err := snaps.PinDisk()
+	if err != nil {
+		t.Fatalf("failed to pin disk layer: %v", err)
+	}
+	defer view.Release()
+	if root != base.root {
+		t.Errorf("pinned root mismatch: have %x, want %x", root, base.root)
+	}
+	// Flatten two diffs onto the disk, making the pinned layer stale
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	if err := snaps.Update(common.HexToHash("0x02"), common.HexToHash("0x01"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if err := snaps.Update(common.HexToHash("0x03"), common.HexToHash("0x02"), nil, accounts, nil); err != nil {
+		t.Fatalf("failed to create a diff layer: %v", err)
+	}
+	if err := snaps.Cap(common.HexToHash("0x03"), 0); err != nil {
+		t.Fatalf("failed to flatten diffs onto disk: %v", err)
+	}
+	if !base.Stale() {
+		t.Fatalf("disk layer not stale after flattening")
+	}
+	// The pinned view must not contain the flattened account
+	if len(rawdb.ReadAccountSnapshot(base.diskdb, common.HexToHash("0xa1"))) == 0 {
+		t.Fatalf("account not flattened onto disk")
+	}
+	if len(rawdb.ReadAccountSnapshot(view, common.HexToHash("0xa1"))) != 0 {
+		t.Errorf("pinned view contains account flattened after pinning")
+	}
+	// Pinning is refused while the snapshot is being generated
+	snaps.disklayer().genMarker = []byte{0x00}
+	if _, _, err := snaps.PinDisk(); err == nil {
+		t.Errorf("pinned disk layer under generation")
+	}
+}
+
 // Tests that if a diff layer becomes stale, no active external references will
 // be returned with junk data. This version of the test retains the bottom diff
 // layer to check the usual mode of operation where the accumulator is retained.
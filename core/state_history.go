@@ -0,0 +1,467 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+var (
+	// errStateHistoryDisabled is returned if historical state is requested but
+	// no state history is being recorded.
+	errStateHistoryDisabled = errors.New("state history disabled")
+
+	// errHistoricStateReadOnly is returned if a historical state is attempted to
+	// be modified on the trie level.
+	errHistoricStateReadOnly = errors.New("historical state is read-only")
+
+	// errHistoricStateNoTrie is returned when iterating or proving a historical
+	// state, which has no trie nodes.
+	errHistoricStateNoTrie = errors.New("historical state has no trie")
+)
+
+// stateHistory is the flat state diff of a block, holding the accounts and the
+// storage slots changed by the block with the values they had before it. Empty
+// values denote entries that did not exist.
+type stateHistory struct {
+	Accounts []stateHistoryAccount
+	Storage  []stateHistoryStorage
+}
+
+// stateHistoryAccount is an account of a state history in slim RLP format.
+type stateHistoryAccount struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// stateHistoryStorage is the set of changed storage slots of an account.
+type stateHistoryStorage struct {
+	Account common.Hash
+	Slots   []stateHistorySlot
+}
+
+// stateHistorySlot is a storage slot of a state history in RLP format.
+type stateHistorySlot struct {
+	Hash common.Hash
+	Blob []byte
+}
+
+// stateHistoryLookup is a decoded state history indexed for lookups.
+type stateHistoryLookup struct {
+	accounts map[common.Hash][]byte
+	storage  map[common.Hash]map[common.Hash][]byte
+}
+
+// collectStateHistory assembles the state history of the block with the given
+// state root from the snapshot diff layer created by it and the snapshot of its
+// parent. The whole storage of destructed accounts is recorded, so that slots
+// wiped out by the destruction can be served too.
+func (bc *BlockChain) collectStateHistory(root common.Hash, parentRoot common.Hash) (*stateHistory, error) {
+	history := new(stateHistory)
+	if bc.snaps == nil {
+		return nil, errors.New("snapshots disabled")
+	}
+	if root == parentRoot {
+		return history, nil
+	}
+	destructs, accounts, storage, err := bc.snaps.Diff(root)
+	if err != nil {
+		return nil, err
+	}
+	parent := bc.snaps.Snapshot(parentRoot)
+	if parent == nil {
+		return nil, fmt.Errorf("snapshot [%#x] missing", parentRoot)
+	}
+	changed := make(map[common.Hash]struct{})
+	for hash := range destructs {
+		changed[hash] = struct{}{}
+	}
+	for hash := range accounts {
+		changed[hash] = struct{}{}
+	}
+	for hash := range storage {
+		changed[hash] = struct{}{}
+	}
+	for _, hash := range sortedHashes(changed) {
+		blob, err := parent.AccountRLP(hash)
+		if err != nil {
+			return nil, err
+		}
+		history.Accounts = append(history.Accounts, stateHistoryAccount{Hash: hash, Blob: blob})
+
+		slots := make(map[common.Hash]struct{})
+		for slot := range storage[hash] {
+			slots[slot] = struct{}{}
+		}
+		if _, destructed := destructs[hash]; destructed && len(blob) > 0 {
+			it, err := bc.snaps.StorageIterator(parentRoot, hash, common.Hash{})
+			if err != nil {
+				return nil, err
+			}
+			for it.Next() {
+				slots[it.Hash()] = struct{}{}
+			}
+			err = it.Error()
+			it.Release()
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(slots) == 0 {
+			continue
+		}
+		entry := stateHistoryStorage{Account: hash}
+		for _, slot := range sortedHashes(slots) {
+			blob, err := parent.Storage(hash, slot)
+			if err != nil {
+				return nil, err
+			}
+			entry.Slots = append(entry.Slots, stateHistorySlot{Hash: slot, Blob: blob})
+		}
+		history.Storage = append(history.Storage, entry)
+	}
+	return history, nil
+}
+
+// writeStateHistory records the flat state history of a freshly written block
+// and prunes the history falling out of the retention window. If the history
+// can't be assembled, the history tail is moved past the block since older
+// states can't be served anymore.
+func (bc *BlockChain) writeStateHistory(block *types.Block, parent *types.Header) {
+	var (
+		number = block.NumberU64()
+		tail   = rawdb.ReadStateHistoryTail(bc.db)
+		batch  = bc.db.NewBatch()
+	)
+	history, err := bc.collectStateHistory(block.Root(), parent.Root)
+	if err == nil && tail != nil && *tail < number && len(rawdb.ReadStateHistory(bc.db, parent.Number.Uint64(), parent.Hash())) == 0 {
+		err = errors.New("parent state history missing")
+	}
+	if err != nil {
+		log.Debug("Failed to record state history", "number", number, "hash", block.Hash(), "err", err)
+		if tail == nil || *tail <= number {
+			rawdb.WriteStateHistoryTail(batch, number+1)
+		}
+	} else {
+		blob, err := rlp.EncodeToBytes(history)
+		if err != nil {
+			log.Crit("Failed to encode state history", "err", err)
+		}
+		rawdb.WriteStateHistory(batch, number, block.Hash(), blob)
+		for _, account := range history.Accounts {
+			rawdb.WriteAccountHistoryIndex(batch, account.Hash, number)
+		}
+		for _, storage := range history.Storage {
+			for _, slot := range storage.Slots {
+				rawdb.WriteStorageHistoryIndex(batch, storage.Account, slot.Hash, number)
+			}
+		}
+		if tail == nil {
+			rawdb.WriteStateHistoryTail(batch, number)
+		}
+		// Drop the history of the block falling out of the retention window
+		if limit := bc.cacheConfig.StateHistory; number > limit {
+			bc.pruneStateHistory(batch, number-limit)
+		}
+	}
+	if err := batch.Write(); err != nil {
+		log.Crit("Failed to write state history", "err", err)
+	}
+}
+
+// pruneStateHistory deletes the state histories of all blocks with the given
+// number along with their index entries.
+func (bc *BlockChain) pruneStateHistory(batch ethdb.Batch, number uint64) {
+	for _, hash := range rawdb.ReadAllHashes(bc.db, number) {
+		blob := rawdb.ReadStateHistory(bc.db, number, hash)
+		if len(blob) == 0 {
+			continue
+		}
+		var history stateHistory
+		if err := rlp.DecodeBytes(blob, &history); err != nil {
+			log.Error("Invalid state history", "number", number, "hash", hash, "err", err)
+		}
+		for _, account := range history.Accounts {
+			rawdb.DeleteAccountHistoryIndex(batch, account.Hash, number)
+		}
+		for _, storage := range history.Storage {
+			for _, slot := range storage.Slots {
+				rawdb.DeleteStorageHistoryIndex(batch, storage.Account, slot.Hash, number)
+			}
+		}
+		rawdb.DeleteStateHistory(batch, number, hash)
+	}
+	if tail := rawdb.ReadStateHistoryTail(bc.db); tail != nil && *tail <= number {
+		rawdb.WriteStateHistoryTail(batch, number+1)
+	}
+}
+
+// HistoricState returns a read-only state of the given canonical block, served
+// from the recorded state history on top of the snapshot of the current head,
+// without needing the state trie of the block.
+func (bc *BlockChain) HistoricState(header *types.Header) (*state.StateDB, error) {
+	if bc.cacheConfig.StateHistory == 0 || bc.snaps == nil {
+		return nil, errStateHistoryDisabled
+	}
+	number := header.Number.Uint64()
+	if bc.GetCanonicalHash(number) != header.Hash() {
+		return nil, fmt.Errorf("block #%d [%x] not canonical", number, header.Hash())
+	}
+	head := bc.CurrentBlock().Header()
+	if number > head.Number.Uint64() {
+		return nil, fmt.Errorf("block #%d beyond head #%d", number, head.Number.Uint64())
+	}
+	if tail := rawdb.ReadStateHistoryTail(bc.db); tail == nil || number+1 < *tail {
+		return nil, fmt.Errorf("state history of block #%d unavailable", number)
+	}
+	snap := bc.snaps.Snapshot(head.Root)
+	if snap == nil {
+		return nil, fmt.Errorf("snapshot [%#x] missing", head.Root)
+	}
+	db := &historyDatabase{
+		bc:     bc,
+		number: number,
+		head:   head.Number.Uint64(),
+		snap:   snap,
+		diffs:  make(map[uint64]*stateHistoryLookup),
+	}
+	return state.New(header.Root, db, nil)
+}
+
+// historyDatabase is a state database serving a historical state by looking up
+// the first change of each account and storage slot after the requested block
+// in the state history, falling back to the snapshot of the head if there is
+// none.
+type historyDatabase struct {
+	bc     *BlockChain
+	number uint64            // Number of the block to serve the state of
+	head   uint64            // Number of the head block the snapshot belongs to
+	snap   snapshot.Snapshot // Snapshot of the head state
+
+	diffs map[uint64]*stateHistoryLookup // Decoded state histories by block number
+	lock  sync.Mutex
+}
+
+func (db *historyDatabase) OpenTrie(root common.Hash) (state.Trie, error) {
+	return &historyTrie{db: db, root: root}, nil
+}
+
+func (db *historyDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	return &historyTrie{db: db, root: root, owner: addrHash, storage: true}, nil
+}
+
+func (db *historyDatabase) CopyTrie(t state.Trie) state.Trie {
+	switch t := t.(type) {
+	case *historyTrie:
+		cpy := *t
+		return &cpy
+	default:
+		panic(fmt.Errorf("unknown trie type %T", t))
+	}
+}
+
+func (db *historyDatabase) ContractCode(addrHash, codeHash common.Hash) ([]byte, error) {
+	return db.bc.stateCache.ContractCode(addrHash, codeHash)
+}
+
+func (db *historyDatabase) ContractCodeSize(addrHash, codeHash common.Hash) (int, error) {
+	return db.bc.stateCache.ContractCodeSize(addrHash, codeHash)
+}
+
+func (db *historyDatabase) TrieDB() *trie.Database {
+	return nil
+}
+
+// history retrieves the indexed state history of the canonical block with the
+// given number.
+func (db *historyDatabase) history(number uint64) (*stateHistoryLookup, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if lookup, ok := db.diffs[number]; ok {
+		return lookup, nil
+	}
+	blob := rawdb.ReadStateHistory(db.bc.db, number, db.bc.GetCanonicalHash(number))
+	if len(blob) == 0 {
+		return nil, fmt.Errorf("state history of block #%d missing", number)
+	}
+	var history stateHistory
+	if err := rlp.DecodeBytes(blob, &history); err != nil {
+		return nil, err
+	}
+	lookup := &stateHistoryLookup{
+		accounts: make(map[common.Hash][]byte),
+		storage:  make(map[common.Hash]map[common.Hash][]byte),
+	}
+	for _, account := range history.Accounts {
+		lookup.accounts[account.Hash] = account.Blob
+	}
+	for _, storage := range history.Storage {
+		slots := make(map[common.Hash][]byte)
+		for _, slot := range storage.Slots {
+			slots[slot.Hash] = slot.Blob
+		}
+		lookup.storage[storage.Account] = slots
+	}
+	db.diffs[number] = lookup
+	return lookup, nil
+}
+
+// account retrieves the slim RLP encoded account at the served block.
+func (db *historyDatabase) account(hash common.Hash) ([]byte, error) {
+	var (
+		blob  []byte
+		found bool
+		err   error
+	)
+	rawdb.IterateAccountHistory(db.bc.db, hash, db.number+1, func(number uint64) bool {
+		if number > db.head {
+			return false
+		}
+		var lookup *stateHistoryLookup
+		if lookup, err = db.history(number); err != nil {
+			return false
+		}
+		// Index entries of side chain blocks don't show up in the canonical history
+		blob, found = lookup.accounts[hash]
+		return !found
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return blob, nil
+	}
+	return db.snap.AccountRLP(hash)
+}
+
+// storage retrieves the RLP encoded storage slot at the served block.
+func (db *historyDatabase) storage(account, hash common.Hash) ([]byte, error) {
+	var (
+		blob  []byte
+		found bool
+		err   error
+	)
+	rawdb.IterateStorageHistory(db.bc.db, account, hash, db.number+1, func(number uint64) bool {
+		if number > db.head {
+			return false
+		}
+		var lookup *stateHistoryLookup
+		if lookup, err = db.history(number); err != nil {
+			return false
+		}
+		blob, found = lookup.storage[account][hash]
+		return !found
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		return blob, nil
+	}
+	return db.snap.Storage(account, hash)
+}
+
+// historyTrie is a read-only view of the account trie or a storage trie of a
+// historical state, serving the leaves from the state history.
+type historyTrie struct {
+	db      *historyDatabase
+	root    common.Hash
+	owner   common.Hash // Account hash of storage tries
+	storage bool
+}
+
+func (t *historyTrie) TryGet(key []byte) ([]byte, error) {
+	hash := crypto.Keccak256Hash(key)
+	if t.storage {
+		return t.db.storage(t.owner, hash)
+	}
+	blob, err := t.db.account(hash)
+	if err != nil || len(blob) == 0 {
+		return nil, err
+	}
+	return snapshot.FullAccountRLP(blob)
+}
+
+func (t *historyTrie) TryUpdate(key, value []byte) error {
+	return errHistoricStateReadOnly
+}
+
+func (t *historyTrie) TryDelete(key []byte) error {
+	return errHistoricStateReadOnly
+}
+
+func (t *historyTrie) Commit(onleaf trie.LeafCallback) (common.Hash, int, error) {
+	return common.Hash{}, 0, errHistoricStateReadOnly
+}
+
+func (t *historyTrie) CommittedNodes() *trie.NodeSet {
+	return nil
+}
+
+func (t *historyTrie) Hash() common.Hash {
+	return t.root
+}
+
+func (t *historyTrie) NodeIterator(startKey []byte) trie.NodeIterator {
+	return &historyIterator{new(trie.Trie).NodeIterator(startKey)}
+}
+
+func (t *historyTrie) GetKey(sha []byte) []byte {
+	return nil
+}
+
+func (t *historyTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	return errHistoricStateNoTrie
+}
+
+// historyIterator is an empty node iterator reporting that historical states
+// can't be iterated.
+type historyIterator struct {
+	trie.NodeIterator
+}
+
+func (it *historyIterator) Error() error {
+	return errHistoricStateNoTrie
+}
+
+// sortedHashes returns the hashes of a set in ascending order.
+func sortedHashes(set map[common.Hash]struct{}) []common.Hash {
+	hashes := make([]common.Hash, 0, len(set))
+	for hash := range set {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	return hashes
+}
@@ -0,0 +1,129 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that historical states are served from the recorded state history,
+// including the storage wiped out by a self-destruct, and that the history
+// falling out of the retention window is pruned.
+func TestHistoricState(t *testing.T) {
+	const (
+		blocks   = 40
+		destruct = 20 // Block in which the contract self-destructs
+		retain   = 30 // Number of blocks to keep state history for
+	)
+	var (
+		key, _   = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		addr     = crypto.PubkeyToAddress(key.PublicKey)
+		contract = common.HexToAddress("0xc0de")
+		funds    = big.NewInt(1000000000000000000)
+		gspec    = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				addr: {Balance: funds},
+				// Stores the call value at the block number slot, or self-destructs
+				// if called without value.
+				contract: {Balance: big.NewInt(0), Code: common.FromHex("3460085733ff00005b34435500")},
+			},
+		}
+		signer = types.LatestSigner(gspec.Config)
+		engine = ethash.NewFaker()
+		db     = rawdb.NewMemoryDatabase()
+	)
+	genesis := gspec.MustCommit(db)
+	chain, _ := GenerateChain(gspec.Config, genesis, engine, db, blocks, func(i int, b *BlockGen) {
+		value := big.NewInt(int64(1000 * b.Number().Uint64()))
+		if b.Number().Uint64() == destruct {
+			value = new(big.Int)
+		}
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), contract, value, 100000, b.header.BaseFee, nil), signer, key)
+		b.AddTx(tx)
+	})
+	diskdb := rawdb.NewMemoryDatabase()
+	gspec.MustCommit(diskdb)
+
+	config := &CacheConfig{
+		TrieCleanLimit: 256,
+		TrieDirtyLimit: 256,
+		TrieTimeLimit:  5 * time.Minute,
+		SnapshotLimit:  256,
+		SnapshotWait:   true,
+		StateHistory:   retain,
+	}
+	bc, err := NewBlockChain(diskdb, config, gspec.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer bc.Stop()
+
+	if n, err := bc.InsertChain(chain); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	for number := uint64(0); number <= blocks; number++ {
+		header := bc.GetHeaderByNumber(number)
+		state, err := bc.HistoricState(header)
+		if number < blocks-retain {
+			if err == nil {
+				t.Errorf("block %d: pruned state available", number)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("block %d: failed to open historic state: %v", number, err)
+		}
+		if nonce := state.GetNonce(addr); nonce != number {
+			t.Errorf("block %d: nonce mismatch: have %d, want %d", number, nonce, number)
+		}
+		balance, alive := new(big.Int), number < destruct
+		for i := uint64(1); i <= number; i++ {
+			if i == destruct {
+				balance = new(big.Int)
+			} else {
+				balance.Add(balance, big.NewInt(int64(1000*i)))
+			}
+			want := common.Hash{}
+			if alive {
+				want = common.BigToHash(big.NewInt(int64(1000 * i)))
+			}
+			if have := state.GetState(contract, common.BigToHash(new(big.Int).SetUint64(i))); have != want {
+				t.Errorf("block %d: slot %d mismatch: have %x, want %x", number, i, have, want)
+			}
+		}
+		if have := state.GetBalance(contract); have.Cmp(balance) != 0 {
+			t.Errorf("block %d: balance mismatch: have %v, want %v", number, have, balance)
+		}
+		if have := len(state.GetCode(contract)) > 0; have != alive {
+			t.Errorf("block %d: code presence mismatch: have %v, want %v", number, have, alive)
+		}
+		if err := state.Error(); err != nil {
+			t.Fatalf("block %d: state error: %v", number, err)
+		}
+	}
+}
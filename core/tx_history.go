@@ -0,0 +1,157 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// TxDropReason describes why a transaction was removed from the pool.
+type TxDropReason uint8
+
+const (
+	TxDropUnknown     TxDropReason = iota
+	TxDropReplaced                 // Replaced by a same-nonce transaction paying more
+	TxDropUnderpriced              // Evicted to make room for better paying transactions
+	TxDropLifetime                 // Queued for longer than the configured lifetime
+	TxDropMined                    // Included in a block
+	TxDropNonceTooLow              // Nonce consumed by a different transaction on chain
+	TxDropNoFunds                  // Sender can no longer pay for it (or it exceeds the gas limit)
+	TxDropRateLimited              // Account or global slot limits exceeded
+	TxDropExpired                  // Private transaction not included before its deadline
+)
+
+var txDropReasonNames = map[TxDropReason]string{
+	TxDropUnknown:     "unknown",
+	TxDropReplaced:    "replaced",
+	TxDropUnderpriced: "underpriced",
+	TxDropLifetime:    "lifetime",
+	TxDropMined:       "mined",
+	TxDropNonceTooLow: "nonceTooLow",
+	TxDropNoFunds:     "insufficientFunds",
+	TxDropRateLimited: "rateLimited",
+	TxDropExpired:     "expired",
+}
+
+// String implements fmt.Stringer.
+func (r TxDropReason) String() string {
+	if name, ok := txDropReasonNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("TxDropReason(%d)", uint8(r))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (r TxDropReason) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// TxDropEvent records a single transaction leaving the pool.
+type TxDropEvent struct {
+	Hash        common.Hash    `json:"hash"`
+	Reason      TxDropReason   `json:"reason"`
+	Replacement *common.Hash   `json:"replacedBy,omitempty"`  // Set if Reason is TxDropReplaced
+	BlockNumber hexutil.Uint64 `json:"blockNumber,omitempty"` // Set if Reason is TxDropMined
+	Time        time.Time      `json:"time"`
+	Private     bool           `json:"-"` // Set if the transaction was withheld from the network
+}
+
+// txDropHistory is a bounded record of the most recent transactions dropped by
+// the pool, together with a backlog of drops not yet announced to subscribers.
+//
+// The history is a ring buffer: once full, recording a new drop forgets the
+// oldest one.
+type txDropHistory struct {
+	ring  []*TxDropEvent                 // Recorded drops in insertion order
+	next  int                            // Ring index the next drop will be written to
+	index map[common.Hash]*TxDropEvent   // Latest drop for each transaction hash
+	mined map[common.Hash]hexutil.Uint64 // Transactions included by the last pool reset
+	queue []*TxDropEvent                 // Drops not yet sent to subscribers
+
+	private func(common.Hash) bool // Reports whether a transaction is withheld from the network
+
+	lock sync.RWMutex
+}
+
+// newTxDropHistory creates a drop history retaining at most limit entries, using
+// the given callback to mark the drops of private transactions.
+func newTxDropHistory(limit uint64, private func(common.Hash) bool) *txDropHistory {
+	return &txDropHistory{
+		ring:    make([]*TxDropEvent, limit),
+		index:   make(map[common.Hash]*TxDropEvent),
+		private: private,
+	}
+}
+
+// record inserts a new drop event into the history, evicting the oldest one if
+// the history is full.
+func (h *txDropHistory) record(hash common.Hash, reason TxDropReason, replacement *common.Hash) {
+	if len(h.ring) == 0 {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	drop := &TxDropEvent{Hash: hash, Reason: reason, Replacement: replacement, Time: time.Now()}
+
+	// Expired transactions are no longer tracked as private once dropped, but they
+	// were never announced either
+	drop.Private = reason == TxDropExpired || (h.private != nil && h.private(hash))
+	if number, ok := h.mined[hash]; ok && reason == TxDropNonceTooLow {
+		drop.Reason, drop.BlockNumber = TxDropMined, number
+	}
+	if old := h.ring[h.next]; old != nil && h.index[old.Hash] == old {
+		delete(h.index, old.Hash)
+	}
+	h.ring[h.next] = drop
+	h.next = (h.next + 1) % len(h.ring)
+
+	h.index[hash] = drop
+	h.queue = append(h.queue, drop)
+}
+
+// setMined replaces the set of transactions known to be included by the current
+// chain head, used to tell mined transactions apart from nonce collisions.
+func (h *txDropHistory) setMined(mined map[common.Hash]hexutil.Uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.mined = mined
+}
+
+// get returns the latest drop recorded for a transaction, or nil if unknown.
+func (h *txDropHistory) get(hash common.Hash) *TxDropEvent {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	return h.index[hash]
+}
+
+// drain returns all drops recorded since the last call and resets the backlog.
+func (h *txDropHistory) drain() []*TxDropEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	queue := h.queue
+	h.queue = nil
+	return queue
+}
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/common/prque"
 	"github.com/ethereum/go-ethereum/consensus/misc"
 	"github.com/ethereum/go-ethereum/core/state"
@@ -165,6 +166,10 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	DropHistory uint64 // Number of dropped transactions to remember the drop reason of
+
+	PrivateLifetime time.Duration // Default amount of time private transactions are withheld from the network
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -182,6 +187,10 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	DropHistory: 4096,
+
+	PrivateLifetime: 10 * time.Minute,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -220,6 +229,10 @@ func (config *TxPoolConfig) sanitize() TxPoolConfig {
 		log.Warn("Sanitizing invalid txpool lifetime", "provided", conf.Lifetime, "updated", DefaultTxPoolConfig.Lifetime)
 		conf.Lifetime = DefaultTxPoolConfig.Lifetime
 	}
+	if conf.PrivateLifetime < 1 {
+		log.Warn("Sanitizing invalid txpool private lifetime", "provided", conf.PrivateLifetime, "updated", DefaultTxPoolConfig.PrivateLifetime)
+		conf.PrivateLifetime = DefaultTxPoolConfig.PrivateLifetime
+	}
 	return conf
 }
 
@@ -236,6 +249,7 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	dropFeed    event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
@@ -256,6 +270,8 @@ type TxPool struct {
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	drops   *txDropHistory               // Recently dropped transactions and the reasons
+	private *privateTxSet                // Transactions withheld from the network
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -281,6 +297,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 	config = (&config).sanitize()
 
 	// Create the transaction pool with its initial settings
+	private := newPrivateTxSet()
 	pool := &TxPool{
 		config:          config,
 		chainconfig:     chainconfig,
@@ -290,6 +307,8 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
 		all:             newTxLookup(),
+		drops:           newTxDropHistory(config.DropHistory, private.contains),
+		private:         private,
 		chainHeadCh:     make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:      make(chan *txpoolResetRequest),
 		reqPromoteCh:    make(chan *accountSet),
@@ -390,12 +409,32 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
+						pool.drops.record(tx.Hash(), TxDropLifetime, nil)
 						pool.removeTx(tx.Hash(), true)
 					}
 					queuedEvictionMeter.Mark(int64(len(list)))
 				}
 			}
+			// Release or drop any private transactions past their deadline
+			publish, drop := pool.private.expire(time.Now())
+			for _, hash := range drop {
+				if pool.all.Get(hash) != nil {
+					pool.drops.record(hash, TxDropExpired, nil)
+					pool.removeTx(hash, true)
+				}
+			}
+			var released types.Transactions
+			for _, hash := range publish {
+				if tx := pool.all.Get(hash); tx != nil {
+					released = append(released, tx)
+				}
+			}
 			pool.mu.Unlock()
+			pool.announceDrops()
+
+			if len(released) > 0 {
+				pool.txFeed.Send(NewTxsEvent{released})
+			}
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -431,6 +470,22 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribeDroppedTxsEvent registers a subscription of DroppedTxsEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeDroppedTxsEvent(ch chan<- DroppedTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.dropFeed.Subscribe(ch))
+}
+
+// announceDrops sends out all drops recorded since the last announcement.
+//
+// Note, this method must not be called with the pool lock held, since the
+// subscribers might call back into the pool.
+func (pool *TxPool) announceDrops() {
+	if drops := pool.drops.drain(); len(drops) > 0 {
+		pool.dropFeed.Send(DroppedTxsEvent{drops})
+	}
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -442,6 +497,8 @@ func (pool *TxPool) GasPrice() *big.Int {
 // SetGasPrice updates the minimum price required by the transaction pool for a
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
+	defer pool.announceDrops()
+
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
@@ -452,6 +509,7 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		// pool.priced is sorted by GasFeeCap, so we have to iterate through pool.all instead
 		drop := pool.all.RemotesBelowTip(price)
 		for _, tx := range drop {
+			pool.drops.record(tx.Hash(), TxDropUnderpriced, nil)
 			pool.removeTx(tx.Hash(), false)
 		}
 		pool.priced.Removed(len(drop))
@@ -566,21 +624,33 @@ func (pool *TxPool) Locals() []common.Address {
 }
 
 // local retrieves all currently known local transactions, grouped by origin
-// account and sorted by nonce. The returned transaction set is a copy and can be
+// account and sorted by nonce. Private transactions are left out so that they
+// never reach the journal. The returned transaction set is a copy and can be
 // freely modified by calling code.
 func (pool *TxPool) local() map[common.Address]types.Transactions {
 	txs := make(map[common.Address]types.Transactions)
 	for addr := range pool.locals.accounts {
 		if pending := pool.pending[addr]; pending != nil {
-			txs[addr] = append(txs[addr], pending.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(pending.Flatten())...)
 		}
 		if queued := pool.queue[addr]; queued != nil {
-			txs[addr] = append(txs[addr], queued.Flatten()...)
+			txs[addr] = append(txs[addr], pool.public(queued.Flatten())...)
 		}
 	}
 	return txs
 }
 
+// public filters the private transactions out of the given list.
+func (pool *TxPool) public(txs types.Transactions) types.Transactions {
+	filtered := txs[:0]
+	for _, tx := range txs {
+		if !pool.private.contains(tx.Hash()) {
+			filtered = append(filtered, tx)
+		}
+	}
+	return filtered
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -704,6 +774,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
+			pool.drops.record(tx.Hash(), TxDropUnderpriced, nil)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
@@ -718,6 +789,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		}
 		// New transaction is better, replace old one
 		if old != nil {
+			pool.drops.record(old.Hash(), TxDropReplaced, &hash)
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
@@ -769,6 +841,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 	}
 	// Discard any previous transaction and mark this
 	if old != nil {
+		pool.drops.record(old.Hash(), TxDropReplaced, &hash)
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
@@ -795,8 +868,8 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 // journalTx adds the specified transaction to the local disk journal if it is
 // deemed to have been sent from a local account.
 func (pool *TxPool) journalTx(from common.Address, tx *types.Transaction) {
-	// Only journal if it's enabled and the transaction is local
-	if pool.journal == nil || !pool.locals.contains(from) {
+	// Only journal if it's enabled and the transaction is local and public
+	if pool.journal == nil || !pool.locals.contains(from) || pool.private.contains(tx.Hash()) {
 		return
 	}
 	if err := pool.journal.insert(tx); err != nil {
@@ -818,6 +891,8 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	inserted, old := list.Add(tx, pool.config.PriceBump)
 	if !inserted {
 		// An older transaction was better, discard this
+		better := list.txs.Get(tx.Nonce()).Hash()
+		pool.drops.record(hash, TxDropReplaced, &better)
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
 		pendingDiscardMeter.Mark(1)
@@ -825,6 +900,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	// Otherwise discard any previous transaction and mark this
 	if old != nil {
+		pool.drops.record(old.Hash(), TxDropReplaced, &hash)
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
@@ -856,6 +932,37 @@ func (pool *TxPool) AddLocal(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate enqueues a single transaction into the pool, withholding it from the
+// network and from the new transaction subscribers until the given lifetime elapses
+// (or the configured default if zero). Afterwards the transaction is either dropped
+// or, if publish is set, announced as if it was just added.
+//
+// Private transactions are validated like remote ones and their sender is not
+// tracked as a local account, so they are never journaled and the sender's later
+// public transactions don't become exempt from the pricing rules.
+func (pool *TxPool) AddPrivate(tx *types.Transaction, lifetime time.Duration, publish bool) error {
+	if lifetime <= 0 {
+		lifetime = pool.config.PrivateLifetime
+	}
+	// Mark the transaction before insertion so it's never journaled or broadcast
+	hash := tx.Hash()
+	if pool.all.Get(hash) != nil {
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	pool.private.add(hash, time.Now().Add(lifetime), publish)
+	if err := pool.addTxs([]*types.Transaction{tx}, false, true)[0]; err != nil {
+		pool.private.remove(hash)
+		return err
+	}
+	return nil
+}
+
+// IsPrivate returns whether a transaction is withheld from the network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	return pool.private.contains(hash)
+}
+
 // AddRemotes enqueues a batch of transactions into the pool if they are valid. If the
 // senders are not among the locally tracked ones, full pricing constraints will apply.
 //
@@ -980,6 +1087,12 @@ func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
 	return pool.all.Get(hash)
 }
 
+// Dropped returns the reason a transaction was last removed from the pool, or
+// nil if the transaction is unknown or was dropped too long ago to remember.
+func (pool *TxPool) Dropped(hash common.Hash) *TxDropEvent {
+	return pool.drops.get(hash)
+}
+
 // SYSCOIN get chainconfig so we can detect if we are syscoin network inside of peer
 func (pool *TxPool) GetChainConfig() *params.ChainConfig {
 	return pool.chainconfig
@@ -1201,8 +1314,15 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	pool.changesSinceReorg = 0 // Reset change counter
 	pool.mu.Unlock()
 
-	// Notify subsystems for newly added transactions
+	// Notify subsystems for dropped transactions
+	pool.announceDrops()
+
+	// Notify subsystems for newly added transactions, keeping the private ones
+	// hidden until they are released
 	for _, tx := range promoted {
+		if pool.private.contains(tx.Hash()) {
+			continue
+		}
 		addr, _ := types.Sender(pool.signer, tx)
 		if _, ok := events[addr]; !ok {
 			events[addr] = newTxSortedMap()
@@ -1222,8 +1342,24 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 // of the transaction pool is valid with regard to the chain state.
 func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// If we're reorging an old state, reinject all dropped transactions
-	var reinject types.Transactions
+	var (
+		reinject types.Transactions
+		mined    = make(map[common.Hash]hexutil.Uint64)
+	)
+	// Track the transactions included by the new blocks, so that dropping them
+	// from the pool can be attributed to mining
+	markMined := func(block *types.Block) {
+		for _, tx := range block.Transactions() {
+			mined[tx.Hash()] = hexutil.Uint64(block.NumberU64())
+		}
+	}
+	defer func() { pool.drops.setMined(mined) }()
 
+	if oldHead != nil && oldHead.Hash() == newHead.ParentHash {
+		if block := pool.chain.GetBlock(newHead.Hash(), newHead.Number.Uint64()); block != nil {
+			markMined(block)
+		}
+	}
 	if oldHead != nil && oldHead.Hash() != newHead.ParentHash {
 		// If the reorg is too deep, avoid doing it (will happen during fast sync)
 		oldNum := oldHead.Number.Uint64()
@@ -1263,6 +1399,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 				}
 				for add.NumberU64() > rem.NumberU64() {
 					included = append(included, add.Transactions()...)
+					markMined(add)
 					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 						return
@@ -1275,6 +1412,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 						return
 					}
 					included = append(included, add.Transactions()...)
+					markMined(add)
 					if add = pool.chain.GetBlock(add.ParentHash(), add.NumberU64()-1); add == nil {
 						log.Error("Unrooted new chain seen by tx pool", "block", newHead.Number, "hash", newHead.Hash())
 						return
@@ -1326,6 +1464,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		forwards := list.Forward(pool.currentState.GetNonce(addr))
 		for _, tx := range forwards {
 			hash := tx.Hash()
+			pool.drops.record(hash, TxDropNonceTooLow, nil)
 			pool.all.Remove(hash)
 		}
 		log.Trace("Removed old queued transactions", "count", len(forwards))
@@ -1333,6 +1472,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		drops, _ := list.Filter(pool.currentState.GetBalance(addr), pool.currentMaxGas)
 		for _, tx := range drops {
 			hash := tx.Hash()
+			pool.drops.record(hash, TxDropNoFunds, nil)
 			pool.all.Remove(hash)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
@@ -1355,6 +1495,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			caps = list.Cap(int(pool.config.AccountQueue))
 			for _, tx := range caps {
 				hash := tx.Hash()
+				pool.drops.record(hash, TxDropRateLimited, nil)
 				pool.all.Remove(hash)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
@@ -1417,6 +1558,7 @@ func (pool *TxPool) truncatePending() {
 					for _, tx := range caps {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
+						pool.drops.record(hash, TxDropRateLimited, nil)
 						pool.all.Remove(hash)
 
 						// Update the account nonce to the dropped transaction
@@ -1444,6 +1586,7 @@ func (pool *TxPool) truncatePending() {
 				for _, tx := range caps {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
+					pool.drops.record(hash, TxDropRateLimited, nil)
 					pool.all.Remove(hash)
 
 					// Update the account nonce to the dropped transaction
@@ -1491,6 +1634,7 @@ func (pool *TxPool) truncateQueue() {
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
+				pool.drops.record(tx.Hash(), TxDropRateLimited, nil)
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1500,6 +1644,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.drops.record(txs[i].Hash(), TxDropRateLimited, nil)
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1523,6 +1668,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		olds := list.Forward(nonce)
 		for _, tx := range olds {
 			hash := tx.Hash()
+			pool.drops.record(hash, TxDropNonceTooLow, nil)
 			pool.all.Remove(hash)
 			log.Trace("Removed old pending transaction", "hash", hash)
 		}
@@ -1531,6 +1677,7 @@ func (pool *TxPool) demoteUnexecutables() {
 		for _, tx := range drops {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
+			pool.drops.record(hash, TxDropNoFunds, nil)
 			pool.all.Remove(hash)
 		}
 		pendingNofundsMeter.Mark(int64(len(drops)))
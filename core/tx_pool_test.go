@@ -2128,6 +2128,167 @@ func TestTransactionReplacement(t *testing.T) {
 	}
 }
 
+// Tests that transactions leaving the pool are remembered together with the
+// reason of the drop, and that the drops are announced to subscribers.
+func TestTransactionDropHistory(t *testing.T) {
+	t.Parallel()
+
+	// Create a pool remembering only a handful of drops
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.DropHistory = 2
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	drops := make(chan DroppedTxsEvent, 32)
+	sub := pool.SubscribeDroppedTxsEvent(drops)
+	defer sub.Unsubscribe()
+
+	key, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Replace a pending transaction and ensure the drop is recorded
+	tx0 := pricedTransaction(0, 100000, big.NewInt(1), key)
+	tx1 := pricedTransaction(0, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(tx0); err != nil {
+		t.Fatalf("failed to add original transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(tx1); err != nil {
+		t.Fatalf("failed to add replacement transaction: %v", err)
+	}
+	drop := pool.Dropped(tx0.Hash())
+	if drop == nil {
+		t.Fatalf("replaced transaction not recorded")
+	}
+	if drop.Reason != TxDropReplaced {
+		t.Errorf("drop reason mismatch: have %v, want %v", drop.Reason, TxDropReplaced)
+	}
+	if drop.Replacement == nil || *drop.Replacement != tx1.Hash() {
+		t.Errorf("replacement mismatch: have %v, want %x", drop.Replacement, tx1.Hash())
+	}
+	if pool.Dropped(tx1.Hash()) != nil {
+		t.Errorf("pooled transaction recorded as dropped")
+	}
+	select {
+	case ev := <-drops:
+		if len(ev.Drops) != 1 || ev.Drops[0].Hash != tx0.Hash() {
+			t.Errorf("announced drops mismatch: have %v, want [%x]", ev.Drops, tx0.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drop event not fired")
+	}
+	// Consume the nonce on chain and ensure the pending transaction is dropped
+	testSetNonce(pool, crypto.PubkeyToAddress(key.PublicKey), 1)
+	<-pool.requestReset(nil, nil)
+
+	if drop := pool.Dropped(tx1.Hash()); drop == nil || drop.Reason != TxDropNonceTooLow {
+		t.Errorf("stale transaction drop mismatch: have %v, want reason %v", drop, TxDropNonceTooLow)
+	}
+	// Overflow the history and ensure the oldest drop is forgotten
+	tx2 := pricedTransaction(1, 100000, big.NewInt(1), key)
+	tx3 := pricedTransaction(1, 100000, big.NewInt(2), key)
+	if err := pool.addRemoteSync(tx2); err != nil {
+		t.Fatalf("failed to add original transaction: %v", err)
+	}
+	if err := pool.addRemoteSync(tx3); err != nil {
+		t.Fatalf("failed to add replacement transaction: %v", err)
+	}
+	if pool.Dropped(tx0.Hash()) != nil {
+		t.Errorf("oldest drop not evicted from history")
+	}
+	if pool.Dropped(tx1.Hash()) == nil || pool.Dropped(tx2.Hash()) == nil {
+		t.Errorf("recent drops missing from history")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that private transactions are withheld until their lifetime elapses and
+// are then either dropped or released to the network.
+func TestTransactionPrivate(t *testing.T) {
+	// Reduce the eviction interval to a testable amount
+	defer func(old time.Duration) { evictionInterval = old }(evictionInterval)
+	evictionInterval = time.Millisecond * 100
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	pool := NewTxPool(testTxPoolConfig, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.SubscribeNewTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	dropper, _ := crypto.GenerateKey()
+	publisher, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(dropper.PublicKey), big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(publisher.PublicKey), big.NewInt(1000000000))
+
+	dropped := pricedTransaction(0, 100000, big.NewInt(1), dropper)
+	published := pricedTransaction(0, 100000, big.NewInt(1), publisher)
+	if err := pool.AddPrivate(dropped, 2*evictionInterval, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(published, 2*evictionInterval, true); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(published, 0, true); err != ErrAlreadyKnown {
+		t.Fatalf("duplicate private transaction error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	for _, tx := range []*types.Transaction{dropped, published} {
+		if !pool.IsPrivate(tx.Hash()) {
+			t.Errorf("transaction %x not private", tx.Hash())
+		}
+	}
+	if pending, _ := pool.Stats(); pending != 2 {
+		t.Fatalf("pending transactions mismatched: have %d, want %d", pending, 2)
+	}
+	for addr, txs := range pool.local() {
+		if len(txs) != 0 {
+			t.Errorf("private transactions of %x reported for journaling: %v", addr, txs)
+		}
+	}
+	for _, key := range []*ecdsa.PrivateKey{dropper, publisher} {
+		if addr := crypto.PubkeyToAddress(key.PublicKey); pool.locals.contains(addr) {
+			t.Errorf("private transaction sender %x tracked as local", addr)
+		}
+	}
+	// Private transactions must not be announced on insertion
+	if err := validateEvents(events, 0); err != nil {
+		t.Fatalf("private transactions announced: %v", err)
+	}
+	time.Sleep(4 * evictionInterval)
+
+	if pool.IsPrivate(dropped.Hash()) || pool.IsPrivate(published.Hash()) {
+		t.Errorf("expired transactions still private")
+	}
+	if pool.Get(dropped.Hash()) != nil {
+		t.Errorf("expired private transaction not dropped")
+	}
+	if drop := pool.Dropped(dropped.Hash()); drop == nil || drop.Reason != TxDropExpired || !drop.Private {
+		t.Errorf("expired transaction drop mismatch: have %v, want private with reason %v", drop, TxDropExpired)
+	}
+	if pool.Get(published.Hash()) == nil {
+		t.Errorf("published private transaction dropped")
+	}
+	select {
+	case ev := <-events:
+		if len(ev.Txs) != 1 || ev.Txs[0].Hash() != published.Hash() {
+			t.Errorf("released transactions mismatch: have %v, want [%x]", ev.Txs, published.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("released transaction not announced")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
 // Tests that the pool rejects replacement dynamic fee transactions that don't
 // meet the minimum price bump required.
 func TestTransactionReplacementDynamicFee(t *testing.T) {
@@ -0,0 +1,91 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// privateTx is the bookkeeping kept for a transaction which must not be
+// propagated to the network.
+type privateTx struct {
+	deadline time.Time // Time after which the transaction stops being private
+	publish  bool      // Whether to broadcast the transaction on expiry instead of dropping it
+}
+
+// privateTxSet tracks the transactions submitted to the pool privately. It is
+// safe for concurrent use, so the network layer can query it without holding
+// the pool lock.
+type privateTxSet struct {
+	txs  map[common.Hash]*privateTx
+	lock sync.RWMutex
+}
+
+// newPrivateTxSet creates an empty private transaction set.
+func newPrivateTxSet() *privateTxSet {
+	return &privateTxSet{
+		txs: make(map[common.Hash]*privateTx),
+	}
+}
+
+// add marks a transaction private until the given deadline.
+func (s *privateTxSet) add(hash common.Hash, deadline time.Time, publish bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.txs[hash] = &privateTx{deadline: deadline, publish: publish}
+}
+
+// remove stops tracking a transaction as private.
+func (s *privateTxSet) remove(hash common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.txs, hash)
+}
+
+// contains reports whether a transaction is currently private.
+func (s *privateTxSet) contains(hash common.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.txs[hash]
+	return ok
+}
+
+// expire stops tracking all transactions whose deadline passed, returning the
+// ones to broadcast and the ones to drop.
+func (s *privateTxSet) expire(now time.Time) (publish []common.Hash, drop []common.Hash) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for hash, tx := range s.txs {
+		if now.Before(tx.deadline) {
+			continue
+		}
+		if tx.publish {
+			publish = append(publish, hash)
+		} else {
+			drop = append(drop, hash)
+		}
+		delete(s.txs, hash)
+	}
+	return publish, drop
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
@@ -34,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/miner"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
@@ -71,6 +73,14 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
+	// SYSCOIN chainlocks are the only finality signal, so safe and finalized agree
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		header := b.eth.blockchain.CurrentFinalizedHeader()
+		if header == nil {
+			return nil, errors.New("finalized block not found")
+		}
+		return header, nil
+	}
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
@@ -110,9 +120,28 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
+	if number == rpc.FinalizedBlockNumber || number == rpc.SafeBlockNumber {
+		block := b.eth.blockchain.CurrentFinalizedBlock()
+		if block == nil {
+			return nil, errors.New("finalized block not found")
+		}
+		return block, nil
+	}
 	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
 }
 
+func (b *EthAPIBackend) SimulatePendingBlock(ctx context.Context, timestamp uint64, baseFee *big.Int) (*types.Block, types.Receipts, []*ethapi.RejectedTx, error) {
+	block, receipts, rejected, err := b.eth.miner.SimulatePending(timestamp, baseFee)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	rpcRejected := make([]*ethapi.RejectedTx, len(rejected))
+	for i, reject := range rejected {
+		rpcRejected[i] = &ethapi.RejectedTx{Tx: reject.Tx, Err: reject.Err}
+	}
+	return block, receipts, rpcRejected, nil
+}
+
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
 	return b.eth.blockchain.GetBlockByHash(hash), nil
 }
@@ -156,7 +185,7 @@ func (b *EthAPIBackend) StateAndHeaderByNumber(ctx context.Context, number rpc.B
 	if header == nil {
 		return nil, nil, errors.New("header not found")
 	}
-	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	stateDb, err := b.stateAt(header)
 	return stateDb, header, err
 }
 
@@ -175,12 +204,24 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 		if blockNrOrHash.RequireCanonical && b.eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != hash {
 			return nil, nil, errors.New("hash is not currently canonical")
 		}
-		stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+		stateDb, err := b.stateAt(header)
 		return stateDb, header, err
 	}
 	return nil, nil, errors.New("invalid arguments; neither block nor hash specified")
 }
 
+// stateAt returns the state of the given block, falling back to the recorded
+// state history if the state trie of the block is not available anymore.
+func (b *EthAPIBackend) stateAt(header *types.Header) (*state.StateDB, error) {
+	stateDb, err := b.eth.BlockChain().StateAt(header.Root)
+	if err != nil && b.eth.config.StateHistory > 0 {
+		if historic, herr := b.eth.BlockChain().HistoricState(header); herr == nil {
+			return historic, nil
+		}
+	}
+	return stateDb, err
+}
+
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
 	return b.eth.blockchain.GetReceiptsByHash(hash), nil
 }
@@ -223,6 +264,10 @@ func (b *EthAPIBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Sub
 	return b.eth.BlockChain().SubscribeChainEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeNEVMMappingEvent(ch chan<- core.NEVMMappingEvent) event.Subscription {
+	return b.eth.BlockChain().SubscribeNEVMMappingEvent(ch)
+}
+
 func (b *EthAPIBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
 	return b.eth.BlockChain().SubscribeChainHeadEvent(ch)
 }
@@ -239,6 +284,14 @@ func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.AddLocal(signedTx)
 }
 
+func (b *EthAPIBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, lifetime time.Duration, publish bool) error {
+	return b.eth.txPool.AddPrivate(signedTx, lifetime, publish)
+}
+
+func (b *EthAPIBackend) SendBundle(ctx context.Context, txs types.Transactions, blockNumber uint64) (common.Hash, error) {
+	return b.eth.miner.AddBundle(txs, blockNumber)
+}
+
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	pending, err := b.eth.txPool.Pending(false)
 	if err != nil {
@@ -246,12 +299,15 @@ func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	}
 	var txs types.Transactions
 	for _, batch := range pending {
-		txs = append(txs, batch...)
+		txs = append(txs, b.publicTxs(batch)...)
 	}
 	return txs, nil
 }
 
 func (b *EthAPIBackend) GetPoolTransaction(hash common.Hash) *types.Transaction {
+	if b.eth.txPool.IsPrivate(hash) {
+		return nil
+	}
 	return b.eth.txPool.Get(hash)
 }
 
@@ -269,11 +325,47 @@ func (b *EthAPIBackend) Stats() (pending int, queued int) {
 }
 
 func (b *EthAPIBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
-	return b.eth.TxPool().Content()
+	pending, queued := b.eth.TxPool().Content()
+	for _, content := range []map[common.Address]types.Transactions{pending, queued} {
+		for addr, txs := range content {
+			if txs = b.publicTxs(txs); len(txs) > 0 {
+				content[addr] = txs
+			} else {
+				delete(content, addr)
+			}
+		}
+	}
+	return pending, queued
 }
 
 func (b *EthAPIBackend) TxPoolContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
-	return b.eth.TxPool().ContentFrom(addr)
+	pending, queued := b.eth.TxPool().ContentFrom(addr)
+	return b.publicTxs(pending), b.publicTxs(queued)
+}
+
+// publicTxs filters the private transactions out of a list retrieved from the
+// pool, so that they can't be discovered through the RPC APIs.
+func (b *EthAPIBackend) publicTxs(txs types.Transactions) types.Transactions {
+	public := txs[:0]
+	for _, tx := range txs {
+		if !b.eth.txPool.IsPrivate(tx.Hash()) {
+			public = append(public, tx)
+		}
+	}
+	return public
+}
+
+func (b *EthAPIBackend) TxPoolTransactionStatus(hash common.Hash) (core.TxStatus, *core.TxDropEvent) {
+	if b.eth.txPool.IsPrivate(hash) {
+		return core.TxStatusUnknown, nil
+	}
+	if status := b.eth.txPool.Status([]common.Hash{hash})[0]; status != core.TxStatusUnknown {
+		return status, nil
+	}
+	if drop := b.eth.txPool.Dropped(hash); drop != nil && !drop.Private {
+		return core.TxStatusUnknown, drop
+	}
+	return core.TxStatusUnknown, nil
 }
 
 func (b *EthAPIBackend) TxPool() *core.TxPool {
@@ -284,6 +376,10 @@ func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.S
 	return b.eth.TxPool().SubscribeNewTxsEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeDroppedTxsEvent(ch chan<- core.DroppedTxsEvent) event.Subscription {
+	return b.eth.TxPool().SubscribeDroppedTxsEvent(ch)
+}
+
 func (b *EthAPIBackend) Downloader() *downloader.Downloader {
 	return b.eth.Downloader()
 }
@@ -292,6 +388,10 @@ func (b *EthAPIBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error)
 	return b.gpo.SuggestTipCap(ctx)
 }
 
+func (b *EthAPIBackend) EstimateGasTipCaps(ctx context.Context, strategy string, confidences []float64) (string, []*big.Int, error) {
+	return b.gpo.EstimateTips(ctx, strategy, confidences)
+}
+
 func (b *EthAPIBackend) FeeHistory(ctx context.Context, blockCount int, lastBlock rpc.BlockNumber, rewardPercentiles []float64) (firstBlock *big.Int, reward [][]*big.Int, baseFee []*big.Int, gasUsedRatio []float64, err error) {
 	return b.gpo.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
 }
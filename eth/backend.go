@@ -66,12 +66,14 @@ type Config = ethconfig.Config
 type NEVMCreateBlockFn func(*Ethereum) *types.Block
 type NEVMAddBlockFn func(*types.NEVMBlockConnect, *Ethereum) error
 type NEVMDeleteBlockFn func(string, *Ethereum) error
+type NEVMFinalizeBlockFn func(string, *Ethereum) error
 
 type NEVMIndex struct {
 	// Callbacks
-	CreateBlock NEVMCreateBlockFn // Mines a block locally
-	AddBlock    NEVMAddBlockFn    // Connects a new NEVM block
-	DeleteBlock NEVMDeleteBlockFn // Disconnects NEVM tip
+	CreateBlock   NEVMCreateBlockFn   // Mines a block locally
+	AddBlock      NEVMAddBlockFn      // Connects a new NEVM block
+	DeleteBlock   NEVMDeleteBlockFn   // Disconnects NEVM tip
+	FinalizeBlock NEVMFinalizeBlockFn // Finalizes a NEVM block chainlocked on SYS
 }
 
 
@@ -97,6 +99,8 @@ type Ethereum struct {
 	bloomIndexer      *core.ChainIndexer             // Bloom indexer operating during block imports
 	closeBloomHandler chan struct{}
 
+	statePruner *pruner.OnlinePruner // Online state pruner, nil if disabled
+
 	APIBackend *EthAPIBackend
 
 	miner     *miner.Miner
@@ -146,17 +150,55 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	ethashConfig := config.Ethash
 	ethashConfig.NotifyFull = config.Miner.NotifyFull
 
+	if stack.Config().AncientReadOnly && config.SyncMode != downloader.FullSync {
+		log.Warn("Read-only ancient store only supports full sync", "provided", config.SyncMode, "updated", downloader.FullSync)
+		config.SyncMode = downloader.FullSync
+	}
 	// Assemble the Ethereum object
 	chainDb, err := stack.OpenDatabaseWithFreezer("chaindata", config.DatabaseCache, config.DatabaseHandles, config.DatabaseFreezer, "eth/db/chaindata/", false)
 	if err != nil {
 		return nil, err
 	}
+	// Resolve the trie node storage scheme before the genesis state is written
+	scheme, err := rawdb.ParseStateScheme(config.StateScheme, chainDb)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == rawdb.PathScheme {
+		if config.NoPruning {
+			return nil, errors.New("archive mode is not supported by the path state scheme")
+		}
+		if config.SyncMode != downloader.FullSync {
+			log.Warn("Path state scheme only supports full sync", "provided", config.SyncMode, "updated", downloader.FullSync)
+			config.SyncMode = downloader.FullSync
+		}
+	}
+	log.Info("Using trie node storage scheme", "scheme", scheme)
+	if config.StateHistory > 0 && config.SnapshotCache == 0 {
+		log.Warn("State history requires snapshots, disabling")
+		config.StateHistory = 0
+	}
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideLondon)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	// The binary trie scheme is selected by the genesis, not by the user
+	if chainConfig.IsBinaryTrie(common.Big0) {
+		if config.StateScheme != "" || rawdb.ReadStateScheme(chainDb) != rawdb.BinaryScheme {
+			return nil, fmt.Errorf("binary trie chain incompatible with %s state scheme", scheme)
+		}
+		scheme = rawdb.BinaryScheme
+		if config.SyncMode != downloader.FullSync {
+			log.Warn("Binary trie state only supports full sync", "provided", config.SyncMode, "updated", downloader.FullSync)
+			config.SyncMode = downloader.FullSync
+		}
+		log.Warn("Using experimental binary trie state")
+	} else if scheme == rawdb.BinaryScheme {
+		return nil, errors.New("binary trie database requires a binary trie chain configuration")
+	}
+
 	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal)); err != nil {
 		log.Error("Failed to recover state", "error", err)
 	}
@@ -206,6 +248,8 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			StateScheme:         scheme,
+			StateHistory:        config.StateHistory,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -220,6 +264,21 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
 
+	if config.StatePruneInterval > 0 {
+		if config.NoPruning || config.SnapshotCache == 0 {
+			log.Warn("Online state pruning requires full gcmode and snapshots, disabling")
+		} else if scheme == rawdb.PathScheme {
+			log.Warn("Online state pruning is not needed by the path state scheme, disabling")
+		} else if scheme == rawdb.BinaryScheme {
+			log.Warn("Online state pruning is not supported by the binary trie, disabling")
+		} else {
+			eth.statePruner = pruner.NewOnlinePruner(eth.blockchain, chainDb, stack.ResolvePath(""), pruner.OnlineConfig{
+				Interval:  config.StatePruneInterval,
+				BloomSize: config.StatePruneBloomSize,
+			})
+		}
+	}
+
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
@@ -390,6 +449,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		} else {
 			log.Info("not building on tip, add to mapping...", "blockhash", nevmBlockConnect.Blockhash, "currenthash", currentHash.String(), "proposedparenthash", nevmBlockConnect.Parenthash.String())
 		}
+		// only announce the mapping once the block it connects was accepted
+		eth.blockchain.PostNEVMMappingEvent(core.NEVMMappingEvent{
+			SysBlockHash:  nevmBlockConnect.Sysblockhash,
+			NEVMBlockHash: nevmBlockConnect.Blockhash,
+			Number:        nextBlockNumber,
+			Header:        eth.blockchain.GetHeaderByHash(nevmBlockConnect.Blockhash),
+		})
 		return nil
 	}
 	// mappings are assumed to be correct on lookup based on addBlock
@@ -424,10 +490,31 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			}
 		}
 		eth.blockchain.DeleteNEVMMappings(sysBlockhash, nevmBlockhash, currentParentHash, current.NumberU64())
+		eth.blockchain.PostNEVMMappingEvent(core.NEVMMappingEvent{SysBlockHash: sysBlockhash, NEVMBlockHash: nevmBlockhash, Number: current.NumberU64(), Removed: true})
+		return nil
+	}
+	// a chainlock on the SYS block makes the NEVM block it connected final
+	finalizeBlock := func(sysBlockhash string, eth *Ethereum) error {
+		nevmBlockhash := eth.blockchain.GetSYSMapping(sysBlockhash)
+		if nevmBlockhash == (common.Hash{}) {
+			return errors.New("finalizeBlock: NEVM block hash does not exist in SYS Mapping")
+		}
+		header := eth.blockchain.GetHeaderByHash(nevmBlockhash)
+		if header == nil {
+			return errors.New("finalizeBlock: NEVM block not found")
+		}
+		if eth.blockchain.GetCanonicalHash(header.Number.Uint64()) != nevmBlockhash {
+			return errors.New("finalizeBlock: NEVM block is not canonical")
+		}
+		// chainlocks only move forward, ignore stale notifications
+		if finalized := eth.blockchain.CurrentFinalizedHeader(); finalized != nil && finalized.Number.Uint64() >= header.Number.Uint64() {
+			return nil
+		}
+		eth.blockchain.SetFinalized(header)
 		return nil
 	}
 	if ethashConfig.PowMode == ethash.ModeNEVM {
-		eth.zmqRep = NewZMQRep(eth, config.NEVMPubEP, NEVMIndex{createBlock, addBlock, deleteBlock})
+		eth.zmqRep = NewZMQRep(eth, config.NEVMPubEP, NEVMIndex{createBlock, addBlock, deleteBlock, finalizeBlock})
 	}
 	return eth, err
 }
@@ -680,7 +767,7 @@ func (s *Ethereum) BloomIndexer() *core.ChainIndexer   { return s.bloomIndexer }
 // network protocols to start.
 func (s *Ethereum) Protocols() []p2p.Protocol {
 	protos := eth.MakeProtocols((*ethHandler)(s.handler), s.networkID, s.ethDialCandidates)
-	if s.config.SnapshotCache > 0 {
+	if s.config.SnapshotCache > 0 && s.blockchain.StateCache().TrieDB().Scheme() != rawdb.BinaryScheme {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
 	}
 	return protos
@@ -694,6 +781,10 @@ func (s *Ethereum) Start() error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers(params.BloomBitsBlocks)
 
+	if s.statePruner != nil {
+		s.statePruner.Start()
+	}
+
 	// Figure out a max peers count based on the server limits
 	maxPeers := s.p2pServer.MaxPeers
 	if s.config.LightServ > 0 {
@@ -728,6 +819,9 @@ func (s *Ethereum) Stop() error {
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
 	s.miner.Stop()
+	if s.statePruner != nil {
+		s.statePruner.Stop()
+	}
 	s.blockchain.Stop()
 	s.engine.Close()
 	rawdb.PopUncleanShutdownMarker(s.chainDb)
@@ -47,6 +47,9 @@ var FullNodeGPO = gasprice.Config{
 	MaxBlockHistory:  1024,
 	MaxPrice:         gasprice.DefaultMaxPrice,
 	IgnorePrice:      gasprice.DefaultIgnorePrice,
+	Strategy:         gasprice.StrategyPercentile,
+	HalfLife:         gasprice.DefaultHalfLife,
+	TargetBlocks:     gasprice.DefaultTargetBlocks,
 }
 
 // LightClientGPO contains default gasprice oracle settings for light client.
@@ -57,6 +60,9 @@ var LightClientGPO = gasprice.Config{
 	MaxBlockHistory:  5,
 	MaxPrice:         gasprice.DefaultMaxPrice,
 	IgnorePrice:      gasprice.DefaultIgnorePrice,
+	Strategy:         gasprice.StrategyPercentile,
+	HalfLife:         gasprice.DefaultHalfLife,
+	TargetBlocks:     gasprice.DefaultTargetBlocks,
 }
 
 // Defaults contains default settings for use on the Ethereum main net.
@@ -136,6 +142,18 @@ type Config struct {
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
 
+	// StateScheme is the trie node storage scheme ("hash" or "path") used when
+	// creating a new database, existing ones keep their scheme.
+	StateScheme string `toml:",omitempty"`
+
+	// StateHistory is the number of recent blocks to record flat state diffs for,
+	// serving historical state queries without archive mode (0 = disabled).
+	StateHistory uint64 `toml:",omitempty"`
+
+	// Online state pruning
+	StatePruneInterval  time.Duration `toml:",omitempty"` // Time between two online state pruning rounds (0 = disabled)
+	StatePruneBloomSize uint64        `toml:",omitempty"` // Megabytes of memory allocated to the online pruning bloom filter
+
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
 
@@ -28,12 +28,36 @@ import (
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// maxReplayQueue is the number of live logs a logs subscription may queue up while
+// replaying historical ones. Subscriptions falling further behind are closed.
+var maxReplayQueue = 10000
+
+// errReplayOverflow is returned to the logs subscriptions closed for queueing up
+// too many live logs while replaying historical ones.
+var errReplayOverflow = errors.New("logs subscription fell behind its replay")
+
+const (
+	// replayTrackDepth is the number of blocks below the head whose replayed logs
+	// are tracked to de-duplicate the live events of a logs subscription.
+	replayTrackDepth = 1024
+
+	// maxBlockHashes is the maximum number of block hashes a log query may target.
+	maxBlockHashes = 1024
+
+	// defaultLogsPageLimit is the number of logs returned per page by a paginated
+	// log query not specifying a limit.
+	defaultLogsPageLimit = 10000
+)
+
 // filter is a helper struct that holds meta information over the filter type
 // and associated subscription in the event system.
 type filter struct {
@@ -175,6 +199,39 @@ func (api *PublicFilterAPI) NewPendingTransactions(ctx context.Context) (*rpc.Su
 	return rpcSub, nil
 }
 
+// DroppedTransactions creates a subscription that is triggered each time a transaction
+// leaves the transaction pool, reporting the reason it was dropped.
+func (api *PublicFilterAPI) DroppedTransactions(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		drops := make(chan []*core.TxDropEvent, 128)
+		droppedTxSub := api.events.SubscribeDroppedTxs(drops)
+
+		for {
+			select {
+			case evs := <-drops:
+				for _, ev := range evs {
+					notifier.Notify(rpcSub.ID, ev)
+				}
+			case <-rpcSub.Err():
+				droppedTxSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				droppedTxSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // NewBlockFilter creates a filter that fetches blocks that are imported into the chain.
 // It is part of the filter package since polling goes with eth_getFilterChanges.
 //
@@ -240,16 +297,138 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
-// Logs creates a subscription that fires for all new log that match the given filter criteria.
-func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
+// NEVMMapping is sent to NEVM mapping subscriptions when Syscoin connects a block,
+// or disconnects it if Removed is set.
+type NEVMMapping struct {
+	SysBlockHash  string         `json:"sysBlockHash"`
+	NEVMBlockHash common.Hash    `json:"nevmBlockHash"`
+	Number        hexutil.Uint64 `json:"number"`
+	Removed       bool           `json:"removed"`
+}
+
+// NevmMappings sends a notification each time Syscoin connects or disconnects a
+// block, writing or deleting the mapping between the Syscoin and NEVM block.
+func (api *PublicFilterAPI) NevmMappings(ctx context.Context) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
 	}
 
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		mappings := make(chan *core.NEVMMappingEvent)
+		mappingsSub := api.events.SubscribeNEVMMappings(mappings)
+
+		for {
+			select {
+			case m := <-mappings:
+				notifier.Notify(rpcSub.ID, &NEVMMapping{
+					SysBlockHash:  m.SysBlockHash,
+					NEVMBlockHash: m.NEVMBlockHash,
+					Number:        hexutil.Uint64(m.Number),
+					Removed:       m.Removed,
+				})
+			case <-rpcSub.Err():
+				mappingsSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				mappingsSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// SyscoinConfirmedHeads sends a notification each time a block is both appended
+// to the chain and connected by Syscoin, whichever happens last.
+func (api *PublicFilterAPI) SyscoinConfirmedHeads(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		headers := make(chan *types.Header)
+		headersSub := api.events.SubscribeSyscoinConfirmedHeads(headers)
+
+		for {
+			select {
+			case h := <-headers:
+				notifier.Notify(rpcSub.ID, h)
+			case <-rpcSub.Err():
+				headersSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				headersSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
+// LogsSubscriptionOptions configures the optional behaviour of a logs subscription.
+type LogsSubscriptionOptions struct {
+	Replay       bool `json:"replay"`       // Replay the historical logs from the fromBlock or blockHash criteria
+	ReorgMarkers bool `json:"reorgMarkers"` // Precede the logs removed by a reorg with a ReorgMarker
+}
+
+// ReorgMarker is sent to logs subscriptions opting in to it, ahead of the logs
+// removed by a chain reorganisation.
+type ReorgMarker struct {
+	Reorg       bool           `json:"reorg"`       // Always true, distinguishing markers from logs
+	BlockNumber hexutil.Uint64 `json:"blockNumber"` // Lowest block number of the removed logs
+	Removed     hexutil.Uint   `json:"removed"`     // Number of removed logs following the marker
+}
+
+// newReorgMarker creates the marker announcing a batch of removed logs.
+func newReorgMarker(logs []*types.Log) *ReorgMarker {
+	marker := &ReorgMarker{Reorg: true, BlockNumber: hexutil.Uint64(logs[0].BlockNumber), Removed: hexutil.Uint(len(logs))}
+	for _, log := range logs {
+		if log.BlockNumber < uint64(marker.BlockNumber) {
+			marker.BlockNumber = hexutil.Uint64(log.BlockNumber)
+		}
+	}
+	return marker
+}
+
+// Logs creates a subscription that fires for all new log that match the given filter criteria.
+//
+// Subscriptions opting in to replay with a fromBlock or a blockHash criteria first
+// get the matching logs already in the chain from that block, before switching to
+// live events. Otherwise, as before, the fromBlock is ignored. A block hash no longer
+// in the canonical chain first has its logs, and those of its side chain
+// descendants, sent back with removed set to true. Subscriptions opting in to reorg
+// markers receive a ReorgMarker ahead of each batch of removed logs. A subscription
+// whose replay fails, or which queues up too many live logs meanwhile, is closed
+// with an error delivered to the client.
+func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria, opts *LogsSubscriptionOptions) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	// Resolve where to replay from up front, so invalid starting points are refused
+	var (
+		from    uint64
+		removed []*types.Log
+		replay  bool
+	)
+	if opts != nil && opts.Replay {
+		var err error
+		if from, removed, replay, err = api.replayStart(ctx, crit); err != nil {
+			return nil, err
+		}
+	}
 	var (
 		rpcSub      = notifier.CreateSubscription()
 		matchedLogs = make(chan []*types.Log)
+		markers     = opts != nil && opts.ReorgMarkers
 	)
 
 	logsSub, err := api.events.SubscribeLogs(ethereum.FilterQuery(crit), matchedLogs)
@@ -258,13 +437,63 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	}
 
 	go func() {
-
+		notify := func(logs []*types.Log) {
+			if markers && len(logs) > 0 && logs[0].Removed {
+				notifier.Notify(rpcSub.ID, newReorgMarker(logs))
+			}
+			for _, log := range logs {
+				notifier.Notify(rpcSub.ID, log)
+			}
+		}
+		// Replay the historical logs in the background, queueing up live events
+		// meanwhile so the event system is never blocked.
+		var (
+			replayCtx, cancel = context.WithCancel(context.Background())
+			replayDone        chan error
+			queue             [][]*types.Log
+			queued            int
+			seen              map[common.Hash]struct{}
+			head              uint64
+		)
+		defer cancel()
+
+		if replay {
+			replayDone = make(chan error, 1)
+			seen = make(map[common.Hash]struct{})
+			go func() {
+				var err error
+				head, err = api.replayLogs(replayCtx, crit, from, removed, seen, notify)
+				replayDone <- err
+			}()
+		}
 		for {
 			select {
 			case logs := <-matchedLogs:
-				for _, log := range logs {
-					notifier.Notify(rpcSub.ID, &log)
+				if replayDone != nil {
+					if queued += len(logs); queued > maxReplayQueue {
+						log.Warn("Dropping logs subscription falling behind its replay", "id", rpcSub.ID, "queued", queued)
+						logsSub.Unsubscribe()
+						notifier.Close(rpcSub.ID, errReplayOverflow)
+						return
+					}
+					queue = append(queue, logs)
+					continue
+				}
+				notify(logs)
+
+			case err := <-replayDone:
+				replayDone = nil
+				if err != nil {
+					log.Warn("Failed to replay logs", "id", rpcSub.ID, "err", err)
+					logsSub.Unsubscribe()
+					notifier.Close(rpcSub.ID, fmt.Errorf("log replay failed: %v", err))
+					return
+				}
+				for _, logs := range queue {
+					notify(unseenLogs(logs, head, seen))
 				}
+				queue, queued, seen = nil, 0, nil
+
 			case <-rpcSub.Err(): // client send an unsubscribe request
 				logsSub.Unsubscribe()
 				return
@@ -278,6 +507,103 @@ func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc
 	return rpcSub, nil
 }
 
+// replayStart returns the block from which a logs subscription replays historical
+// logs, if any, along with the logs to report as removed first if the subscription
+// resumes from a block no longer in the canonical chain.
+func (api *PublicFilterAPI) replayStart(ctx context.Context, crit FilterCriteria) (uint64, []*types.Log, bool, error) {
+	if crit.BlockHash == nil {
+		if crit.FromBlock == nil || crit.FromBlock.Sign() < 0 {
+			return 0, nil, false, nil
+		}
+		return crit.FromBlock.Uint64(), nil, true, nil
+	}
+	header, err := api.backend.HeaderByHash(ctx, *crit.BlockHash)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if header == nil {
+		return 0, nil, false, errors.New("unknown block")
+	}
+	// Walk back to the canonical chain, collecting the logs of the side chain
+	var removed []*types.Log
+	for rawdb.ReadCanonicalHash(api.chainDb, header.Number.Uint64()) != header.Hash() {
+		logsList, err := api.backend.GetLogs(ctx, header.Hash())
+		if err != nil {
+			return 0, nil, false, err
+		}
+		var unfiltered []*types.Log
+		for _, logs := range logsList {
+			unfiltered = append(unfiltered, logs...)
+		}
+		for _, log := range filterLogs(unfiltered, nil, nil, crit.Addresses, crit.Topics) {
+			cpy := *log
+			cpy.Removed = true
+			removed = append(removed, &cpy)
+		}
+		parent, err := api.backend.HeaderByHash(ctx, header.ParentHash)
+		if err != nil {
+			return 0, nil, false, err
+		}
+		if parent == nil {
+			return 0, nil, false, errors.New("unknown ancestor")
+		}
+		header = parent
+	}
+	if len(removed) > 0 {
+		// The common ancestor was reached, resume from its canonical child
+		return header.Number.Uint64() + 1, removed, true, nil
+	}
+	return header.Number.Uint64(), nil, true, nil
+}
+
+// replayLogs sends the logs removed from a side chain, followed by the historical
+// logs matching the criteria from the given block up to the current head. The
+// hashes of the replayed blocks close to the head are recorded in seen to allow
+// de-duplicating the live events received meanwhile.
+func (api *PublicFilterAPI) replayLogs(ctx context.Context, crit FilterCriteria, from uint64, removed []*types.Log, seen map[common.Hash]struct{}, notify func([]*types.Log)) (uint64, error) {
+	if len(removed) > 0 {
+		notify(removed)
+	}
+	header, err := api.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if header == nil || err != nil {
+		return 0, err
+	}
+	head := header.Number.Uint64()
+
+	end := head
+	if crit.ToBlock != nil && crit.ToBlock.Sign() >= 0 && crit.ToBlock.Uint64() < end {
+		end = crit.ToBlock.Uint64()
+	}
+	if from > end {
+		return head, nil
+	}
+	filter := NewRangeFilter(api.backend, int64(from), int64(end), crit.Addresses, crit.Topics)
+	err = filter.Iterate(ctx, nil, func(log *types.Log) bool {
+		if log.BlockNumber+replayTrackDepth > head {
+			seen[log.BlockHash] = struct{}{}
+		}
+		notify([]*types.Log{log})
+		return true
+	})
+	return head, err
+}
+
+// unseenLogs filters a batch of live logs received during a replay up to head,
+// dropping the logs of blocks already replayed and the removal of logs from blocks
+// which never were.
+func unseenLogs(logs []*types.Log, head uint64, seen map[common.Hash]struct{}) []*types.Log {
+	var fresh []*types.Log
+	for _, log := range logs {
+		if log.BlockNumber <= head {
+			if _, replayed := seen[log.BlockHash]; replayed != log.Removed {
+				continue
+			}
+		}
+		fresh = append(fresh, log)
+	}
+	return fresh
+}
+
 // FilterCriteria represents a request to create a new filter.
 // Same as ethereum.FilterQuery but with UnmarshalJSON() method.
 type FilterCriteria ethereum.FilterQuery
@@ -331,31 +657,76 @@ func (api *PublicFilterAPI) NewFilter(crit FilterCriteria) (rpc.ID, error) {
 //
 // https://eth.wiki/json-rpc/API#eth_getlogs
 func (api *PublicFilterAPI) GetLogs(ctx context.Context, crit FilterCriteria) ([]*types.Log, error) {
-	var filter *Filter
-	if crit.BlockHash != nil {
-		// Block filter requested, construct a single-shot filter
-		filter = NewBlockFilter(api.backend, *crit.BlockHash, crit.Addresses, crit.Topics)
-	} else {
-		// Convert the RPC block numbers into internal representations
-		begin := rpc.LatestBlockNumber.Int64()
-		if crit.FromBlock != nil {
-			begin = crit.FromBlock.Int64()
-		}
-		end := rpc.LatestBlockNumber.Int64()
-		if crit.ToBlock != nil {
-			end = crit.ToBlock.Int64()
-		}
-		// Construct the range filter
-		filter = NewRangeFilter(api.backend, begin, end, crit.Addresses, crit.Topics)
-	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
+	filter := newCriteriaFilter(api.backend, crit)
+
+	// Run the filter and return all the logs, or up to the requested limit
+	var logs []*types.Log
+	err := filter.Iterate(ctx, nil, func(log *types.Log) bool {
+		logs = append(logs, log)
+		return crit.Limit == 0 || uint64(len(logs)) < crit.Limit
+	})
 	if err != nil {
 		return nil, err
 	}
 	return returnLogs(logs), err
 }
 
+// LogsPage is a page of the logs matching a filter, along with the cursor from
+// which to retrieve the next page.
+type LogsPage struct {
+	Logs   []*types.Log `json:"logs"`
+	Cursor *LogCursor   `json:"cursor"` // nil if there are no more logs
+}
+
+// GetLogsPage returns the logs matching the given argument, starting at the cursor
+// if one is given. At most crit.Limit logs are returned (or defaultLogsPageLimit
+// if unset), along with the cursor to resume from if more logs match.
+func (api *PublicFilterAPI) GetLogsPage(ctx context.Context, crit FilterCriteria, cursor *LogCursor) (*LogsPage, error) {
+	limit := crit.Limit
+	if limit == 0 {
+		limit = defaultLogsPageLimit
+	}
+	filter := newCriteriaFilter(api.backend, crit)
+
+	// Retrieve one log past the limit to know where the next page starts
+	page := &LogsPage{Logs: []*types.Log{}}
+	err := filter.Iterate(ctx, cursor, func(log *types.Log) bool {
+		if uint64(len(page.Logs)) == limit {
+			page.Cursor = &LogCursor{Block: log.BlockNumber, Index: log.Index}
+			return false
+		}
+		page.Logs = append(page.Logs, log)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// newCriteriaFilter constructs the one-shot filter retrieving the logs matching
+// the given criteria.
+func newCriteriaFilter(backend Backend, crit FilterCriteria) *Filter {
+	switch {
+	case crit.BlockHash != nil:
+		// Block filter requested, construct a single-shot filter
+		return NewBlockFilter(backend, *crit.BlockHash, crit.Addresses, crit.Topics)
+	case len(crit.BlockHashes) > 0:
+		return NewBlocksFilter(backend, crit.BlockHashes, crit.Addresses, crit.Topics)
+	}
+	// Convert the RPC block numbers into internal representations
+	begin := rpc.LatestBlockNumber.Int64()
+	if crit.FromBlock != nil {
+		begin = crit.FromBlock.Int64()
+	}
+	end := rpc.LatestBlockNumber.Int64()
+	if crit.ToBlock != nil {
+		end = crit.ToBlock.Int64()
+	}
+	// Construct the range filter
+	return NewRangeFilter(backend, begin, end, crit.Addresses, crit.Topics)
+}
+
 // UninstallFilter removes the filter with the given filter id.
 //
 // https://eth.wiki/json-rpc/API#eth_uninstallfilter
@@ -386,25 +757,8 @@ func (api *PublicFilterAPI) GetFilterLogs(ctx context.Context, id rpc.ID) ([]*ty
 		return nil, fmt.Errorf("filter not found")
 	}
 
-	var filter *Filter
-	if f.crit.BlockHash != nil {
-		// Block filter requested, construct a single-shot filter
-		filter = NewBlockFilter(api.backend, *f.crit.BlockHash, f.crit.Addresses, f.crit.Topics)
-	} else {
-		// Convert the RPC block numbers into internal representations
-		begin := rpc.LatestBlockNumber.Int64()
-		if f.crit.FromBlock != nil {
-			begin = f.crit.FromBlock.Int64()
-		}
-		end := rpc.LatestBlockNumber.Int64()
-		if f.crit.ToBlock != nil {
-			end = f.crit.ToBlock.Int64()
-		}
-		// Construct the range filter
-		filter = NewRangeFilter(api.backend, begin, end, f.crit.Addresses, f.crit.Topics)
-	}
 	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
+	logs, err := newCriteriaFilter(api.backend, f.crit).Logs(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -466,11 +820,13 @@ func returnLogs(logs []*types.Log) []*types.Log {
 // UnmarshalJSON sets *args fields with given data.
 func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
 	type input struct {
-		BlockHash *common.Hash     `json:"blockHash"`
-		FromBlock *rpc.BlockNumber `json:"fromBlock"`
-		ToBlock   *rpc.BlockNumber `json:"toBlock"`
-		Addresses interface{}      `json:"address"`
-		Topics    []interface{}    `json:"topics"`
+		BlockHash   *common.Hash     `json:"blockHash"`
+		BlockHashes []common.Hash    `json:"blockHashes"`
+		FromBlock   *rpc.BlockNumber `json:"fromBlock"`
+		ToBlock     *rpc.BlockNumber `json:"toBlock"`
+		Addresses   interface{}      `json:"address"`
+		Topics      []interface{}    `json:"topics"`
+		Limit       *hexutil.Uint64  `json:"limit"`
 	}
 
 	var raw input
@@ -483,7 +839,22 @@ func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
 			// BlockHash is mutually exclusive with FromBlock/ToBlock criteria
 			return fmt.Errorf("cannot specify both BlockHash and FromBlock/ToBlock, choose one or the other")
 		}
+		if raw.BlockHashes != nil {
+			return fmt.Errorf("cannot specify both BlockHash and BlockHashes, choose one or the other")
+		}
 		args.BlockHash = raw.BlockHash
+	} else if raw.BlockHashes != nil {
+		if raw.FromBlock != nil || raw.ToBlock != nil {
+			// BlockHashes is mutually exclusive with FromBlock/ToBlock criteria
+			return fmt.Errorf("cannot specify both BlockHashes and FromBlock/ToBlock, choose one or the other")
+		}
+		if len(raw.BlockHashes) == 0 {
+			return errors.New("empty BlockHashes")
+		}
+		if len(raw.BlockHashes) > maxBlockHashes {
+			return fmt.Errorf("too many BlockHashes (%d > %d)", len(raw.BlockHashes), maxBlockHashes)
+		}
+		args.BlockHashes = raw.BlockHashes
 	} else {
 		if raw.FromBlock != nil {
 			args.FromBlock = big.NewInt(raw.FromBlock.Int64())
@@ -494,6 +865,9 @@ func (args *FilterCriteria) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	if raw.Limit != nil {
+		args.Limit = uint64(*raw.Limit)
+	}
 	args.Addresses = []common.Address{}
 
 	if raw.Addresses != nil {
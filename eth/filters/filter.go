@@ -18,10 +18,14 @@ package filters
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -38,7 +42,9 @@ type Backend interface {
 	GetLogs(ctx context.Context, blockHash common.Hash) ([][]*types.Log, error)
 
 	SubscribeNewTxsEvent(chan<- core.NewTxsEvent) event.Subscription
+	SubscribeDroppedTxsEvent(chan<- core.DroppedTxsEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeNEVMMappingEvent(ch chan<- core.NEVMMappingEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 	SubscribePendingLogsEvent(ch chan<- []*types.Log) event.Subscription
@@ -55,8 +61,8 @@ type Filter struct {
 	addresses []common.Address
 	topics    [][]common.Hash
 
-	block      common.Hash // Block hash if filtering a single block
-	begin, end int64       // Range interval if filtering multiple blocks
+	blocks     []common.Hash // Block hashes if filtering a set of blocks
+	begin, end int64         // Range interval if filtering multiple blocks
 
 	matcher *bloombits.Matcher
 }
@@ -97,9 +103,27 @@ func NewRangeFilter(backend Backend, begin, end int64, addresses []common.Addres
 // NewBlockFilter creates a new filter which directly inspects the contents of
 // a block to figure out whether it is interesting or not.
 func NewBlockFilter(backend Backend, block common.Hash, addresses []common.Address, topics [][]common.Hash) *Filter {
+	return NewBlocksFilter(backend, []common.Hash{block}, addresses, topics)
+}
+
+// NewBlocksFilter creates a new filter which directly inspects the contents of
+// each of the given blocks, returning their logs in chain order. Duplicate hashes
+// are only inspected once and the zero hash is ignored as unset.
+func NewBlocksFilter(backend Backend, blocks []common.Hash, addresses []common.Address, topics [][]common.Hash) *Filter {
 	// Create a generic filter and convert it into a block filter
 	filter := newFilter(backend, addresses, topics)
-	filter.block = block
+
+	seen := make(map[common.Hash]struct{}, len(blocks))
+	for _, hash := range blocks {
+		if hash == (common.Hash{}) {
+			continue
+		}
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		filter.blocks = append(filter.blocks, hash)
+	}
 	return filter
 }
 
@@ -114,72 +138,170 @@ func newFilter(backend Backend, addresses []common.Address, topics [][]common.Ha
 	}
 }
 
+// errIterationStopped is returned internally when the consumer of the logs
+// doesn't want any more of them.
+var errIterationStopped = errors.New("iteration stopped")
+
+// LogCursor is the position in the chain at which a paginated log query resumes.
+// It is encoded as an opaque hex token of the block number and the log index.
+type LogCursor struct {
+	Block uint64 // Number of the block to resume from
+	Index uint   // Index within the block of the first log to return
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (c LogCursor) MarshalText() ([]byte, error) {
+	var blob [12]byte
+	binary.BigEndian.PutUint64(blob[:8], c.Block)
+	binary.BigEndian.PutUint32(blob[8:], uint32(c.Index))
+	return hexutil.Bytes(blob[:]).MarshalText()
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (c *LogCursor) UnmarshalText(input []byte) error {
+	var blob hexutil.Bytes
+	if err := blob.UnmarshalText(input); err != nil {
+		return err
+	}
+	if len(blob) != 12 {
+		return fmt.Errorf("invalid log cursor length %d", len(blob))
+	}
+	c.Block = binary.BigEndian.Uint64(blob[:8])
+	c.Index = uint(binary.BigEndian.Uint32(blob[8:]))
+	return nil
+}
+
+// before reports whether a log precedes the cursor and must thus be skipped.
+func (c *LogCursor) before(log *types.Log) bool {
+	return c != nil && (log.BlockNumber < c.Block || (log.BlockNumber == c.Block && log.Index < c.Index))
+}
+
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
-	// If we're doing singleton block filtering, execute and return
-	if f.block != (common.Hash{}) {
-		header, err := f.backend.HeaderByHash(ctx, f.block)
-		if err != nil {
-			return nil, err
+	var logs []*types.Log
+	err := f.Iterate(ctx, nil, func(log *types.Log) bool {
+		logs = append(logs, log)
+		return true
+	})
+	return logs, err
+}
+
+// Iterate streams the logs matching the filter criteria to fn in chain order,
+// skipping any preceding the cursor if one is given. Iteration stops as soon as
+// fn returns false, without looking up the remaining blocks.
+func (f *Filter) Iterate(ctx context.Context, cursor *LogCursor, fn func(*types.Log) bool) error {
+	emit := func(logs []*types.Log) error {
+		for _, log := range logs {
+			if cursor.before(log) {
+				continue
+			}
+			if !fn(log) {
+				return errIterationStopped
+			}
 		}
-		if header == nil {
-			return nil, errors.New("unknown block")
+		return nil
+	}
+	err := f.iterate(ctx, cursor, emit)
+	if err == errIterationStopped {
+		return nil
+	}
+	return err
+}
+
+// iterate feeds the logs matching the filter criteria to emit, block by block.
+func (f *Filter) iterate(ctx context.Context, cursor *LogCursor, emit func([]*types.Log) error) error {
+	// If we're doing block set filtering, execute and return
+	if len(f.blocks) > 0 {
+		headers := make([]*types.Header, 0, len(f.blocks))
+		for _, hash := range f.blocks {
+			header, err := f.backend.HeaderByHash(ctx, hash)
+			if err != nil {
+				return err
+			}
+			if header == nil {
+				return errors.New("unknown block")
+			}
+			headers = append(headers, header)
+		}
+		sort.SliceStable(headers, func(i, j int) bool {
+			return headers[i].Number.Cmp(headers[j].Number) < 0
+		})
+		for _, header := range headers {
+			if cursor != nil && header.Number.Uint64() < cursor.Block {
+				continue
+			}
+			found, err := f.blockLogs(ctx, header)
+			if err != nil {
+				return err
+			}
+			if err := emit(found); err != nil {
+				return err
+			}
 		}
-		return f.blockLogs(ctx, header)
+		return nil
 	}
 	// Figure out the limits of the filter range
 	header, _ := f.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	if header == nil {
-		return nil, nil
+		return nil
 	}
 	head := header.Number.Uint64()
 
+	// Resolve the finality tags against the latest chainlocked block
+	for _, number := range []*int64{&f.begin, &f.end} {
+		if *number == rpc.FinalizedBlockNumber.Int64() || *number == rpc.SafeBlockNumber.Int64() {
+			finalized, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(*number))
+			if err != nil {
+				return err
+			}
+			if finalized == nil {
+				return errors.New("finalized block not found")
+			}
+			*number = finalized.Number.Int64()
+		}
+	}
 	if f.begin == -1 {
 		f.begin = int64(head)
 	}
+	if cursor != nil && int64(cursor.Block) > f.begin {
+		f.begin = int64(cursor.Block)
+	}
 	end := uint64(f.end)
 	if f.end == -1 {
 		end = head
 	}
 	// Gather all indexed logs, and finish with non indexed ones
-	var (
-		logs []*types.Log
-		err  error
-	)
 	size, sections := f.backend.BloomStatus()
 	if indexed := sections * size; indexed > uint64(f.begin) {
+		var err error
 		if indexed > end {
-			logs, err = f.indexedLogs(ctx, end)
+			err = f.indexedLogs(ctx, end, emit)
 		} else {
-			logs, err = f.indexedLogs(ctx, indexed-1)
+			err = f.indexedLogs(ctx, indexed-1, emit)
 		}
 		if err != nil {
-			return logs, err
+			return err
 		}
 	}
-	rest, err := f.unindexedLogs(ctx, end)
-	logs = append(logs, rest...)
-	return logs, err
+	return f.unindexedLogs(ctx, end, emit)
 }
 
-// indexedLogs returns the logs matching the filter criteria based on the bloom
-// bits indexed available locally or via the network.
-func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+// indexedLogs feeds the logs matching the filter criteria to emit based on the
+// bloom bits indexed available locally or via the network.
+func (f *Filter) indexedLogs(ctx context.Context, end uint64, emit func([]*types.Log) error) error {
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
 	session, err := f.matcher.Start(ctx, uint64(f.begin), end, matches)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer session.Close()
 
 	f.backend.ServiceFilter(ctx, session)
 
 	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
-
 	for {
 		select {
 		case number, ok := <-matches:
@@ -189,44 +311,46 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 				if err == nil {
 					f.begin = int64(end) + 1
 				}
-				return logs, err
+				return err
 			}
 			f.begin = int64(number) + 1
 
 			// Retrieve the suggested block and pull any truly matching logs
 			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
 			if header == nil || err != nil {
-				return logs, err
+				return err
 			}
 			found, err := f.checkMatches(ctx, header)
 			if err != nil {
-				return logs, err
+				return err
+			}
+			if err := emit(found); err != nil {
+				return err
 			}
-			logs = append(logs, found...)
 
 		case <-ctx.Done():
-			return logs, ctx.Err()
+			return ctx.Err()
 		}
 	}
 }
 
-// unindexedLogs returns the logs matching the filter criteria based on raw block
-// iteration and bloom matching.
-func (f *Filter) unindexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
-	var logs []*types.Log
-
+// unindexedLogs feeds the logs matching the filter criteria to emit based on raw
+// block iteration and bloom matching.
+func (f *Filter) unindexedLogs(ctx context.Context, end uint64, emit func([]*types.Log) error) error {
 	for ; f.begin <= int64(end); f.begin++ {
 		header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(f.begin))
 		if header == nil || err != nil {
-			return logs, err
+			return err
 		}
 		found, err := f.blockLogs(ctx, header)
 		if err != nil {
-			return logs, err
+			return err
+		}
+		if err := emit(found); err != nil {
+			return err
 		}
-		logs = append(logs, found...)
 	}
-	return logs, nil
+	return nil
 }
 
 // blockLogs returns the logs matching the filter criteria within a single block.
@@ -19,6 +19,7 @@
 package filters
 
 import (
+	"container/list"
 	"context"
 	"fmt"
 	"sync"
@@ -52,6 +53,15 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// DroppedTransactionsSubscription queries transactions leaving the
+	// transaction pool together with the reason they were dropped
+	DroppedTransactionsSubscription
+	// NEVMMappingsSubscription queries the NEVM block mappings written and
+	// deleted as Syscoin connects and disconnects blocks
+	NEVMMappingsSubscription
+	// SyscoinConfirmedHeadsSubscription queries headers of blocks once they
+	// are both imported and connected by Syscoin
+	SyscoinConfirmedHeadsSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -60,12 +70,20 @@ const (
 	// txChanSize is the size of channel listening to NewTxsEvent.
 	// The number is referenced from the size of tx pool.
 	txChanSize = 4096
+	// dropsChanSize is the size of channel listening to DroppedTxsEvent.
+	dropsChanSize = 4096
 	// rmLogsChanSize is the size of channel listening to RemovedLogsEvent.
 	rmLogsChanSize = 10
 	// logsChanSize is the size of channel listening to LogsEvent.
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// nevmEvChanSize is the size of channel listening to NEVMMappingEvent.
+	nevmEvChanSize = 10
+	// maxUnconfirmedHeads is the number of blocks connected by Syscoin ahead
+	// of their import that are tracked for confirmed head subscriptions. Once
+	// exceeded, the oldest ones are evicted and never announced.
+	maxUnconfirmedHeads = 1024
 )
 
 type subscription struct {
@@ -76,6 +94,8 @@ type subscription struct {
 	logs      chan []*types.Log
 	hashes    chan []common.Hash
 	headers   chan *types.Header
+	drops     chan []*core.TxDropEvent
+	mappings  chan *core.NEVMMappingEvent
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -89,19 +109,27 @@ type EventSystem struct {
 
 	// Subscriptions
 	txsSub         event.Subscription // Subscription for new transaction event
+	dropsSub       event.Subscription // Subscription for dropped transaction event
 	logsSub        event.Subscription // Subscription for new log event
 	rmLogsSub      event.Subscription // Subscription for removed log event
 	pendingLogsSub event.Subscription // Subscription for pending log event
 	chainSub       event.Subscription // Subscription for new chain event
+	nevmSub        event.Subscription // Subscription for NEVM mapping event
 
 	// Channels
 	install       chan *subscription         // install filter for event notification
 	uninstall     chan *subscription         // remove filter for event notification
 	txsCh         chan core.NewTxsEvent      // Channel to receive new transactions event
+	dropsCh       chan core.DroppedTxsEvent  // Channel to receive dropped transactions event
 	logsCh        chan []*types.Log          // Channel to receive new log event
 	pendingLogsCh chan []*types.Log          // Channel to receive new log event
 	rmLogsCh      chan core.RemovedLogsEvent // Channel to receive removed log event
 	chainCh       chan core.ChainEvent       // Channel to receive new chain event
+	nevmCh        chan core.NEVMMappingEvent // Channel to receive NEVM mapping event
+
+	// Blocks connected by Syscoin but not yet imported, owned by the event loop
+	unconfirmed      map[common.Hash]*list.Element
+	unconfirmedOrder *list.List // Tracked block hashes, oldest first
 }
 
 // NewEventSystem creates a new manager that listens for event on the given mux,
@@ -112,26 +140,32 @@ type EventSystem struct {
 // or by stopping the given mux.
 func NewEventSystem(backend Backend, lightMode bool) *EventSystem {
 	m := &EventSystem{
-		backend:       backend,
-		lightMode:     lightMode,
-		install:       make(chan *subscription),
-		uninstall:     make(chan *subscription),
-		txsCh:         make(chan core.NewTxsEvent, txChanSize),
-		logsCh:        make(chan []*types.Log, logsChanSize),
-		rmLogsCh:      make(chan core.RemovedLogsEvent, rmLogsChanSize),
-		pendingLogsCh: make(chan []*types.Log, logsChanSize),
-		chainCh:       make(chan core.ChainEvent, chainEvChanSize),
+		backend:          backend,
+		lightMode:        lightMode,
+		install:          make(chan *subscription),
+		uninstall:        make(chan *subscription),
+		txsCh:            make(chan core.NewTxsEvent, txChanSize),
+		dropsCh:          make(chan core.DroppedTxsEvent, dropsChanSize),
+		logsCh:           make(chan []*types.Log, logsChanSize),
+		rmLogsCh:         make(chan core.RemovedLogsEvent, rmLogsChanSize),
+		pendingLogsCh:    make(chan []*types.Log, logsChanSize),
+		chainCh:          make(chan core.ChainEvent, chainEvChanSize),
+		nevmCh:           make(chan core.NEVMMappingEvent, nevmEvChanSize),
+		unconfirmed:      make(map[common.Hash]*list.Element),
+		unconfirmedOrder: list.New(),
 	}
 
 	// Subscribe events
 	m.txsSub = m.backend.SubscribeNewTxsEvent(m.txsCh)
+	m.dropsSub = m.backend.SubscribeDroppedTxsEvent(m.dropsCh)
 	m.logsSub = m.backend.SubscribeLogsEvent(m.logsCh)
 	m.rmLogsSub = m.backend.SubscribeRemovedLogsEvent(m.rmLogsCh)
 	m.chainSub = m.backend.SubscribeChainEvent(m.chainCh)
 	m.pendingLogsSub = m.backend.SubscribePendingLogsEvent(m.pendingLogsCh)
+	m.nevmSub = m.backend.SubscribeNEVMMappingEvent(m.nevmCh)
 
 	// Make sure none of the subscriptions are empty
-	if m.txsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil {
+	if m.txsSub == nil || m.dropsSub == nil || m.logsSub == nil || m.rmLogsSub == nil || m.chainSub == nil || m.pendingLogsSub == nil || m.nevmSub == nil {
 		log.Crit("Subscribe for event system failed")
 	}
 
@@ -167,6 +201,8 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.drops:
+			case <-sub.f.mappings:
 			}
 		}
 
@@ -188,6 +224,9 @@ func (es *EventSystem) subscribe(sub *subscription) *Subscription {
 // given criteria to the given logs channel. Default value for the from and to
 // block is "latest". If the fromBlock > toBlock an error is returned.
 func (es *EventSystem) SubscribeLogs(crit ethereum.FilterQuery, logs chan []*types.Log) (*Subscription, error) {
+	if len(crit.BlockHashes) > 0 || crit.Limit > 0 {
+		return nil, fmt.Errorf("block hashes and limit are only supported by one-shot log queries")
+	}
 	var from, to rpc.BlockNumber
 	if crit.FromBlock == nil {
 		from = rpc.LatestBlockNumber
@@ -234,6 +273,8 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit ethereum.FilterQuery, logs
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -251,6 +292,8 @@ func (es *EventSystem) subscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -268,6 +311,8 @@ func (es *EventSystem) subscribePendingLogs(crit ethereum.FilterQuery, logs chan
 		logs:      logs,
 		hashes:    make(chan []common.Hash),
 		headers:   make(chan *types.Header),
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -284,6 +329,8 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 		logs:      make(chan []*types.Log),
 		hashes:    make(chan []common.Hash),
 		headers:   headers,
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -300,6 +347,62 @@ func (es *EventSystem) SubscribePendingTxs(hashes chan []common.Hash) *Subscript
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.Header),
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeDroppedTxs creates a subscription that writes the drop events of
+// transactions that leave the transaction pool.
+func (es *EventSystem) SubscribeDroppedTxs(drops chan []*core.TxDropEvent) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       DroppedTransactionsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.Header),
+		drops:     drops,
+		mappings:  make(chan *core.NEVMMappingEvent),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeNEVMMappings creates a subscription that writes the NEVM block mappings
+// written and deleted as Syscoin connects and disconnects blocks.
+func (es *EventSystem) SubscribeNEVMMappings(mappings chan *core.NEVMMappingEvent) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       NEVMMappingsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   make(chan *types.Header),
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  mappings,
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeSyscoinConfirmedHeads creates a subscription that writes the header of
+// a block once it is both imported in the chain and connected by Syscoin.
+func (es *EventSystem) SubscribeSyscoinConfirmedHeads(headers chan *types.Header) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       SyscoinConfirmedHeadsSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan []common.Hash),
+		headers:   headers,
+		drops:     make(chan []*core.TxDropEvent),
+		mappings:  make(chan *core.NEVMMappingEvent),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -351,10 +454,82 @@ func (es *EventSystem) handleTxsEvent(filters filterIndex, ev core.NewTxsEvent)
 	}
 }
 
+func (es *EventSystem) handleDroppedTxsEvent(filters filterIndex, ev core.DroppedTxsEvent) {
+	if len(filters[DroppedTransactionsSubscription]) == 0 {
+		return
+	}
+	// Drops of private transactions would disclose their hashes, leave them out
+	drops := make([]*core.TxDropEvent, 0, len(ev.Drops))
+	for _, drop := range ev.Drops {
+		if !drop.Private {
+			drops = append(drops, drop)
+		}
+	}
+	if len(drops) == 0 {
+		return
+	}
+	for _, f := range filters[DroppedTransactionsSubscription] {
+		f.drops <- drops
+	}
+}
+
+func (es *EventSystem) handleNEVMMappingEvent(filters filterIndex, ev core.NEVMMappingEvent) {
+	for _, f := range filters[NEVMMappingsSubscription] {
+		f.mappings <- &ev
+	}
+	if len(filters[SyscoinConfirmedHeadsSubscription]) == 0 {
+		return
+	}
+	if ev.Removed {
+		es.forgetUnconfirmed(ev.NEVMBlockHash)
+		return
+	}
+	// Syscoin may connect a block before it is imported, in which case it is
+	// announced by the chain event importing it
+	if ev.Header == nil {
+		es.trackUnconfirmed(ev.NEVMBlockHash)
+		return
+	}
+	for _, f := range filters[SyscoinConfirmedHeadsSubscription] {
+		f.headers <- ev.Header
+	}
+}
+
+// trackUnconfirmed records a block connected by Syscoin ahead of its import,
+// evicting the oldest tracked block if too many are pending.
+func (es *EventSystem) trackUnconfirmed(hash common.Hash) {
+	if _, ok := es.unconfirmed[hash]; ok {
+		return
+	}
+	if es.unconfirmedOrder.Len() >= maxUnconfirmedHeads {
+		oldest := es.unconfirmedOrder.Front()
+		log.Warn("Too many unimported Syscoin connected blocks, dropping oldest", "hash", oldest.Value, "tracked", es.unconfirmedOrder.Len())
+		es.forgetUnconfirmed(oldest.Value.(common.Hash))
+	}
+	es.unconfirmed[hash] = es.unconfirmedOrder.PushBack(hash)
+}
+
+// forgetUnconfirmed stops tracking a block connected by Syscoin, returning
+// whether it was tracked.
+func (es *EventSystem) forgetUnconfirmed(hash common.Hash) bool {
+	elem, ok := es.unconfirmed[hash]
+	if !ok {
+		return false
+	}
+	es.unconfirmedOrder.Remove(elem)
+	delete(es.unconfirmed, hash)
+	return true
+}
+
 func (es *EventSystem) handleChainEvent(filters filterIndex, ev core.ChainEvent) {
 	for _, f := range filters[BlocksSubscription] {
 		f.headers <- ev.Block.Header()
 	}
+	if es.forgetUnconfirmed(ev.Hash) {
+		for _, f := range filters[SyscoinConfirmedHeadsSubscription] {
+			f.headers <- ev.Block.Header()
+		}
+	}
 	if es.lightMode && len(filters[LogsSubscription]) > 0 {
 		es.lightFilterNewHead(ev.Block.Header(), func(header *types.Header, remove bool) {
 			for _, f := range filters[LogsSubscription] {
@@ -444,10 +619,12 @@ func (es *EventSystem) eventLoop() {
 	// Ensure all subscriptions get cleaned up
 	defer func() {
 		es.txsSub.Unsubscribe()
+		es.dropsSub.Unsubscribe()
 		es.logsSub.Unsubscribe()
 		es.rmLogsSub.Unsubscribe()
 		es.pendingLogsSub.Unsubscribe()
 		es.chainSub.Unsubscribe()
+		es.nevmSub.Unsubscribe()
 	}()
 
 	index := make(filterIndex)
@@ -459,6 +636,8 @@ func (es *EventSystem) eventLoop() {
 		select {
 		case ev := <-es.txsCh:
 			es.handleTxsEvent(index, ev)
+		case ev := <-es.dropsCh:
+			es.handleDroppedTxsEvent(index, ev)
 		case ev := <-es.logsCh:
 			es.handleLogs(index, ev)
 		case ev := <-es.rmLogsCh:
@@ -467,6 +646,8 @@ func (es *EventSystem) eventLoop() {
 			es.handlePendingLogs(index, ev)
 		case ev := <-es.chainCh:
 			es.handleChainEvent(index, ev)
+		case ev := <-es.nevmCh:
+			es.handleNEVMMappingEvent(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
@@ -486,17 +667,25 @@ func (es *EventSystem) eventLoop() {
 			} else {
 				delete(index[f.typ], f.id)
 			}
+			if len(index[SyscoinConfirmedHeadsSubscription]) == 0 && len(es.unconfirmed) > 0 {
+				es.unconfirmed = make(map[common.Hash]*list.Element)
+				es.unconfirmedOrder.Init()
+			}
 			close(f.err)
 
 		// System stopped
 		case <-es.txsSub.Err():
 			return
+		case <-es.dropsSub.Err():
+			return
 		case <-es.logsSub.Err():
 			return
 		case <-es.rmLogsSub.Err():
 			return
 		case <-es.chainSub.Err():
 			return
+		case <-es.nevmSub.Err():
+			return
 		}
 	}
 }
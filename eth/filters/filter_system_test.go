@@ -18,6 +18,7 @@ package filters
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -28,6 +29,7 @@ import (
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
@@ -48,10 +50,12 @@ type testBackend struct {
 	db              ethdb.Database
 	sections        uint64
 	txFeed          event.Feed
+	dropsFeed       event.Feed
 	logsFeed        event.Feed
 	rmLogsFeed      event.Feed
 	pendingLogsFeed event.Feed
 	chainFeed       event.Feed
+	nevmFeed        event.Feed
 }
 
 func (b *testBackend) ChainDb() ethdb.Database {
@@ -110,6 +114,10 @@ func (b *testBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Sub
 	return b.txFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeDroppedTxsEvent(ch chan<- core.DroppedTxsEvent) event.Subscription {
+	return b.dropsFeed.Subscribe(ch)
+}
+
 func (b *testBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
 	return b.rmLogsFeed.Subscribe(ch)
 }
@@ -126,6 +134,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeNEVMMappingEvent(ch chan<- core.NEVMMappingEvent) event.Subscription {
+	return b.nevmFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -213,6 +225,93 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestNEVMMappingSubscriptions tests that NEVM mapping events are delivered to
+// mapping subscriptions, and that blocks are announced as confirmed heads once both
+// imported and connected by Syscoin.
+func TestNEVMMappingSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db       = rawdb.NewMemoryDatabase()
+		backend  = &testBackend{db: db}
+		api      = NewPublicFilterAPI(backend, false, deadline)
+		genesis  = (&core.Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+		chain, _ = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 3, func(i int, gen *core.BlockGen) {})
+	)
+	mappings := make(chan *core.NEVMMappingEvent)
+	mappingsSub := api.events.SubscribeNEVMMappings(mappings)
+	defer mappingsSub.Unsubscribe()
+	confirmed := make(chan *types.Header)
+	confirmedSub := api.events.SubscribeSyscoinConfirmedHeads(confirmed)
+	defer confirmedSub.Unsubscribe()
+	heads := make(chan *types.Header)
+	headsSub := api.events.SubscribeNewHeads(heads)
+	defer headsSub.Unsubscribe()
+
+	mapping := func(block *types.Block, removed bool, imported bool) {
+		t.Helper()
+		ev := core.NEVMMappingEvent{SysBlockHash: fmt.Sprintf("sys%d", block.NumberU64()), NEVMBlockHash: block.Hash(), Number: block.NumberU64(), Removed: removed}
+		if imported {
+			ev.Header = block.Header()
+		}
+		backend.nevmFeed.Send(ev)
+		if got := <-mappings; *got != ev {
+			t.Fatalf("mapping mismatch: have %+v, want %+v", got, ev)
+		}
+	}
+	importBlock := func(block *types.Block) {
+		t.Helper()
+		rawdb.WriteHeader(db, block.Header())
+		backend.chainFeed.Send(core.ChainEvent{Block: block, Hash: block.Hash()})
+		if head := <-heads; head.Hash() != block.Hash() {
+			t.Fatalf("new head mismatch: have %x, want %x", head.Hash(), block.Hash())
+		}
+	}
+	expectConfirmed := func(block *types.Block) {
+		t.Helper()
+		select {
+		case head := <-confirmed:
+			if block == nil {
+				t.Fatalf("unexpected confirmed head %x", head.Hash())
+			}
+			if head.Hash() != block.Hash() {
+				t.Fatalf("confirmed head mismatch: have %x, want %x", head.Hash(), block.Hash())
+			}
+		case <-time.After(100 * time.Millisecond):
+			if block != nil {
+				t.Fatalf("confirmed head %x not announced", block.Hash())
+			}
+		}
+	}
+	// A block connected ahead of its import is confirmed when imported
+	mapping(chain[0], false, false)
+	expectConfirmed(nil)
+	importBlock(chain[0])
+	expectConfirmed(chain[0])
+
+	// A block connected after its import is confirmed right away
+	mapping(chain[1], false, true)
+	expectConfirmed(chain[1])
+
+	// A block disconnected before its import is never confirmed
+	mapping(chain[2], false, false)
+	mapping(chain[2], true, false)
+	importBlock(chain[2])
+	expectConfirmed(nil)
+
+	// Blocks tracked beyond the limit evict the oldest ones
+	for i := 0; i < maxUnconfirmedHeads; i++ {
+		backend.nevmFeed.Send(core.NEVMMappingEvent{NEVMBlockHash: common.BigToHash(big.NewInt(int64(i + 1))), Number: uint64(i + 1)})
+		<-mappings
+	}
+	mapping(chain[0], false, false)
+	backend.chainFeed.Send(core.ChainEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1)}), Hash: common.BigToHash(big.NewInt(1))})
+	<-heads
+	expectConfirmed(nil)
+	importBlock(chain[0])
+	expectConfirmed(chain[0])
+}
+
 // TestPendingTxFilter tests whether pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -269,6 +368,36 @@ func TestPendingTxFilter(t *testing.T) {
 	}
 }
 
+// TestDroppedTxsSubscription tests that drop notifications are delivered to the
+// subscribers, leaving out the private transactions.
+func TestDroppedTxsSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+
+		public  = &core.TxDropEvent{Hash: common.HexToHash("0x01"), Reason: core.TxDropReplaced}
+		private = &core.TxDropEvent{Hash: common.HexToHash("0x02"), Reason: core.TxDropExpired, Private: true}
+	)
+	drops := make(chan []*core.TxDropEvent)
+	sub := api.events.SubscribeDroppedTxs(drops)
+	defer sub.Unsubscribe()
+
+	backend.dropsFeed.Send(core.DroppedTxsEvent{Drops: []*core.TxDropEvent{private}})
+	backend.dropsFeed.Send(core.DroppedTxsEvent{Drops: []*core.TxDropEvent{private, public}})
+
+	select {
+	case have := <-drops:
+		if len(have) != 1 || have[0].Hash != public.Hash {
+			t.Fatalf("drops mismatch: have %v, want [%x]", have, public.Hash)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("drops not delivered")
+	}
+}
+
 // TestLogFilterCreation test whether a given filter criteria makes sense.
 // If not it must return an error.
 func TestLogFilterCreation(t *testing.T) {
@@ -680,3 +809,184 @@ func flattenLogs(pl [][]*types.Log) []*types.Log {
 	}
 	return logs
 }
+
+// TestLogsSubscriptionReplay tests that logs subscriptions opting in to replay
+// from a past block get the historical logs before switching to live events, and
+// that a subscription resuming from a side chain block first gets its logs removed.
+// Subscriptions not opting in ignore their starting block.
+func TestLogsSubscriptionReplay(t *testing.T) {
+	t.Parallel()
+
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		backend = &testBackend{db: db}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+		addr    = common.HexToAddress("0x1111111111111111111111111111111111111111")
+	)
+	addLog := func(i int, gen *core.BlockGen) {
+		receipt := types.NewReceipt(nil, false, 0)
+		receipt.Logs = []*types.Log{{Address: addr, Topics: []common.Hash{common.BigToHash(gen.Number())}}}
+		gen.AddUncheckedReceipt(receipt)
+		gen.AddUncheckedTx(types.NewTransaction(uint64(i), common.HexToAddress("0x1"), big.NewInt(1), 1, gen.BaseFee(), nil))
+	}
+	genesis := core.GenesisBlockForTesting(db, addr, big.NewInt(1000000))
+	chain, receipts := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 4, addLog)
+	for i, block := range chain {
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+		rawdb.WriteHeadBlockHash(db, block.Hash())
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+	}
+	// Create a side chain block at height 3, known but not canonical
+	fork, forkReceipts := core.GenerateChain(params.TestChainConfig, chain[1], ethash.NewFaker(), db, 1, func(i int, gen *core.BlockGen) {
+		gen.SetCoinbase(common.HexToAddress("0xdead"))
+		addLog(i, gen)
+	})
+	rawdb.WriteBlock(db, fork[0])
+	rawdb.WriteReceipts(db, fork[0].Hash(), fork[0].NumberU64(), forkReceipts[0])
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	type notification struct {
+		Reorg       bool           `json:"reorg"`
+		Removed     interface{}    `json:"removed"`
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+		BlockHash   common.Hash    `json:"blockHash"`
+	}
+	expect := func(ch chan notification, number uint64, removed, reorg bool) {
+		t.Helper()
+		select {
+		case n := <-ch:
+			if uint64(n.BlockNumber) != number || n.Reorg != reorg || (!reorg && n.Removed != removed) {
+				t.Fatalf("unexpected notification %+v, want number %d removed %v reorg %v", n, number, removed, reorg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout waiting for log of block %d", number)
+		}
+	}
+	// Subscribe from genesis without replay, as clients setting a default
+	// fromBlock do, expecting live events only
+	plain := make(chan notification)
+	plainSub, err := client.Subscribe(context.Background(), "eth", plain, "logs",
+		map[string]interface{}{"fromBlock": "0x0", "address": addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plainSub.Unsubscribe()
+
+	// Subscribe from block 2, opting in to replay and reorg markers
+	ch := make(chan notification)
+	sub, err := client.Subscribe(context.Background(), "eth", ch, "logs",
+		map[string]interface{}{"fromBlock": "0x2", "address": addr},
+		map[string]interface{}{"replay": true, "reorgMarkers": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	for number := uint64(2); number <= 4; number++ {
+		expect(ch, number, false, false)
+	}
+	live := &types.Log{Address: addr, BlockNumber: 5, BlockHash: common.HexToHash("0x05")}
+	backend.logsFeed.Send([]*types.Log{live})
+	expect(ch, 5, false, false)
+	expect(plain, 5, false, false)
+
+	removed := *live
+	removed.Removed = true
+	backend.rmLogsFeed.Send(core.RemovedLogsEvent{Logs: []*types.Log{&removed}})
+	expect(ch, 5, true, true)
+	expect(ch, 5, true, false)
+
+	// Resume from the side chain block, expecting its log removed first
+	ch2 := make(chan notification)
+	sub2, err := client.Subscribe(context.Background(), "eth", ch2, "logs",
+		map[string]interface{}{"blockHash": fork[0].Hash(), "address": addr},
+		map[string]interface{}{"replay": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub2.Unsubscribe()
+
+	expect(ch2, 3, true, false)
+	expect(ch2, 3, false, false)
+	expect(ch2, 4, false, false)
+}
+
+// replayTestBackend is a test backend whose chain head lookup, the first step of a
+// log replay, waits for a gate to open and then optionally fails.
+type replayTestBackend struct {
+	*testBackend
+	gate chan struct{}
+	err  error
+}
+
+func (b *replayTestBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		<-b.gate
+		if b.err != nil {
+			return nil, b.err
+		}
+	}
+	return b.testBackend.HeaderByNumber(ctx, number)
+}
+
+// TestLogsSubscriptionReplayClosed tests that logs subscriptions falling behind
+// their replay, or whose replay fails, are closed with an error seen by the client.
+func TestLogsSubscriptionReplayClosed(t *testing.T) {
+	defer func(old int) { maxReplayQueue = old }(maxReplayQueue)
+	maxReplayQueue = 1
+
+	var (
+		backend = &replayTestBackend{testBackend: &testBackend{db: rawdb.NewMemoryDatabase()}, gate: make(chan struct{})}
+		api     = NewPublicFilterAPI(backend, false, deadline)
+	)
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("eth", api); err != nil {
+		t.Fatal(err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	subscribe := func() *rpc.ClientSubscription {
+		t.Helper()
+		sub, err := client.Subscribe(context.Background(), "eth", make(chan *types.Log), "logs",
+			map[string]interface{}{"fromBlock": "0x0"}, map[string]interface{}{"replay": true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	expectErr := func(sub *rpc.ClientSubscription, want string) {
+		t.Helper()
+		select {
+		case err := <-sub.Err():
+			if err == nil || err.Error() != want {
+				t.Fatalf("subscription error mismatch: have %v, want %q", err, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("subscription not closed")
+		}
+	}
+	// Queue up more live logs than allowed while the replay is stuck
+	overflown := subscribe()
+	defer overflown.Unsubscribe()
+
+	backend.logsFeed.Send([]*types.Log{{BlockNumber: 1}, {BlockNumber: 1, Index: 1}})
+	expectErr(overflown, errReplayOverflow.Error())
+
+	// Fail the replay of another subscription
+	backend.err = errors.New("header unavailable")
+	failed := subscribe()
+	defer failed.Unsubscribe()
+
+	close(backend.gate)
+	expectErr(failed, "log replay failed: header unavailable")
+}
@@ -18,6 +18,7 @@ package filters
 
 import (
 	"context"
+	"encoding/json"
 	"io/ioutil"
 	"math/big"
 	"os"
@@ -222,4 +223,67 @@ func TestFilters(t *testing.T) {
 	if len(logs) != 0 {
 		t.Error("expected 0 log, got", len(logs))
 	}
+	// Block set filters return the logs of the given blocks in chain order
+	filter = NewBlocksFilter(backend, []common.Hash{chain[998].Hash(), chain[1].Hash(), chain[998].Hash(), {}}, []common.Address{addr}, nil)
+	logs, _ = filter.Logs(context.Background())
+	if len(logs) != 2 {
+		t.Fatal("expected 2 log, got", len(logs))
+	}
+	if logs[0].Topics[0] != hash1 || logs[1].Topics[0] != hash3 {
+		t.Errorf("wrong log order: %x, %x", logs[0].Topics[0], logs[1].Topics[0])
+	}
+
+	// Iterating resumes from the cursor and stops when asked to
+	var (
+		cursor *LogCursor
+		paged  []*types.Log
+	)
+	for {
+		var page []*types.Log
+		filter = NewRangeFilter(backend, 0, -1, []common.Address{addr}, nil)
+		err := filter.Iterate(context.Background(), cursor, func(log *types.Log) bool {
+			if len(page) == 3 {
+				cursor = &LogCursor{Block: log.BlockNumber, Index: log.Index}
+				return false
+			}
+			page = append(page, log)
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		paged = append(paged, page...)
+		if len(page) < 3 {
+			break
+		}
+	}
+	if len(paged) != 4 {
+		t.Fatal("expected 4 paged logs, got", len(paged))
+	}
+	for i, topic := range []common.Hash{hash1, hash2, hash3, hash4} {
+		if paged[i].Topics[0] != topic {
+			t.Errorf("paged log %d: have topic %x, want %x", i, paged[i].Topics[0], topic)
+		}
+	}
+}
+
+func TestLogCursorJSON(t *testing.T) {
+	cursor := LogCursor{Block: 0x1234, Index: 7}
+	enc, err := json.Marshal(cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(enc) != `"0x000000000000123400000007"` {
+		t.Fatalf("wrong encoding %s", enc)
+	}
+	var dec LogCursor
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatal(err)
+	}
+	if dec != cursor {
+		t.Fatalf("cursor mismatch: have %+v, want %+v", dec, cursor)
+	}
+	if err := json.Unmarshal([]byte(`"0x1234"`), &dec); err == nil {
+		t.Fatal("expected error for short cursor")
+	}
 }
@@ -0,0 +1,396 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tip estimation strategies selectable through Config.Strategy.
+const (
+	// StrategyPercentile suggests a percentile of the cheapest tips included
+	// in the last few blocks.
+	StrategyPercentile = "percentile"
+
+	// StrategyTimeWeighted suggests a weighted percentile of the recently
+	// included tips, where the weight of a sample decays with the age of its
+	// block. Bursts of blocks thus don't push older samples out of the window.
+	StrategyTimeWeighted = "timeweighted"
+
+	// StrategyMempool suggests the tip needed to outbid the executable
+	// transactions currently waiting in the pool, falling back to the block
+	// history if the pool is not congested.
+	StrategyMempool = "mempool"
+
+	// StrategyInclusion suggests the tip that would have been included within
+	// a target number of blocks over the recent history.
+	StrategyInclusion = "inclusion"
+)
+
+var (
+	// DefaultHalfLife is the sample age at which its weight halves in the
+	// time-weighted strategy.
+	DefaultHalfLife = 10 * time.Minute
+
+	// DefaultTargetBlocks is the number of blocks to get included within in
+	// the inclusion strategy.
+	DefaultTargetBlocks = 3
+
+	// DefaultConfidences are the confidence levels tips are estimated for if
+	// the caller doesn't request specific ones.
+	DefaultConfidences = []float64{25, 50, 75, 90}
+)
+
+var (
+	errInvalidConfidence = errors.New("invalid confidence level")
+	errUnknownStrategy   = errors.New("unknown tip estimation strategy")
+)
+
+// estimator is a tip estimation strategy. For every requested confidence level
+// (a percentage), it returns the tip a transaction should pay to be included in
+// a timely manner with roughly that confidence. Higher confidence levels never
+// result in lower tips.
+type estimator interface {
+	estimate(ctx context.Context, head *types.Header, confidences []float64) ([]*big.Int, error)
+}
+
+// estimatorConstructors contains all the available tip estimation strategies.
+var estimatorConstructors = map[string]func(*Oracle) estimator{
+	StrategyPercentile:   func(o *Oracle) estimator { return &percentileEstimator{o} },
+	StrategyTimeWeighted: func(o *Oracle) estimator { return &timeWeightedEstimator{o} },
+	StrategyMempool:      func(o *Oracle) estimator { return &mempoolEstimator{o} },
+	StrategyInclusion:    func(o *Oracle) estimator { return &inclusionEstimator{o} },
+}
+
+// EstimateTips returns tip suggestions for each of the given confidence levels
+// using the named strategy, or the configured one if strategy is empty. The
+// returned strategy is the name of the one actually used.
+func (oracle *Oracle) EstimateTips(ctx context.Context, strategy string, confidences []float64) (string, []*big.Int, error) {
+	if strategy == "" {
+		strategy = oracle.strategy
+	}
+	est, ok := oracle.estimators[strategy]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", errUnknownStrategy, strategy)
+	}
+	if len(confidences) == 0 {
+		confidences = DefaultConfidences
+	}
+	for i, c := range confidences {
+		if c < 0 || c > 100 {
+			return "", nil, fmt.Errorf("%w: %f", errInvalidConfidence, c)
+		}
+		if i > 0 && c < confidences[i-1] {
+			return "", nil, fmt.Errorf("%w: #%d:%f > #%d:%f", errInvalidConfidence, i-1, confidences[i-1], i, c)
+		}
+	}
+	head, err := oracle.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if err != nil {
+		return "", nil, err
+	}
+	tips, err := est.estimate(ctx, head, confidences)
+	if err != nil {
+		return "", nil, err
+	}
+	for i, tip := range tips {
+		if tip.Cmp(oracle.maxPrice) > 0 {
+			tips[i] = new(big.Int).Set(oracle.maxPrice)
+		}
+	}
+	return strategy, tips, nil
+}
+
+// fallbackTips returns the last suggested tip for every confidence level.
+func (oracle *Oracle) fallbackTips(confidences []float64) []*big.Int {
+	oracle.cacheLock.RLock()
+	defer oracle.cacheLock.RUnlock()
+
+	tips := make([]*big.Int, len(confidences))
+	for i := range tips {
+		tips[i] = new(big.Int).Set(oracle.lastPrice)
+	}
+	return tips
+}
+
+// recentBlockValues retrieves the cheapest tips of the given number of blocks
+// preceding (and including) head. Blocks without any meaningful transactions
+// are returned with no values.
+func (oracle *Oracle) recentBlockValues(ctx context.Context, head *types.Header, blocks int) ([]results, error) {
+	var (
+		sent   int
+		number = head.Number.Uint64()
+		result = make(chan results, blocks)
+		quit   = make(chan struct{})
+	)
+	defer close(quit)
+
+	for sent < blocks && number > 0 {
+		go oracle.getBlockValues(ctx, types.MakeSigner(oracle.backend.ChainConfig(), new(big.Int).SetUint64(number)), number, sampleNumber, oracle.ignorePrice, result, quit)
+		sent++
+		number--
+	}
+	values := make([]results, 0, sent)
+	for ; sent > 0; sent-- {
+		res := <-result
+		if res.err != nil {
+			return nil, res.err
+		}
+		values = append(values, res)
+	}
+	// Blocks arrive in random order, sort them newest first
+	sort.Slice(values, func(i, j int) bool { return values[i].number > values[j].number })
+	return values, nil
+}
+
+// percentileEstimator picks the requested confidence level as a percentile of
+// the cheapest tips included in the last few blocks.
+type percentileEstimator struct {
+	oracle *Oracle
+}
+
+func (e *percentileEstimator) estimate(ctx context.Context, head *types.Header, confidences []float64) ([]*big.Int, error) {
+	oracle := e.oracle
+
+	oracle.cacheLock.RLock()
+	lastPrice := oracle.lastPrice
+	oracle.cacheLock.RUnlock()
+
+	var (
+		sent, exp int
+		number    = head.Number.Uint64()
+		result    = make(chan results, oracle.checkBlocks)
+		quit      = make(chan struct{})
+		samples   []*big.Int
+	)
+	for sent < oracle.checkBlocks && number > 0 {
+		go oracle.getBlockValues(ctx, types.MakeSigner(oracle.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, oracle.ignorePrice, result, quit)
+		sent++
+		exp++
+		number--
+	}
+	for exp > 0 {
+		res := <-result
+		if res.err != nil {
+			close(quit)
+			return nil, res.err
+		}
+		exp--
+		// Nothing returned. There are two special cases here:
+		// - The block is empty
+		// - All the transactions included are sent by the miner itself.
+		// In these cases, use the latest calculated price for sampling.
+		if len(res.values) == 0 {
+			res.values = []*big.Int{lastPrice}
+		}
+		// Besides, in order to collect enough data for sampling, if nothing
+		// meaningful returned, try to query more blocks. But the maximum
+		// is 2*checkBlocks.
+		if len(res.values) == 1 && len(samples)+1+exp < oracle.checkBlocks*2 && number > 0 {
+			go oracle.getBlockValues(ctx, types.MakeSigner(oracle.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, oracle.ignorePrice, result, quit)
+			sent++
+			exp++
+			number--
+		}
+		samples = append(samples, res.values...)
+	}
+	if len(samples) == 0 {
+		return oracle.fallbackTips(confidences), nil
+	}
+	sort.Sort(bigIntArray(samples))
+
+	tips := make([]*big.Int, len(confidences))
+	for i, c := range confidences {
+		tips[i] = samples[int(float64(len(samples)-1)*c/100)]
+	}
+	return tips, nil
+}
+
+// timeWeightedEstimator picks the requested confidence level as a weighted
+// percentile of the cheapest tips included in the last few blocks, where the
+// weight of each sample halves every configured half life of block age.
+type timeWeightedEstimator struct {
+	oracle *Oracle
+}
+
+func (e *timeWeightedEstimator) estimate(ctx context.Context, head *types.Header, confidences []float64) ([]*big.Int, error) {
+	oracle := e.oracle
+
+	blocks, err := oracle.recentBlockValues(ctx, head, oracle.checkBlocks*2)
+	if err != nil {
+		return nil, err
+	}
+	type sample struct {
+		tip    *big.Int
+		weight float64
+	}
+	var (
+		samples []sample
+		total   float64
+	)
+	for _, block := range blocks {
+		var age float64
+		if head.Time > block.time {
+			age = float64(head.Time - block.time)
+		}
+		weight := math.Pow(0.5, age/oracle.halfLife.Seconds())
+		for _, tip := range block.values {
+			samples = append(samples, sample{tip, weight})
+			total += weight
+		}
+	}
+	if len(samples) == 0 || total == 0 {
+		return oracle.fallbackTips(confidences), nil
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].tip.Cmp(samples[j].tip) < 0 })
+
+	tips := make([]*big.Int, len(confidences))
+	for i, c := range confidences {
+		var (
+			target = total * c / 100
+			sum    float64
+		)
+		tips[i] = samples[len(samples)-1].tip
+		for _, s := range samples {
+			if sum += s.weight; sum >= target {
+				tips[i] = s.tip
+				break
+			}
+		}
+	}
+	return tips, nil
+}
+
+// mempoolEstimator suggests tips based on the executable transactions waiting
+// in the pool. Ordering them by their effective tip at the next base fee, the
+// tip required for a confidence level c is the one paid by the transaction at
+// (100-c)% of the next block's gas limit. If the pool doesn't contain enough
+// transactions to reach that position, or the tip found is lower than what
+// recent blocks paid, the percentile strategy is used instead.
+type mempoolEstimator struct {
+	oracle *Oracle
+}
+
+func (e *mempoolEstimator) estimate(ctx context.Context, head *types.Header, confidences []float64) ([]*big.Int, error) {
+	oracle := e.oracle
+
+	floor, err := oracle.estimators[StrategyPercentile].estimate(ctx, head, confidences)
+	if err != nil {
+		return nil, err
+	}
+	txs, err := oracle.backend.GetPoolTransactions()
+	if err != nil {
+		return nil, err
+	}
+	var baseFee *big.Int
+	if config := oracle.backend.ChainConfig(); config.IsLondon(new(big.Int).Add(head.Number, big.NewInt(1))) {
+		baseFee = misc.CalcBaseFee(config, head)
+	}
+	type pooled struct {
+		tip *big.Int
+		gas uint64
+	}
+	pool := make([]pooled, 0, len(txs))
+	for _, tx := range txs {
+		tip, err := tx.EffectiveGasTip(baseFee)
+		if err != nil {
+			continue // Not includable at the next base fee
+		}
+		pool = append(pool, pooled{tip, tx.Gas()})
+	}
+	// Walk the pool from the best paying transaction downwards
+	sort.Slice(pool, func(i, j int) bool { return pool[i].tip.Cmp(pool[j].tip) > 0 })
+
+	tips := make([]*big.Int, len(confidences))
+	for i, c := range confidences {
+		var (
+			position = uint64(float64(head.GasLimit) * (100 - c) / 100)
+			gas      uint64
+		)
+		tips[i] = floor[i]
+		for _, tx := range pool {
+			if gas += tx.gas; gas >= position {
+				if tx.tip.Cmp(floor[i]) > 0 {
+					tips[i] = new(big.Int).Set(tx.tip)
+				}
+				break
+			}
+		}
+	}
+	return tips, nil
+}
+
+// inclusionEstimator suggests tips that would have been included within the
+// target number of blocks. For every window of consecutive target blocks in
+// the recent history, the cheapest tip any of its blocks accepted is the price
+// of inclusion within that window; the confidence level is a percentile over
+// those prices.
+type inclusionEstimator struct {
+	oracle *Oracle
+}
+
+func (e *inclusionEstimator) estimate(ctx context.Context, head *types.Header, confidences []float64) ([]*big.Int, error) {
+	oracle := e.oracle
+
+	blocks, err := oracle.recentBlockValues(ctx, head, oracle.checkBlocks+oracle.targetBlocks-1)
+	if err != nil {
+		return nil, err
+	}
+	// Calculate the cheapest accepted tip of every block. A block without any
+	// meaningful transactions accepted anything above the ignore threshold.
+	minimums := make([]*big.Int, len(blocks))
+	for i, block := range blocks {
+		if len(block.values) == 0 {
+			minimums[i] = oracle.ignorePrice
+		} else {
+			minimums[i] = block.values[0]
+		}
+	}
+	window := oracle.targetBlocks
+	if window > len(minimums) {
+		window = len(minimums)
+	}
+	var prices []*big.Int
+	for i := 0; i+window <= len(minimums) && window > 0; i++ {
+		price := minimums[i]
+		for _, min := range minimums[i+1 : i+window] {
+			if min.Cmp(price) < 0 {
+				price = min
+			}
+		}
+		prices = append(prices, price)
+	}
+	if len(prices) == 0 {
+		return oracle.fallbackTips(confidences), nil
+	}
+	sort.Sort(bigIntArray(prices))
+
+	tips := make([]*big.Int, len(confidences))
+	for i, c := range confidences {
+		tips[i] = new(big.Int).Set(prices[int(float64(len(prices)-1)*c/100)])
+	}
+	return tips, nil
+}
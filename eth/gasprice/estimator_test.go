@@ -0,0 +1,100 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestEstimateTips(t *testing.T) {
+	// Pool transactions with 1M gas each, paying 100, 90, 80 and 70 GWei tips
+	var pool types.Transactions
+	for i := int64(0); i < 4; i++ {
+		pool = append(pool, types.NewTx(&types.DynamicFeeTx{
+			ChainID:   params.TestChainConfig.ChainID,
+			To:        &common.Address{},
+			Gas:       1000000,
+			GasFeeCap: big.NewInt(1000 * params.GWei),
+			GasTipCap: big.NewInt((100 - 10*i) * params.GWei),
+		}))
+	}
+	var cases = []struct {
+		config      Config
+		pool        types.Transactions
+		confidences []float64
+		expect      []int64 // Expected tips in GWei
+	}{
+		// The cheapest tips of the last 6 blocks are 27G..32G, the 60th percentile is 30G
+		{Config{Blocks: 3, Strategy: StrategyPercentile}, nil, []float64{0, 60, 100}, []int64{27, 30, 32}},
+
+		// Equal weights behave like the percentile strategy, a short half life
+		// makes the newest block dominate
+		{Config{Blocks: 3, Strategy: StrategyTimeWeighted, HalfLife: 1000 * time.Hour}, nil, []float64{0, 40, 100}, []int64{27, 29, 32}},
+		{Config{Blocks: 3, Strategy: StrategyTimeWeighted, HalfLife: time.Second}, nil, []float64{50, 100}, []int64{32, 32}},
+
+		// An empty pool falls back to the block history, a congested one to
+		// the tips needed to outbid the pool
+		{Config{Blocks: 3, Strategy: StrategyMempool}, nil, []float64{0, 60}, []int64{27, 30}},
+		{Config{Blocks: 3, Strategy: StrategyMempool}, pool, []float64{0, 50, 90}, []int64{27, 80, 100}},
+
+		// Windows of 2 blocks over 32G, 31G, 30G and 29G cost 31G, 30G and 29G
+		{Config{Blocks: 3, Strategy: StrategyInclusion, TargetBlocks: 2}, nil, []float64{0, 50, 100}, []int64{29, 30, 31}},
+	}
+	for i, c := range cases {
+		backend := newTestBackend(t, big.NewInt(0), false)
+		backend.pool = c.pool
+		oracle := NewOracle(backend, c.config)
+
+		strategy, tips, err := oracle.EstimateTips(context.Background(), "", c.confidences)
+		if err != nil {
+			t.Fatalf("test %d: failed to estimate tips: %v", i, err)
+		}
+		if strategy != c.config.Strategy {
+			t.Errorf("test %d: strategy mismatch: have %s, want %s", i, strategy, c.config.Strategy)
+		}
+		if len(tips) != len(c.expect) {
+			t.Fatalf("test %d: tip count mismatch: have %d, want %d", i, len(tips), len(c.expect))
+		}
+		for j, tip := range tips {
+			if want := big.NewInt(c.expect[j] * params.GWei); tip.Cmp(want) != 0 {
+				t.Errorf("test %d, confidence %v: tip mismatch: have %v, want %v", i, c.confidences[j], tip, want)
+			}
+		}
+	}
+}
+
+func TestEstimateTipsInvalid(t *testing.T) {
+	oracle := NewOracle(newTestBackend(t, big.NewInt(0), false), Config{Blocks: 3})
+
+	if _, _, err := oracle.EstimateTips(context.Background(), "unknown", nil); !errors.Is(err, errUnknownStrategy) {
+		t.Errorf("unknown strategy error mismatch: have %v, want %v", err, errUnknownStrategy)
+	}
+	if _, _, err := oracle.EstimateTips(context.Background(), "", []float64{101}); !errors.Is(err, errInvalidConfidence) {
+		t.Errorf("out of range confidence error mismatch: have %v, want %v", err, errInvalidConfidence)
+	}
+	if _, _, err := oracle.EstimateTips(context.Background(), "", []float64{50, 10}); !errors.Is(err, errInvalidConfidence) {
+		t.Errorf("unordered confidence error mismatch: have %v, want %v", err, errInvalidConfidence)
+	}
+}
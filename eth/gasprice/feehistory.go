@@ -165,6 +165,16 @@ func (oracle *Oracle) resolveBlockRange(ctx context.Context, lastBlock rpc.Block
 			return nil, nil, 0, 0, err
 		}
 	}
+	if lastBlock == rpc.FinalizedBlockNumber || lastBlock == rpc.SafeBlockNumber {
+		header, err := oracle.backend.HeaderByNumber(ctx, lastBlock)
+		if err != nil {
+			return nil, nil, 0, 0, err
+		}
+		if header == nil {
+			return nil, nil, 0, 0, errors.New("finalized block not found")
+		}
+		lastBlock = rpc.BlockNumber(header.Number.Uint64())
+	}
 	if lastBlock == rpc.LatestBlockNumber {
 		lastBlock = headBlock
 	} else if pendingBlock == nil && lastBlock > headBlock {
@@ -21,6 +21,7 @@ import (
 	"math/big"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core"
@@ -44,9 +45,12 @@ type Config struct {
 	Percentile       int
 	MaxHeaderHistory int
 	MaxBlockHistory  int
-	Default          *big.Int `toml:",omitempty"`
-	MaxPrice         *big.Int `toml:",omitempty"`
-	IgnorePrice      *big.Int `toml:",omitempty"`
+	Default          *big.Int      `toml:",omitempty"`
+	MaxPrice         *big.Int      `toml:",omitempty"`
+	IgnorePrice      *big.Int      `toml:",omitempty"`
+	Strategy         string        `toml:",omitempty"` // Tip estimation strategy, see the Strategy* constants
+	HalfLife         time.Duration `toml:",omitempty"` // Sample age at which its weight halves (timeweighted strategy)
+	TargetBlocks     int           `toml:",omitempty"` // Number of blocks to get included within (inclusion strategy)
 }
 
 // OracleBackend includes all necessary background APIs for oracle.
@@ -55,6 +59,7 @@ type OracleBackend interface {
 	BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error)
 	GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error)
 	PendingBlockAndReceipts() (*types.Block, types.Receipts)
+	GetPoolTransactions() (types.Transactions, error)
 	ChainConfig() *params.ChainConfig
 	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
 }
@@ -73,6 +78,11 @@ type Oracle struct {
 	checkBlocks, percentile           int
 	maxHeaderHistory, maxBlockHistory int
 	historyCache                      *lru.Cache
+
+	strategy     string               // Name of the strategy used for tip suggestions
+	halfLife     time.Duration        // Sample age at which its weight halves
+	targetBlocks int                  // Number of blocks to get included within
+	estimators   map[string]estimator // All available tip estimation strategies
 }
 
 // NewOracle returns a new gasprice oracle which can recommend suitable
@@ -105,6 +115,28 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		log.Info("Gasprice oracle is ignoring threshold set", "threshold", ignorePrice)
 	}
 
+	strategy := params.Strategy
+	if strategy == "" {
+		strategy = StrategyPercentile
+	}
+	if _, ok := estimatorConstructors[strategy]; !ok {
+		log.Warn("Sanitizing invalid gasprice oracle strategy", "provided", params.Strategy, "updated", StrategyPercentile)
+		strategy = StrategyPercentile
+	}
+	halfLife := params.HalfLife
+	if halfLife <= 0 {
+		halfLife = DefaultHalfLife
+		if strategy == StrategyTimeWeighted {
+			log.Warn("Sanitizing invalid gasprice oracle half life", "provided", params.HalfLife, "updated", halfLife)
+		}
+	}
+	targetBlocks := params.TargetBlocks
+	if targetBlocks < 1 {
+		targetBlocks = DefaultTargetBlocks
+		if strategy == StrategyInclusion {
+			log.Warn("Sanitizing invalid gasprice oracle target blocks", "provided", params.TargetBlocks, "updated", targetBlocks)
+		}
+	}
 	cache, _ := lru.New(2048)
 	headEvent := make(chan core.ChainHeadEvent, 1)
 	backend.SubscribeChainHeadEvent(headEvent)
@@ -118,7 +150,7 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		}
 	}()
 
-	return &Oracle{
+	oracle := &Oracle{
 		backend:          backend,
 		lastPrice:        params.Default,
 		maxPrice:         maxPrice,
@@ -128,7 +160,15 @@ func NewOracle(backend OracleBackend, params Config) *Oracle {
 		maxHeaderHistory: params.MaxHeaderHistory,
 		maxBlockHistory:  params.MaxBlockHistory,
 		historyCache:     cache,
+		strategy:         strategy,
+		halfLife:         halfLife,
+		targetBlocks:     targetBlocks,
+		estimators:       make(map[string]estimator),
 	}
+	for name, constructor := range estimatorConstructors {
+		oracle.estimators[name] = constructor(oracle)
+	}
+	return oracle
 }
 
 // SuggestTipCap returns a tip cap so that newly created transaction can have a
@@ -158,49 +198,11 @@ func (oracle *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 	if headHash == lastHead {
 		return new(big.Int).Set(lastPrice), nil
 	}
-	var (
-		sent, exp int
-		number    = head.Number.Uint64()
-		result    = make(chan results, oracle.checkBlocks)
-		quit      = make(chan struct{})
-		results   []*big.Int
-	)
-	for sent < oracle.checkBlocks && number > 0 {
-		go oracle.getBlockValues(ctx, types.MakeSigner(oracle.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, oracle.ignorePrice, result, quit)
-		sent++
-		exp++
-		number--
-	}
-	for exp > 0 {
-		res := <-result
-		if res.err != nil {
-			close(quit)
-			return new(big.Int).Set(lastPrice), res.err
-		}
-		exp--
-		// Nothing returned. There are two special cases here:
-		// - The block is empty
-		// - All the transactions included are sent by the miner itself.
-		// In these cases, use the latest calculated price for sampling.
-		if len(res.values) == 0 {
-			res.values = []*big.Int{lastPrice}
-		}
-		// Besides, in order to collect enough data for sampling, if nothing
-		// meaningful returned, try to query more blocks. But the maximum
-		// is 2*checkBlocks.
-		if len(res.values) == 1 && len(results)+1+exp < oracle.checkBlocks*2 && number > 0 {
-			go oracle.getBlockValues(ctx, types.MakeSigner(oracle.backend.ChainConfig(), big.NewInt(int64(number))), number, sampleNumber, oracle.ignorePrice, result, quit)
-			sent++
-			exp++
-			number--
-		}
-		results = append(results, res.values...)
-	}
-	price := lastPrice
-	if len(results) > 0 {
-		sort.Sort(bigIntArray(results))
-		price = results[(len(results)-1)*oracle.percentile/100]
+	prices, err := oracle.estimators[oracle.strategy].estimate(ctx, head, []float64{float64(oracle.percentile)})
+	if err != nil {
+		return new(big.Int).Set(lastPrice), err
 	}
+	price := prices[0]
 	if price.Cmp(oracle.maxPrice) > 0 {
 		price = new(big.Int).Set(oracle.maxPrice)
 	}
@@ -214,6 +216,8 @@ func (oracle *Oracle) SuggestTipCap(ctx context.Context) (*big.Int, error) {
 
 type results struct {
 	values []*big.Int
+	number uint64 // Number of the block the values were sampled from
+	time   uint64 // Timestamp of the block the values were sampled from
 	err    error
 }
 
@@ -249,7 +253,7 @@ func (oracle *Oracle) getBlockValues(ctx context.Context, signer types.Signer, b
 	block, err := oracle.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
 	if block == nil {
 		select {
-		case result <- results{nil, err}:
+		case result <- results{values: nil, number: blockNum, err: err}:
 		case <-quit:
 		}
 		return
@@ -275,7 +279,7 @@ func (oracle *Oracle) getBlockValues(ctx context.Context, signer types.Signer, b
 		}
 	}
 	select {
-	case result <- results{prices, nil}:
+	case result <- results{values: prices, number: blockNum, time: block.Time()}:
 	case <-quit:
 	}
 }
@@ -38,7 +38,21 @@ type ethHandler handler
 
 func (h *ethHandler) Chain() *core.BlockChain     { return h.chain }
 func (h *ethHandler) StateBloom() *trie.SyncBloom { return h.stateBloom }
-func (h *ethHandler) TxPool() eth.TxPool          { return h.txpool }
+func (h *ethHandler) TxPool() eth.TxPool          { return &publicTxPool{h.txpool} }
+
+// publicTxPool is the view of the transaction pool served to remote peers, which
+// hides all private transactions.
+type publicTxPool struct {
+	txPool
+}
+
+// Get retrieves a transaction from the pool unless it is private.
+func (p *publicTxPool) Get(hash common.Hash) *types.Transaction {
+	if p.txPool.IsPrivate(hash) {
+		return nil
+	}
+	return p.txPool.Get(hash)
+}
 
 // RunPeer is invoked when a peer joins on the `eth` protocol.
 func (h *ethHandler) RunPeer(peer *eth.Peer, hand eth.Handler) error {
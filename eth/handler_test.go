@@ -82,6 +82,12 @@ func (pool *testTxPool) GetChainConfig() *params.ChainConfig {
 	return params.TestChainConfig
 }
 
+// IsPrivate returns whether a transaction must be withheld from the network,
+// which is never the case for the test pool.
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	return false
+}
+
 // AddRemotes appends a batch of transactions to the pool, and notifies any
 // listeners if the addition channel is non nil
 func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
@@ -92,6 +92,15 @@ func (zmq *ZMQRep) Init(nevmEP string) error {
 				}
 				msgSend := zmq4.NewMsgFrom([]byte("nevmdisconnect"), []byte(result))
 				zmq.rep.SendMulti(msgSend)
+			} else if strTopic == "nevmchainlock" {
+				result := "chainlocked"
+				err := zmq.nevmIndexer.FinalizeBlock(string(msg.Frames[1]), zmq.eth)
+				if err != nil {
+					log.Error("chainlockSub", "err", err)
+					result = err.Error()
+				}
+				msgSend := zmq4.NewMsgFrom([]byte("nevmchainlock"), []byte(result))
+				zmq.rep.SendMulti(msgSend)
 			} else if strTopic == "nevmblock" {
 				var nevmBlockConnectBytes []byte
 				block := zmq.nevmIndexer.CreateBlock(zmq.eth)
@@ -79,7 +79,8 @@ func (ec *Client) BlockByHash(ctx context.Context, hash common.Hash) (*types.Blo
 }
 
 // BlockByNumber returns a block from the current canonical chain. If number is nil, the
-// latest known block is returned.
+// latest known block is returned. Use rpc.FinalizedBlockNumber or rpc.SafeBlockNumber
+// to retrieve the latest block finalized by a Syscoin chainlock.
 //
 // Note that loading full blocks requires two requests. Use HeaderByNumber
 // if you don't need all transactions or uncle headers.
@@ -176,7 +177,8 @@ func (ec *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.He
 }
 
 // HeaderByNumber returns a block header from the current canonical chain. If number is
-// nil, the latest known header is returned.
+// nil, the latest known header is returned. Use rpc.FinalizedBlockNumber or
+// rpc.SafeBlockNumber to retrieve the header of the latest finalized block.
 func (ec *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
 	var head *types.Header
 	err := ec.c.CallContext(ctx, &head, "eth_getBlockByNumber", toBlockNumArg(number), false)
@@ -397,11 +399,22 @@ func toFilterArg(q ethereum.FilterQuery) (interface{}, error) {
 		"address": q.Addresses,
 		"topics":  q.Topics,
 	}
+	if q.Limit > 0 {
+		arg["limit"] = hexutil.Uint64(q.Limit)
+	}
 	if q.BlockHash != nil {
 		arg["blockHash"] = *q.BlockHash
 		if q.FromBlock != nil || q.ToBlock != nil {
 			return nil, fmt.Errorf("cannot specify both BlockHash and FromBlock/ToBlock")
 		}
+		if q.BlockHashes != nil {
+			return nil, fmt.Errorf("cannot specify both BlockHash and BlockHashes")
+		}
+	} else if q.BlockHashes != nil {
+		arg["blockHashes"] = q.BlockHashes
+		if q.FromBlock != nil || q.ToBlock != nil {
+			return nil, fmt.Errorf("cannot specify both BlockHashes and FromBlock/ToBlock")
+		}
 	} else {
 		if q.FromBlock == nil {
 			arg["fromBlock"] = "0x0"
@@ -532,6 +545,14 @@ func toBlockNumArg(number *big.Int) string {
 	if number.Cmp(pending) == 0 {
 		return "pending"
 	}
+	finalized := big.NewInt(int64(rpc.FinalizedBlockNumber))
+	if number.Cmp(finalized) == 0 {
+		return "finalized"
+	}
+	safe := big.NewInt(int64(rpc.SafeBlockNumber))
+	if number.Cmp(safe) == 0 {
+		return "safe"
+	}
 	return hexutil.EncodeBig(number)
 }
 
@@ -64,6 +64,7 @@ type KeyValueStore interface {
 	Iteratee
 	Stater
 	Compacter
+	Snapshotter
 	io.Closer
 }
 
@@ -88,6 +89,11 @@ type AncientReader interface {
 
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
+
+	// AncientTxLookup retrieves the number of the frozen block containing the
+	// transaction with the given hash from the frozen transaction index, only
+	// searching the blocks below limit.
+	AncientTxLookup(hash []byte, limit uint64) (uint64, error)
 }
 
 // AncientWriter contains the methods required to write to immutable ancient data.
@@ -134,5 +140,6 @@ type Database interface {
 	Iteratee
 	Stater
 	Compacter
+	Snapshotter
 	io.Closer
 }
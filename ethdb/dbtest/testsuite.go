@@ -313,6 +313,45 @@ func TestDatabaseSuite(t *testing.T, New func() ethdb.KeyValueStore) {
 		}
 	})
 
+	t.Run("Snapshot", func(t *testing.T) {
+		db := New()
+		defer db.Close()
+
+		for _, k := range []string{"1", "2", "3"} {
+			if err := db.Put([]byte(k), []byte("val"+k)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		snap, err := db.NewSnapshot()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer snap.Release()
+
+		// Mutate the database, none of which may be visible through the snapshot
+		if err := db.Put([]byte("1"), []byte("new")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Delete([]byte("2")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte("4"), []byte("val4")); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := snap.Get([]byte("1")); err != nil || !bytes.Equal(v, []byte("val1")) {
+			t.Errorf("snapshot get mismatch: have %q (err %v), want %q", v, err, "val1")
+		}
+		if ok, err := snap.Has([]byte("2")); err != nil || !ok {
+			t.Errorf("deleted key missing from snapshot: %v", err)
+		}
+		if ok, err := snap.Has([]byte("4")); err != nil || ok {
+			t.Errorf("new key present in snapshot: %v", err)
+		}
+		if got, want := iterateKeys(snap.NewIterator(nil, nil)), []string{"1", "2", "3"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got: %s; want: %s", got, want)
+		}
+		snap.Release() // releasing twice must be safe
+	})
 }
 
 func iterateKeys(it ethdb.Iterator) []string {
@@ -19,10 +19,12 @@ package graphql
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum"
@@ -32,14 +34,22 @@ import (
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/eth/filters"
+	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
 )
 
 var (
-	errBlockInvariant = errors.New("block objects must be instantiated with at least one of num or hash")
+	errBlockInvariant          = errors.New("block objects must be instantiated with at least one of num or hash")
+	errSubscriptionUnsupported = errors.New("subscriptions are not supported by this node")
 )
 
+// maxStorageRange is the maximum number of storage slots returned by a single
+// storageRange query.
+const maxStorageRange = 1024
+
 type Long int64
 
 // ImplementsGraphQLType returns true if Long implements the provided GraphQL type.
@@ -124,6 +134,80 @@ func (a *Account) Storage(ctx context.Context, args struct{ Slot common.Hash })
 	return state.GetState(a.address, args.Slot), nil
 }
 
+func (a *Account) StorageRange(ctx context.Context, args struct {
+	Start *common.Hash
+	Limit int32
+}) (*StorageRange, error) {
+	if args.Limit < 0 || args.Limit > maxStorageRange {
+		return nil, fmt.Errorf("limit must be between 0 and %d", maxStorageRange)
+	}
+	state, err := a.getState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &StorageRange{slots: []*StorageSlot{}}
+	st := state.StorageTrie(a.address)
+	if st == nil {
+		return result, nil
+	}
+	var start []byte
+	if args.Start != nil {
+		start = args.Start.Bytes()
+	}
+	it := trie.NewIterator(st.NodeIterator(start))
+	for i := int32(0); i < args.Limit && it.Next(); i++ {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return nil, err
+		}
+		slot := &StorageSlot{hash: common.BytesToHash(it.Key), value: common.BytesToHash(content)}
+		if preimage := st.GetKey(it.Key); preimage != nil {
+			key := common.BytesToHash(preimage)
+			slot.key = &key
+		}
+		result.slots = append(result.slots, slot)
+	}
+	// Add the 'next key' so clients can continue downloading.
+	if it.Next() {
+		next := common.BytesToHash(it.Key)
+		result.nextKey = &next
+	}
+	return result, nil
+}
+
+// StorageRange represents a page of the storage slots of a contract account.
+type StorageRange struct {
+	slots   []*StorageSlot
+	nextKey *common.Hash // nil if slots include the last slot in the trie
+}
+
+func (r *StorageRange) Slots(ctx context.Context) []*StorageSlot {
+	return r.slots
+}
+
+func (r *StorageRange) NextKey(ctx context.Context) *common.Hash {
+	return r.nextKey
+}
+
+// StorageSlot represents a single storage slot of a contract account.
+type StorageSlot struct {
+	hash  common.Hash
+	key   *common.Hash // nil if the preimage of the hash is unknown
+	value common.Hash
+}
+
+func (s *StorageSlot) Hash(ctx context.Context) common.Hash {
+	return s.hash
+}
+
+func (s *StorageSlot) Key(ctx context.Context) *common.Hash {
+	return s.key
+}
+
+func (s *StorageSlot) Value(ctx context.Context) common.Hash {
+	return s.value
+}
+
 // Log represents an individual log message. All arguments are mandatory.
 type Log struct {
 	backend     ethapi.Backend
@@ -155,6 +239,10 @@ func (l *Log) Data(ctx context.Context) hexutil.Bytes {
 	return l.log.Data
 }
 
+func (l *Log) Removed(ctx context.Context) bool {
+	return l.log.Removed
+}
+
 // AccessTuple represents EIP-2930
 type AccessTuple struct {
 	address     common.Address
@@ -475,6 +563,89 @@ func (t *Transaction) V(ctx context.Context) (hexutil.Big, error) {
 	return hexutil.Big(*v), nil
 }
 
+func (t *Transaction) CallTrace(ctx context.Context) (*CallTrace, error) {
+	tx, err := t.resolve(ctx)
+	if err != nil || tx == nil || t.block == nil {
+		return nil, err
+	}
+	traces, err := t.block.callTraces(ctx)
+	if err != nil || t.index >= uint64(len(traces)) {
+		return nil, err
+	}
+	return traces[t.index].trace, traces[t.index].err
+}
+
+// callFrame is a call as reported by the call tracer.
+type callFrame struct {
+	Type    string          `json:"type"`
+	From    common.Address  `json:"from"`
+	To      *common.Address `json:"to"`
+	Value   *hexutil.Big    `json:"value"`
+	Gas     *hexutil.Uint64 `json:"gas"`
+	GasUsed *hexutil.Uint64 `json:"gasUsed"`
+	Input   hexutil.Bytes   `json:"input"`
+	Output  *hexutil.Bytes  `json:"output"`
+	Error   *string         `json:"error"`
+	Calls   []callFrame     `json:"calls"`
+}
+
+// CallTrace represents a call made during the execution of a transaction.
+type CallTrace struct {
+	frame callFrame
+}
+
+func (c *CallTrace) Type(ctx context.Context) string {
+	return c.frame.Type
+}
+
+func (c *CallTrace) From(ctx context.Context) common.Address {
+	return c.frame.From
+}
+
+func (c *CallTrace) To(ctx context.Context) *common.Address {
+	return c.frame.To
+}
+
+func (c *CallTrace) Value(ctx context.Context) *hexutil.Big {
+	return c.frame.Value
+}
+
+func (c *CallTrace) Gas(ctx context.Context) *Long {
+	if c.frame.Gas == nil {
+		return nil
+	}
+	gas := Long(*c.frame.Gas)
+	return &gas
+}
+
+func (c *CallTrace) GasUsed(ctx context.Context) *Long {
+	if c.frame.GasUsed == nil {
+		return nil
+	}
+	gasUsed := Long(*c.frame.GasUsed)
+	return &gasUsed
+}
+
+func (c *CallTrace) Input(ctx context.Context) hexutil.Bytes {
+	return c.frame.Input
+}
+
+func (c *CallTrace) Output(ctx context.Context) *hexutil.Bytes {
+	return c.frame.Output
+}
+
+func (c *CallTrace) Error(ctx context.Context) *string {
+	return c.frame.Error
+}
+
+func (c *CallTrace) Calls(ctx context.Context) []*CallTrace {
+	calls := make([]*CallTrace, len(c.frame.Calls))
+	for i, frame := range c.frame.Calls {
+		calls[i] = &CallTrace{frame: frame}
+	}
+	return calls
+}
+
 type BlockType int
 
 // Block represents an Ethereum block.
@@ -487,6 +658,61 @@ type Block struct {
 	header       *types.Header
 	block        *types.Block
 	receipts     []*types.Receipt
+
+	traceLock sync.Mutex
+	traces    []callTraceResult // Call traces of the transactions, nil until traced
+}
+
+// callTraceResult is the call trace of a transaction, or the reason it could not
+// be traced.
+type callTraceResult struct {
+	trace *CallTrace
+	err   error
+}
+
+// callTraces traces all the transactions of the block with the call tracer. The
+// results are cached, so that the block is only re-executed once however many of
+// its transactions are queried.
+func (b *Block) callTraces(ctx context.Context) ([]callTraceResult, error) {
+	b.traceLock.Lock()
+	defer b.traceLock.Unlock()
+
+	if b.traces != nil {
+		return b.traces, nil
+	}
+	backend, ok := b.backend.(tracers.Backend)
+	if !ok {
+		return nil, nil
+	}
+	hash, err := b.Hash(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tracer := "callTracer"
+	results, err := tracers.NewAPI(backend).TraceBlockByHash(ctx, hash, &tracers.TraceConfig{Tracer: &tracer})
+	if err != nil {
+		return nil, err
+	}
+	traces := make([]callTraceResult, len(results))
+	for i, result := range results {
+		if result.Error != "" {
+			traces[i].err = errors.New(result.Error)
+			continue
+		}
+		raw, ok := result.Result.(json.RawMessage)
+		if !ok {
+			traces[i].err = fmt.Errorf("unexpected call tracer result %T", result.Result)
+			continue
+		}
+		trace := new(CallTrace)
+		if err := json.Unmarshal(raw, &trace.frame); err != nil {
+			traces[i].err = err
+			continue
+		}
+		traces[i].trace = trace
+	}
+	b.traces = traces
+	return traces, nil
 }
 
 // resolve returns the internal Block object representing this block, fetching
@@ -596,6 +822,52 @@ func (b *Block) BaseFeePerGas(ctx context.Context) (*hexutil.Big, error) {
 	return (*hexutil.Big)(header.BaseFee), nil
 }
 
+func (b *Block) GasUsedRatio(ctx context.Context) (float64, error) {
+	header, err := b.resolveHeader(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if header.GasLimit == 0 {
+		return 0, nil
+	}
+	return float64(header.GasUsed) / float64(header.GasLimit), nil
+}
+
+func (b *Block) Rewards(ctx context.Context, args struct{ Percentiles []float64 }) ([]hexutil.Big, error) {
+	if len(args.Percentiles) == 0 {
+		return []hexutil.Big{}, nil
+	}
+	header, err := b.resolveHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, reward, _, _, err := b.backend.FeeHistory(ctx, 1, rpc.BlockNumber(header.Number.Int64()), args.Percentiles)
+	if err != nil {
+		return nil, err
+	}
+	if len(reward) == 0 {
+		return nil, fmt.Errorf("fee history of block %d not available", header.Number)
+	}
+	rewards := make([]hexutil.Big, len(reward[0]))
+	for i, r := range reward[0] {
+		rewards[i] = hexutil.Big(*r)
+	}
+	return rewards, nil
+}
+
+func (b *Block) SysBlockHash(ctx context.Context) (*common.Hash, error) {
+	header, err := b.resolveHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sysBlockHash, err := b.backend.ReadSYSHash(ctx, rpc.BlockNumber(header.Number.Int64()))
+	if err != nil || len(sysBlockHash) == 0 {
+		return nil, err
+	}
+	hash := common.BytesToHash(sysBlockHash)
+	return &hash, nil
+}
+
 func (b *Block) Parent(ctx context.Context) (*Block, error) {
 	// If the block header hasn't been fetched, and we'll need it, fetch it.
 	if b.numberOrHash == nil && b.header == nil {
@@ -1051,6 +1323,7 @@ func (p *Pending) EstimateGas(ctx context.Context, args struct {
 // Resolver is the top-level object in the GraphQL hierarchy.
 type Resolver struct {
 	backend ethapi.Backend
+	events  *filters.EventSystem // Event source of subscriptions, nil if unsupported
 }
 
 func (r *Resolver) Block(ctx context.Context, args struct {
@@ -1213,6 +1486,69 @@ func (r *Resolver) ChainID(ctx context.Context) (hexutil.Big, error) {
 	return hexutil.Big(*r.backend.ChainConfig().ChainID), nil
 }
 
+// FeeHistory represents the fee market history of a range of blocks.
+type FeeHistory struct {
+	oldestBlock  *big.Int
+	reward       [][]*big.Int
+	baseFee      []*big.Int
+	gasUsedRatio []float64
+}
+
+func (f *FeeHistory) OldestBlock(ctx context.Context) Long {
+	return Long(f.oldestBlock.Int64())
+}
+
+func (f *FeeHistory) BaseFeePerGas(ctx context.Context) []hexutil.Big {
+	baseFees := make([]hexutil.Big, len(f.baseFee))
+	for i, fee := range f.baseFee {
+		baseFees[i] = hexutil.Big(*fee)
+	}
+	return baseFees
+}
+
+func (f *FeeHistory) GasUsedRatio(ctx context.Context) []float64 {
+	return f.gasUsedRatio
+}
+
+func (f *FeeHistory) Reward(ctx context.Context) *[][]hexutil.Big {
+	if f.reward == nil {
+		return nil
+	}
+	rewards := make([][]hexutil.Big, len(f.reward))
+	for i, block := range f.reward {
+		rewards[i] = make([]hexutil.Big, len(block))
+		for j, reward := range block {
+			rewards[i][j] = hexutil.Big(*reward)
+		}
+	}
+	return &rewards
+}
+
+func (r *Resolver) FeeHistory(ctx context.Context, args struct {
+	BlockCount        int32
+	LastBlock         *Long
+	RewardPercentiles *[]float64
+}) (*FeeHistory, error) {
+	lastBlock := rpc.LatestBlockNumber
+	if args.LastBlock != nil {
+		lastBlock = rpc.BlockNumber(*args.LastBlock)
+	}
+	var percentiles []float64
+	if args.RewardPercentiles != nil {
+		percentiles = *args.RewardPercentiles
+	}
+	oldest, reward, baseFee, gasUsedRatio, err := r.backend.FeeHistory(ctx, int(args.BlockCount), lastBlock, percentiles)
+	if err != nil {
+		return nil, err
+	}
+	return &FeeHistory{
+		oldestBlock:  oldest,
+		reward:       reward,
+		baseFee:      baseFee,
+		gasUsedRatio: gasUsedRatio,
+	}, nil
+}
+
 // SyncState represents the synchronisation status returned from the `syncing` accessor.
 type SyncState struct {
 	progress ethereum.SyncProgress
@@ -1257,3 +1593,123 @@ func (r *Resolver) Syncing() (*SyncState, error) {
 	// Otherwise gather the block sync stats
 	return &SyncState{progress}, nil
 }
+
+// SubscriptionFilterCriteria encapsulates the arguments to `newLogs` on the root
+// resolver object.
+type SubscriptionFilterCriteria struct {
+	Addresses *[]common.Address // restricts matches to events created by specific contracts
+	Topics    *[][]common.Hash  // restricts matches to particular event topics, as in FilterCriteria
+}
+
+// NewBlocks streams the blocks imported into the chain until the subscription
+// is cancelled.
+func (r *Resolver) NewBlocks(ctx context.Context) (<-chan *Block, error) {
+	if r.events == nil {
+		return nil, errSubscriptionUnsupported
+	}
+	headers := make(chan *types.Header)
+	sub := r.events.SubscribeNewHeads(headers)
+
+	blocks := make(chan *Block)
+	go func() {
+		defer close(blocks)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case header := <-headers:
+				numberOrHash := rpc.BlockNumberOrHashWithHash(header.Hash(), false)
+				block := &Block{
+					backend:      r.backend,
+					numberOrHash: &numberOrHash,
+					hash:         header.Hash(),
+					header:       header,
+				}
+				select {
+				case blocks <- block:
+				case <-ctx.Done():
+					return
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return blocks, nil
+}
+
+// NewLogs streams the logs of imported and reorged blocks that match the given
+// filter until the subscription is cancelled.
+func (r *Resolver) NewLogs(ctx context.Context, args struct{ Filter SubscriptionFilterCriteria }) (<-chan *Log, error) {
+	if r.events == nil {
+		return nil, errSubscriptionUnsupported
+	}
+	var crit ethereum.FilterQuery
+	if args.Filter.Addresses != nil {
+		crit.Addresses = *args.Filter.Addresses
+	}
+	if args.Filter.Topics != nil {
+		crit.Topics = *args.Filter.Topics
+	}
+	matches := make(chan []*types.Log)
+	sub, err := r.events.SubscribeLogs(crit, matches)
+	if err != nil {
+		return nil, err
+	}
+	logs := make(chan *Log)
+	go func() {
+		defer close(logs)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case batch := <-matches:
+				for _, log := range batch {
+					select {
+					case logs <- &Log{backend: r.backend, transaction: &Transaction{backend: r.backend, hash: log.TxHash}, log: log}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return logs, nil
+}
+
+// NewPendingTransactions streams the transactions entering the transaction pool
+// until the subscription is cancelled.
+func (r *Resolver) NewPendingTransactions(ctx context.Context) (<-chan *Transaction, error) {
+	if r.events == nil {
+		return nil, errSubscriptionUnsupported
+	}
+	hashes := make(chan []common.Hash, 128)
+	sub := r.events.SubscribePendingTxs(hashes)
+
+	txs := make(chan *Transaction)
+	go func() {
+		defer close(txs)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case batch := <-hashes:
+				for _, hash := range batch {
+					select {
+					case txs <- &Transaction{backend: r.backend, hash: hash}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-sub.Err():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return txs, nil
+}
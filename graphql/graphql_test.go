@@ -33,8 +33,10 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/gorilla/websocket"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -47,13 +49,16 @@ func TestBuildSchema(t *testing.T) {
 	// Copy config
 	conf := node.DefaultConfig
 	conf.DataDir = ddir
-	stack, err := node.New(&conf)
-	if err != nil {
-		t.Fatalf("could not create new node: %v", err)
-	}
-	// Make sure the schema can be parsed and matched up to the object model.
-	if err := newHandler(stack, nil, []string{}, []string{}); err != nil {
-		t.Errorf("Could not construct GraphQL handler: %v", err)
+	for _, tracing := range []bool{false, true} {
+		stack, err := node.New(&conf)
+		if err != nil {
+			t.Fatalf("could not create new node: %v", err)
+		}
+		// Make sure the schema can be parsed and matched up to the object model.
+		if err := newHandler(stack, nil, nil, []string{}, []string{}, tracing); err != nil {
+			t.Errorf("Could not construct GraphQL handler (tracing %v): %v", tracing, err)
+		}
+		stack.Close()
 	}
 }
 
@@ -143,6 +148,12 @@ func TestGraphQLBlockSerialization(t *testing.T) {
 			want: `{"data":{"block":{"number":10,"call":{"data":"0x","status":1}}}}`,
 			code: 200,
 		},
+		// call traces are only served if tracing is enabled
+		{
+			body: `{"query": "{block {transactions { callTrace { type }}}}"}`,
+			want: `{"errors":[{"message":"Cannot query field \"callTrace\" on type \"Transaction\".","locations":[{"line":1,"column":24}]}]}`,
+			code: 400,
+		},
 	} {
 		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
 		if err != nil {
@@ -179,6 +190,21 @@ func TestGraphQLBlockSerializationEIP2718(t *testing.T) {
 			want: `{"data":{"block":{"number":1,"transactions":[{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x64","hash":"0xd864c9d7d37fade6b70164740540c06dd58bb9c3f6b46101908d6339db6a6a7b","type":0,"accessList":[],"index":0},{"from":{"address":"0x71562b71999873db5b286df957af199ec94617f7"},"to":{"address":"0x0000000000000000000000000000000000000dad"},"value":"0x32","hash":"0x19b35f8187b4e15fb59a9af469dca5dfa3cd363c11d372058c12f6482477b474","type":1,"accessList":[{"address":"0x0000000000000000000000000000000000000dad","storageKeys":["0x0000000000000000000000000000000000000000000000000000000000000000"]}],"index":1}]}}}`,
 			code: 200,
 		},
+		{ // Should return the fee market fields and call traces of the block
+			body: `{"query": "{block {gasUsedRatio sysBlockHash rewards(percentiles: [0, 100]) transactions { callTrace { type from to value gasUsed error calls { type } }}}}"}`,
+			want: `{"data":{"block":{"gasUsedRatio":0.004583304347826087,"sysBlockHash":null,"rewards":["0x7735940","0x7735940"],"transactions":[{"callTrace":{"type":"CALL","from":"0x71562b71999873db5b286df957af199ec94617f7","to":"0x0000000000000000000000000000000000000dad","value":"0x64","gasUsed":4204,"error":null,"calls":[]}},{"callTrace":{"type":"CALL","from":"0x71562b71999873db5b286df957af199ec94617f7","to":"0x0000000000000000000000000000000000000dad","value":"0x32","gasUsed":2204,"error":null,"calls":[]}}]}}}`,
+			code: 200,
+		},
+		{ // Should return the fee history of the chain
+			body: `{"query": "{feeHistory(blockCount: 2, rewardPercentiles: [50]) {oldestBlock baseFeePerGas gasUsedRatio reward}}"}`,
+			want: `{"data":{"feeHistory":{"oldestBlock":0,"baseFeePerGas":["0x3b9aca00","0x342770c0","0x2db1cf0e"],"gasUsedRatio":[0,0.004583304347826087],"reward":[["0x0"],["0x7735940"]]}}}`,
+			code: 200,
+		},
+		{ // Should return the storage slots of an account page by page
+			body: `{"query": "{block {account(address: \"0x0000000000000000000000000000000000000dad\") {storageRange(limit: 1) {slots {hash value} nextKey}}}}"}`,
+			want: `{"data":{"block":{"account":{"storageRange":{"slots":[{"hash":"0x340dd630ad21bf010b4e676dbfa9ba9a02175262d1fa356232cfde6cb5b47ef2","value":"0x0300000000000000000000000000000000000000000000000000000000000000"}],"nextKey":"0x48078cfed56339ea54962e72c37c7f588fc4f8e5bc173827ba75cb10a63a96a5"}}}}}`,
+			code: 200,
+		},
 	} {
 		resp, err := http.Post(fmt.Sprintf("%s/graphql", stack.HTTPEndpoint()), "application/json", strings.NewReader(tt.body))
 		if err != nil {
@@ -213,6 +239,61 @@ func TestGraphQLHTTPOnSamePort_GQLRequest_Unsuccessful(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
 
+// Tests that subscriptions and queries are served over websocket on the same
+// port as both HTTP and WS-RPC.
+func TestGraphQLWebsocket(t *testing.T) {
+	stack := createNode(t, false, false)
+	defer stack.Close()
+	backend := createGQLService(t, stack)
+	if err := stack.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	url := strings.Replace(stack.HTTPEndpoint(), "http://", "ws://", 1) + "/graphql"
+	dialer := websocket.Dialer{Subprotocols: []string{wsProtocol}}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	expect := func(want string) {
+		t.Helper()
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("could not read message: %v", err)
+		}
+		if strings.TrimSpace(string(msg)) != want {
+			t.Fatalf("wrong message\ngot:  %s\nwant: %s", msg, want)
+		}
+	}
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init"}`))
+	expect(`{"type":"connection_ack"}`)
+
+	// Subscribe to new blocks and import one
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"subscribe","payload":{"query":"subscription{newBlocks{number}}"}}`))
+	time.Sleep(100 * time.Millisecond)
+
+	chain := backend.BlockChain()
+	blocks, _ := core.GenerateChain(params.AllEthashProtocolChanges, chain.CurrentBlock(),
+		ethash.NewFaker(), backend.ChainDb(), 1, func(i int, gen *core.BlockGen) {})
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("could not import block: %v", err)
+	}
+	expect(`{"id":"1","type":"next","payload":{"data":{"newBlocks":{"number":11}}}}`)
+
+	// Queries yield a single result and complete
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"2","type":"subscribe","payload":{"query":"{block{number}}"}}`))
+	expect(`{"id":"2","type":"next","payload":{"data":{"block":{"number":11}}}}`)
+	expect(`{"id":"2","type":"complete"}`)
+
+	// Duplicate operation ids are rejected
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"subscribe","payload":{"query":"subscription{newBlocks{number}}"}}`))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, 4409) {
+		t.Fatalf("expected close error 4409, got %v", err)
+	}
+}
+
 func createNode(t *testing.T, gqlEnabled bool, txEnabled bool) *node.Node {
 	stack, err := node.New(&node.Config{
 		HTTPHost: "127.0.0.1",
@@ -234,7 +315,7 @@ func createNode(t *testing.T, gqlEnabled bool, txEnabled bool) *node.Node {
 	return stack
 }
 
-func createGQLService(t *testing.T, stack *node.Node) {
+func createGQLService(t *testing.T, stack *node.Node) *eth.Ethereum {
 	// create backend
 	ethConf := &ethconfig.Config{
 		Genesis: &core.Genesis{
@@ -265,10 +346,11 @@ func createGQLService(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, filters.NewEventSystem(ethBackend.APIBackend, false), []string{}, []string{}, false)
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
+	return ethBackend
 }
 
 func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
@@ -295,6 +377,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 					},
 					Nonce:   0,
 					Balance: big.NewInt(0),
+					Storage: map[common.Hash]common.Hash{{1}: {2}, {2}: {3}},
 				},
 			},
 			BaseFee: big.NewInt(params.InitialBaseFee),
@@ -302,6 +385,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 		Ethash: ethash.Config{
 			PowMode: ethash.ModeFake,
 		},
+		GPO:                     ethconfig.Defaults.GPO,
 		NetworkId:               1337,
 		TrieCleanCache:          5,
 		TrieCleanCacheJournal:   "triecache",
@@ -350,7 +434,7 @@ func createGQLServiceWithTransactions(t *testing.T, stack *node.Node) {
 		t.Fatalf("could not create import blocks: %v", err)
 	}
 	// create gql service
-	err = New(stack, ethBackend.APIBackend, []string{}, []string{})
+	err = New(stack, ethBackend.APIBackend, filters.NewEventSystem(ethBackend.APIBackend, false), []string{}, []string{}, true)
 	if err != nil {
 		t.Fatalf("could not create graphql service: %v", err)
 	}
@@ -34,6 +34,7 @@ const schema string = `
     schema {
         query: Query
         mutation: Mutation
+        subscription: Subscription
     }
 
     # Account is an Ethereum account at a particular block.
@@ -52,6 +53,29 @@ const schema string = `
         # Storage provides access to the storage of a contract account, indexed
         # by its 32 byte slot identifier.
         storage(slot: Bytes32!): Bytes32!
+        # StorageRange returns up to limit storage slots of a contract account,
+        # ordered by the hash of their slot identifier and starting at the given
+        # hash.
+        storageRange(start: Bytes32, limit: Int!): StorageRange!
+    }
+
+    # StorageRange is a page of the storage slots of a contract account.
+    type StorageRange {
+        # Slots are the storage slots in this page.
+        slots: [StorageSlot!]!
+        # NextKey is the hash at which the next page starts, or null if this is
+        # the last page.
+        nextKey: Bytes32
+    }
+
+    # StorageSlot is a single storage slot of a contract account.
+    type StorageSlot {
+        # Hash is the keccak256 hash of the slot identifier.
+        hash: Bytes32!
+        # Key is the slot identifier, or null if its preimage is not known.
+        key: Bytes32
+        # Value is the value stored in the slot.
+        value: Bytes32!
     }
 
     # Log is an Ethereum event log.
@@ -67,6 +91,9 @@ const schema string = `
         data: Bytes!
         # Transaction is the transaction that generated this log entry.
         transaction: Transaction!
+        # Removed is true if the log was reverted by a chain reorganisation. It is
+        # only ever set on logs delivered by subscriptions.
+        removed: Boolean!
     }
 
     #EIP-2718 
@@ -189,6 +216,14 @@ const schema string = `
         gasUsed: Long!
         # BaseFeePerGas is the fee perunit of gas burned by the protocol in this block.
 		baseFeePerGas: BigInt
+        # GasUsedRatio is the ratio of gasUsed to gasLimit of this block.
+        gasUsedRatio: Float!
+        # Rewards returns the effective priority fees per gas paid by the
+        # transactions of this block at the given percentiles of gas used.
+        rewards(percentiles: [Float!]!): [BigInt!]!
+        # SysBlockHash is the hash of the Syscoin block this block is anchored
+        # in, or null if it is not known.
+        sysBlockHash: Bytes32
         # Timestamp is the unix timestamp at which this block was mined.
         timestamp: Long!
         # LogsBloom is a bloom filter that can be used to check if a block may
@@ -289,6 +324,31 @@ const schema string = `
         topics: [[Bytes32!]!]
     }
 
+    # SubscriptionFilterCriteria encapsulates log filter criteria for streaming
+    # new log entries.
+    input SubscriptionFilterCriteria {
+        # Addresses is a list of addresses that are of interest. If this list is
+        # empty, results will not be filtered by address.
+        addresses: [Address!]
+        # Topics list restricts matches to particular event topics, following the
+        # same rules as the topics of FilterCriteria.
+        topics: [[Bytes32!]!]
+    }
+
+    # FeeHistory contains the fee market history of a range of blocks.
+    type FeeHistory {
+        # OldestBlock is the number of the first block of the range.
+        oldestBlock: Long!
+        # BaseFeePerGas are the base fees per gas of the blocks of the range,
+        # followed by the base fee of the block after the range.
+        baseFeePerGas: [BigInt!]!
+        # GasUsedRatio are the ratios of gasUsed to gasLimit of the blocks.
+        gasUsedRatio: [Float!]!
+        # Reward are the effective priority fees per gas at the requested
+        # percentiles of each block, or null if no percentiles were requested.
+        reward: [[BigInt!]!]
+    }
+
     # SyncState contains the current synchronisation state of the client.
     type SyncState{
         # StartingBlock is the block number at which synchronisation started.
@@ -343,10 +403,63 @@ const schema string = `
         syncing: SyncState
         # ChainID returns the current chain ID for transaction replay protection.
         chainID: BigInt!
+        # FeeHistory returns the fee market history of up to blockCount blocks
+        # ending at lastBlock, or at the most recent known block if it is not
+        # supplied.
+        feeHistory(blockCount: Int!, lastBlock: Long, rewardPercentiles: [Float!]): FeeHistory!
     }
 
     type Mutation {
         # SendRawTransaction sends an RLP-encoded transaction to the network.
         sendRawTransaction(data: Bytes!): Bytes32!
     }
+
+    # Subscriptions are only available over websocket connections.
+    type Subscription {
+        # NewBlocks streams the blocks imported into the chain.
+        newBlocks: Block!
+        # NewLogs streams the log entries of imported blocks matching the provided
+        # filter, as well as the ones reverted by chain reorganisations.
+        newLogs(filter: SubscriptionFilterCriteria!): Log!
+        # NewPendingTransactions streams the transactions entering the transaction
+        # pool.
+        newPendingTransactions: Transaction!
+    }
+`
+
+// tracingSchema extends the schema with the call traces of transactions. Tracing
+// re-executes whole blocks, so it is only served if explicitly enabled.
+const tracingSchema string = `
+    extend type Transaction {
+        # CallTrace is the tree of calls made by this transaction, as recorded
+        # by the call tracer. The whole block is traced once on first access. If
+        # the transaction is pending, or the node cannot trace transactions, this
+        # field will be null.
+        callTrace: CallTrace
+    }
+
+    # CallTrace is a call made during the execution of a transaction, along with
+    # the calls it made in turn.
+    type CallTrace {
+        # Type is the kind of call, such as CALL, DELEGATECALL or CREATE.
+        type: String!
+        # From is the address making the call.
+        from: Address!
+        # To is the address called, or the address of the created contract.
+        to: Address
+        # Value is the value, in wei, sent along with the call.
+        value: BigInt
+        # Gas is the amount of gas given to the call.
+        gas: Long
+        # GasUsed is the amount of gas used by the call.
+        gasUsed: Long
+        # Input is the data sent to the callee.
+        input: Bytes!
+        # Output is the data returned by the callee.
+        output: Bytes
+        # Error is the reason the call failed, or null if it succeeded.
+        error: String
+        # Calls are the calls made by this call.
+        calls: [CallTrace!]!
+    }
 `
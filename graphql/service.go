@@ -20,16 +20,23 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/node"
+	"github.com/gorilla/websocket"
 	"github.com/graph-gophers/graphql-go"
 )
 
 type handler struct {
-	Schema *graphql.Schema
+	Schema  *graphql.Schema
+	Origins []string // Origins allowed to open websocket connections
 }
 
 func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		h.serveWebsocket(w, r)
+		return
+	}
 	var params struct {
 		Query         string                 `json:"query"`
 		OperationName string                 `json:"operationName"`
@@ -55,25 +62,31 @@ func (h handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
-// New constructs a new GraphQL service instance.
-func New(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
+// New constructs a new GraphQL service instance. Subscriptions are served over
+// websocket from the given event system, or rejected if it is nil. The call traces
+// of transactions are only served if tracing is enabled.
+func New(stack *node.Node, backend ethapi.Backend, events *filters.EventSystem, cors, vhosts []string, tracing bool) error {
 	if backend == nil {
 		panic("missing backend")
 	}
 	// check if http server with given endpoint exists and enable graphQL on it
-	return newHandler(stack, backend, cors, vhosts)
+	return newHandler(stack, backend, events, cors, vhosts, tracing)
 }
 
 // newHandler returns a new `http.Handler` that will answer GraphQL queries.
 // It additionally exports an interactive query browser on the / endpoint.
-func newHandler(stack *node.Node, backend ethapi.Backend, cors, vhosts []string) error {
-	q := Resolver{backend}
+func newHandler(stack *node.Node, backend ethapi.Backend, events *filters.EventSystem, cors, vhosts []string, tracing bool) error {
+	q := Resolver{backend: backend, events: events}
 
-	s, err := graphql.ParseSchema(schema, &q)
+	sdl := schema
+	if tracing {
+		sdl += tracingSchema
+	}
+	s, err := graphql.ParseSchema(sdl, &q)
 	if err != nil {
 		return err
 	}
-	h := handler{Schema: s}
+	h := handler{Schema: s, Origins: cors}
 	handler := node.NewHTTPHandlerStack(h, cors, vhosts)
 
 	stack.RegisterHandler("GraphQL UI", "/graphql/ui", GraphiQL{})
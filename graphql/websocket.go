@@ -0,0 +1,311 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/gorilla/websocket"
+	"github.com/graph-gophers/graphql-go"
+)
+
+const (
+	// Subprotocols of the websocket transport. graphql-transport-ws is the protocol
+	// of the graphql-ws library, graphql-ws the legacy subscriptions-transport-ws.
+	wsProtocol       = "graphql-transport-ws"
+	wsLegacyProtocol = "graphql-ws"
+
+	wsInitTimeout     = 10 * time.Second // Time allowed for the client to initialise the connection
+	wsWriteTimeout    = 10 * time.Second // Time allowed to write a message to the client
+	wsKeepAlive       = 30 * time.Second // Keepalive interval of legacy protocol connections
+	wsMaxMessageSize  = 1024 * 1024      // Maximum size of a message read from the client
+	wsMaxSubscription = 64               // Maximum number of operations running on a connection
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	Subprotocols:    []string{wsProtocol, wsLegacyProtocol},
+}
+
+// wsMessage is the envelope of all messages of both websocket protocols.
+type wsMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// wsConn is a websocket connection running GraphQL operations.
+type wsConn struct {
+	schema *graphql.Schema
+	conn   *websocket.Conn
+	legacy bool // Whether the connection speaks subscriptions-transport-ws
+
+	writeLock sync.Mutex
+
+	lock sync.Mutex
+	ops  map[string]context.CancelFunc // Cancel functions of the running operations
+	wg   sync.WaitGroup
+}
+
+// serveWebsocket upgrades the request to a websocket connection and serves
+// GraphQL queries and subscriptions over it until it is closed.
+func (h handler) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := wsUpgrader
+	upgrader.CheckOrigin = func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allowed := range h.Origins {
+			if allowed == "*" || allowed == origin {
+				return true
+			}
+		}
+		log.Debug("Rejected GraphQL websocket connection", "origin", origin)
+		return false
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &wsConn{
+		schema: h.Schema,
+		conn:   conn,
+		legacy: conn.Subprotocol() == wsLegacyProtocol,
+		ops:    make(map[string]context.CancelFunc),
+	}
+	c.run()
+}
+
+// run handles the messages of the client until the connection fails or is
+// terminated, then stops all running operations.
+func (c *wsConn) run() {
+	defer c.conn.Close()
+	defer c.wg.Wait()
+	defer c.cancelAll()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsInitTimeout))
+
+	var msg wsMessage
+	if err := c.conn.ReadJSON(&msg); err != nil || msg.Type != "connection_init" {
+		c.close(4408, "Connection initialisation timeout")
+		return
+	}
+	c.conn.SetReadDeadline(time.Time{})
+	if err := c.send(&wsMessage{Type: "connection_ack"}); err != nil {
+		return
+	}
+	if c.legacy {
+		stop := make(chan struct{})
+		defer close(stop)
+		go c.keepAlive(stop)
+	}
+	for {
+		var msg wsMessage
+		if err := c.conn.ReadJSON(&msg); err != nil {
+			return
+		}
+		switch msg.Type {
+		case "subscribe", "start":
+			if !c.start(&msg) {
+				return
+			}
+		case "complete", "stop":
+			c.stop(msg.ID)
+		case "ping":
+			c.send(&wsMessage{Type: "pong", Payload: msg.Payload})
+		case "pong":
+		case "connection_terminate":
+			return
+		default:
+			c.close(4400, "Invalid message type "+msg.Type)
+			return
+		}
+	}
+}
+
+// start begins executing the operation requested by the client. It returns false
+// if the request violates the protocol and the connection was closed.
+func (c *wsConn) start(msg *wsMessage) bool {
+	var params struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	if msg.ID == "" || json.Unmarshal(msg.Payload, &params) != nil {
+		c.close(4400, "Invalid subscribe message")
+		return false
+	}
+	c.lock.Lock()
+	if _, ok := c.ops[msg.ID]; ok {
+		c.lock.Unlock()
+		c.close(4409, "Subscriber for "+msg.ID+" already exists")
+		return false
+	}
+	if len(c.ops) >= wsMaxSubscription {
+		c.lock.Unlock()
+		c.sendError(msg.ID, "too many subscriptions")
+		return true
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.ops[msg.ID] = cancel
+	c.wg.Add(1)
+	c.lock.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+		c.execute(ctx, msg.ID, params.Query, params.OperationName, params.Variables)
+	}()
+	return true
+}
+
+// execute runs an operation and forwards its results to the client. Queries and
+// mutations yield a single result, subscriptions one result per event.
+func (c *wsConn) execute(ctx context.Context, id, query, operation string, vars map[string]interface{}) {
+	responses, err := c.schema.Subscribe(ctx, query, operation, vars)
+	if err != nil {
+		c.finish(id)
+		c.sendError(id, err.Error())
+		return
+	}
+	// The response channel must be drained until closed to release the resolvers.
+	failed := false
+	for resp := range responses {
+		if failed {
+			continue
+		}
+		r := resp.(*graphql.Response)
+		if len(r.Data) == 0 && len(r.Errors) > 0 {
+			failed = true
+			c.sendErrors(id, r.Errors)
+			continue
+		}
+		payload, err := json.Marshal(r)
+		if err != nil {
+			continue
+		}
+		typ := "next"
+		if c.legacy {
+			typ = "data"
+		}
+		c.send(&wsMessage{ID: id, Type: typ, Payload: payload})
+	}
+	// Announce the completion unless the client stopped the operation itself.
+	if c.finish(id) && !failed {
+		c.send(&wsMessage{ID: id, Type: "complete"})
+	}
+}
+
+// stop cancels the operation with the given id.
+func (c *wsConn) stop(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if cancel, ok := c.ops[id]; ok {
+		cancel()
+		delete(c.ops, id)
+	}
+}
+
+// finish removes a finished operation, reporting whether it was still running.
+func (c *wsConn) finish(id string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	cancel, ok := c.ops[id]
+	if ok {
+		cancel()
+		delete(c.ops, id)
+	}
+	return ok
+}
+
+// cancelAll cancels all running operations.
+func (c *wsConn) cancelAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for id, cancel := range c.ops {
+		cancel()
+		delete(c.ops, id)
+	}
+}
+
+// keepAlive periodically sends keepalive messages, as expected by clients of the
+// legacy protocol.
+func (c *wsConn) keepAlive(stop chan struct{}) {
+	ticker := time.NewTicker(wsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.send(&wsMessage{Type: "ka"}); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sendError reports a failed operation to the client.
+func (c *wsConn) sendError(id string, message string) {
+	c.sendErrors(id, []interface{}{map[string]string{"message": message}})
+}
+
+// sendErrors reports a failed operation to the client. The new protocol expects
+// the list of errors, the legacy one a single error object.
+func (c *wsConn) sendErrors(id string, errs interface{}) {
+	var (
+		payload []byte
+		err     error
+	)
+	if c.legacy {
+		payload, err = json.Marshal(map[string]interface{}{"errors": errs})
+	} else {
+		payload, err = json.Marshal(errs)
+	}
+	if err != nil {
+		return
+	}
+	c.send(&wsMessage{ID: id, Type: "error", Payload: payload})
+}
+
+// send writes a message to the client.
+func (c *wsConn) send(msg *wsMessage) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteJSON(msg)
+}
+
+// close terminates the connection with the given close code and reason.
+func (c *wsConn) close(code int, reason string) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteTimeout))
+}
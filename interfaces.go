@@ -152,6 +152,9 @@ type FilterQuery struct {
 	// {{A}, {B}}         matches topic A in first position AND B in second position
 	// {{A, B}, {C, D}}   matches topic (A OR B) in first position AND (C OR D) in second position
 	Topics [][]common.Hash
+
+	BlockHashes []common.Hash // used by eth_getLogs, return logs only from blocks with these hashes
+	Limit       uint64        // used by eth_getLogs, maximum number of logs to return (0 = unlimited)
 }
 
 // LogFilterer provides access to contract log events using a one-off query or continuous
@@ -40,6 +40,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/params"
@@ -80,6 +81,47 @@ func (s *PublicEthereumAPI) MaxPriorityFeePerGas(ctx context.Context) (*hexutil.
 	return (*hexutil.Big)(tipcap), err
 }
 
+type feeEstimate struct {
+	Confidence           float64      `json:"confidence"`
+	MaxPriorityFeePerGas *hexutil.Big `json:"maxPriorityFeePerGas"`
+}
+
+type feeEstimatesResult struct {
+	Strategy  string        `json:"strategy"`
+	BaseFee   *hexutil.Big  `json:"baseFeePerGas,omitempty"`
+	Estimates []feeEstimate `json:"estimates"`
+}
+
+// FeeEstimates returns gas tip cap suggestions for dynamic fee transactions at
+// several confidence levels (percentages of how likely the transaction is to be
+// included in a timely manner). The estimation strategy defaults to the one
+// configured for the node, the base fee is the one of the next block.
+func (s *PublicEthereumAPI) FeeEstimates(ctx context.Context, strategy *string, confidences []float64) (*feeEstimatesResult, error) {
+	var name string
+	if strategy != nil {
+		name = *strategy
+	}
+	name, tips, err := s.b.EstimateGasTipCaps(ctx, name, confidences)
+	if err != nil {
+		return nil, err
+	}
+	if len(confidences) == 0 {
+		confidences = gasprice.DefaultConfidences
+	}
+	result := &feeEstimatesResult{
+		Strategy:  name,
+		Estimates: make([]feeEstimate, len(tips)),
+	}
+	for i, tip := range tips {
+		result.Estimates[i] = feeEstimate{Confidence: confidences[i], MaxPriorityFeePerGas: (*hexutil.Big)(tip)}
+	}
+	head := s.b.CurrentHeader()
+	if config := s.b.ChainConfig(); config.IsLondon(new(big.Int).Add(head.Number, big.NewInt(1))) {
+		result.BaseFee = (*hexutil.Big)(misc.CalcBaseFee(config, head))
+	}
+	return result, nil
+}
+
 type feeHistoryResult struct {
 	OldestBlock  *hexutil.Big     `json:"oldestBlock"`
 	Reward       [][]*hexutil.Big `json:"reward,omitempty"`
@@ -242,6 +284,32 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	return content
 }
 
+// RPCTxPoolStatus is the pool status of a transaction. The drop details are
+// only present if the transaction already left the pool.
+type RPCTxPoolStatus struct {
+	Status string `json:"status"`
+	*core.TxDropEvent
+}
+
+// GetTransactionStatus returns whether a transaction is pending or queued in the
+// pool or, if it already left the pool, why it was dropped. Transactions that
+// the pool has never seen or has forgotten about are reported as unknown.
+func (s *PublicTxPoolAPI) GetTransactionStatus(hash common.Hash) *RPCTxPoolStatus {
+	status, drop := s.b.TxPoolTransactionStatus(hash)
+	switch {
+	case status == core.TxStatusPending:
+		return &RPCTxPoolStatus{Status: "pending"}
+	case status == core.TxStatusQueued:
+		return &RPCTxPoolStatus{Status: "queued"}
+	case drop == nil:
+		return &RPCTxPoolStatus{Status: "unknown"}
+	case drop.Reason == core.TxDropMined:
+		return &RPCTxPoolStatus{Status: "included", TxDropEvent: drop}
+	default:
+		return &RPCTxPoolStatus{Status: "dropped", TxDropEvent: drop}
+	}
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -756,6 +824,75 @@ func (s *PublicBlockChainAPI) GetBlockByHash(ctx context.Context, hash common.Ha
 	return nil, err
 }
 
+// SimulateBlockArgs represents the arguments to simulate the next block.
+type SimulateBlockArgs struct {
+	Timestamp *hexutil.Uint64 `json:"timestamp"`
+	BaseFee   *hexutil.Big    `json:"baseFeePerGas"`
+	FullTx    bool            `json:"fullTx"`
+}
+
+// RPCRejectedTx is a transaction left out of a simulated block, along with the
+// reason it could not be included.
+type RPCRejectedTx struct {
+	Hash   common.Hash    `json:"hash"`
+	From   common.Address `json:"from"`
+	Nonce  hexutil.Uint64 `json:"nonce"`
+	Reason string         `json:"reason"`
+}
+
+// SimulatePendingBlock assembles the block this node would build on top of the
+// current head from the contents of the transaction pool, at the given timestamp
+// (defaults to now) and base fee (defaults to the one derived from the parent).
+// The block is not sealed, so its hash is that of the unsealed header. Its receipts
+// and the pool transactions which could not be included are returned along with it.
+// Private transactions and bundles are withheld from the network, so they are left
+// out of the simulation.
+func (s *PublicBlockChainAPI) SimulatePendingBlock(ctx context.Context, args *SimulateBlockArgs) (map[string]interface{}, error) {
+	var (
+		timestamp = uint64(time.Now().Unix())
+		baseFee   *big.Int
+		fullTx    bool
+	)
+	if head := s.b.CurrentBlock(); timestamp <= head.Time() {
+		timestamp = head.Time() + 1
+	}
+	if args != nil {
+		if args.Timestamp != nil {
+			timestamp = uint64(*args.Timestamp)
+		}
+		baseFee = (*big.Int)(args.BaseFee)
+		fullTx = args.FullTx
+	}
+	block, receipts, rejected, err := s.b.SimulatePendingBlock(ctx, timestamp, baseFee)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := RPCMarshalBlock(block, true, fullTx)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.MakeSigner(s.b.ChainConfig(), block.Number())
+	rpcReceipts := make([]map[string]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		rpcReceipts[i] = marshalReceipt(receipt, block.Hash(), block.NumberU64(), signer, block.Transactions()[i], i, block.BaseFee())
+	}
+	rpcRejected := make([]*RPCRejectedTx, len(rejected))
+	for i, reject := range rejected {
+		from, _ := types.Sender(signer, reject.Tx)
+		rpcRejected[i] = &RPCRejectedTx{
+			Hash:   reject.Tx.Hash(),
+			From:   from,
+			Nonce:  hexutil.Uint64(reject.Tx.Nonce()),
+			Reason: reject.Err.Error(),
+		}
+	}
+	return map[string]interface{}{
+		"block":    fields,
+		"receipts": rpcReceipts,
+		"rejected": rpcRejected,
+	}, nil
+}
+
 // GetUncleByBlockNumberAndIndex returns the uncle block for the given block hash and index. When fullTx is true
 // all transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetUncleByBlockNumberAndIndex(ctx context.Context, blockNr rpc.BlockNumber, index hexutil.Uint) (map[string]interface{}, error) {
@@ -1619,12 +1756,27 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	// Derive the sender.
 	bigblock := new(big.Int).SetUint64(blockNumber)
 	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
+
+	var baseFee *big.Int
+	if s.b.ChainConfig().IsLondon(bigblock) {
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		baseFee = header.BaseFee
+	}
+	return marshalReceipt(receipt, blockHash, blockNumber, signer, tx, int(index), baseFee), nil
+}
+
+// marshalReceipt converts a receipt into the RPC representation. The base fee is
+// nil for blocks before London.
+func marshalReceipt(receipt *types.Receipt, blockHash common.Hash, blockNumber uint64, signer types.Signer, tx *types.Transaction, index int, baseFee *big.Int) map[string]interface{} {
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
 		"blockHash":         blockHash,
 		"blockNumber":       hexutil.Uint64(blockNumber),
-		"transactionHash":   hash,
+		"transactionHash":   tx.Hash(),
 		"transactionIndex":  hexutil.Uint64(index),
 		"from":              from,
 		"to":                tx.To(),
@@ -1636,14 +1788,10 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	if !s.b.ChainConfig().IsLondon(bigblock) {
+	if baseFee == nil {
 		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
 	} else {
-		header, err := s.b.HeaderByHash(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		gasPrice := new(big.Int).Add(header.BaseFee, tx.EffectiveGasTipValue(header.BaseFee))
+		gasPrice := new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
 		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 	}
 	// Assign receipt status or post state.
@@ -1659,7 +1807,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	return fields
 }
 
 // sign is a helper function that signs a transaction with the private key of the given address.
@@ -1764,6 +1912,70 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// PrivateTxArgs represents the options of a private transaction submission.
+type PrivateTxArgs struct {
+	Lifetime *hexutil.Uint64 `json:"lifetime"` // Seconds to withhold the transaction from the network
+	Publish  bool            `json:"publish"`  // Whether to broadcast the transaction once the lifetime elapses
+}
+
+// SendPrivateTransaction will add the signed transaction to the transaction pool
+// without announcing it to the network, so that only the local miner includes it.
+// Once its lifetime elapses, the transaction is dropped unless publish is set, in
+// which case it is broadcast like any other transaction.
+func (s *PublicTransactionPoolAPI) SendPrivateTransaction(ctx context.Context, input hexutil.Bytes, args *PrivateTxArgs) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	if !s.b.UnprotectedAllowed() && !tx.Protected() {
+		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+	}
+	var (
+		lifetime time.Duration
+		publish  bool
+	)
+	if args != nil {
+		if args.Lifetime != nil {
+			lifetime = time.Duration(*args.Lifetime) * time.Second
+		}
+		publish = args.Publish
+	}
+	if err := s.b.SendPrivateTx(ctx, tx, lifetime, publish); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "hash", tx.Hash().Hex(), "nonce", tx.Nonce(), "recipient", tx.To(), "publish", publish)
+	return tx.Hash(), nil
+}
+
+// SendBundle submits an ordered list of signed transactions to the local miner for
+// atomic inclusion at the top of the given block. The bundle is either included in
+// full or not at all, and is never propagated to the network.
+func (s *PublicTransactionPoolAPI) SendBundle(ctx context.Context, inputs []hexutil.Bytes, blockNumber hexutil.Uint64) (common.Hash, error) {
+	txs := make(types.Transactions, len(inputs))
+	for i, input := range inputs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(input); err != nil {
+			return common.Hash{}, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+			return common.Hash{}, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if !s.b.UnprotectedAllowed() && !tx.Protected() {
+			return common.Hash{}, fmt.Errorf("transaction %d: only replay-protected (EIP-155) transactions allowed over RPC", i)
+		}
+		txs[i] = tx
+	}
+	hash, err := s.b.SendBundle(ctx, txs, uint64(blockNumber))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted transaction bundle", "hash", hash, "txs", len(txs), "block", uint64(blockNumber))
+	return hash, nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
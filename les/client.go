@@ -56,11 +56,13 @@ import (
 // SYSCOIN
 type LightNEVMAddBlockFn func(*types.NEVMBlockConnect, *LightEthereum) error
 type LightNEVMDeleteBlockFn func(string, *LightEthereum) error
+type LightNEVMFinalizeBlockFn func(string, *LightEthereum) error
 
 type LightNEVMIndex struct {
 	// Callbacks
-	AddBlock    LightNEVMAddBlockFn    // Connects a new NEVM block
-	DeleteBlock LightNEVMDeleteBlockFn // Disconnects NEVM tip
+	AddBlock      LightNEVMAddBlockFn      // Connects a new NEVM block
+	DeleteBlock   LightNEVMDeleteBlockFn   // Disconnects NEVM tip
+	FinalizeBlock LightNEVMFinalizeBlockFn // Finalizes a NEVM block chainlocked on SYS
 }
 type LightEthereum struct {
 	lesCommons
@@ -285,6 +287,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*LightEthereum, error) {
 		} else {
 			log.Info("not building on tip, add to mapping...", "blockhash", nevmBlockConnect.Blockhash, "currenthash", currentHash.String(), "proposedparenthash", nevmBlockConnect.Parenthash.String())
 		}
+		// only announce the mapping once the block it connects was accepted
+		leth.blockchain.PostNEVMMappingEvent(core.NEVMMappingEvent{
+			SysBlockHash:  nevmBlockConnect.Sysblockhash,
+			NEVMBlockHash: nevmBlockConnect.Blockhash,
+			Number:        nextBlockNumber,
+			Header:        leth.blockchain.GetHeaderByHash(nevmBlockConnect.Blockhash),
+		})
 		return nil
 	}
 	// mappings are assumed to be correct on lookup based on addBlock
@@ -314,10 +323,31 @@ func New(stack *node.Node, config *ethconfig.Config) (*LightEthereum, error) {
 			}
 		}
 		leth.blockchain.DeleteNEVMMappings(sysBlockhash, nevmBlockhash, current.ParentHash, current.Number.Uint64())
+		leth.blockchain.PostNEVMMappingEvent(core.NEVMMappingEvent{SysBlockHash: sysBlockhash, NEVMBlockHash: nevmBlockhash, Number: current.Number.Uint64(), Removed: true})
+		return nil
+	}
+	// a chainlock on the SYS block makes the NEVM block it connected final
+	finalizeBlock := func(sysBlockhash string, leth *LightEthereum) error {
+		nevmBlockhash := leth.blockchain.GetSYSMapping(sysBlockhash)
+		if nevmBlockhash == (common.Hash{}) {
+			return errors.New("finalizeBlock: NEVM block hash does not exist in SYS Mapping")
+		}
+		header := leth.blockchain.GetHeaderByHash(nevmBlockhash)
+		if header == nil {
+			return errors.New("finalizeBlock: NEVM header not found")
+		}
+		if leth.blockchain.GetCanonicalHash(header.Number.Uint64()) != nevmBlockhash {
+			return errors.New("finalizeBlock: NEVM header is not canonical")
+		}
+		// chainlocks only move forward, ignore stale notifications
+		if finalized := leth.blockchain.CurrentFinalizedHeader(); finalized != nil && finalized.Number.Uint64() >= header.Number.Uint64() {
+			return nil
+		}
+		leth.blockchain.SetFinalized(header)
 		return nil
 	}
 	if config.Ethash.PowMode == ethash.ModeNEVM {
-		leth.zmqRep = NewZMQRep(leth, config.NEVMPubEP, LightNEVMIndex{addBlock, deleteBlock})
+		leth.zmqRep = NewZMQRep(leth, config.NEVMPubEP, LightNEVMIndex{addBlock, deleteBlock, finalizeBlock})
 	}
 	return leth, nil
 }
@@ -554,8 +554,10 @@ func handleGetTxStatus(msg Decoder) (serveRequestFn, uint64, uint64, error) {
 // txStatus returns the status of a specified transaction.
 func txStatus(b serverBackend, hash common.Hash) light.TxStatus {
 	var stat light.TxStatus
-	// Looking the transaction in txpool first.
-	stat.Status = b.TxPool().Status([]common.Hash{hash})[0]
+	// Looking the transaction in txpool first, private ones are not disclosed.
+	if !b.TxPool().IsPrivate(hash) {
+		stat.Status = b.TxPool().Status([]common.Hash{hash})[0]
+	}
 
 	// If the transaction is unknown to the pool, try looking it up locally.
 	if stat.Status == core.TxStatusUnknown {
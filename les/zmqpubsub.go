@@ -91,6 +91,14 @@ func (zmq *ZMQRep) Init(nevmEP string) error {
 				}
 				msgSend := zmq4.NewMsgFrom([]byte("nevmdisconnect"), []byte(result))
 				zmq.rep.SendMulti(msgSend)
+			} else if strTopic == "nevmchainlock" {
+				result := "chainlocked"
+				errMsg := zmq.nevmIndexer.FinalizeBlock(string(msg.Frames[1]), zmq.leth)
+				if errMsg != nil {
+					result = errMsg.Error()
+				}
+				msgSend := zmq4.NewMsgFrom([]byte("nevmchainlock"), []byte(result))
+				zmq.rep.SendMulti(msgSend)
 			} else if strTopic == "nevmblock" {
 				nevmBlockConnectBytes := make([]byte, 0)
 				msgSend := zmq4.NewMsgFrom([]byte("nevmblock"), nevmBlockConnectBytes)
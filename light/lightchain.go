@@ -57,6 +57,7 @@ type LightChain struct {
 	chainFeed     event.Feed
 	chainSideFeed event.Feed
 	chainHeadFeed event.Feed
+	nevmFeed      event.Feed
 	scope         event.SubscriptionScope
 	genesisBlock  *types.Block
 
@@ -424,6 +425,18 @@ func (lc *LightChain) CurrentHeader() *types.Header {
 	return lc.hc.CurrentHeader()
 }
 
+// CurrentFinalizedHeader retrieves the header of the latest block finalized by a
+// Syscoin chainlock, or nil if no block has been finalized yet.
+func (lc *LightChain) CurrentFinalizedHeader() *types.Header {
+	return lc.hc.CurrentFinalizedHeader()
+}
+
+// SetFinalized marks the given header as the latest block finalized by a Syscoin
+// chainlock.
+func (lc *LightChain) SetFinalized(header *types.Header) {
+	lc.hc.SetFinalized(header)
+}
+
 // GetTd retrieves a block's total difficulty in the canonical chain from the
 // database by hash and number, caching it if found.
 func (lc *LightChain) GetTd(hash common.Hash, number uint64) *big.Int {
@@ -502,6 +515,12 @@ func (lc *LightChain) WriteNEVMMappings(sysBlockhash string, nevmBlockhash commo
 	lc.hc.WriteNEVMMappings(sysBlockhash, nevmBlockhash, n)
 }
 
+// PostNEVMMappingEvent announces a NEVM mapping once the header insertion
+// depending on it, if any, succeeded.
+func (lc *LightChain) PostNEVMMappingEvent(ev core.NEVMMappingEvent) {
+	lc.nevmFeed.Send(ev)
+}
+
 
 // GetBlockHashesFromHash retrieves a number of block hashes starting at a given
 // hash, fetching towards the genesis block.
@@ -615,3 +634,8 @@ func (lc *LightChain) DisableCheckFreq() {
 func (lc *LightChain) EnableCheckFreq() {
 	atomic.StoreInt32(&lc.disableCheckFreq, 0)
 }
+
+// SubscribeNEVMMappingEvent registers a subscription of core.NEVMMappingEvent.
+func (lc *LightChain) SubscribeNEVMMappingEvent(ch chan<- core.NEVMMappingEvent) event.Subscription {
+	return lc.scope.Track(lc.nevmFeed.Subscribe(ch))
+}
@@ -132,6 +132,10 @@ func (t *odrTrie) Commit(onleaf trie.LeafCallback) (common.Hash, int, error) {
 	return t.trie.Commit(onleaf)
 }
 
+func (t *odrTrie) CommittedNodes() *trie.NodeSet {
+	return nil
+}
+
 func (t *odrTrie) Hash() common.Hash {
 	if t.trie == nil {
 		return t.id.Root
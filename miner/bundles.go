@@ -0,0 +1,129 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// maxBundleTxs is the maximum number of transactions a single bundle may carry.
+	maxBundleTxs = 64
+
+	// maxBundlesPerBlock is the maximum number of bundles accepted for a single
+	// target block.
+	maxBundlesPerBlock = 32
+
+	// maxBundleFutureBlocks is how far ahead of the chain head a bundle may target.
+	maxBundleFutureBlocks = 64
+)
+
+var (
+	errEmptyBundle      = errors.New("empty bundle")
+	errBundleTooLarge   = errors.New("bundle exceeds transaction limit")
+	errBundleTargetPast = errors.New("bundle target block already mined")
+	errBundleTargetFar  = errors.New("bundle target block too far in the future")
+	errBundlePoolFull   = errors.New("too many bundles for target block")
+	errBundleKnown      = errors.New("bundle already known")
+)
+
+// bundle is an ordered list of transactions which must be included atomically
+// at the top of a specific block, or not at all.
+type bundle struct {
+	hash   common.Hash
+	txs    types.Transactions
+	number uint64
+}
+
+// bundleHash returns the identifier of a bundle, derived from the hashes of its
+// transactions in order.
+func bundleHash(txs types.Transactions) common.Hash {
+	hashes := make([]byte, 0, len(txs)*common.HashLength)
+	for _, tx := range txs {
+		hashes = append(hashes, tx.Hash().Bytes()...)
+	}
+	return crypto.Keccak256Hash(hashes)
+}
+
+// bundlePool holds the bundles submitted to the local miner, keyed by their target
+// block number. Bundles never enter the transaction pool and are therefore never
+// propagated to the network.
+type bundlePool struct {
+	bundles map[uint64][]*bundle
+	lock    sync.RWMutex
+}
+
+// newBundlePool creates an empty bundle pool.
+func newBundlePool() *bundlePool {
+	return &bundlePool{
+		bundles: make(map[uint64][]*bundle),
+	}
+}
+
+// add inserts a new bundle targeting the given block number, validated against
+// the current chain head.
+func (p *bundlePool) add(txs types.Transactions, number uint64, head uint64) (common.Hash, error) {
+	switch {
+	case len(txs) == 0:
+		return common.Hash{}, errEmptyBundle
+	case len(txs) > maxBundleTxs:
+		return common.Hash{}, errBundleTooLarge
+	case number <= head:
+		return common.Hash{}, errBundleTargetPast
+	case number > head+maxBundleFutureBlocks:
+		return common.Hash{}, errBundleTargetFar
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	hash := bundleHash(txs)
+	for _, b := range p.bundles[number] {
+		if b.hash == hash {
+			return common.Hash{}, errBundleKnown
+		}
+	}
+	if len(p.bundles[number]) >= maxBundlesPerBlock {
+		return common.Hash{}, errBundlePoolFull
+	}
+	p.bundles[number] = append(p.bundles[number], &bundle{hash: hash, txs: txs, number: number})
+	return hash, nil
+}
+
+// get returns the bundles targeting the given block number in submission order.
+func (p *bundlePool) get(number uint64) []*bundle {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return append([]*bundle(nil), p.bundles[number]...)
+}
+
+// prune drops all bundles targeting blocks at or below the given head.
+func (p *bundlePool) prune(head uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for number := range p.bundles {
+		if number <= head {
+			delete(p.bundles, number)
+		}
+	}
+}
@@ -206,6 +206,28 @@ func (miner *Miner) PendingBlockAndReceipts() (*types.Block, types.Receipts) {
 	return miner.worker.pendingBlockAndReceipts()
 }
 
+// SimulatePending assembles the block the miner would build on top of the current
+// head at the given timestamp from the current pool contents, optionally with an
+// overridden base fee. The block is not sealed and does not replace the pending
+// block. Transactions left out of it are returned together with the reason.
+// Private transactions and bundles are never part of a simulation.
+func (miner *Miner) SimulatePending(timestamp uint64, baseFee *big.Int) (*types.Block, types.Receipts, []*RejectedTx, error) {
+	return miner.worker.simulate(timestamp, baseFee)
+}
+
+// AddBundle schedules an ordered list of transactions for atomic inclusion at the
+// top of the given block. The transactions are kept locally and never announced
+// to the network. The returned hash identifies the bundle.
+func (miner *Miner) AddBundle(txs types.Transactions, number uint64) (common.Hash, error) {
+	signer := types.MakeSigner(miner.worker.chainConfig, new(big.Int).SetUint64(number))
+	for _, tx := range txs {
+		if _, err := types.Sender(signer, tx); err != nil {
+			return common.Hash{}, err
+		}
+	}
+	return miner.worker.bundles.add(txs, number, miner.worker.chain.CurrentBlock().NumberU64())
+}
+
 func (miner *Miner) SetEtherbase(addr common.Address) {
 	miner.coinbase = addr
 	miner.worker.setEtherbase(addr)
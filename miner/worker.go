@@ -19,6 +19,7 @@ package miner
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"math/big"
 	"sync"
 	"sync/atomic"
@@ -77,6 +78,10 @@ const (
 	staleThreshold = 7
 )
 
+// errReplayProtected is returned for replay protected transactions included
+// before the EIP155 fork.
+var errReplayProtected = errors.New("replay protected transaction before EIP155")
+
 // environment is the worker's current environment and holds all of the current state information.
 type environment struct {
 	signer types.Signer
@@ -91,6 +96,25 @@ type environment struct {
 	header   *types.Header
 	txs      []*types.Transaction
 	receipts []*types.Receipt
+
+	simulated bool          // Whether the block is only simulated and never sealed
+	rejected  []*RejectedTx // Transactions left out of a simulated block
+	withheld  bool          // Whether the block contains private transactions or bundles
+}
+
+// RejectedTx is a transaction left out of a simulated block, along with the
+// reason it could not be included.
+type RejectedTx struct {
+	Tx  *types.Transaction
+	Err error
+}
+
+// reject records why a transaction was left out of the block. It is a no-op
+// unless the environment is simulated.
+func (env *environment) reject(tx *types.Transaction, err error) {
+	if env.simulated {
+		env.rejected = append(env.rejected, &RejectedTx{Tx: tx, Err: err})
+	}
 }
 
 // task contains all information for consensus engine sealing and result submitting.
@@ -154,6 +178,7 @@ type worker struct {
 	localUncles  map[common.Hash]*types.Block // A set of side blocks generated locally as the possible uncle blocks.
 	remoteUncles map[common.Hash]*types.Block // A set of side blocks as the possible uncle blocks.
 	unconfirmed  *unconfirmedBlocks           // A set of locally mined blocks pending canonicalness confirmations.
+	bundles      *bundlePool                  // Private transaction bundles targeting upcoming blocks.
 
 	mu       sync.RWMutex // The lock used to protect the coinbase and extra fields
 	coinbase common.Address
@@ -200,6 +225,7 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		localUncles:        make(map[common.Hash]*types.Block),
 		remoteUncles:       make(map[common.Hash]*types.Block),
 		unconfirmed:        newUnconfirmedBlocks(eth.BlockChain(), miningLogAtDepth),
+		bundles:            newBundlePool(),
 		pendingTasks:       make(map[common.Hash]*task),
 		txsCh:              make(chan core.NewTxsEvent, txChanSize),
 		chainHeadCh:        make(chan core.ChainHeadEvent, chainHeadChanSize),
@@ -520,7 +546,7 @@ func (w *worker) mainLoop() {
 				}
 				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs, w.current.header.BaseFee)
 				tcount := w.current.tcount
-				w.commitTransactions(txset, coinbase, nil)
+				w.commitTransactions(w.current, txset, coinbase, nil)
 				// Only update the snapshot if any new transactons were added
 				// to the pending block
 				if tcount != w.current.tcount {
@@ -667,14 +693,29 @@ func (w *worker) resultLoop() {
 
 // makeCurrent creates a new environment for the current cycle.
 func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
-	// Retrieve the parent state to execute on top and start a prefetcher for
-	// the miner to speed block sealing up a bit
-	state, err := w.chain.StateAt(parent.Root())
+	env, err := w.makeEnv(parent, header)
 	if err != nil {
 		return err
 	}
-	state.StartPrefetcher("miner")
+	// Start a prefetcher for the miner to speed block sealing up a bit
+	env.state.StartPrefetcher("miner")
+
+	// Swap out the old work with the new one, terminating any leftover prefetcher
+	// processes in the mean time and starting a new one.
+	if w.current != nil && w.current.state != nil {
+		w.current.state.StopPrefetcher()
+	}
+	w.current = env
+	return nil
+}
 
+// makeEnv creates a new environment on top of the given parent block.
+func (w *worker) makeEnv(parent *types.Block, header *types.Header) (*environment, error) {
+	// Retrieve the parent state to execute on top
+	state, err := w.chain.StateAt(parent.Root())
+	if err != nil {
+		return nil, err
+	}
 	env := &environment{
 		signer:    types.MakeSigner(w.chainConfig, header.Number),
 		state:     state,
@@ -693,14 +734,7 @@ func (w *worker) makeCurrent(parent *types.Block, header *types.Header) error {
 	}
 	// Keep track of transactions which return errors so they can be removed
 	env.tcount = 0
-
-	// Swap out the old work with the new one, terminating any leftover prefetcher
-	// processes in the mean time and starting a new one.
-	if w.current != nil && w.current.state != nil {
-		w.current.state.StopPrefetcher()
-	}
-	w.current = env
-	return nil
+	return env, nil
 }
 
 // commitUncle adds the given block to uncle block set, returns error if failed to add.
@@ -725,11 +759,22 @@ func (w *worker) commitUncle(env *environment, uncle *types.Header) error {
 // updateSnapshot updates pending snapshot block and state.
 // Note this function assumes the current variable is thread safe.
 func (w *worker) updateSnapshot() {
+	// The snapshot is served to anyone asking for the pending block, so it must
+	// not disclose the transactions withheld from the network.
+	env := w.current
+	if env.withheld {
+		public, err := w.publicEnv(env)
+		if err != nil {
+			log.Warn("Failed to assemble public pending block", "err", err)
+			return
+		}
+		env = public
+	}
 	w.snapshotMu.Lock()
 	defer w.snapshotMu.Unlock()
 
 	var uncles []*types.Header
-	w.current.uncles.Each(func(item interface{}) bool {
+	env.uncles.Each(func(item interface{}) bool {
 		hash, ok := item.(common.Hash)
 		if !ok {
 			return false
@@ -746,39 +791,149 @@ func (w *worker) updateSnapshot() {
 	})
 
 	w.snapshotBlock = types.NewBlock(
-		w.current.header,
-		w.current.txs,
+		env.header,
+		env.txs,
 		uncles,
-		w.current.receipts,
+		env.receipts,
 		trie.NewStackTrie(nil),
 	)
-	w.snapshotReceipts = copyReceipts(w.current.receipts)
-	w.snapshotState = w.current.state.Copy()
+	w.snapshotReceipts = copyReceipts(env.receipts)
+	w.snapshotState = env.state.Copy()
 }
 
-func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
-	snap := w.current.state.Snapshot()
+// publicEnv assembles the counterpart of the given environment with only the
+// pool transactions broadcast to the network, leaving out both the private ones
+// and the bundles.
+func (w *worker) publicEnv(env *environment) (*environment, error) {
+	parent := w.chain.GetBlockByHash(env.header.ParentHash)
+	if parent == nil {
+		return nil, fmt.Errorf("parent block %x not found", env.header.ParentHash)
+	}
+	header := types.CopyHeader(env.header)
+	header.GasUsed = 0
 
-	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, w.current.gasPool, w.current.state, w.current.header, tx, &w.current.header.GasUsed, *w.chain.GetVMConfig())
+	public, err := w.makeEnv(parent, header)
+	if err != nil {
+		return nil, err
+	}
+	public.simulated = true
+	public.uncles = env.uncles
+	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
+		misc.ApplyDAOHardFork(public.state)
+	}
+	pending, err := w.eth.TxPool().Pending(true)
 	if err != nil {
-		w.current.state.RevertToSnapshot(snap)
 		return nil, err
 	}
-	w.current.txs = append(w.current.txs, tx)
-	w.current.receipts = append(w.current.receipts, receipt)
+	w.fillTransactions(public, w.publicPending(pending), header.Coinbase, nil)
+	return public, nil
+}
+
+// publicPending drops the private transactions from a set of pending ones, along
+// with the later transactions of their senders that can't execute without them.
+func (w *worker) publicPending(pending map[common.Address]types.Transactions) map[common.Address]types.Transactions {
+	pool := w.eth.TxPool()
+	for from, txs := range pending {
+		for i, tx := range txs {
+			if pool.IsPrivate(tx.Hash()) {
+				if i == 0 {
+					delete(pending, from)
+				} else {
+					pending[from] = txs[:i]
+				}
+				break
+			}
+		}
+	}
+	return pending
+}
+
+func (w *worker) commitTransaction(env *environment, tx *types.Transaction, coinbase common.Address) ([]*types.Log, error) {
+	snap := env.state.Snapshot()
+
+	receipt, err := core.ApplyTransaction(w.chainConfig, w.chain, &coinbase, env.gasPool, env.state, env.header, tx, &env.header.GasUsed, *w.chain.GetVMConfig())
+	if err != nil {
+		env.state.RevertToSnapshot(snap)
+		return nil, err
+	}
+	env.txs = append(env.txs, tx)
+	env.receipts = append(env.receipts, receipt)
 
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
-	// Short circuit if current is nil
-	if w.current == nil {
-		return true
+// commitBundle applies all transactions of a bundle in order on top of the current
+// environment. If any of them fails to apply or reverts, the environment is rolled
+// back to its state before the bundle and an error is returned.
+func (w *worker) commitBundle(env *environment, b *bundle, coinbase common.Address) error {
+	// Transactions are finalised one by one, so journal snapshots do not span the
+	// whole bundle. Keep a full copy of the pre-bundle environment instead.
+	var (
+		state    = env.state.Copy()
+		gasPool  = *env.gasPool
+		gasUsed  = env.header.GasUsed
+		tcount   = env.tcount
+		txs      = len(env.txs)
+		receipts = len(env.receipts)
+	)
+	revert := func() {
+		env.state.StopPrefetcher()
+		env.state = state
+		*env.gasPool = gasPool
+		env.header.GasUsed = gasUsed
+		env.tcount = tcount
+		env.txs = env.txs[:txs]
+		env.receipts = env.receipts[:receipts]
 	}
+	for _, tx := range b.txs {
+		if tx.Protected() && !w.chainConfig.IsEIP155(env.header.Number) {
+			revert()
+			return fmt.Errorf("transaction %x: %w", tx.Hash(), errReplayProtected)
+		}
+		env.state.Prepare(tx.Hash(), env.tcount)
 
-	gasLimit := w.current.header.GasLimit
-	if w.current.gasPool == nil {
-		w.current.gasPool = new(core.GasPool).AddGas(gasLimit)
+		if _, err := w.commitTransaction(env, tx, coinbase); err != nil {
+			revert()
+			return fmt.Errorf("transaction %x failed: %w", tx.Hash(), err)
+		}
+		if receipt := env.receipts[len(env.receipts)-1]; receipt.Status == types.ReceiptStatusFailed {
+			revert()
+			return fmt.Errorf("transaction %x reverted", tx.Hash())
+		}
+		env.tcount++
+	}
+	return nil
+}
+
+// commitBundles applies the bundles targeting the current block, each one either
+// in full or not at all. It returns whether any bundle was included.
+//
+// The logs of bundled transactions are not posted to the pending log subscribers,
+// bundles are withheld from the network until sealed.
+func (w *worker) commitBundles(env *environment, coinbase common.Address) bool {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	var included bool
+	for _, b := range w.bundles.get(env.header.Number.Uint64()) {
+		if err := w.commitBundle(env, b, coinbase); err != nil {
+			log.Debug("Skipping transaction bundle", "hash", b.hash, "txs", len(b.txs), "err", err)
+			for _, tx := range b.txs {
+				env.reject(tx, err)
+			}
+			continue
+		}
+		log.Trace("Included transaction bundle", "hash", b.hash, "txs", len(b.txs))
+		env.withheld = true
+		included = true
+	}
+	return included
+}
+
+func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+	gasLimit := env.header.GasLimit
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(gasLimit)
 	}
 
 	var coalescedLogs []*types.Log
@@ -793,7 +948,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
 			// Notify resubmit loop to increase resubmitting interval due to too frequent commits.
 			if atomic.LoadInt32(interrupt) == commitInterruptResubmit {
-				ratio := float64(gasLimit-w.current.gasPool.Gas()) / float64(gasLimit)
+				ratio := float64(gasLimit-env.gasPool.Gas()) / float64(gasLimit)
 				if ratio < 0.1 {
 					ratio = 0.1
 				}
@@ -805,8 +960,8 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
 		}
 		// If we don't have enough gas for any further transactions then we're done
-		if w.current.gasPool.Gas() < params.TxGas {
-			log.Trace("Not enough gas for further transactions", "have", w.current.gasPool, "want", params.TxGas)
+		if env.gasPool.Gas() < params.TxGas {
+			log.Trace("Not enough gas for further transactions", "have", env.gasPool, "want", params.TxGas)
 			break
 		}
 		// Retrieve the next transaction and abort if all done
@@ -818,19 +973,23 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		// during transaction acceptance is the transaction pool.
 		//
 		// We use the eip155 signer regardless of the current hf.
-		from, _ := types.Sender(w.current.signer, tx)
+		from, _ := types.Sender(env.signer, tx)
 		// Check whether the tx is replay protected. If we're not in the EIP155 hf
 		// phase, start ignoring the sender until we do.
-		if tx.Protected() && !w.chainConfig.IsEIP155(w.current.header.Number) {
+		if tx.Protected() && !w.chainConfig.IsEIP155(env.header.Number) {
 			log.Trace("Ignoring reply protected transaction", "hash", tx.Hash(), "eip155", w.chainConfig.EIP155Block)
 
+			env.reject(tx, errReplayProtected)
 			txs.Pop()
 			continue
 		}
 		// Start executing the transaction
-		w.current.state.Prepare(tx.Hash(), w.current.tcount)
+		env.state.Prepare(tx.Hash(), env.tcount)
 
-		logs, err := w.commitTransaction(tx, coinbase)
+		logs, err := w.commitTransaction(env, tx, coinbase)
+		if err != nil {
+			env.reject(tx, err)
+		}
 		switch {
 		case errors.Is(err, core.ErrGasLimitReached):
 			// Pop the current out-of-gas transaction without shifting in the next from the account
@@ -849,8 +1008,12 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 
 		case errors.Is(err, nil):
 			// Everything ok, collect the logs and shift in the next transaction from the same account
-			coalescedLogs = append(coalescedLogs, logs...)
-			w.current.tcount++
+			if w.eth.TxPool().IsPrivate(tx.Hash()) {
+				env.withheld = true
+			} else {
+				coalescedLogs = append(coalescedLogs, logs...)
+			}
+			env.tcount++
 			txs.Shift()
 
 		case errors.Is(err, core.ErrTxTypeNotSupported):
@@ -866,7 +1029,20 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		}
 	}
 
-	if !w.isRunning() && len(coalescedLogs) > 0 {
+	w.postPendingLogs(env, coalescedLogs)
+
+	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
+	// than the user-specified one.
+	if interrupt != nil {
+		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
+	}
+	return false
+}
+
+// postPendingLogs publishes the logs of the transactions added to the pending
+// block to the pending log subscribers.
+func (w *worker) postPendingLogs(env *environment, logs []*types.Log) {
+	if !w.isRunning() && !env.simulated && len(logs) > 0 {
 		// We don't push the pendingLogsEvent while we are mining. The reason is that
 		// when we are mining, the worker will regenerate a mining block every 3 seconds.
 		// In order to avoid pushing the repeated pendingLog, we disable the pending log pushing.
@@ -874,19 +1050,13 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		// make a copy, the state caches the logs and these logs get "upgraded" from pending to mined
 		// logs by filling in the block hash when the block was mined by the local miner. This can
 		// cause a race condition if a log was "upgraded" before the PendingLogsEvent is processed.
-		cpy := make([]*types.Log, len(coalescedLogs))
-		for i, l := range coalescedLogs {
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
 			cpy[i] = new(types.Log)
 			*cpy[i] = *l
 		}
 		w.pendingLogsFeed.Send(cpy)
 	}
-	// Notify resubmit loop to decrease resubmitting interval if current interval is larger
-	// than the user-specified one.
-	if interrupt != nil {
-		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
-	}
-	return false
 }
 
 // commitNewWork generates several new sealing tasks based on the parent block.
@@ -900,22 +1070,8 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	if parent.Time() >= uint64(timestamp) {
 		timestamp = int64(parent.Time() + 1)
 	}
-	num := parent.Number()
-	header := &types.Header{
-		ParentHash: parent.Hash(),
-		Number:     num.Add(num, common.Big1),
-		GasLimit:   core.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
-		Extra:      w.extra,
-		Time:       uint64(timestamp),
-	}
-	// Set baseFee and GasLimit if we are on an EIP-1559 chain
-	if w.chainConfig.IsLondon(header.Number) {
-		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
-		if !w.chainConfig.IsLondon(parent.Number()) {
-			parentGasLimit := parent.GasLimit() * params.ElasticityMultiplier
-			header.GasLimit = core.CalcGasLimit(parentGasLimit, w.config.GasCeil)
-		}
-	}
+	header := w.makeHeader(parent, uint64(timestamp))
+
 	// Only set the coinbase if our consensus engine is running (avoid spurious block rewards)
 	if w.isRunning() {
 		if w.coinbase == (common.Address{}) {
@@ -983,6 +1139,10 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
+	// Place any bundles targeting this block at the top, before pool transactions.
+	w.bundles.prune(parent.NumberU64())
+	bundled := w.commitBundles(env, w.coinbase)
+
 	// Fill the block with all available pending transactions.
 	pending, err := w.eth.TxPool().Pending(true)
 	if err != nil {
@@ -992,10 +1152,42 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	// Short circuit if there is no available pending transactions.
 	// But if we disable empty precommit already, ignore it. Since
 	// empty block is necessary to keep the liveness of the network.
-	if len(pending) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
+	if len(pending) == 0 && !bundled && atomic.LoadUint32(&w.noempty) == 0 {
 		w.updateSnapshot()
 		return
 	}
+	if w.fillTransactions(env, pending, w.coinbase, interrupt) {
+		return
+	}
+	w.commit(uncles, w.fullTaskHook, true, tstart)
+}
+
+// makeHeader creates the header of a new block on top of the given parent.
+//
+// Note, this method assumes the worker lock is held!
+func (w *worker) makeHeader(parent *types.Block, timestamp uint64) *types.Header {
+	num := parent.Number()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     num.Add(num, common.Big1),
+		GasLimit:   core.CalcGasLimit(parent.GasLimit(), w.config.GasCeil),
+		Extra:      w.extra,
+		Time:       timestamp,
+	}
+	// Set baseFee and GasLimit if we are on an EIP-1559 chain
+	if w.chainConfig.IsLondon(header.Number) {
+		header.BaseFee = misc.CalcBaseFee(w.chainConfig, parent.Header())
+		if !w.chainConfig.IsLondon(parent.Number()) {
+			parentGasLimit := parent.GasLimit() * params.ElasticityMultiplier
+			header.GasLimit = core.CalcGasLimit(parentGasLimit, w.config.GasCeil)
+		}
+	}
+	return header
+}
+
+// fillTransactions fills the given environment with the pending transactions,
+// local ones first. It returns true if the work was interrupted by a new head.
+func (w *worker) fillTransactions(env *environment, pending map[common.Address]types.Transactions, coinbase common.Address, interrupt *int32) bool {
 	// Split the pending transactions into locals and remotes
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
@@ -1005,18 +1197,82 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		}
 	}
 	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs, header.BaseFee)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
-			return
+		txs := types.NewTransactionsByPriceAndNonce(env.signer, localTxs, env.header.BaseFee)
+		if w.commitTransactions(env, txs, coinbase, interrupt) {
+			return true
 		}
 	}
 	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs, header.BaseFee)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
-			return
+		txs := types.NewTransactionsByPriceAndNonce(env.signer, remoteTxs, env.header.BaseFee)
+		if w.commitTransactions(env, txs, coinbase, interrupt) {
+			return true
 		}
 	}
-	w.commit(uncles, w.fullTaskHook, true, tstart)
+	return false
+}
+
+// simulate assembles the block the worker would build on top of the current
+// head at the given timestamp, optionally overriding the base fee. The block is
+// neither sealed nor does it replace the pending snapshot.
+//
+// Simulations are served publicly, so the block only holds the pool transactions
+// broadcast to the network, leaving out the private ones and the bundles.
+func (w *worker) simulate(timestamp uint64, baseFee *big.Int) (*types.Block, types.Receipts, []*RejectedTx, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	parent := w.chain.CurrentBlock()
+	if timestamp <= parent.Time() {
+		return nil, nil, nil, fmt.Errorf("timestamp %d not after parent block timestamp %d", timestamp, parent.Time())
+	}
+	header := w.makeHeader(parent, timestamp)
+	header.Coinbase = w.coinbase
+	if baseFee != nil {
+		if header.BaseFee == nil {
+			return nil, nil, nil, errors.New("base fee override before London")
+		}
+		header.BaseFee = new(big.Int).Set(baseFee)
+	}
+	if err := w.engine.Prepare(w.chain, header); err != nil {
+		return nil, nil, nil, err
+	}
+	env, err := w.makeEnv(parent, header)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	env.simulated = true
+
+	pending, err := w.eth.TxPool().Pending(true)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pending = w.publicPending(pending)
+	// Transactions not paying the overridden base fee would be silently skipped
+	// by the price ordering, report them here instead.
+	if header.BaseFee != nil {
+		for from, txs := range pending {
+			for i, tx := range txs {
+				if tx.GasFeeCapIntCmp(header.BaseFee) < 0 {
+					for _, tx := range txs[i:] {
+						env.reject(tx, core.ErrFeeCapTooLow)
+					}
+					if i == 0 {
+						delete(pending, from)
+					} else {
+						pending[from] = txs[:i]
+					}
+					break
+				}
+			}
+		}
+	}
+	w.fillTransactions(env, pending, w.coinbase, nil)
+
+	block, err := w.engine.FinalizeAndAssemble(w.chain, header, env.state, env.txs, nil, env.receipts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return block, env.receipts, env.rejected, nil
 }
 
 // commit runs any post-transaction state modifications, assembles the final block
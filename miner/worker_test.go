@@ -17,6 +17,8 @@
 package miner
 
 import (
+	"crypto/ecdsa"
+	"errors"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -519,3 +521,182 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+func TestCommitBundles(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var (
+		signer   = types.LatestSigner(ethashChainConfig)
+		gasPrice = big.NewInt(10 * params.InitialBaseFee)
+		sign     = func(key *ecdsa.PrivateKey, tx *types.LegacyTx) *types.Transaction {
+			return types.MustSignNewTx(key, signer, tx)
+		}
+	)
+	// A bundle whose second transaction reverts must be skipped entirely
+	reverting := types.Transactions{
+		sign(testBankKey, &types.LegacyTx{Nonce: 0, To: &testUserAddress, Value: big.NewInt(1000), Gas: params.TxGas, GasPrice: gasPrice}),
+		sign(testBankKey, &types.LegacyTx{Nonce: 1, Gas: 100000, GasPrice: gasPrice, Data: common.FromHex("0x60006000fd")}),
+	}
+	// A bundle whose second transaction depends on the first must be included in order
+	funding := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(2*params.TxGas))
+	dependent := types.Transactions{
+		sign(testBankKey, &types.LegacyTx{Nonce: 0, To: &testUserAddress, Value: funding, Gas: params.TxGas, GasPrice: gasPrice}),
+		sign(testUserKey, &types.LegacyTx{Nonce: 0, To: &testBankAddress, Value: big.NewInt(1), Gas: params.TxGas, GasPrice: gasPrice}),
+		sign(testBankKey, &types.LegacyTx{Nonce: 1, Gas: 100000, GasPrice: gasPrice, Data: common.FromHex("0x60006000a0")}),
+	}
+	for _, bundle := range []types.Transactions{reverting, dependent} {
+		if _, err := w.bundles.add(bundle, 1, 0); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	if _, err := w.bundles.add(dependent, 1, 0); err != errBundleKnown {
+		t.Fatalf("duplicate bundle error mismatch: have %v, want %v", err, errBundleKnown)
+	}
+	if _, err := w.bundles.add(dependent, 0, 0); err != errBundleTargetPast {
+		t.Fatalf("stale bundle error mismatch: have %v, want %v", err, errBundleTargetPast)
+	}
+	logsCh := make(chan []*types.Log, 1)
+	sub := w.pendingLogsFeed.Subscribe(logsCh)
+	defer sub.Unsubscribe()
+
+	w.commitNewWork(nil, true, time.Now().Unix())
+
+	// The sealing work must contain the bundle at the top
+	txs := w.current.txs
+	if len(txs) < len(dependent) {
+		t.Fatalf("transaction count mismatch: have %d, want at least %d", len(txs), len(dependent))
+	}
+	for i, tx := range dependent {
+		if txs[i].Hash() != tx.Hash() {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, txs[i].Hash(), tx.Hash())
+		}
+	}
+	if nonce := w.current.state.GetNonce(testUserAddress); nonce != 1 {
+		t.Errorf("user nonce mismatch: have %d, want %d", nonce, 1)
+	}
+	// The pending block served to anyone must not disclose the bundle
+	block, state := w.pending()
+	if block.NumberU64() != 1 {
+		t.Fatalf("pending block number mismatch: have %d, want %d", block.NumberU64(), 1)
+	}
+	for _, tx := range block.Transactions() {
+		for _, bundled := range dependent {
+			if tx.Hash() == bundled.Hash() {
+				t.Errorf("bundled transaction %x disclosed in pending block", tx.Hash())
+			}
+		}
+	}
+	if nonce := state.GetNonce(testUserAddress); nonce != 0 {
+		t.Errorf("pending user nonce mismatch: have %d, want %d", nonce, 0)
+	}
+	select {
+	case logs := <-logsCh:
+		for _, log := range logs {
+			if log.TxHash == dependent[2].Hash() {
+				t.Errorf("bundle logs posted: %v", logs)
+			}
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Tests that private transactions are sealed but left out of the pending block
+// served to anyone asking.
+func TestPendingWithholdsPrivate(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	if err := b.txPool.AddPrivate(newTxs[0], 0, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	w.commitNewWork(nil, true, time.Now().Unix())
+
+	if len(w.current.txs) != 2 || w.current.txs[1].Hash() != newTxs[0].Hash() {
+		t.Fatalf("sealing work mismatch: have %v, want [%x %x]", w.current.txs, pendingTxs[0].Hash(), newTxs[0].Hash())
+	}
+	block, receipts := w.pendingBlockAndReceipts()
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != pendingTxs[0].Hash() {
+		t.Errorf("pending transactions mismatch: have %v, want [%x]", block.Transactions(), pendingTxs[0].Hash())
+	}
+	if len(receipts) != 1 {
+		t.Errorf("pending receipts mismatch: have %d, want %d", len(receipts), 1)
+	}
+	if _, state := w.pending(); state.GetNonce(testBankAddress) != 1 {
+		t.Errorf("pending nonce mismatch: have %d, want %d", state.GetNonce(testBankAddress), 1)
+	}
+}
+
+func TestSimulatePending(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	timestamp := b.chain.CurrentBlock().Time() + 10
+	if _, _, _, err := w.simulate(b.chain.CurrentBlock().Time(), nil); err == nil {
+		t.Fatalf("simulation on top of parent timestamp succeeded")
+	}
+	// Simulate with the default base fee, the pending transaction should be included
+	block, receipts, rejected, err := w.simulate(timestamp, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate block: %v", err)
+	}
+	if block.NumberU64() != 1 || block.Time() != timestamp {
+		t.Errorf("simulated block mismatch: have #%d at %d, want #%d at %d", block.NumberU64(), block.Time(), 1, timestamp)
+	}
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != pendingTxs[0].Hash() {
+		t.Errorf("simulated transactions mismatch: have %v, want [%x]", block.Transactions(), pendingTxs[0].Hash())
+	}
+	if len(receipts) != 1 || receipts[0].Status != types.ReceiptStatusSuccessful {
+		t.Errorf("simulated receipts mismatch: have %v", receipts)
+	}
+	if len(rejected) != 0 {
+		t.Errorf("unexpected rejected transactions: %v", rejected)
+	}
+	// Simulate with a base fee above the transaction's fee cap
+	block, _, rejected, err = w.simulate(timestamp, big.NewInt(2*params.InitialBaseFee))
+	if err != nil {
+		t.Fatalf("failed to simulate block: %v", err)
+	}
+	if block.BaseFee().Cmp(big.NewInt(2*params.InitialBaseFee)) != 0 {
+		t.Errorf("base fee mismatch: have %v, want %v", block.BaseFee(), 2*params.InitialBaseFee)
+	}
+	if len(block.Transactions()) != 0 {
+		t.Errorf("underpriced transactions included: %v", block.Transactions())
+	}
+	if len(rejected) != 1 || rejected[0].Tx.Hash() != pendingTxs[0].Hash() || !errors.Is(rejected[0].Err, core.ErrFeeCapTooLow) {
+		t.Errorf("rejected transactions mismatch: have %v", rejected)
+	}
+	// Simulations must never touch the pending block
+	if pending := w.pendingBlock(); pending != nil {
+		t.Errorf("simulation updated the pending block")
+	}
+	// Private transactions and bundles must not be disclosed by simulations
+	if err := b.txPool.AddPrivate(newTxs[0], 0, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	bundle := types.Transactions{types.MustSignNewTx(testUserKey, types.LatestSigner(ethashChainConfig), &types.LegacyTx{
+		To: &testBankAddress, Gas: params.TxGas, GasPrice: big.NewInt(params.InitialBaseFee),
+	})}
+	if _, err := w.bundles.add(bundle, 1, 0); err != nil {
+		t.Fatalf("failed to add bundle: %v", err)
+	}
+	block, _, rejected, err = w.simulate(timestamp, nil)
+	if err != nil {
+		t.Fatalf("failed to simulate block: %v", err)
+	}
+	if len(block.Transactions()) != 1 || block.Transactions()[0].Hash() != pendingTxs[0].Hash() {
+		t.Errorf("simulated transactions mismatch: have %v, want [%x]", block.Transactions(), pendingTxs[0].Hash())
+	}
+	if len(rejected) != 0 {
+		t.Errorf("unexpected rejected transactions: %v", rejected)
+	}
+}
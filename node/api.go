@@ -185,6 +185,8 @@ func (api *privateAdminAPI) StartHTTP(host *string, port *int, cors *string, api
 		CorsAllowedOrigins: api.node.config.HTTPCors,
 		Vhosts:             api.node.config.HTTPVirtualHosts,
 		Modules:            api.node.config.HTTPModules,
+		Limiter:            api.node.rpcLimiter,
+		Execution:          api.node.config.RPCExecutionLimits,
 	}
 	if cors != nil {
 		config.CorsAllowedOrigins = nil
@@ -256,8 +258,10 @@ func (api *privateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 
 	// Determine config.
 	config := wsConfig{
-		Modules: api.node.config.WSModules,
-		Origins: api.node.config.WSOrigins,
+		Modules:   api.node.config.WSModules,
+		Origins:   api.node.config.WSOrigins,
+		Limiter:   api.node.rpcLimiter,
+		Execution: api.node.config.RPCExecutionLimits,
 		// ExposeAll: api.node.config.WSExposeAll,
 	}
 	if apis != nil {
@@ -167,6 +167,28 @@ type Config struct {
 	// private APIs to untrusted users is a major security risk.
 	WSExposeAll bool `toml:",omitempty"`
 
+	// DBEngine is the engine of the persistent databases ("leveldb" or "pebble").
+	// If empty, existing databases are opened with the engine they were created
+	// with, and new ones use leveldb.
+	DBEngine string `toml:",omitempty"`
+
+	// AncientReadOnly opens the ancient chain segments read-only, so that several
+	// nodes on one host can share the ones written by a single node.
+	AncientReadOnly bool `toml:",omitempty"`
+
+	// BinaryHost is the host interface on which to start the binary RPC server. If
+	// this field is empty, no binary API endpoint will be started.
+	BinaryHost string
+
+	// BinaryPort is the TCP port number on which to start the binary RPC server.
+	// The default zero value is valid and will pick a port number randomly.
+	BinaryPort int `toml:",omitempty"`
+
+	// BinaryModules is a list of API modules to expose via the binary RPC interface.
+	// If the module list is empty, all RPC API endpoints designated public will be
+	// exposed.
+	BinaryModules []string
+
 	// GraphQLCors is the Cross-Origin Resource Sharing header to send to requesting
 	// clients. Please be aware that CORS is a browser enforced security, it's fully
 	// useless for custom HTTP clients.
@@ -181,6 +203,10 @@ type Config struct {
 	// Requests using ip address directly are not affected
 	GraphQLVirtualHosts []string `toml:",omitempty"`
 
+	// GraphQLTracing enables the call traces of transactions on GraphQL. Tracing
+	// re-executes the blocks of the queried transactions, so it is off by default.
+	GraphQLTracing bool `toml:",omitempty"`
+
 	// Logger is a custom logger to use with the p2p.Server.
 	Logger log.Logger `toml:",omitempty"`
 
@@ -190,6 +216,16 @@ type Config struct {
 
 	// AllowUnprotectedTxs allows non EIP-155 protected transactions to be send over RPC.
 	AllowUnprotectedTxs bool `toml:",omitempty"`
+
+	// RPCLimits configures the API keys and per-method rate, quota and concurrency
+	// limits enforced on the HTTP and WebSocket RPC endpoints. IPC and in-process
+	// connections are trusted and never limited.
+	RPCLimits rpc.LimitConfig `toml:",omitempty"`
+
+	// RPCExecutionLimits bounds the batch length, response size and execution
+	// time of the requests served over HTTP, WebSocket, IPC and the binary
+	// transport, and sets the threshold of the slow request log.
+	RPCExecutionLimits rpc.ExecutionLimits
 }
 
 // IPCEndpoint resolves an IPC endpoint based on a configured value, taking into
@@ -261,6 +297,15 @@ func (c *Config) WSEndpoint() string {
 	return fmt.Sprintf("%s:%d", c.WSHost, c.WSPort)
 }
 
+// BinaryEndpoint resolves a binary RPC endpoint based on the configured host
+// interface and port parameters.
+func (c *Config) BinaryEndpoint() string {
+	if c.BinaryHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.BinaryHost, c.BinaryPort)
+}
+
 // DefaultWSEndpoint returns the websocket endpoint used by default.
 func DefaultWSEndpoint() string {
 	config := &Config{WSHost: DefaultWSHost, WSPort: DefaultWSPort}
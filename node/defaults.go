@@ -34,6 +34,8 @@ const (
 	DefaultWSPort      = 8546        // Default TCP port for the websocket RPC server
 	DefaultGraphQLHost = "localhost" // Default host interface for the GraphQL server
 	DefaultGraphQLPort = 8547        // Default TCP port for the GraphQL server
+	DefaultBinaryHost  = "localhost" // Default host interface for the binary RPC server
+	DefaultBinaryPort  = 8548        // Default TCP port for the binary RPC server
 )
 
 // DefaultConfig contains reasonable default settings.
@@ -43,8 +45,11 @@ var DefaultConfig = Config{
 	HTTPModules:         []string{"net", "web3"},
 	HTTPVirtualHosts:    []string{"localhost"},
 	HTTPTimeouts:        rpc.DefaultHTTPTimeouts,
+	RPCExecutionLimits:  rpc.DefaultExecutionLimits,
 	WSPort:              DefaultWSPort,
 	WSModules:           []string{"net", "web3"},
+	BinaryPort:          DefaultBinaryPort,
+	BinaryModules:       []string{"net", "web3"},
 	GraphQLVirtualHosts: []string{"localhost"},
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
@@ -51,12 +51,14 @@ type Node struct {
 	state         int               // Tracks state of node lifecycle
 
 	lock          sync.Mutex
-	lifecycles    []Lifecycle // All registered backends, services, and auxiliary services that have a lifecycle
-	rpcAPIs       []rpc.API   // List of APIs currently provided by the node
-	http          *httpServer //
-	ws            *httpServer //
-	ipc           *ipcServer  // Stores information about the ipc http server
-	inprocHandler *rpc.Server // In-process RPC request handler to process the API requests
+	lifecycles    []Lifecycle   // All registered backends, services, and auxiliary services that have a lifecycle
+	rpcAPIs       []rpc.API     // List of APIs currently provided by the node
+	http          *httpServer   //
+	ws            *httpServer   //
+	ipc           *ipcServer    // Stores information about the ipc http server
+	binary        *binaryServer // Stores information about the binary RPC server
+	rpcLimiter    *rpc.Limiter  // Access limits shared by the HTTP and WebSocket servers
+	inprocHandler *rpc.Server   // In-process RPC request handler to process the API requests
 
 	databases map[*closeTrackingDB]struct{} // All open databases
 }
@@ -145,10 +147,13 @@ func New(conf *Config) (*Node, error) {
 		return nil, err
 	}
 
-	// Configure RPC servers.
+	// Configure RPC servers. HTTP and WebSocket share a single limiter so that
+	// clients can't double their quotas by using both.
+	node.rpcLimiter = rpc.NewLimiter(conf.RPCLimits)
 	node.http = newHTTPServer(node.log, conf.HTTPTimeouts)
 	node.ws = newHTTPServer(node.log, rpc.DefaultHTTPTimeouts)
-	node.ipc = newIPCServer(node.log, conf.IPCEndpoint())
+	node.ipc = newIPCServer(node.log, conf.IPCEndpoint(), conf.RPCExecutionLimits)
+	node.binary = newBinaryServer(node.log, conf.BinaryEndpoint(), conf.BinaryModules, conf.RPCExecutionLimits)
 
 	return node, nil
 }
@@ -350,12 +355,21 @@ func (n *Node) startRPC() error {
 		}
 	}
 
+	// Configure the binary transport.
+	if n.binary.endpoint != "" {
+		if err := n.binary.start(n.rpcAPIs); err != nil {
+			return err
+		}
+	}
+
 	// Configure HTTP.
 	if n.config.HTTPHost != "" {
 		config := httpConfig{
 			CorsAllowedOrigins: n.config.HTTPCors,
 			Vhosts:             n.config.HTTPVirtualHosts,
 			Modules:            n.config.HTTPModules,
+			Limiter:            n.rpcLimiter,
+			Execution:          n.config.RPCExecutionLimits,
 			prefix:             n.config.HTTPPathPrefix,
 		}
 		if err := n.http.setListenAddr(n.config.HTTPHost, n.config.HTTPPort); err != nil {
@@ -370,9 +384,11 @@ func (n *Node) startRPC() error {
 	if n.config.WSHost != "" {
 		server := n.wsServerForPort(n.config.WSPort)
 		config := wsConfig{
-			Modules: n.config.WSModules,
-			Origins: n.config.WSOrigins,
-			prefix:  n.config.WSPathPrefix,
+			Modules:   n.config.WSModules,
+			Origins:   n.config.WSOrigins,
+			Limiter:   n.rpcLimiter,
+			Execution: n.config.RPCExecutionLimits,
+			prefix:    n.config.WSPathPrefix,
 		}
 		if err := server.setListenAddr(n.config.WSHost, n.config.WSPort); err != nil {
 			return err
@@ -399,6 +415,7 @@ func (n *Node) stopRPC() {
 	n.http.stop()
 	n.ws.stop()
 	n.ipc.stop()
+	n.binary.stop()
 	n.stopInProc()
 }
 
@@ -545,6 +562,11 @@ func (n *Node) WSEndpoint() string {
 	return "ws://" + n.ws.listenAddr() + n.ws.wsConfig.prefix
 }
 
+// BinaryEndpoint returns the URL of the binary RPC server.
+func (n *Node) BinaryEndpoint() string {
+	return "binary://" + n.binary.listenAddr()
+}
+
 // EventMux retrieves the event multiplexer used by all the network services in
 // the current protocol stack.
 func (n *Node) EventMux() *event.TypeMux {
@@ -566,7 +588,14 @@ func (n *Node) OpenDatabase(name string, cache, handles int, namespace string, r
 	if n.config.DataDir == "" {
 		db = rawdb.NewMemoryDatabase()
 	} else {
-		db, err = rawdb.NewLevelDBDatabase(n.ResolvePath(name), cache, handles, namespace, readonly)
+		db, err = rawdb.Open(rawdb.OpenOptions{
+			Type:      n.config.DBEngine,
+			Directory: n.ResolvePath(name),
+			Namespace: namespace,
+			Cache:     cache,
+			Handles:   handles,
+			ReadOnly:  readonly,
+		})
 	}
 
 	if err == nil {
@@ -599,7 +628,16 @@ func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer,
 		case !filepath.IsAbs(freezer):
 			freezer = n.ResolvePath(freezer)
 		}
-		db, err = rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace, readonly)
+		db, err = rawdb.Open(rawdb.OpenOptions{
+			Type:              n.config.DBEngine,
+			Directory:         root,
+			AncientsDirectory: freezer,
+			AncientsReadOnly:  n.config.AncientReadOnly,
+			Namespace:         namespace,
+			Cache:             cache,
+			Handles:           handles,
+			ReadOnly:          readonly,
+		})
 	}
 
 	if err == nil {
@@ -485,6 +485,24 @@ func TestWebsocketHTTPOnSeparatePort_WSRequest(t *testing.T) {
 	}
 }
 
+// Tests that the binary RPC endpoint is served on its own port.
+func TestBinaryRPC(t *testing.T) {
+	node, err := New(&Config{BinaryHost: "127.0.0.1", BinaryPort: 0})
+	if err != nil {
+		t.Fatalf("could not create node: %v", err)
+	}
+	defer node.Close()
+	if err := node.Start(); err != nil {
+		t.Fatalf("could not start node: %v", err)
+	}
+	if !strings.HasPrefix(node.BinaryEndpoint(), "binary://127.0.0.1:") {
+		t.Fatalf("wrong binary endpoint %s", node.BinaryEndpoint())
+	}
+	if !checkRPC(node.BinaryEndpoint()) {
+		t.Fatalf("binary request failed")
+	}
+}
+
 type rpcPrefixTest struct {
 	httpPrefix, wsPrefix string
 	// These lists paths on which JSON-RPC should be served / not served.
@@ -39,14 +39,18 @@ type httpConfig struct {
 	Modules            []string
 	CorsAllowedOrigins []string
 	Vhosts             []string
+	Limiter            *rpc.Limiter
+	Execution          rpc.ExecutionLimits
 	prefix             string // path prefix on which to mount http handler
 }
 
 // wsConfig is the JSON-RPC/Websocket configuration
 type wsConfig struct {
-	Origins []string
-	Modules []string
-	prefix  string // path prefix on which to mount ws handler
+	Origins   []string
+	Modules   []string
+	Limiter   *rpc.Limiter
+	Execution rpc.ExecutionLimits
+	prefix    string // path prefix on which to mount ws handler
 }
 
 type rpcHandler struct {
@@ -181,6 +185,15 @@ func (h *httpServer) start() error {
 }
 
 func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Websocket requests to a handler registered via Node.RegisterHandler (e.g.
+	// GraphQL subscriptions) are routed to that handler rather than to WS-RPC.
+	rpc := h.httpHandler.Load().(*rpcHandler)
+	if rpc != nil && isWebsocket(r) {
+		if muxHandler, pattern := h.mux.Handler(r); pattern != "" {
+			muxHandler.ServeHTTP(w, r)
+			return
+		}
+	}
 	// check if ws request and serve if ws enabled
 	ws := h.wsHandler.Load().(*rpcHandler)
 	if ws != nil && isWebsocket(r) {
@@ -190,7 +203,6 @@ func (h *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	// if http-rpc is enabled, try to serve request
-	rpc := h.httpHandler.Load().(*rpcHandler)
 	if rpc != nil {
 		// First try to route in the mux.
 		// Requests to a path below root are handled by the mux,
@@ -280,6 +292,8 @@ func (h *httpServer) enableRPC(apis []rpc.API, config httpConfig) error {
 
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetLimiter(config.Limiter)
+	srv.SetExecutionLimits(config.Execution)
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
@@ -312,6 +326,8 @@ func (h *httpServer) enableWS(apis []rpc.API, config wsConfig) error {
 
 	// Create RPC server and handler.
 	srv := rpc.NewServer()
+	srv.SetLimiter(config.Limiter)
+	srv.SetExecutionLimits(config.Execution)
 	if err := RegisterApis(apis, config.Modules, srv, false); err != nil {
 		return err
 	}
@@ -453,7 +469,7 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 
 func newGzipHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") || isWebsocket(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -473,14 +489,15 @@ func newGzipHandler(next http.Handler) http.Handler {
 type ipcServer struct {
 	log      log.Logger
 	endpoint string
+	limits   rpc.ExecutionLimits
 
 	mu       sync.Mutex
 	listener net.Listener
 	srv      *rpc.Server
 }
 
-func newIPCServer(log log.Logger, endpoint string) *ipcServer {
-	return &ipcServer{log: log, endpoint: endpoint}
+func newIPCServer(log log.Logger, endpoint string, limits rpc.ExecutionLimits) *ipcServer {
+	return &ipcServer{log: log, endpoint: endpoint, limits: limits}
 }
 
 // Start starts the httpServer's http.Server
@@ -491,7 +508,7 @@ func (is *ipcServer) start(apis []rpc.API) error {
 	if is.listener != nil {
 		return nil // already running
 	}
-	listener, srv, err := rpc.StartIPCEndpoint(is.endpoint, apis)
+	listener, srv, err := rpc.StartLimitedIPCEndpoint(is.endpoint, apis, is.limits)
 	if err != nil {
 		is.log.Warn("IPC opening failed", "url", is.endpoint, "error", err)
 		return err
@@ -515,6 +532,73 @@ func (is *ipcServer) stop() error {
 	return err
 }
 
+// binaryServer serves the RPC APIs over TCP connections using the binary framing.
+type binaryServer struct {
+	log      log.Logger
+	endpoint string
+	modules  []string
+	limits   rpc.ExecutionLimits
+
+	mu       sync.Mutex
+	listener net.Listener
+	srv      *rpc.Server
+}
+
+func newBinaryServer(log log.Logger, endpoint string, modules []string, limits rpc.ExecutionLimits) *binaryServer {
+	return &binaryServer{log: log, endpoint: endpoint, modules: modules, limits: limits}
+}
+
+// start registers the allowed APIs and starts accepting connections.
+func (bs *binaryServer) start(apis []rpc.API) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.listener != nil {
+		return nil // already running
+	}
+	srv := rpc.NewServer()
+	srv.SetExecutionLimits(bs.limits)
+	if err := RegisterApis(apis, bs.modules, srv, false); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", bs.endpoint)
+	if err != nil {
+		bs.log.Warn("Binary RPC opening failed", "endpoint", bs.endpoint, "error", err)
+		return err
+	}
+	go srv.ServeBinaryListener(listener)
+
+	bs.log.Info("Binary RPC endpoint opened", "url", "binary://"+listener.Addr().String())
+	bs.listener, bs.srv = listener, srv
+	return nil
+}
+
+func (bs *binaryServer) stop() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.listener == nil {
+		return nil // not running
+	}
+	err := bs.listener.Close()
+	bs.srv.Stop()
+	bs.listener, bs.srv = nil, nil
+	bs.log.Info("Binary RPC endpoint closed", "endpoint", bs.endpoint)
+	return err
+}
+
+// listenAddr returns the listening address of the server, or the configured
+// endpoint if it is not running.
+func (bs *binaryServer) listenAddr() string {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if bs.listener != nil {
+		return bs.listener.Addr().String()
+	}
+	return bs.endpoint
+}
+
 // RegisterApis checks the given modules' availability, generates an allowlist based on the allowed modules,
 // and then registers all of the APIs exposed by the services.
 func RegisterApis(apis []rpc.API, modules []string, srv *rpc.Server, exposeAll bool) error {
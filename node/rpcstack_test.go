@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"testing"
@@ -291,3 +293,39 @@ func rpcRequest(t *testing.T, url string, extraHeaders ...string) *http.Response
 	}
 	return resp
 }
+
+// Tests that the execution limits are enforced on the IPC endpoint too.
+func TestIPCExecutionLimits(t *testing.T) {
+	endpoint := filepath.Join(t.TempDir(), "limits.ipc")
+	if runtime.GOOS == "windows" {
+		endpoint = `\\.\pipe\limits.ipc`
+	}
+	srv := newIPCServer(testlog.Logger(t, log.LvlDebug), endpoint, rpc.ExecutionLimits{BatchItems: 1})
+	if err := srv.start(nil); err != nil {
+		t.Fatalf("failed to start IPC server: %v", err)
+	}
+	defer srv.stop()
+
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		t.Fatalf("failed to dial IPC endpoint: %v", err)
+	}
+	defer client.Close()
+
+	var modules map[string]string
+	if err := client.Call(&modules, "rpc_modules"); err != nil {
+		t.Fatalf("single call failed: %v", err)
+	}
+	batch := []rpc.BatchElem{
+		{Method: "rpc_modules", Result: new(map[string]string)},
+		{Method: "rpc_modules", Result: new(map[string]string)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("batch call failed: %v", err)
+	}
+	for i, elem := range batch {
+		if rpcErr, ok := elem.Error.(rpc.Error); !ok || rpcErr.ErrorCode() != -32007 {
+			t.Errorf("batch element %d: error mismatch: have %v, want code %d", i, elem.Error, -32007)
+		}
+	}
+}
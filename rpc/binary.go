@@ -0,0 +1,300 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// maxBinaryFrameSize is the maximum size of a frame accepted by the binary codec.
+const maxBinaryFrameSize = 128 * 1024 * 1024
+
+// binaryMessage is the RLP envelope of a JSON-RPC message on the binary transport.
+// Parameters and errors are carried as their raw JSON encoding. Results are RLP
+// encoded if the request is flagged as Native, meaning the client decodes it into
+// a type with a native RLP form, and the result value has one too; all others
+// are carried as JSON, the same as on the other transports. On a response, the
+// Native flag tells which encoding the result uses. Empty fields stand for absent
+// ones.
+type binaryMessage struct {
+	ID     []byte
+	Method string
+	Params []byte
+	Result []byte
+	Error  []byte
+	Native bool
+}
+
+// binaryFrame is the RLP payload of a single frame, holding one message or a batch.
+type binaryFrame struct {
+	Batch    bool
+	Messages []binaryMessage
+}
+
+// binaryCodec reads and writes JSON-RPC messages as length-prefixed RLP frames.
+type binaryCodec struct {
+	remote  string
+	closer  sync.Once        // close closed channel once
+	closeCh chan interface{} // closed on Close
+	reader  *bufio.Reader
+	encMu   sync.Mutex // guards writes to conn
+	conn    Conn
+}
+
+// NewBinaryCodec creates a codec speaking the binary RPC framing on the given
+// connection. Every frame consists of a 4 byte big endian length followed by the
+// RLP encoding of the message envelope.
+func NewBinaryCodec(conn Conn) ServerCodec {
+	codec := &binaryCodec{
+		closeCh: make(chan interface{}),
+		reader:  bufio.NewReader(conn),
+		conn:    conn,
+	}
+	if ra, ok := conn.(ConnRemoteAddr); ok {
+		codec.remote = ra.RemoteAddr()
+	} else if nc, ok := conn.(net.Conn); ok {
+		codec.remote = nc.RemoteAddr().String()
+	}
+	return codec
+}
+
+func (c *binaryCodec) remoteAddr() string {
+	return c.remote
+}
+
+func (c *binaryCodec) apiKey() string {
+	return ""
+}
+
+func (c *binaryCodec) readBatch() ([]*jsonrpcMessage, bool, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return nil, false, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxBinaryFrameSize {
+		return nil, false, fmt.Errorf("frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return nil, false, err
+	}
+	var frame binaryFrame
+	if err := rlp.DecodeBytes(payload, &frame); err != nil {
+		return nil, false, err
+	}
+	msgs := make([]*jsonrpcMessage, len(frame.Messages))
+	for i, m := range frame.Messages {
+		msg := &jsonrpcMessage{Version: vsn, Method: m.Method, native: m.Native}
+		if len(m.ID) > 0 {
+			msg.ID = m.ID
+		}
+		if len(m.Params) > 0 {
+			msg.Params = m.Params
+		}
+		if len(m.Result) > 0 {
+			msg.Result = m.Result
+		}
+		if len(m.Error) > 0 {
+			msg.Error = new(jsonError)
+			if err := json.Unmarshal(m.Error, msg.Error); err != nil {
+				return nil, false, err
+			}
+		}
+		msgs[i] = msg
+	}
+	if !frame.Batch && len(msgs) != 1 {
+		return nil, false, fmt.Errorf("invalid frame with %d messages", len(msgs))
+	}
+	return msgs, frame.Batch, nil
+}
+
+func (c *binaryCodec) writeJSON(ctx context.Context, v interface{}) error {
+	var frame binaryFrame
+	switch v := v.(type) {
+	case *jsonrpcMessage:
+		frame.Messages = make([]binaryMessage, 1)
+		if err := frame.Messages[0].fromJSON(v); err != nil {
+			return err
+		}
+	case []*jsonrpcMessage:
+		frame.Batch = true
+		frame.Messages = make([]binaryMessage, len(v))
+		for i, msg := range v {
+			if err := frame.Messages[i].fromJSON(msg); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("can't encode %T on binary transport", v)
+	}
+	payload, err := rlp.EncodeToBytes(&frame)
+	if err != nil {
+		return err
+	}
+	if len(payload) > maxBinaryFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+	buf := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	copy(buf[4:], payload)
+
+	c.encMu.Lock()
+	defer c.encMu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultWriteTimeout)
+	}
+	c.conn.SetWriteDeadline(deadline)
+	_, err = c.conn.Write(buf)
+	return err
+}
+
+func (c *binaryCodec) close() {
+	c.closer.Do(func() {
+		close(c.closeCh)
+		c.conn.Close()
+	})
+}
+
+// Closed returns a channel which will be closed when Close is called
+func (c *binaryCodec) closed() <-chan interface{} {
+	return c.closeCh
+}
+
+// fromJSON fills the envelope with the fields of a JSON-RPC message.
+func (m *binaryMessage) fromJSON(msg *jsonrpcMessage) error {
+	m.ID, m.Method, m.Params, m.Result, m.Native = msg.ID, msg.Method, msg.Params, msg.Result, msg.native
+	if msg.Error != nil {
+		enc, err := json.Marshal(msg.Error)
+		if err != nil {
+			return err
+		}
+		m.Error = enc
+	}
+	return nil
+}
+
+// decodeResult decodes the result of a response into the given pointer.
+func (msg *jsonrpcMessage) decodeResult(result interface{}) error {
+	if msg.native {
+		return rlp.DecodeBytes(msg.Result, result)
+	}
+	return json.Unmarshal(msg.Result, result)
+}
+
+// ServeBinaryListener accepts connections on l, serving JSON-RPC on them using the
+// binary framing.
+func (s *Server) ServeBinaryListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if netutil.IsTemporaryError(err) {
+			log.Warn("RPC accept error", "err", err)
+			continue
+		} else if err != nil {
+			return err
+		}
+		log.Trace("Accepted binary RPC connection", "conn", conn.RemoteAddr())
+		go s.ServeCodec(NewBinaryCodec(conn), 0)
+	}
+}
+
+// DialBinary creates a new client that connects to the given TCP endpoint using the
+// binary framing. Calls decoding into byte strings, unsigned or big integers,
+// hashes, addresses or types with their own RLP encoding get their results RLP
+// encoded by the server if it returns such a type too, all others are JSON.
+//
+// The context is used for the initial connection establishment. It does not
+// affect subsequent interactions with the client.
+func DialBinary(ctx context.Context, endpoint string) (*Client, error) {
+	return newClient(ctx, func(ctx context.Context) (ServerCodec, error) {
+		conn, err := new(net.Dialer).DialContext(ctx, "tcp", endpoint)
+		if err != nil {
+			return nil, err
+		}
+		return NewBinaryCodec(conn), nil
+	})
+}
+
+var (
+	bigIntType     = reflect.TypeOf(big.Int{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	rlpEncoderType = reflect.TypeOf((*rlp.Encoder)(nil)).Elem()
+	rlpDecoderType = reflect.TypeOf((*rlp.Decoder)(nil)).Elem()
+)
+
+// nativeType reports whether values of the given type have a native RLP form
+// carrying the same information as their JSON encoding: unsigned integers, byte
+// strings and arrays such as hashes and addresses, big integers, types with their
+// own RLP encoding and lists of those. Structs are left out, as RLP matches their
+// fields by position while JSON does by name. Strings are only native as results,
+// as a string result target might decode the JSON form of a byte string.
+func nativeType(typ reflect.Type, decode bool) bool {
+	switch {
+	case typ == rawMessageType:
+		return false
+	case !decode && typ.Implements(rlpEncoderType):
+		return true
+	case decode && reflect.PtrTo(typ).Implements(rlpDecoderType):
+		return true
+	case typ == bigIntType:
+		return true
+	}
+	switch typ.Kind() {
+	case reflect.Bool, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	case reflect.String:
+		return !decode
+	case reflect.Slice, reflect.Array:
+		return typ.Elem().Kind() == reflect.Uint8 || nativeType(typ.Elem(), decode)
+	case reflect.Ptr:
+		return nativeType(typ.Elem(), decode)
+	}
+	return false
+}
+
+// nativeResult reports whether the given call result can be sent RLP encoded.
+// Nil pointers are left to JSON, to keep their null value.
+func nativeResult(result interface{}) bool {
+	val := reflect.ValueOf(result)
+	if !val.IsValid() || (val.Kind() == reflect.Ptr && val.IsNil()) {
+		return false
+	}
+	return nativeType(val.Type(), false)
+}
+
+// nativeTarget reports whether a call result can be decoded into the given
+// pointer from its RLP encoding.
+func nativeTarget(result interface{}) bool {
+	typ := reflect.TypeOf(result)
+	return typ != nil && typ.Kind() == reflect.Ptr && nativeType(typ.Elem(), true)
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Tests that calls, batches, errors and subscriptions work over the binary framing.
+func TestBinaryTransport(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("can't listen:", err)
+	}
+	defer listener.Close()
+	go server.ServeBinaryListener(listener)
+
+	client, err := DialContext(context.Background(), "binary://"+listener.Addr().String())
+	if err != nil {
+		t.Fatal("can't dial:", err)
+	}
+	defer client.Close()
+
+	// Plain calls.
+	var resp echoResult
+	if err := client.Call(&resp, "test_echo", "hello", 10, &echoArgs{"world"}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(resp, echoResult{"hello", 10, &echoArgs{"world"}}) {
+		t.Errorf("incorrect result %#v", resp)
+	}
+	// Results with a native RLP form, and JSON ones decoded into them.
+	var blob []byte
+	if err := client.Call(&blob, "test_blob", 3); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(blob, []byte{0xab, 0xab, 0xab}) {
+		t.Errorf("incorrect blob %x", blob)
+	}
+	var str string
+	if err := client.Call(&str, "test_rets"); err != nil || str != "" {
+		t.Errorf("incorrect string result %q: %v", str, err)
+	}
+	// Errors, including their code and data.
+	err = client.Call(nil, "test_returnError")
+	if rpcErr, ok := err.(Error); !ok || rpcErr.ErrorCode() != 444 {
+		t.Fatalf("wrong error: %v", err)
+	}
+	if dataErr, ok := err.(DataError); !ok || dataErr.ErrorData() != "testError data" {
+		t.Fatalf("wrong error data: %v", err)
+	}
+	// Batches.
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 10, &echoArgs{"world"}}, Result: new(echoResult)},
+		{Method: "no_such_method", Args: []interface{}{1, 2, 3}, Result: new(int)},
+		{Method: "test_blob", Args: []interface{}{2}, Result: new([]byte)},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(batch[0].Result, &echoResult{"hello", 10, &echoArgs{"world"}}) {
+		t.Errorf("incorrect batch result %#v", batch[0].Result)
+	}
+	if batch[1].Error == nil {
+		t.Errorf("expected error for unknown method")
+	}
+	if blob := *batch[2].Result.(*[]byte); batch[2].Error != nil || !bytes.Equal(blob, []byte{0xab, 0xab}) {
+		t.Errorf("incorrect batch blob %x: %v", blob, batch[2].Error)
+	}
+	// Subscriptions.
+	nc := make(chan int)
+	count := 10
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "someSubscription", count, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	for i := 0; i < count; i++ {
+		if val := <-nc; val != i {
+			t.Fatalf("value mismatch: got %d, want %d", val, i)
+		}
+	}
+	sub.Unsubscribe()
+}
+
+// Tests that results are only RLP encoded on the wire if the request asks for it
+// and the result type has a native RLP form.
+func TestBinaryNativeResults(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+
+	p1, p2 := net.Pipe()
+	go server.ServeCodec(NewBinaryCodec(p1), 0)
+	codec := NewBinaryCodec(p2)
+	defer codec.close()
+
+	tests := []struct {
+		method, params string
+		native, want   bool
+	}{
+		{"test_blob", "[3]", true, true},
+		{"test_blob", "[3]", false, false},
+		{"test_echo", `["x", 1, {"S": "y"}]`, true, false},
+	}
+	for i, tt := range tests {
+		req := &jsonrpcMessage{Version: vsn, ID: json.RawMessage("1"), Method: tt.method, Params: json.RawMessage(tt.params), native: tt.native}
+		if err := codec.writeJSON(context.Background(), req); err != nil {
+			t.Fatalf("test %d: write error: %v", i, err)
+		}
+		msgs, _, err := codec.readBatch()
+		if err != nil {
+			t.Fatalf("test %d: read error: %v", i, err)
+		}
+		if resp := msgs[0]; resp.native != tt.want {
+			t.Errorf("test %d: native result mismatch: have %v, want %v", i, resp.native, tt.want)
+		} else if tt.want {
+			var blob []byte
+			if err := rlp.DecodeBytes(resp.Result, &blob); err != nil || !bytes.Equal(blob, []byte{0xab, 0xab, 0xab}) {
+				t.Errorf("test %d: wrong RLP result %x: %v", i, resp.Result, err)
+			}
+		}
+	}
+}
+
+// Tests which types are considered to have a native RLP form.
+func TestNativeType(t *testing.T) {
+	tests := []struct {
+		val            interface{}
+		result, target bool
+	}{
+		{uint64(1), true, true},
+		{[]byte{1}, true, true},
+		{[32]byte{}, true, true},
+		{[][]byte{}, true, true},
+		{new(big.Int), true, true},
+		{"", true, false},
+		{json.RawMessage{}, false, false},
+		{int64(1), false, false},
+		{echoResult{}, false, false},
+		{map[string]interface{}{}, false, false},
+		{[]interface{}{}, false, false},
+	}
+	for i, tt := range tests {
+		typ := reflect.TypeOf(tt.val)
+		if have := nativeType(typ, false); have != tt.result {
+			t.Errorf("test %d (%T): result mismatch: have %v, want %v", i, tt.val, have, tt.result)
+		}
+		if have := nativeType(typ, true); have != tt.target {
+			t.Errorf("test %d (%T): target mismatch: have %v, want %v", i, tt.val, have, tt.target)
+		}
+	}
+}
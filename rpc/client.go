@@ -77,6 +77,8 @@ type Client struct {
 	idgen    func() ID // for subscriptions
 	isHTTP   bool
 	services *serviceRegistry
+	limiter  *Limiter        // limits applied to calls served to the remote side, nil if none
+	exec     ExecutionLimits // execution limits of calls served to the remote side
 
 	idCounter uint32
 
@@ -111,7 +113,7 @@ type clientConn struct {
 
 func (c *Client) newClientConn(conn ServerCodec) *clientConn {
 	ctx := context.WithValue(context.Background(), clientContextKey{}, c)
-	handler := newHandler(ctx, conn, c.idgen, c.services)
+	handler := newHandler(ctx, conn, c.idgen, c.services, c.limiter, c.exec)
 	return &clientConn{conn, handler}
 }
 
@@ -150,10 +152,12 @@ func (op *requestOp) wait(ctx context.Context, c *Client) (*jsonrpcMessage, erro
 
 // Dial creates a new client for the given URL.
 //
-// The currently supported URL schemes are "http", "https", "ws" and "wss". If rawurl is a
-// file name with no URL scheme, a local socket connection is established using UNIX
-// domain sockets on supported platforms and named pipes on Windows. If you want to
-// configure transport options, use DialHTTP, DialWebsocket or DialIPC instead.
+// The currently supported URL schemes are "http", "https", "ws", "wss" and "binary". If
+// rawurl is a file name with no URL scheme, a local socket connection is established
+// using UNIX domain sockets on supported platforms and named pipes on Windows. If you
+// want to configure transport options, use DialHTTP, DialWebsocket or DialIPC instead.
+//
+// For binary connections, the URL is of the form binary://host:port.
 //
 // For websocket connections, the origin is set to the local host name.
 //
@@ -178,6 +182,8 @@ func DialContext(ctx context.Context, rawurl string) (*Client, error) {
 		return DialWebsocket(ctx, rawurl, "")
 	case "stdio":
 		return DialStdIO(ctx)
+	case "binary":
+		return DialBinary(ctx, u.Host)
 	case "":
 		return DialIPC(ctx, rawurl)
 	default:
@@ -197,17 +203,19 @@ func newClient(initctx context.Context, connect reconnectFunc) (*Client, error)
 	if err != nil {
 		return nil, err
 	}
-	c := initClient(conn, randomIDGenerator(), new(serviceRegistry))
+	c := initClient(conn, randomIDGenerator(), new(serviceRegistry), nil, ExecutionLimits{})
 	c.reconnectFunc = connect
 	return c, nil
 }
 
-func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry) *Client {
+func initClient(conn ServerCodec, idgen func() ID, services *serviceRegistry, limiter *Limiter, exec ExecutionLimits) *Client {
 	_, isHTTP := conn.(*httpConn)
 	c := &Client{
 		idgen:       idgen,
 		isHTTP:      isHTTP,
 		services:    services,
+		limiter:     limiter,
+		exec:        exec,
 		writeConn:   conn,
 		close:       make(chan struct{}),
 		closing:     make(chan struct{}),
@@ -296,6 +304,7 @@ func (c *Client) CallContext(ctx context.Context, result interface{}, method str
 	if err != nil {
 		return err
 	}
+	msg.native = nativeTarget(result)
 	op := &requestOp{ids: []json.RawMessage{msg.ID}, resp: make(chan *jsonrpcMessage, 1)}
 
 	if c.isHTTP {
@@ -315,6 +324,8 @@ func (c *Client) CallContext(ctx context.Context, result interface{}, method str
 		return resp.Error
 	case len(resp.Result) == 0:
 		return ErrNoResult
+	case resp.native:
+		return resp.decodeResult(result)
 	default:
 		return json.Unmarshal(resp.Result, &result)
 	}
@@ -352,6 +363,7 @@ func (c *Client) BatchCallContext(ctx context.Context, b []BatchElem) error {
 		if err != nil {
 			return err
 		}
+		msg.native = nativeTarget(elem.Result)
 		msgs[i] = msg
 		op.ids[i] = msg.ID
 	}
@@ -388,7 +400,7 @@ func (c *Client) BatchCallContext(ctx context.Context, b []BatchElem) error {
 			elem.Error = ErrNoResult
 			continue
 		}
-		elem.Error = json.Unmarshal(resp.Result, elem.Result)
+		elem.Error = resp.decodeResult(elem.Result)
 	}
 	return err
 }
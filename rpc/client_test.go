@@ -311,6 +311,40 @@ func TestClientSubscribe(t *testing.T) {
 	}
 }
 
+// Tests that subscriptions closed by the server end with the error they were
+// closed with, after delivering the preceding notifications.
+func TestClientSubscribeServerClose(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	nc := make(chan int)
+	count := 3
+	sub, err := client.Subscribe(context.Background(), "nftest", nc, "closedSubscription", count, 0)
+	if err != nil {
+		t.Fatal("can't subscribe:", err)
+	}
+	defer sub.Unsubscribe()
+
+	for i := 0; i < count; i++ {
+		if val := <-nc; val != i {
+			t.Fatalf("value mismatch: got %d, want %d", val, i)
+		}
+	}
+	select {
+	case v := <-nc:
+		t.Fatal("received value after close:", v)
+	case err := <-sub.Err():
+		rpcErr, ok := err.(Error)
+		if !ok || rpcErr.ErrorCode() != 444 || err.Error() != "testError" {
+			t.Fatalf("wrong subscription error: %v", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatalf("subscription not closed within 1s after server close")
+	}
+}
+
 // In this test, the connection drops while Subscribe is waiting for a response.
 func TestClientSubscribeClose(t *testing.T) {
 	server := newTestServer()
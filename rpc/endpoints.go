@@ -25,12 +25,18 @@ import (
 
 // StartIPCEndpoint starts an IPC endpoint.
 func StartIPCEndpoint(ipcEndpoint string, apis []API) (net.Listener, *Server, error) {
+	return StartLimitedIPCEndpoint(ipcEndpoint, apis, ExecutionLimits{})
+}
+
+// StartLimitedIPCEndpoint starts an IPC endpoint enforcing the given execution limits.
+func StartLimitedIPCEndpoint(ipcEndpoint string, apis []API, limits ExecutionLimits) (net.Listener, *Server, error) {
 	// Register all the APIs exposed by the services.
 	var (
 		handler    = NewServer()
 		regMap     = make(map[string]struct{})
 		registered []string
 	)
+	handler.SetExecutionLimits(limits)
 	for _, api := range apis {
 		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
 			log.Info("IPC registration failed", "namespace", api.Namespace, "error", err)
@@ -16,7 +16,10 @@
 
 package rpc
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 // HTTPError is returned by client operations when the HTTP status code of the
 // response is not a 2xx status.
@@ -54,6 +57,13 @@ var (
 	_ Error = new(invalidRequestError)
 	_ Error = new(invalidMessageError)
 	_ Error = new(invalidParamsError)
+	_ Error = new(unauthorizedError)
+	_ Error = new(limitExceededError)
+	_ Error = new(batchTooLargeError)
+	_ Error = new(responseTooLargeError)
+	_ Error = new(callTimeoutError)
+
+	_ DataError = new(limitExceededError)
 )
 
 const defaultErrorCode = -32000
@@ -101,3 +111,64 @@ type invalidParamsError struct{ message string }
 func (e *invalidParamsError) ErrorCode() int { return -32602 }
 
 func (e *invalidParamsError) Error() string { return e.message }
+
+// missing or unknown API key
+type unauthorizedError struct{}
+
+func (e *unauthorizedError) ErrorCode() int { return -32006 }
+
+func (e *unauthorizedError) Error() string { return "missing or invalid API key" }
+
+// the client exceeded one of the limits configured for a method
+type limitExceededError struct {
+	method     string
+	limit      string        // "rate", "quota" or "concurrency"
+	retryAfter time.Duration // time until the call may succeed, 0 if unknown
+}
+
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+func (e *limitExceededError) Error() string {
+	return fmt.Sprintf("%s limit exceeded for method %s", e.limit, e.method)
+}
+
+func (e *limitExceededError) ErrorData() interface{} {
+	data := map[string]interface{}{
+		"method": e.method,
+		"limit":  e.limit,
+	}
+	if e.retryAfter > 0 {
+		data["retryAfter"] = e.retryAfter.Seconds()
+	}
+	return data
+}
+
+// the batch contains more calls than the server allows
+type batchTooLargeError struct{ limit int }
+
+func (e *batchTooLargeError) ErrorCode() int { return -32007 }
+
+func (e *batchTooLargeError) Error() string {
+	return fmt.Sprintf("batch too large, at most %d calls allowed", e.limit)
+}
+
+// the serialized response exceeds the size the server allows
+type responseTooLargeError struct{ limit int }
+
+func (e *responseTooLargeError) ErrorCode() int { return -32008 }
+
+func (e *responseTooLargeError) Error() string {
+	return fmt.Sprintf("response too large, at most %d bytes allowed", e.limit)
+}
+
+// the call did not finish within the execution time the server allows
+type callTimeoutError struct {
+	method  string
+	timeout time.Duration
+}
+
+func (e *callTimeoutError) ErrorCode() int { return -32009 }
+
+func (e *callTimeoutError) Error() string {
+	return fmt.Sprintf("method %s exceeded execution timeout of %v", e.method, e.timeout)
+}
@@ -18,6 +18,8 @@ package rpc
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"reflect"
 	"strconv"
@@ -25,7 +27,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 // handler handles JSON-RPC messages. There is one handler per connection. Note that
@@ -61,6 +66,8 @@ type handler struct {
 	conn           jsonWriter                     // where responses will be sent
 	log            log.Logger
 	allowSubscribe bool
+	limiter        *Limiter        // limits applied to served calls, nil if none
+	exec           ExecutionLimits // execution limits of served calls
 
 	subLock    sync.Mutex
 	serverSubs map[ID]*Subscription
@@ -71,7 +78,7 @@ type callProc struct {
 	notifiers []*Notifier
 }
 
-func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry) *handler {
+func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *serviceRegistry, limiter *Limiter, exec ExecutionLimits) *handler {
 	rootCtx, cancelRoot := context.WithCancel(connCtx)
 	h := &handler{
 		reg:            reg,
@@ -84,6 +91,8 @@ func newHandler(connCtx context.Context, conn jsonWriter, idgen func() ID, reg *
 		allowSubscribe: true,
 		serverSubs:     make(map[ID]*Subscription),
 		log:            log.Root(),
+		limiter:        limiter,
+		exec:           exec,
 	}
 	if conn.remoteAddr() != "" {
 		h.log = h.log.New("conn", conn.remoteAddr())
@@ -101,6 +110,22 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 		})
 		return
 	}
+	// Refuse oversized batches, answering each call so clients can match the error:
+	if limit := h.batchLimit(); limit > 0 && len(msgs) > limit {
+		h.startCallProc(func(cp *callProc) {
+			answers := make([]*jsonrpcMessage, 0, len(msgs))
+			for _, msg := range msgs {
+				if msg.isCall() {
+					answers = append(answers, msg.errorResponse(&batchTooLargeError{limit}))
+				}
+			}
+			if len(answers) == 0 {
+				answers = append(answers, errorMessage(&batchTooLargeError{limit}))
+			}
+			h.conn.writeJSON(cp.ctx, answers)
+		})
+		return
+	}
 
 	// Handle non-call messages first:
 	calls := make([]*jsonrpcMessage, 0, len(msgs))
@@ -114,9 +139,25 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
-		answers := make([]*jsonrpcMessage, 0, len(msgs))
+		var (
+			answers = make([]*jsonrpcMessage, 0, len(msgs))
+			limit   = h.responseLimit()
+			size    int
+		)
 		for _, msg := range calls {
-			if answer := h.handleCallMsg(cp, msg); answer != nil {
+			// Once the batch response is full, refuse to execute the rest. Each
+			// call may only use the space left by the previous ones.
+			budget := 0
+			if limit > 0 {
+				if budget = limit - size; budget <= 0 {
+					if msg.isCall() {
+						answers = append(answers, msg.errorResponse(&responseTooLargeError{limit}))
+					}
+					continue
+				}
+			}
+			if answer := h.handleCallMsg(cp, msg, budget); answer != nil {
+				size += len(answer.Result)
 				answers = append(answers, answer)
 			}
 		}
@@ -136,7 +177,7 @@ func (h *handler) handleMsg(msg *jsonrpcMessage) {
 		return
 	}
 	h.startCallProc(func(cp *callProc) {
-		answer := h.handleCallMsg(cp, msg)
+		answer := h.handleCallMsg(cp, msg, h.responseLimit())
 		h.addSubscriptions(cp.notifiers)
 		if answer != nil {
 			h.conn.writeJSON(cp.ctx, answer)
@@ -254,9 +295,17 @@ func (h *handler) handleSubscriptionResult(msg *jsonrpcMessage) {
 		h.log.Debug("Dropping invalid subscription message")
 		return
 	}
-	if h.clientSubs[result.ID] != nil {
-		h.clientSubs[result.ID].deliver(result.Result)
+	sub := h.clientSubs[result.ID]
+	if sub == nil {
+		return
+	}
+	if result.Error != nil {
+		// The server closed the subscription, end it with the reported error
+		delete(h.clientSubs, result.ID)
+		sub.close(result.Error)
+		return
 	}
+	sub.deliver(result.Result)
 }
 
 // handleResponse processes method call responses.
@@ -286,18 +335,34 @@ func (h *handler) handleResponse(msg *jsonrpcMessage) {
 	}
 }
 
-// handleCallMsg executes a call message and returns the answer.
-func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+// handleCallMsg executes a call message and returns the answer. The result of the
+// call may be at most limit bytes long once serialized (0 = unlimited).
+func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage, limit int) *jsonrpcMessage {
 	start := time.Now()
 	switch {
 	case msg.isNotification():
-		h.handleCall(ctx, msg)
-		h.log.Debug("Served "+msg.Method, "t", time.Since(start))
+		h.handleCall(ctx, msg, limit)
+		elapsed := time.Since(start)
+		h.logSlowCall(msg, elapsed)
+		h.log.Debug("Served "+msg.Method, "t", elapsed)
 		return nil
 	case msg.isCall():
-		resp := h.handleCall(ctx, msg)
+		// Only registered methods are tracked individually, so that clients can't
+		// create arbitrary metrics by calling made-up methods.
+		tracked := metrics.Enabled && h.reg.callback(msg.Method) != nil
+		if tracked {
+			newRPCInflightGauge(msg.Method).Inc(1)
+		}
+		resp := h.handleCall(ctx, msg, limit)
+		elapsed := time.Since(start)
+		if tracked {
+			newRPCInflightGauge(msg.Method).Dec(1)
+			updateRPCMetrics(msg.Method, resp, elapsed)
+		}
+		h.logSlowCall(msg, elapsed)
+
 		var ctx []interface{}
-		ctx = append(ctx, "reqid", idForLog{msg.ID}, "t", time.Since(start))
+		ctx = append(ctx, "reqid", idForLog{msg.ID}, "t", elapsed)
 		if resp.Error != nil {
 			ctx = append(ctx, "err", resp.Error.Message)
 			if resp.Error.Data != nil {
@@ -316,7 +381,14 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 }
 
 // handleCall processes method calls.
-func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
+func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage, limit int) *jsonrpcMessage {
+	if h.limiter != nil && !msg.isUnsubscribe() {
+		release, err := h.limiter.acquire(h.conn.apiKey(), h.conn.remoteAddr(), msg.Method)
+		if err != nil {
+			return msg.errorResponse(err)
+		}
+		defer release()
+	}
 	if msg.isSubscribe() {
 		return h.handleSubscribe(cp, msg)
 	}
@@ -333,8 +405,18 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	if err != nil {
 		return msg.errorResponse(&invalidParamsError{err.Error()})
 	}
+	ctx := cp.ctx
+	timeout := h.callTimeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
 	start := time.Now()
-	answer := h.runMethod(cp.ctx, msg, callb, args)
+	answer := h.runMethod(ctx, msg, callb, args, limit)
+	if timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+		answer = msg.errorResponse(&callTimeoutError{method: msg.Method, timeout: timeout})
+	}
 
 	// Collect the statistics for RPC calls if metrics is enabled.
 	// We only care about pure rpc call. Filter out subscription.
@@ -351,6 +433,32 @@ func (h *handler) handleCall(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage
 	return answer
 }
 
+// logSlowCall reports a call in the slow request log if it took longer than the
+// configured threshold.
+func (h *handler) logSlowCall(msg *jsonrpcMessage, elapsed time.Duration) {
+	if h.exec.SlowThreshold == 0 || elapsed < h.exec.SlowThreshold {
+		return
+	}
+	hash := sha256.Sum256(msg.Params)
+	log.Warn("Slow RPC request", "method", msg.Method, "params", hex.EncodeToString(hash[:8]),
+		"elapsed", common.PrettyDuration(elapsed), "remote", h.conn.remoteAddr())
+}
+
+// batchLimit returns the maximum number of calls allowed in a batch, 0 if unlimited.
+func (h *handler) batchLimit() int {
+	return h.exec.BatchItems
+}
+
+// responseLimit returns the maximum size of a serialized response, 0 if unlimited.
+func (h *handler) responseLimit() int {
+	return h.exec.ResponseBytes
+}
+
+// callTimeout returns the maximum execution time of a call, 0 if unlimited.
+func (h *handler) callTimeout() time.Duration {
+	return h.exec.CallTimeout
+}
+
 // handleSubscribe processes *_subscribe method calls.
 func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMessage {
 	if !h.allowSubscribe {
@@ -381,16 +489,46 @@ func (h *handler) handleSubscribe(cp *callProc, msg *jsonrpcMessage) *jsonrpcMes
 	cp.notifiers = append(cp.notifiers, n)
 	ctx := context.WithValue(cp.ctx, notifierKey{}, n)
 
-	return h.runMethod(ctx, msg, callb, args)
+	return h.runMethod(ctx, msg, callb, args, 0)
 }
 
 // runMethod runs the Go callback for an RPC method.
-func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value) *jsonrpcMessage {
+func (h *handler) runMethod(ctx context.Context, msg *jsonrpcMessage, callb *callback, args []reflect.Value, limit int) *jsonrpcMessage {
 	result, err := callb.call(ctx, msg.Method, args)
 	if err != nil {
 		return msg.errorResponse(err)
 	}
-	return msg.response(result)
+	if msg.native && nativeResult(result) {
+		if enc, err := rlp.EncodeToBytes(result); err == nil {
+			if limit > 0 && len(enc) > limit {
+				return msg.errorResponse(&responseTooLargeError{h.responseLimit()})
+			}
+			return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc, native: true}
+		}
+	}
+	if limit == 0 {
+		return msg.response(result)
+	}
+	enc, err := encodeLimited(result, limit)
+	if err == errResponseTooLarge {
+		return msg.errorResponse(&responseTooLargeError{h.responseLimit()})
+	}
+	if err != nil {
+		return msg.errorResponse(err)
+	}
+	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
+}
+
+// removeSubscription stops tracking a server subscription closed by its notifier
+// and closes its error channel.
+func (h *handler) removeSubscription(id ID) {
+	h.subLock.Lock()
+	defer h.subLock.Unlock()
+
+	if s := h.serverSubs[id]; s != nil {
+		close(s.err)
+		delete(h.serverSubs, id)
+	}
 }
 
 // unsubscribe is the callback function for all *_unsubscribe calls.
@@ -57,6 +57,10 @@ func (hc *httpConn) remoteAddr() string {
 	return hc.url
 }
 
+func (hc *httpConn) apiKey() string {
+	return ""
+}
+
 func (hc *httpConn) readBatch() ([]*jsonrpcMessage, bool, error) {
 	<-hc.closeCh
 	return nil, false, io.EOF
@@ -222,6 +226,11 @@ func (t *httpServerConn) RemoteAddr() string {
 	return t.r.RemoteAddr
 }
 
+// apiKey returns the API key presented with the request.
+func (t *httpServerConn) apiKey() string {
+	return requestAPIKey(t.r)
+}
+
 // SetWriteDeadline does nothing and always returns nil.
 func (t *httpServerConn) SetWriteDeadline(time.Time) error { return nil }
 
@@ -162,3 +162,128 @@ func TestHTTPErrorResponse(t *testing.T) {
 		t.Error("unexpected error message", errMsg)
 	}
 }
+
+// Tests that API keys and method limits are enforced on HTTP requests and that
+// breaches are reported as structured errors.
+func TestHTTPLimits(t *testing.T) {
+	s := newTestServer()
+	defer s.Stop()
+	s.SetLimiter(NewLimiter(LimitConfig{
+		APIKeys: map[string]uint64{"key1": 0, "key2": 1},
+		Methods: map[string]MethodLimit{
+			"test_echo": {Rate: 0.001, Burst: 2},
+			"test_*":    {Concurrent: 1},
+		},
+	}))
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, err := DialHTTP(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var r echoResult
+	checkCode := func(err error, code int) {
+		t.Helper()
+		rpcErr, ok := err.(Error)
+		if !ok {
+			t.Fatalf("expected RPC error with code %d, got %v", code, err)
+		}
+		if rpcErr.ErrorCode() != code {
+			t.Fatalf("wrong error code %d, want %d", rpcErr.ErrorCode(), code)
+		}
+	}
+
+	// Calls without a valid API key are refused.
+	checkCode(c.Call(&r, "test_echo", "x", 1), -32006)
+
+	// The rate limit of test_echo allows a burst of two calls.
+	c.SetHeader(apiKeyHeader, "key1")
+	for i := 0; i < 2; i++ {
+		if err := c.Call(&r, "test_echo", "x", 1); err != nil {
+			t.Fatalf("call %d failed: %v", i, err)
+		}
+	}
+	err = c.Call(&r, "test_echo", "x", 1)
+	checkCode(err, -32005)
+	data := err.(DataError).ErrorData().(map[string]interface{})
+	if data["limit"] != "rate" || data["method"] != "test_echo" {
+		t.Fatalf("wrong error data %v", data)
+	}
+	if retry, ok := data["retryAfter"].(float64); !ok || retry <= 0 {
+		t.Fatalf("missing retryAfter in error data %v", data)
+	}
+
+	// The daily quota of key2 allows a single call.
+	c.SetHeader(apiKeyHeader, "key2")
+	if err := c.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal(err)
+	}
+	checkCode(c.Call(nil, "test_noArgsRets"), -32005)
+}
+
+// Tests that concurrency caps reject calls while all slots are taken.
+func TestLimiterConcurrency(t *testing.T) {
+	l := NewLimiter(LimitConfig{
+		Methods: map[string]MethodLimit{
+			"debug_trace*": {Concurrent: 1},
+			"*":            {Concurrent: 2},
+		},
+	})
+	release, err := l.acquire("", "1.2.3.4:1", "debug_traceTransaction")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.acquire("", "5.6.7.8:1", "debug_traceBlockByNumber"); err == nil {
+		t.Fatal("expected concurrency limit error")
+	}
+	// Other methods fall back to the catch-all pattern.
+	if _, err := l.acquire("", "5.6.7.8:1", "eth_getLogs"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if _, err := l.acquire("", "5.6.7.8:1", "debug_traceBlockByNumber"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Tests that calls refused by the rate or concurrency limits don't count against
+// the daily quota of an API key.
+func TestLimiterQuotaAfterLimits(t *testing.T) {
+	l := NewLimiter(LimitConfig{
+		APIKeys: map[string]uint64{"key": 2},
+		Methods: map[string]MethodLimit{
+			"eth_call": {Concurrent: 1},
+		},
+	})
+	release, err := l.acquire("key", "1.2.3.4:1", "eth_call")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.acquire("key", "1.2.3.4:1", "eth_call"); err == nil {
+			t.Fatal("expected concurrency limit error")
+		}
+	}
+	release()
+	if _, err := l.acquire("key", "1.2.3.4:1", "eth_call"); err != nil {
+		t.Fatalf("quota charged for refused calls: %v", err)
+	}
+	if _, err := l.acquire("key", "1.2.3.4:1", "eth_blockNumber"); err == nil {
+		t.Fatal("expected quota limit error")
+	}
+}
+
+// Tests that API keys are only accepted in the request header.
+func TestRequestAPIKey(t *testing.T) {
+	r := httptest.NewRequest("POST", "/?apikey=query", nil)
+	if key := requestAPIKey(r); key != "" {
+		t.Fatalf("API key accepted from URL query: %q", key)
+	}
+	r.Header.Set(apiKeyHeader, "header")
+	if key := requestAPIKey(r); key != "header" {
+		t.Fatalf("wrong API key %q, want %q", key, "header")
+	}
+}
@@ -19,6 +19,7 @@ package rpc
 import (
 	"bytes"
 	"context"
+	"encoding"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -44,6 +45,7 @@ var null = json.RawMessage("null")
 type subscriptionResult struct {
 	ID     string          `json:"subscription"`
 	Result json.RawMessage `json:"result,omitempty"`
+	Error  *jsonError      `json:"error,omitempty"` // Set on the final notification of a subscription closed by the server
 }
 
 // A value of this type can a JSON-RPC request, notification, successful response or
@@ -55,6 +57,8 @@ type jsonrpcMessage struct {
 	Params  json.RawMessage `json:"params,omitempty"`
 	Error   *jsonError      `json:"error,omitempty"`
 	Result  json.RawMessage `json:"result,omitempty"`
+
+	native bool // Result is (or may be, on requests) RLP encoded, binary transport only
 }
 
 func (msg *jsonrpcMessage) isNotification() bool {
@@ -106,6 +110,84 @@ func (msg *jsonrpcMessage) response(result interface{}) *jsonrpcMessage {
 	return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: enc}
 }
 
+var (
+	errResponseTooLarge = errors.New("response too large")
+
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// encodeLimited serializes a call result like json.Marshal, but gives up with
+// errResponseTooLarge as soon as the output grows past limit bytes. Lists, which
+// make up the bulk of large responses, are written out one element at a time so
+// that the check happens while encoding rather than after the whole result was
+// serialized.
+func encodeLimited(result interface{}, limit int) (json.RawMessage, error) {
+	val := reflect.ValueOf(result)
+	for val.Kind() == reflect.Ptr && !val.IsNil() && !val.Type().Implements(jsonMarshalerType) && !val.Type().Implements(textMarshalerType) {
+		val = val.Elem()
+	}
+	if !streamable(val) {
+		enc, err := json.Marshal(result)
+		if err != nil {
+			return nil, err
+		}
+		if len(enc) > limit {
+			return nil, errResponseTooLarge
+		}
+		return enc, nil
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte('[')
+	for i := 0; i < val.Len(); i++ {
+		elem := val.Index(i)
+		if elem.CanAddr() {
+			elem = elem.Addr() // keep pointer receiver marshalers working
+		}
+		enc, err := json.Marshal(elem.Interface())
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if buf.Len()+len(enc)+1 > limit {
+			return nil, errResponseTooLarge
+		}
+		buf.Write(enc)
+	}
+	if buf.Len()+1 > limit {
+		return nil, errResponseTooLarge
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// streamable reports whether a value is a list that encoding/json would serialize
+// as a plain JSON array, so that its elements can be encoded one by one.
+func streamable(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Slice:
+		if val.IsNil() {
+			return false
+		}
+	case reflect.Array:
+	default:
+		return false
+	}
+	typ := val.Type()
+	if typ.Elem().Kind() == reflect.Uint8 {
+		return false // byte slices are base64 encoded
+	}
+	if typ.Implements(jsonMarshalerType) || typ.Implements(textMarshalerType) {
+		return false
+	}
+	if reflect.PtrTo(typ).Implements(jsonMarshalerType) || reflect.PtrTo(typ).Implements(textMarshalerType) {
+		return false
+	}
+	return true
+}
+
 func errorMessage(err error) *jsonrpcMessage {
 	msg := &jsonrpcMessage{Version: vsn, ID: null, Error: &jsonError{
 		Code:    defaultErrorCode,
@@ -161,10 +243,17 @@ type ConnRemoteAddr interface {
 	RemoteAddr() string
 }
 
+// connAPIKey is implemented by connections which carry the API key the remote
+// side authenticated with.
+type connAPIKey interface {
+	apiKey() string
+}
+
 // jsonCodec reads and writes JSON-RPC messages to the underlying connection. It also has
 // support for parsing arguments and serializing (result) objects.
 type jsonCodec struct {
 	remote  string
+	key     string
 	closer  sync.Once                 // close closed channel once
 	closeCh chan interface{}          // closed on Close
 	decode  func(v interface{}) error // decoder to allow multiple transports
@@ -186,6 +275,9 @@ func NewFuncCodec(conn deadlineCloser, encode, decode func(v interface{}) error)
 	if ra, ok := conn.(ConnRemoteAddr); ok {
 		codec.remote = ra.RemoteAddr()
 	}
+	if ak, ok := conn.(connAPIKey); ok {
+		codec.key = ak.apiKey()
+	}
 	return codec
 }
 
@@ -202,6 +294,10 @@ func (c *jsonCodec) remoteAddr() string {
 	return c.remote
 }
 
+func (c *jsonCodec) apiKey() string {
+	return c.key
+}
+
 func (c *jsonCodec) readBatch() (messages []*jsonrpcMessage, batch bool, err error) {
 	// Decode the next JSON object in the input stream.
 	// This verifies basic syntax, etc.
@@ -0,0 +1,268 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// apiKeyHeader is the HTTP header carrying the API key of a request. Keys are
+	// not accepted in the URL, where they would end up in proxy and access logs.
+	apiKeyHeader = "X-API-Key"
+
+	// maxRateBuckets is the number of per-client rate limiters retained before
+	// idle ones are discarded.
+	maxRateBuckets = 65536
+)
+
+// LimitConfig configures API key access control and per-method limits of an RPC
+// server. The zero value imposes no restrictions.
+type LimitConfig struct {
+	// APIKeys maps the accepted API keys to the number of calls each may make
+	// per day (0 = unlimited). If empty, no API key is required.
+	APIKeys map[string]uint64 `toml:",omitempty"`
+
+	// Methods maps method names to the limits applied to them. A name ending in
+	// '*' matches all methods with the given prefix (e.g. "debug_trace*"), and
+	// "*" alone matches any method without a more specific entry.
+	Methods map[string]MethodLimit `toml:",omitempty"`
+}
+
+// ExecutionLimits bounds the resources a single request may consume on a server,
+// regardless of the transport it arrived on. The slow request log is configured
+// here too, but works independently of the limits and of any Limiter.
+type ExecutionLimits struct {
+	BatchItems    int           // Maximum number of calls in a batch (0 = unlimited)
+	ResponseBytes int           // Maximum size of a serialized response or batch response (0 = unlimited)
+	CallTimeout   time.Duration // Maximum execution time of a call (0 = unlimited)
+	SlowThreshold time.Duration // Execution time above which calls are logged as slow (0 = disabled)
+}
+
+// DefaultExecutionLimits are the execution limits used by the node's RPC servers.
+// Nothing is limited by default, so existing clients keep working unless the
+// operator opts in.
+var DefaultExecutionLimits = ExecutionLimits{}
+
+// MethodLimit is the set of limits applied to calls of a method.
+type MethodLimit struct {
+	Rate       float64 // Calls per second allowed for each client (0 = unlimited)
+	Burst      int     // Calls a client may make at once before being rate limited
+	Concurrent int     // Calls allowed to execute at the same time across all clients (0 = unlimited)
+}
+
+// Limiter enforces a LimitConfig on the calls served by one or more RPC servers.
+// Servers sharing a limiter share the quotas, rates and concurrency slots of their
+// clients. Clients are identified by their API key, or by their remote host if
+// they have none.
+type Limiter struct {
+	config LimitConfig
+
+	lock    sync.Mutex
+	buckets map[rateBucketKey]*rateBucket // Token buckets of each client and method pattern
+	quotas  map[string]*quotaUsage        // Calls made by each API key today
+	slots   map[string]chan struct{}      // Concurrency slots of each method pattern
+}
+
+type rateBucketKey struct {
+	client  string
+	pattern string
+}
+
+type rateBucket struct {
+	limiter *rate.Limiter
+	used    time.Time
+}
+
+type quotaUsage struct {
+	day   int64
+	calls uint64
+}
+
+// NewLimiter creates a limiter enforcing the given configuration, or returns nil
+// if the configuration imposes no restrictions.
+func NewLimiter(config LimitConfig) *Limiter {
+	if len(config.APIKeys) == 0 && len(config.Methods) == 0 {
+		return nil
+	}
+	l := &Limiter{
+		config:  config,
+		buckets: make(map[rateBucketKey]*rateBucket),
+		quotas:  make(map[string]*quotaUsage),
+		slots:   make(map[string]chan struct{}),
+	}
+	for pattern, limit := range config.Methods {
+		if limit.Concurrent > 0 {
+			l.slots[pattern] = make(chan struct{}, limit.Concurrent)
+		}
+	}
+	return l
+}
+
+// match returns the configured pattern governing the given method, preferring an
+// exact match over the longest matching prefix over the catch-all.
+func (l *Limiter) match(method string) (string, MethodLimit, bool) {
+	if len(l.config.Methods) == 0 {
+		return "", MethodLimit{}, false
+	}
+	if limit, ok := l.config.Methods[method]; ok {
+		return method, limit, true
+	}
+	var (
+		best  string
+		limit MethodLimit
+		found bool
+	)
+	for pattern, lim := range l.config.Methods {
+		if !strings.HasSuffix(pattern, "*") {
+			continue
+		}
+		prefix := strings.TrimSuffix(pattern, "*")
+		if strings.HasPrefix(method, prefix) && (!found || len(pattern) > len(best)) {
+			best, limit, found = pattern, lim, true
+		}
+	}
+	return best, limit, found
+}
+
+// acquire checks whether the given client may call the method right now. On
+// success, the returned function must be called once the call has finished.
+//
+// The daily quota of the client is only charged once the call passed the rate
+// and concurrency limits, so refused calls don't count against it.
+func (l *Limiter) acquire(key, remote, method string) (func(), error) {
+	var quota uint64
+	if len(l.config.APIKeys) > 0 {
+		var ok bool
+		if quota, ok = l.config.APIKeys[key]; !ok {
+			return nil, &unauthorizedError{}
+		}
+	}
+	client := key
+	if client == "" {
+		client = remoteHost(remote)
+	}
+	release := func() {}
+	if pattern, limit, ok := l.match(method); ok {
+		if limit.Rate > 0 {
+			if delay := l.reserve(client, pattern, limit); delay > 0 {
+				return nil, &limitExceededError{method: method, limit: "rate", retryAfter: delay}
+			}
+		}
+		if slots := l.slots[pattern]; slots != nil {
+			select {
+			case slots <- struct{}{}:
+				release = func() { <-slots }
+			default:
+				return nil, &limitExceededError{method: method, limit: "concurrency"}
+			}
+		}
+	}
+	if quota > 0 && !l.useQuota(key, quota) {
+		release()
+		return nil, &limitExceededError{method: method, limit: "quota", retryAfter: untilTomorrow()}
+	}
+	return release, nil
+}
+
+// reserve takes a token from the client's bucket for the method pattern. If none
+// is available, it returns how long the client has to wait for one.
+func (l *Limiter) reserve(client, pattern string, limit MethodLimit) time.Duration {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	key := rateBucketKey{client: client, pattern: pattern}
+	bucket := l.buckets[key]
+	if bucket == nil {
+		if len(l.buckets) >= maxRateBuckets {
+			l.pruneBuckets(now)
+		}
+		burst := limit.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = &rateBucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), burst)}
+		l.buckets[key] = bucket
+	}
+	bucket.used = now
+
+	r := bucket.limiter.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return delay
+	}
+	return 0
+}
+
+// pruneBuckets discards the token buckets of clients idle for long enough to have
+// refilled them.
+//
+// Note, this method assumes the limiter lock is held!
+func (l *Limiter) pruneBuckets(now time.Time) {
+	for key, bucket := range l.buckets {
+		refill := time.Duration(float64(bucket.limiter.Burst()) / float64(bucket.limiter.Limit()) * float64(time.Second))
+		if now.Sub(bucket.used) > refill {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// useQuota counts a call against the daily quota of an API key, returning false
+// if the quota is already exhausted.
+func (l *Limiter) useQuota(key string, quota uint64) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	day := time.Now().UTC().Unix() / 86400
+	usage := l.quotas[key]
+	if usage == nil || usage.day != day {
+		usage = &quotaUsage{day: day}
+		l.quotas[key] = usage
+	}
+	if usage.calls >= quota {
+		return false
+	}
+	usage.calls++
+	return true
+}
+
+// untilTomorrow returns the time left until daily quotas are reset.
+func untilTomorrow() time.Duration {
+	now := time.Now().UTC()
+	return now.Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+}
+
+// remoteHost strips the port from a remote address, so that all connections from
+// the same host share their limits.
+func remoteHost(remote string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		return host
+	}
+	return remote
+}
+
+// requestAPIKey returns the API key presented with an HTTP request, if any.
+func requestAPIKey(r *http.Request) string {
+	return r.Header.Get(apiKeyHeader)
+}
@@ -18,6 +18,7 @@ package rpc
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ethereum/go-ethereum/metrics"
 )
@@ -37,3 +38,45 @@ func newRPCServingTimer(method string, valid bool) metrics.Timer {
 	m := fmt.Sprintf("rpc/duration/%s/%s", method, flag)
 	return metrics.GetOrRegisterTimer(m, nil)
 }
+
+// rpcSampler creates the sample backing the per-method histograms.
+func rpcSampler() metrics.Sample {
+	return metrics.NewExpDecaySample(1028, 0.015)
+}
+
+// newRPCLatencyHistogram returns the histogram of the execution time of a method,
+// in microseconds.
+func newRPCLatencyHistogram(method string) metrics.Histogram {
+	return metrics.GetOrRegisterHistogramLazy("rpc/latency/"+method, nil, rpcSampler)
+}
+
+// newRPCResponseSizeHistogram returns the histogram of the serialized result size
+// of a method, in bytes.
+func newRPCResponseSizeHistogram(method string) metrics.Histogram {
+	return metrics.GetOrRegisterHistogramLazy("rpc/size/"+method, nil, rpcSampler)
+}
+
+// newRPCInflightGauge returns the gauge of the calls of a method being executed.
+func newRPCInflightGauge(method string) metrics.Gauge {
+	return metrics.GetOrRegisterGauge("rpc/inflight/"+method, nil)
+}
+
+// newRPCErrorCounter returns the counter of the errors with the given code returned
+// by a method. Metric names may not contain '-', so the (conventionally negative)
+// code is recorded without its sign.
+func newRPCErrorCounter(method string, code int) metrics.Counter {
+	if code < 0 {
+		code = -code
+	}
+	return metrics.GetOrRegisterCounter(fmt.Sprintf("rpc/errors/%s/%d", method, code), nil)
+}
+
+// updateRPCMetrics records the outcome of a call in the per-method metrics.
+func updateRPCMetrics(method string, resp *jsonrpcMessage, elapsed time.Duration) {
+	newRPCLatencyHistogram(method).Update(elapsed.Microseconds())
+	if resp.Error != nil {
+		newRPCErrorCounter(method, resp.Error.Code).Inc(1)
+		return
+	}
+	newRPCResponseSizeHistogram(method).Update(int64(len(resp.Result)))
+}
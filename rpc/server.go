@@ -46,6 +46,9 @@ type Server struct {
 	idgen    func() ID
 	run      int32
 	codecs   mapset.Set
+
+	limiter *Limiter
+	exec    ExecutionLimits
 }
 
 // NewServer creates a new server instance with no registered handlers.
@@ -66,6 +69,19 @@ func (s *Server) RegisterName(name string, receiver interface{}) error {
 	return s.services.registerName(name, receiver)
 }
 
+// SetLimiter configures the API keys accepted by the server and the limits applied
+// to the calls it serves. The limiter may be shared by several servers. It must be
+// called before the server starts serving.
+func (s *Server) SetLimiter(limiter *Limiter) {
+	s.limiter = limiter
+}
+
+// SetExecutionLimits configures the maximum batch length, response size and call
+// execution time of the server. It must be called before the server starts serving.
+func (s *Server) SetExecutionLimits(limits ExecutionLimits) {
+	s.exec = limits
+}
+
 // ServeCodec reads incoming requests from codec, calls the appropriate callback and writes
 // the response back using the given codec. It will block until the codec is closed or the
 // server is stopped. In either case the codec is closed.
@@ -83,7 +99,7 @@ func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
 	s.codecs.Add(codec)
 	defer s.codecs.Remove(codec)
 
-	c := initClient(codec, s.idgen, &s.services)
+	c := initClient(codec, s.idgen, &s.services, s.limiter, s.exec)
 	<-codec.closed()
 	c.Close()
 }
@@ -97,7 +113,7 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 		return
 	}
 
-	h := newHandler(ctx, codec, s.idgen, &s.services)
+	h := newHandler(ctx, codec, s.idgen, &s.services, s.limiter, s.exec)
 	h.allowSubscribe = false
 	defer h.close(io.EOF, nil)
 
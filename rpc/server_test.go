@@ -19,13 +19,18 @@ package rpc
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
 func TestServerRegisterName(t *testing.T) {
@@ -45,7 +50,7 @@ func TestServerRegisterName(t *testing.T) {
 		t.Fatalf("Expected service calc to be registered")
 	}
 
-	wantCallbacks := 9
+	wantCallbacks := 10
 	if len(svc.callbacks) != wantCallbacks {
 		t.Errorf("Expected %d callbacks for service 'service', got %d", wantCallbacks, len(svc.callbacks))
 	}
@@ -150,3 +155,166 @@ func TestServerShortLivedConn(t *testing.T) {
 		}
 	}
 }
+
+// Tests that batch length, response size and execution time limits are enforced
+// and reported with their dedicated error codes.
+func TestServerExecutionLimits(t *testing.T) {
+	server := newTestServer()
+	defer server.Stop()
+	server.SetExecutionLimits(ExecutionLimits{
+		BatchItems:    3,
+		ResponseBytes: 100,
+		CallTimeout:   100 * time.Millisecond,
+	})
+	client := DialInProc(server)
+	defer client.Close()
+
+	checkCode := func(err error, code int) {
+		t.Helper()
+		rpcErr, ok := err.(Error)
+		if !ok {
+			t.Fatalf("expected RPC error with code %d, got %v", code, err)
+		}
+		if rpcErr.ErrorCode() != code {
+			t.Fatalf("wrong error code %d, want %d", rpcErr.ErrorCode(), code)
+		}
+	}
+	// Calls exceeding the execution timeout are aborted.
+	checkCode(client.Call(nil, "test_block"), -32009)
+
+	// Single responses over the size limit are replaced with an error.
+	var r echoResult
+	if err := client.Call(&r, "test_echo", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	checkCode(client.Call(&r, "test_echo", strings.Repeat("x", 100), 1), -32008)
+
+	// Batches over the length limit are refused as a whole.
+	batch := make([]BatchElem, 4)
+	for i := range batch {
+		batch[i] = BatchElem{Method: "test_echo", Args: []interface{}{"x", i}, Result: new(echoResult)}
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, elem := range batch {
+		checkCode(elem.Error, -32007)
+	}
+
+	// Calls past the batch response size limit are not executed.
+	batch = batch[:3]
+	for i := range batch {
+		batch[i].Error = nil
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatal(err)
+	}
+	if batch[0].Error != nil || batch[1].Error != nil {
+		t.Fatalf("unexpected errors: %v, %v", batch[0].Error, batch[1].Error)
+	}
+	checkCode(batch[2].Error, -32008)
+}
+
+// Tests that per-method metrics are recorded for registered methods only.
+func TestServerMethodMetrics(t *testing.T) {
+	enabled := metrics.Enabled
+	metrics.Enabled = true
+	defer func() { metrics.Enabled = enabled }()
+
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	var r echoResult
+	if err := client.Call(&r, "test_echo", "x", 1); err != nil {
+		t.Fatal(err)
+	}
+	client.Call(nil, "test_returnError")
+	client.Call(nil, "test_madeUp")
+
+	if h, ok := metrics.DefaultRegistry.Get("rpc/latency/test_echo").(metrics.Histogram); !ok || h.Count() != 1 {
+		t.Errorf("latency of test_echo not recorded")
+	}
+	if h, ok := metrics.DefaultRegistry.Get("rpc/size/test_echo").(metrics.Histogram); !ok || h.Count() != 1 {
+		t.Errorf("response size of test_echo not recorded")
+	}
+	if g, ok := metrics.DefaultRegistry.Get("rpc/inflight/test_echo").(metrics.Gauge); !ok || g.Value() != 0 {
+		t.Errorf("in-flight calls of test_echo not tracked")
+	}
+	if c, ok := metrics.DefaultRegistry.Get("rpc/errors/test_returnError/444").(metrics.Counter); !ok || c.Count() != 1 {
+		t.Errorf("error of test_returnError not counted")
+	}
+	if metrics.DefaultRegistry.Get("rpc/latency/test_madeUp") != nil {
+		t.Errorf("metrics recorded for unknown method")
+	}
+}
+
+// Tests that size limited encoding produces the same output as encoding/json and
+// refuses results exceeding the limit.
+func TestEncodeLimited(t *testing.T) {
+	results := []interface{}{
+		nil,
+		"string",
+		[]int(nil),
+		[]int{},
+		[]int{1, 2, 3},
+		&[]string{"a", "b"},
+		[2]echoResult{{String: "x"}, {Int: 1}},
+		[]byte{1, 2, 3},
+		[]*echoResult{{String: "<html>"}, nil},
+		[]json.RawMessage{json.RawMessage(`{"a":1}`)},
+	}
+	for i, result := range results {
+		want, err := json.Marshal(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := encodeLimited(result, len(want))
+		if err != nil {
+			t.Fatalf("result %d: encoding failed: %v", i, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("result %d: encoding mismatch: have %s, want %s", i, have, want)
+		}
+		if _, err := encodeLimited(result, len(want)-1); err != errResponseTooLarge {
+			t.Fatalf("result %d: oversized encoding not refused: %v", i, err)
+		}
+	}
+}
+
+// Tests that slow calls are logged on servers without any limits or limiter.
+func TestServerSlowLog(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		logged []string
+	)
+	root := log.Root().GetHandler()
+	defer log.Root().SetHandler(root)
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Msg == "Slow RPC request" {
+			lock.Lock()
+			logged = append(logged, r.Ctx[1].(string))
+			lock.Unlock()
+		}
+		return nil
+	}))
+
+	server := newTestServer()
+	defer server.Stop()
+	server.SetExecutionLimits(ExecutionLimits{SlowThreshold: 50 * time.Millisecond})
+	client := DialInProc(server)
+	defer client.Close()
+
+	if err := client.Call(nil, "test_sleep", 100*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(nil, "test_noArgsRets"); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(logged) != 1 || logged[0] != "test_sleep" {
+		t.Fatalf("wrong slow calls logged: %v", logged)
+	}
+}
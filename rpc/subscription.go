@@ -99,6 +99,7 @@ type Notifier struct {
 	buffer       []json.RawMessage
 	callReturned bool
 	activated    bool
+	closed       *jsonError // Error the subscription was closed with, if any
 }
 
 // CreateSubscription returns a new subscription that is coupled to the
@@ -134,6 +135,9 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	} else if n.sub.ID != id {
 		panic("Notify with wrong ID")
 	}
+	if n.closed != nil {
+		return ErrSubscriptionNotFound
+	}
 	if n.activated {
 		return n.send(n.sub, enc)
 	}
@@ -141,6 +145,36 @@ func (n *Notifier) Notify(id ID, data interface{}) error {
 	return nil
 }
 
+// Close ends the subscription with the given error. The client is sent a final
+// notification carrying the error instead of a result, which ends the subscription
+// on its side too. Later notifications and unsubscribe requests are refused.
+func (n *Notifier) Close(id ID, err error) error {
+	n.mu.Lock()
+	if n.sub == nil {
+		n.mu.Unlock()
+		panic("can't Close before subscription is created")
+	} else if n.sub.ID != id {
+		n.mu.Unlock()
+		panic("Close with wrong ID")
+	}
+	if n.closed != nil {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = errorMessage(err).Error
+
+	var sendErr error
+	if n.activated {
+		sendErr = n.sendClose(n.sub)
+	}
+	n.mu.Unlock()
+
+	// The subscription is only tracked by the connection once the subscribe call
+	// returned, a closed one is not handed over anymore if that's yet to happen.
+	n.h.removeSubscription(id)
+	return sendErr
+}
+
 // Closed returns a channel that is closed when the RPC connection is closed.
 // Deprecated: use subscription error channel
 func (n *Notifier) Closed() <-chan interface{} {
@@ -153,6 +187,9 @@ func (n *Notifier) takeSubscription() *Subscription {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 	n.callReturned = true
+	if n.closed != nil {
+		return nil
+	}
 	return n.sub
 }
 
@@ -169,6 +206,9 @@ func (n *Notifier) activate() error {
 		}
 	}
 	n.activated = true
+	if n.closed != nil {
+		return n.sendClose(n.sub)
+	}
 	return nil
 }
 
@@ -182,6 +222,17 @@ func (n *Notifier) send(sub *Subscription, data json.RawMessage) error {
 	})
 }
 
+// sendClose sends the final notification of a subscription closed by the server.
+func (n *Notifier) sendClose(sub *Subscription) error {
+	params, _ := json.Marshal(&subscriptionResult{ID: string(sub.ID), Error: n.closed})
+	ctx := context.Background()
+	return n.h.conn.writeJSON(ctx, &jsonrpcMessage{
+		Version: vsn,
+		Method:  n.namespace + notificationMethodSuffix,
+		Params:  params,
+	})
+}
+
 // A Subscription is created by a notifier and tied to that notifier. The client can use
 // this subscription to wait for an unsubscribe request for the client, see Err().
 type Subscription struct {
@@ -344,6 +395,10 @@ func (sub *ClientSubscription) forward() (unsubscribeServer bool, err error) {
 				// Exiting because Unsubscribe was called, unsubscribe on server.
 				return true, nil
 			}
+			if closed, ok := err.(*jsonError); ok {
+				// Closed by the server, which already forgot the subscription.
+				return false, sub.drain(buffer, closed)
+			}
 			return false, err
 
 		case 1: // <-sub.in
@@ -363,6 +418,27 @@ func (sub *ClientSubscription) forward() (unsubscribeServer bool, err error) {
 	}
 }
 
+// drain delivers the notifications received before the server closed the
+// subscription, returning the error it was closed with. It gives up early if
+// Unsubscribe is called or the client is closed meanwhile.
+func (sub *ClientSubscription) drain(buffer *list.List, closed error) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(sub.quit)},
+		{Dir: reflect.SelectSend, Chan: sub.channel},
+	}
+	for buffer.Len() > 0 {
+		cases[1].Send = reflect.ValueOf(buffer.Front().Value)
+		if chosen, recv, _ := reflect.Select(cases); chosen == 0 {
+			if recv.IsNil() || recv.Interface().(error) == errUnsubscribed {
+				return nil
+			}
+			return recv.Interface().(error)
+		}
+		buffer.Remove(buffer.Front())
+	}
+	return closed
+}
+
 func (sub *ClientSubscription) unmarshal(result json.RawMessage) (interface{}, error) {
 	val := reflect.New(sub.etype)
 	err := json.Unmarshal(result, val.Interface())
@@ -0,0 +1,648 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Node types of the binary trie, the first byte of their encoding.
+const (
+	binaryLeafTag   = 0x00 // binaryLeafTag + key (32 bytes) + value
+	binaryBranchTag = 0x01 // binaryBranchTag + left child hash + right child hash
+)
+
+// binaryNode is a node of a binary trie. It's either a *binaryBranch, a
+// *binaryLeaf, a binaryHash referencing a node not yet loaded from the database,
+// or nil for an empty subtrie.
+type binaryNode interface{}
+
+// binaryFlags contains the caching related metadata of a binary trie node.
+type binaryFlags struct {
+	hash  *common.Hash // Cached hash of the node, nil if not computed yet
+	dirty bool         // Whether the node has changes not yet written to the database
+}
+
+// binaryBranch is an inner node of the binary trie, with a child for both values
+// of the next key bit.
+type binaryBranch struct {
+	children [2]binaryNode
+	flags    binaryFlags
+}
+
+// binaryLeaf is a value stored in the binary trie, together with its full key.
+type binaryLeaf struct {
+	key   common.Hash
+	value []byte
+	flags binaryFlags
+}
+
+// binaryHash is a reference to a binary trie node stored in the database.
+type binaryHash common.Hash
+
+// BinaryTrie is an experimental state trie alternative to the Merkle Patricia
+// trie. It's a sparse binary Merkle trie over the keccak256 hashes of the keys,
+// where every leaf is stored at the shallowest depth its key is unique at.
+//
+// The commitment scheme is built on sha256: leaves are hashed together with
+// their key as sha256(0x00 || key || value), inner nodes as
+// sha256(0x01 || left || right), with the zero hash standing for an empty child.
+// The root of the empty trie is the empty Merkle Patricia root, so the state
+// processing can keep treating it as the marker of empty storage.
+//
+// Nodes are keyed by their hash and written straight to disk on commit, so the
+// state is never garbage collected. BinaryTrie is not safe for concurrent use,
+// but copies don't share mutable data.
+type BinaryTrie struct {
+	root binaryNode
+	db   *Database
+
+	secKeyCache map[string][]byte // Preimages of the keys hashed since the last commit
+}
+
+// NewBinary creates a binary trie with an existing root node from db. If root is
+// the zero hash or the empty root, the trie is initially empty. The database may
+// be nil for a trie built purely in memory.
+func NewBinary(root common.Hash, db *Database) (*BinaryTrie, error) {
+	t := &BinaryTrie{
+		db:          db,
+		secKeyCache: make(map[string][]byte),
+	}
+	if root != (common.Hash{}) && root != emptyRoot {
+		n, err := t.resolve(root, common.Hash{}, 0)
+		if err != nil {
+			return nil, err
+		}
+		t.root = n
+	}
+	return t, nil
+}
+
+// binaryBit returns the bit of the key at the given depth.
+func binaryBit(key common.Hash, depth int) int {
+	return int(key[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+// binaryPath returns the first bits of the key, one bit per byte.
+func binaryPath(key common.Hash, bits int) []byte {
+	path := make([]byte, bits)
+	for i := range path {
+		path[i] = byte(binaryBit(key, i))
+	}
+	return path
+}
+
+// encode returns the database encoding of the leaf.
+func (n *binaryLeaf) encode() []byte {
+	blob := make([]byte, 1+common.HashLength+len(n.value))
+	blob[0] = binaryLeafTag
+	copy(blob[1:], n.key[:])
+	copy(blob[1+common.HashLength:], n.value)
+	return blob
+}
+
+// encode returns the database encoding of the branch. The children must have
+// been hashed already.
+func (n *binaryBranch) encode() []byte {
+	blob := make([]byte, 1+2*common.HashLength)
+	blob[0] = binaryBranchTag
+	for i, child := range n.children {
+		hash := binaryChildHash(child)
+		copy(blob[1+i*common.HashLength:], hash[:])
+	}
+	return blob
+}
+
+// binaryChildHash returns the hash of an already hashed node, or the zero hash
+// for an empty subtrie.
+func binaryChildHash(n binaryNode) common.Hash {
+	switch n := n.(type) {
+	case nil:
+		return common.Hash{}
+	case binaryHash:
+		return common.Hash(n)
+	case *binaryLeaf:
+		return *n.flags.hash
+	case *binaryBranch:
+		return *n.flags.hash
+	default:
+		panic(fmt.Sprintf("%T: invalid binary node: %v", n, n))
+	}
+}
+
+// binaryHashNode computes the hash of a node, returning a copy of it with the
+// hashes of the whole subtrie cached. Shared nodes are never modified.
+func binaryHashNode(n binaryNode) (binaryNode, common.Hash) {
+	switch n := n.(type) {
+	case nil:
+		return nil, common.Hash{}
+	case binaryHash:
+		return n, common.Hash(n)
+	case *binaryLeaf:
+		if n.flags.hash != nil {
+			return n, *n.flags.hash
+		}
+		cpy := *n
+		hash := common.Hash(sha256.Sum256(n.encode()))
+		cpy.flags.hash = &hash
+		return &cpy, hash
+	case *binaryBranch:
+		if n.flags.hash != nil {
+			return n, *n.flags.hash
+		}
+		cpy := *n
+		for i, child := range n.children {
+			cpy.children[i], _ = binaryHashNode(child)
+		}
+		hash := common.Hash(sha256.Sum256(cpy.encode()))
+		cpy.flags.hash = &hash
+		return &cpy, hash
+	default:
+		panic(fmt.Sprintf("%T: invalid binary node: %v", n, n))
+	}
+}
+
+// decodeBinaryNode parses the database encoding of a binary trie node.
+func decodeBinaryNode(hash common.Hash, blob []byte) (binaryNode, error) {
+	switch {
+	case len(blob) >= 1+common.HashLength && blob[0] == binaryLeafTag:
+		return &binaryLeaf{
+			key:   common.BytesToHash(blob[1 : 1+common.HashLength]),
+			value: common.CopyBytes(blob[1+common.HashLength:]),
+			flags: binaryFlags{hash: &hash},
+		}, nil
+	case len(blob) == 1+2*common.HashLength && blob[0] == binaryBranchTag:
+		n := &binaryBranch{flags: binaryFlags{hash: &hash}}
+		for i := range n.children {
+			if child := common.BytesToHash(blob[1+i*common.HashLength : 1+(i+1)*common.HashLength]); child != (common.Hash{}) {
+				n.children[i] = binaryHash(child)
+			}
+		}
+		if n.children[0] == nil && n.children[1] == nil {
+			return nil, fmt.Errorf("empty binary branch %x", hash)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("invalid binary node %x: %x", hash, blob)
+	}
+}
+
+// binaryNode retrieves an encoded binary trie node from the clean cache or from
+// the persistent database.
+func (db *Database) binaryNode(hash common.Hash) []byte {
+	if db.cleans != nil {
+		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
+			return enc
+		}
+	}
+	enc := rawdb.ReadBinaryTrieNode(db.diskdb, hash)
+	if len(enc) != 0 && db.cleans != nil {
+		db.cleans.Set(hash[:], enc)
+	}
+	return enc
+}
+
+// resolve loads the node with the given hash, found on the path of the key at
+// the given depth, from the database.
+func (t *BinaryTrie) resolve(hash common.Hash, key common.Hash, depth int) (binaryNode, error) {
+	var blob []byte
+	if t.db != nil {
+		blob = t.db.binaryNode(hash)
+	}
+	if len(blob) == 0 {
+		return nil, &MissingNodeError{NodeHash: hash, Path: binaryPath(key, depth)}
+	}
+	return decodeBinaryNode(hash, blob)
+}
+
+// hashKey returns the keccak256 hash of the key, the path of its value.
+func (t *BinaryTrie) hashKey(key []byte) common.Hash {
+	return crypto.Keccak256Hash(key)
+}
+
+// GetKey returns the preimage of a hashed key that was previously used to store
+// a value.
+func (t *BinaryTrie) GetKey(shaKey []byte) []byte {
+	if key, ok := t.secKeyCache[string(shaKey)]; ok {
+		return key
+	}
+	if t.db == nil {
+		return nil
+	}
+	return t.db.preimage(common.BytesToHash(shaKey))
+}
+
+// TryGet returns the value for key stored in the trie. The value bytes must not
+// be modified by the caller. If a node was not found in the database, a
+// MissingNodeError is returned.
+func (t *BinaryTrie) TryGet(key []byte) ([]byte, error) {
+	value, newroot, didResolve, err := t.get(t.root, t.hashKey(key), 0)
+	if err == nil && didResolve {
+		t.root = newroot
+	}
+	return value, err
+}
+
+func (t *BinaryTrie) get(n binaryNode, key common.Hash, depth int) ([]byte, binaryNode, bool, error) {
+	switch n := n.(type) {
+	case nil:
+		return nil, nil, false, nil
+	case *binaryLeaf:
+		if n.key == key {
+			return n.value, n, false, nil
+		}
+		return nil, n, false, nil
+	case *binaryBranch:
+		bit := binaryBit(key, depth)
+		value, child, didResolve, err := t.get(n.children[bit], key, depth+1)
+		if err == nil && didResolve {
+			cpy := *n
+			cpy.children[bit] = child
+			return value, &cpy, true, nil
+		}
+		return value, n, didResolve, err
+	case binaryHash:
+		child, err := t.resolve(common.Hash(n), key, depth)
+		if err != nil {
+			return nil, n, true, err
+		}
+		value, newnode, _, err := t.get(child, key, depth)
+		return value, newnode, true, err
+	default:
+		panic(fmt.Sprintf("%T: invalid binary node: %v", n, n))
+	}
+}
+
+// TryUpdate associates key with value in the trie. If value has length zero, any
+// existing value is deleted from the trie. The value bytes must not be modified
+// by the caller while they are stored in the trie. If a node was not found in the
+// database, a MissingNodeError is returned.
+func (t *BinaryTrie) TryUpdate(key, value []byte) error {
+	hash := t.hashKey(key)
+	if err := t.TryUpdateHashed(hash, value); err != nil {
+		return err
+	}
+	if len(value) != 0 {
+		t.secKeyCache[string(hash[:])] = common.CopyBytes(key)
+	}
+	return nil
+}
+
+// TryUpdateHashed is identical to TryUpdate, but the value is stored under the
+// already hashed key, as found in the state snapshot.
+func (t *BinaryTrie) TryUpdateHashed(key common.Hash, value []byte) error {
+	if len(value) == 0 {
+		n, err := t.delete(t.root, key, 0)
+		if err != nil {
+			return err
+		}
+		t.root = n
+		return nil
+	}
+	n, err := t.insert(t.root, key, value, 0)
+	if err != nil {
+		return err
+	}
+	t.root = n
+	return nil
+}
+
+func (t *BinaryTrie) insert(n binaryNode, key common.Hash, value []byte, depth int) (binaryNode, error) {
+	switch n := n.(type) {
+	case nil:
+		return &binaryLeaf{key: key, value: value, flags: binaryFlags{dirty: true}}, nil
+	case *binaryLeaf:
+		if n.key == key {
+			if bytes.Equal(n.value, value) {
+				return n, nil
+			}
+			return &binaryLeaf{key: key, value: value, flags: binaryFlags{dirty: true}}, nil
+		}
+		// Push the existing leaf down until the two keys diverge
+		branch := &binaryBranch{flags: binaryFlags{dirty: true}}
+		if have, want := binaryBit(n.key, depth), binaryBit(key, depth); have != want {
+			branch.children[have] = n
+			branch.children[want] = &binaryLeaf{key: key, value: value, flags: binaryFlags{dirty: true}}
+			return branch, nil
+		}
+		child, err := t.insert(n, key, value, depth+1)
+		if err != nil {
+			return n, err
+		}
+		branch.children[binaryBit(key, depth)] = child
+		return branch, nil
+	case *binaryBranch:
+		bit := binaryBit(key, depth)
+		child, err := t.insert(n.children[bit], key, value, depth+1)
+		if err != nil || child == n.children[bit] {
+			return n, err
+		}
+		cpy := *n
+		cpy.children[bit] = child
+		cpy.flags = binaryFlags{dirty: true}
+		return &cpy, nil
+	case binaryHash:
+		rn, err := t.resolve(common.Hash(n), key, depth)
+		if err != nil {
+			return n, err
+		}
+		return t.insert(rn, key, value, depth)
+	default:
+		panic(fmt.Sprintf("%T: invalid binary node: %v", n, n))
+	}
+}
+
+// TryDelete removes any existing value for key from the trie. If a node was not
+// found in the database, a MissingNodeError is returned.
+func (t *BinaryTrie) TryDelete(key []byte) error {
+	hash := t.hashKey(key)
+	delete(t.secKeyCache, string(hash[:]))
+	return t.TryUpdateHashed(hash, nil)
+}
+
+func (t *BinaryTrie) delete(n binaryNode, key common.Hash, depth int) (binaryNode, error) {
+	switch n := n.(type) {
+	case nil:
+		return nil, nil
+	case *binaryLeaf:
+		if n.key == key {
+			return nil, nil
+		}
+		return n, nil
+	case *binaryBranch:
+		bit := binaryBit(key, depth)
+		child, err := t.delete(n.children[bit], key, depth+1)
+		if err != nil || child == n.children[bit] {
+			return n, err
+		}
+		cpy := *n
+		cpy.children[bit] = child
+		cpy.flags = binaryFlags{dirty: true}
+
+		// Pull up the remaining leaf if it's the only one left below the branch,
+		// keeping every leaf at the shallowest depth its key is unique at
+		sibling := cpy.children[1-bit]
+		if child == nil {
+			if sibling == nil {
+				return nil, nil
+			}
+			if hash, ok := sibling.(binaryHash); ok {
+				path := binaryPath(key, depth+1)
+				path[depth] = byte(1 - bit)
+				if sibling, err = t.resolve(common.Hash(hash), common.Hash{}, 0); err != nil {
+					if missing, ok := err.(*MissingNodeError); ok {
+						missing.Path = path
+					}
+					return n, err
+				}
+				cpy.children[1-bit] = sibling
+			}
+			if leaf, ok := sibling.(*binaryLeaf); ok {
+				return leaf, nil
+			}
+		} else if sibling == nil {
+			if leaf, ok := child.(*binaryLeaf); ok {
+				return leaf, nil
+			}
+		}
+		return &cpy, nil
+	case binaryHash:
+		rn, err := t.resolve(common.Hash(n), key, depth)
+		if err != nil {
+			return n, err
+		}
+		return t.delete(rn, key, depth)
+	default:
+		panic(fmt.Sprintf("%T: invalid binary node: %v", n, n))
+	}
+}
+
+// Hash returns the root hash of the trie. It does not write to the database and
+// can be used even if the trie doesn't have one.
+func (t *BinaryTrie) Hash() common.Hash {
+	if t.root == nil {
+		return emptyRoot
+	}
+	var hash common.Hash
+	t.root, hash = binaryHashNode(t.root)
+	return hash
+}
+
+// Commit writes all the changed nodes of the trie straight into the persistent
+// database, together with the preimages of the updated keys. The onleaf callback
+// is invoked with every written leaf.
+func (t *BinaryTrie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
+	if t.db == nil {
+		return common.Hash{}, 0, errors.New("binary trie without database")
+	}
+	// Write all the pre-images to the actual disk database
+	if len(t.secKeyCache) > 0 {
+		if t.db.preimages != nil {
+			t.db.lock.Lock()
+			for hk, key := range t.secKeyCache {
+				t.db.insertPreimage(common.BytesToHash([]byte(hk)), key)
+			}
+			t.db.lock.Unlock()
+		}
+		t.secKeyCache = make(map[string][]byte)
+	}
+	root := t.Hash()
+	if t.root == nil {
+		return root, 0, nil
+	}
+	batch := t.db.diskdb.NewBatch()
+	n, committed, err := t.commit(t.root, batch, onleaf, common.Hash{})
+	if err != nil {
+		return common.Hash{}, 0, err
+	}
+	if err := batch.Write(); err != nil {
+		return common.Hash{}, 0, err
+	}
+	t.root = n
+	return root, committed, nil
+}
+
+// commit writes the dirty nodes of an already hashed subtrie into the database,
+// returning a copy of it with the nodes marked clean.
+func (t *BinaryTrie) commit(n binaryNode, w ethdb.KeyValueWriter, onleaf LeafCallback, parent common.Hash) (binaryNode, int, error) {
+	switch n := n.(type) {
+	case *binaryLeaf:
+		if !n.flags.dirty {
+			return n, 0, nil
+		}
+		t.write(w, *n.flags.hash, n.encode())
+		if onleaf != nil {
+			if err := onleaf(nil, nil, n.value, parent); err != nil {
+				return n, 0, err
+			}
+		}
+		cpy := *n
+		cpy.flags.dirty = false
+		return &cpy, 1, nil
+	case *binaryBranch:
+		if !n.flags.dirty {
+			return n, 0, nil
+		}
+		var (
+			cpy       = *n
+			committed = 1
+		)
+		for i, child := range n.children {
+			child, count, err := t.commit(child, w, onleaf, *n.flags.hash)
+			if err != nil {
+				return n, 0, err
+			}
+			cpy.children[i] = child
+			committed += count
+		}
+		t.write(w, *n.flags.hash, n.encode())
+		cpy.flags.dirty = false
+		return &cpy, committed, nil
+	default:
+		return n, 0, nil
+	}
+}
+
+// write stores an encoded node into the database and the clean cache.
+func (t *BinaryTrie) write(w ethdb.KeyValueWriter, hash common.Hash, blob []byte) {
+	rawdb.WriteBinaryTrieNode(w, hash, blob)
+	if t.db.cleans != nil {
+		t.db.cleans.Set(hash[:], blob)
+	}
+}
+
+// CommittedNodes always returns nil, binary tries are never backed by a path
+// based database.
+func (t *BinaryTrie) CommittedNodes() *NodeSet {
+	return nil
+}
+
+// Copy returns a copy of BinaryTrie.
+func (t *BinaryTrie) Copy() *BinaryTrie {
+	cpy := &BinaryTrie{
+		root:        t.root,
+		db:          t.db,
+		secKeyCache: make(map[string][]byte, len(t.secKeyCache)),
+	}
+	for hk, key := range t.secKeyCache {
+		cpy.secKeyCache[hk] = key
+	}
+	return cpy
+}
+
+// Prove constructs a proof for the value at the given hashed key. The result
+// contains the encodings of all the nodes on the path to the key, keyed by their
+// hash, starting at the root unless fromLevel nodes are to be skipped. If the
+// trie doesn't contain the key, the last node proves its absence by being a leaf
+// of another key or a branch missing the next child on the path.
+func (t *BinaryTrie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	if len(key) != common.HashLength {
+		return fmt.Errorf("invalid binary trie key length %d", len(key))
+	}
+	var (
+		hash  = common.BytesToHash(key)
+		nodes []binaryNode
+		n     binaryNode
+	)
+	t.Hash()
+	n = t.root
+	for depth := 0; n != nil; depth++ {
+		if ref, ok := n.(binaryHash); ok {
+			rn, err := t.resolve(common.Hash(ref), hash, depth)
+			if err != nil {
+				return err
+			}
+			n = rn
+		}
+		nodes = append(nodes, n)
+
+		branch, ok := n.(*binaryBranch)
+		if !ok {
+			break
+		}
+		n = branch.children[binaryBit(hash, depth)]
+	}
+	for i, n := range nodes {
+		if uint(i) < fromLevel {
+			continue
+		}
+		var blob []byte
+		switch n := n.(type) {
+		case *binaryLeaf:
+			blob = n.encode()
+		case *binaryBranch:
+			blob = n.encode()
+		}
+		if err := proofDb.Put(binaryChildHash(n).Bytes(), blob); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyBinaryProof checks a binary trie proof constructed by Prove against the
+// given root hash, returning the value stored at the hashed key, or nil if the
+// proof shows the key is missing from the trie.
+func VerifyBinaryProof(rootHash common.Hash, key []byte, proofDb ethdb.KeyValueReader) ([]byte, error) {
+	if len(key) != common.HashLength {
+		return nil, fmt.Errorf("invalid binary trie key length %d", len(key))
+	}
+	if rootHash == emptyRoot {
+		return nil, nil
+	}
+	var (
+		hash = common.BytesToHash(key)
+		want = rootHash
+	)
+	for depth := 0; depth <= 8*common.HashLength; depth++ {
+		blob, _ := proofDb.Get(want[:])
+		if blob == nil {
+			return nil, fmt.Errorf("proof node %d (hash %064x) missing", depth, want)
+		}
+		if have := common.Hash(sha256.Sum256(blob)); have != want {
+			return nil, fmt.Errorf("proof node %d hash mismatch: have %x, want %x", depth, have, want)
+		}
+		n, err := decodeBinaryNode(want, blob)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", depth, err)
+		}
+		switch n := n.(type) {
+		case *binaryLeaf:
+			if n.key != hash {
+				return nil, nil
+			}
+			return n.value, nil
+		case *binaryBranch:
+			child := n.children[binaryBit(hash, depth)]
+			if child == nil {
+				return nil, nil
+			}
+			want = common.Hash(child.(binaryHash))
+		}
+	}
+	log.Debug("Binary trie proof too deep", "root", rootHash, "key", hash)
+	return nil, errors.New("binary trie proof too deep")
+}
@@ -0,0 +1,206 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+)
+
+// binaryIteratorState represents the iteration state at one particular node of
+// the binary trie.
+type binaryIteratorState struct {
+	hash   common.Hash // Hash of the node being iterated
+	node   binaryNode  // Resolved trie node being iterated
+	parent common.Hash // Hash of the parent node (zero if current is the root)
+	index  int         // Child to be processed next
+	path   []byte      // Bit path of the node's position in the trie
+}
+
+// binaryNodeIterator is a NodeIterator over the nodes of a binary trie, in
+// pre-order. Leaves report their full key as their path, so that they compare
+// equal across tries regardless of the depth they are stored at.
+type binaryNodeIterator struct {
+	trie    *BinaryTrie
+	start   []byte // Bit path of the key to start iterating at
+	stack   []*binaryIteratorState
+	started bool
+	err     error
+}
+
+// NodeIterator returns an iterator that returns nodes of the trie. Iteration
+// starts at the key after the given start key.
+func (t *BinaryTrie) NodeIterator(start []byte) NodeIterator {
+	t.Hash()
+
+	var key common.Hash
+	copy(key[:], start)
+	return &binaryNodeIterator{
+		trie:  t.Copy(),
+		start: binaryPath(key, 8*common.HashLength),
+	}
+}
+
+// open resolves a node reached at the given position into an iterator state.
+func (it *binaryNodeIterator) open(n binaryNode, parent common.Hash, path []byte) (*binaryIteratorState, error) {
+	if ref, ok := n.(binaryHash); ok {
+		var key common.Hash
+		for i, bit := range path {
+			key[i/8] |= bit << (7 - uint(i%8))
+		}
+		rn, err := it.trie.resolve(common.Hash(ref), key, len(path))
+		if err != nil {
+			return nil, err
+		}
+		n = rn
+	}
+	return &binaryIteratorState{
+		hash:   binaryChildHash(n),
+		node:   n,
+		parent: parent,
+		path:   path,
+	}, nil
+}
+
+func (it *binaryNodeIterator) Next(descend bool) bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if it.trie.root == nil {
+			return false
+		}
+		state, err := it.open(it.trie.root, common.Hash{}, nil)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.stack = append(it.stack, state)
+		return true
+	}
+	if !descend && len(it.stack) > 0 {
+		it.stack[len(it.stack)-1].index = len(binaryBranch{}.children)
+	}
+	for len(it.stack) > 0 {
+		top := it.stack[len(it.stack)-1]
+		if branch, ok := top.node.(*binaryBranch); ok {
+			for top.index < len(branch.children) {
+				i := top.index
+				top.index++
+
+				child := branch.children[i]
+				if child == nil {
+					continue
+				}
+				path := append(common.CopyBytes(top.path), byte(i))
+				if bytes.Compare(path, it.start[:len(path)]) < 0 {
+					continue // subtrie entirely before the start key
+				}
+				state, err := it.open(child, top.hash, path)
+				if err != nil {
+					it.err = err
+					return false
+				}
+				if leaf, ok := state.node.(*binaryLeaf); ok && bytes.Compare(binaryPath(leaf.key, len(it.start)), it.start) < 0 {
+					continue
+				}
+				it.stack = append(it.stack, state)
+				return true
+			}
+		}
+		it.stack = it.stack[:len(it.stack)-1]
+	}
+	return false
+}
+
+func (it *binaryNodeIterator) Error() error {
+	return it.err
+}
+
+func (it *binaryNodeIterator) Hash() common.Hash {
+	if len(it.stack) == 0 {
+		return common.Hash{}
+	}
+	return it.stack[len(it.stack)-1].hash
+}
+
+func (it *binaryNodeIterator) Parent() common.Hash {
+	if len(it.stack) == 0 {
+		return common.Hash{}
+	}
+	return it.stack[len(it.stack)-1].parent
+}
+
+func (it *binaryNodeIterator) Path() []byte {
+	if len(it.stack) == 0 {
+		return nil
+	}
+	top := it.stack[len(it.stack)-1]
+	if leaf, ok := top.node.(*binaryLeaf); ok {
+		return binaryPath(leaf.key, 8*common.HashLength)
+	}
+	return top.path
+}
+
+func (it *binaryNodeIterator) Leaf() bool {
+	if len(it.stack) == 0 {
+		return false
+	}
+	_, ok := it.stack[len(it.stack)-1].node.(*binaryLeaf)
+	return ok
+}
+
+func (it *binaryNodeIterator) LeafKey() []byte {
+	if len(it.stack) > 0 {
+		if leaf, ok := it.stack[len(it.stack)-1].node.(*binaryLeaf); ok {
+			return leaf.key[:]
+		}
+	}
+	panic("not at leaf")
+}
+
+func (it *binaryNodeIterator) LeafBlob() []byte {
+	if len(it.stack) > 0 {
+		if leaf, ok := it.stack[len(it.stack)-1].node.(*binaryLeaf); ok {
+			return leaf.value
+		}
+	}
+	panic("not at leaf")
+}
+
+func (it *binaryNodeIterator) LeafProof() [][]byte {
+	if !it.Leaf() {
+		panic("not at leaf")
+	}
+	proofs := make([][]byte, 0, len(it.stack))
+	for _, state := range it.stack {
+		switch n := state.node.(type) {
+		case *binaryBranch:
+			proofs = append(proofs, n.encode())
+		case *binaryLeaf:
+			proofs = append(proofs, n.encode())
+		}
+	}
+	return proofs
+}
+
+// AddResolver is a no-op, binary trie nodes are only ever loaded from the trie's
+// own database.
+func (it *binaryNodeIterator) AddResolver(ethdb.KeyValueStore) {}
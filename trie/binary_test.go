@@ -0,0 +1,259 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+func newBinaryDatabase() *Database {
+	return NewDatabaseWithConfig(memorydb.New(), &Config{Scheme: rawdb.BinaryScheme, Preimages: true})
+}
+
+// makeBinaryEntries creates a set of random keys and values.
+func makeBinaryEntries(n int) map[string]string {
+	entries := make(map[string]string)
+	for i := 0; i < n; i++ {
+		entries[fmt.Sprintf("key-%d", i)] = fmt.Sprintf("value-%d-%d", i, rand.Int())
+	}
+	return entries
+}
+
+func TestBinaryEmpty(t *testing.T) {
+	tr, _ := NewBinary(common.Hash{}, nil)
+	if root := tr.Hash(); root != emptyRoot {
+		t.Fatalf("empty root mismatch: have %x, want %x", root, emptyRoot)
+	}
+	tr.TryUpdate([]byte("key"), []byte("value"))
+	tr.TryDelete([]byte("key"))
+	if root := tr.Hash(); root != emptyRoot {
+		t.Fatalf("emptied root mismatch: have %x, want %x", root, emptyRoot)
+	}
+}
+
+// Tests that the root of a binary trie only depends on its content, not on the
+// order of the insertions and deletions that built it.
+func TestBinaryOrderIndependence(t *testing.T) {
+	entries := makeBinaryEntries(500)
+
+	// Build the trie from the final content directly
+	want, _ := NewBinary(common.Hash{}, nil)
+	for key, val := range entries {
+		if err := want.TryUpdate([]byte(key), []byte(val)); err != nil {
+			t.Fatalf("failed to insert %q: %v", key, err)
+		}
+	}
+	// Build it again in a different order, with junk inserted and removed
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	have, _ := NewBinary(common.Hash{}, nil)
+	for i, key := range keys {
+		have.TryUpdate([]byte(key), []byte("junk"))
+		if i%3 == 0 {
+			have.TryUpdate([]byte("extra-"+key), []byte("junk"))
+		}
+	}
+	for i, key := range keys {
+		have.TryUpdate([]byte(key), []byte(entries[key]))
+		if i%3 == 0 {
+			have.TryDelete([]byte("extra-" + key))
+		}
+	}
+	if have.Hash() != want.Hash() {
+		t.Fatalf("root mismatch: have %x, want %x", have.Hash(), want.Hash())
+	}
+	for key, val := range entries {
+		blob, err := have.TryGet([]byte(key))
+		if err != nil || string(blob) != val {
+			t.Fatalf("value mismatch for %q: have %q (%v), want %q", key, blob, err, val)
+		}
+	}
+}
+
+func TestBinaryCommitAndReopen(t *testing.T) {
+	var (
+		db      = newBinaryDatabase()
+		entries = makeBinaryEntries(300)
+	)
+	tr, _ := NewBinary(common.Hash{}, db)
+	for key, val := range entries {
+		tr.TryUpdate([]byte(key), []byte(val))
+	}
+	var leaves int
+	root, _, err := tr.Commit(func(_ [][]byte, _ []byte, leaf []byte, _ common.Hash) error {
+		leaves++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if leaves != len(entries) {
+		t.Fatalf("leaf callback count mismatch: have %d, want %d", leaves, len(entries))
+	}
+	// Flush the preimages and reopen the trie on a fresh database without any
+	// cached nodes
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit database: %v", err)
+	}
+	db = NewDatabaseWithConfig(db.DiskDB(), &Config{Scheme: rawdb.BinaryScheme, Preimages: true})
+	tr, err = NewBinary(root, db)
+	if err != nil {
+		t.Fatalf("failed to reopen trie: %v", err)
+	}
+	for key, val := range entries {
+		blob, err := tr.TryGet([]byte(key))
+		if err != nil || string(blob) != val {
+			t.Fatalf("value mismatch for %q: have %q (%v), want %q", key, blob, err, val)
+		}
+		if preimage := tr.GetKey(crypto.Keccak256([]byte(key))); string(preimage) != key {
+			t.Fatalf("preimage mismatch: have %q, want %q", preimage, key)
+		}
+	}
+	// Modify the reopened trie and ensure only the changed nodes are written
+	var deleted int
+	for key := range entries {
+		if deleted == 100 {
+			break
+		}
+		if err := tr.TryDelete([]byte(key)); err != nil {
+			t.Fatalf("failed to delete %q: %v", key, err)
+		}
+		delete(entries, key)
+		deleted++
+	}
+	tr.TryUpdate([]byte("key-new"), []byte("value-new"))
+	entries["key-new"] = "value-new"
+
+	leaves = 0
+	root, _, err = tr.Commit(func(_ [][]byte, _ []byte, leaf []byte, _ common.Hash) error {
+		leaves++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	if leaves >= len(entries) {
+		t.Fatalf("too many leaves committed: have %d, total %d", leaves, len(entries))
+	}
+	want, _ := NewBinary(common.Hash{}, nil)
+	for key, val := range entries {
+		want.TryUpdate([]byte(key), []byte(val))
+	}
+	if root != want.Hash() {
+		t.Fatalf("root mismatch: have %x, want %x", root, want.Hash())
+	}
+	// Missing nodes must be reported as such
+	if _, err := NewBinary(common.HexToHash("0xdeadbeef"), db); err == nil {
+		t.Fatalf("opened trie with missing root")
+	} else if _, ok := err.(*MissingNodeError); !ok {
+		t.Fatalf("unexpected error for missing root: %v", err)
+	}
+}
+
+func TestBinaryProof(t *testing.T) {
+	db := newBinaryDatabase()
+	entries := makeBinaryEntries(200)
+
+	tr, _ := NewBinary(common.Hash{}, db)
+	for key, val := range entries {
+		tr.TryUpdate([]byte(key), []byte(val))
+	}
+	root, _, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	tr, _ = NewBinary(root, db)
+
+	for key, val := range entries {
+		hash := crypto.Keccak256([]byte(key))
+		proof := memorydb.New()
+		if err := tr.Prove(hash, 0, proof); err != nil {
+			t.Fatalf("failed to prove %q: %v", key, err)
+		}
+		blob, err := VerifyBinaryProof(root, hash, proof)
+		if err != nil {
+			t.Fatalf("failed to verify proof of %q: %v", key, err)
+		}
+		if string(blob) != val {
+			t.Fatalf("proven value mismatch for %q: have %q, want %q", key, blob, val)
+		}
+	}
+	// Prove the absence of a missing key
+	hash := crypto.Keccak256([]byte("missing"))
+	proof := memorydb.New()
+	if err := tr.Prove(hash, 0, proof); err != nil {
+		t.Fatalf("failed to prove missing key: %v", err)
+	}
+	if blob, err := VerifyBinaryProof(root, hash, proof); err != nil || blob != nil {
+		t.Fatalf("missing key proof mismatch: have %x (%v)", blob, err)
+	}
+	// A proof against another root must fail
+	if _, err := VerifyBinaryProof(common.HexToHash("0x01"), hash, proof); err == nil {
+		t.Fatalf("proof verified against wrong root")
+	}
+}
+
+func TestBinaryIterator(t *testing.T) {
+	db := newBinaryDatabase()
+	entries := makeBinaryEntries(300)
+
+	tr, _ := NewBinary(common.Hash{}, db)
+	hashes := make([][]byte, 0, len(entries))
+	for key, val := range entries {
+		tr.TryUpdate([]byte(key), []byte(val))
+		hashes = append(hashes, crypto.Keccak256([]byte(key)))
+	}
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i], hashes[j]) < 0 })
+
+	root, _, _ := tr.Commit(nil)
+	tr, _ = NewBinary(root, db)
+
+	for _, start := range []int{0, 1, 150, len(hashes) - 1} {
+		var (
+			it    = NewIterator(tr.NodeIterator(hashes[start]))
+			index = start
+		)
+		for it.Next() {
+			if index >= len(hashes) {
+				t.Fatalf("start %d: iterated past the end", start)
+			}
+			if !bytes.Equal(it.Key, hashes[index]) {
+				t.Fatalf("start %d: key %d mismatch: have %x, want %x", start, index, it.Key, hashes[index])
+			}
+			index++
+		}
+		if it.Err != nil {
+			t.Fatalf("start %d: iteration failed: %v", start, it.Err)
+		}
+		if index != len(hashes) {
+			t.Fatalf("start %d: iterated %d keys, want %d", start, index-start, len(hashes)-start)
+		}
+	}
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"golang.org/x/crypto/sha3"
 )
 
@@ -49,6 +50,11 @@ type committer struct {
 
 	onleaf LeafCallback
 	leafCh chan *leaf
+
+	// Path based databases only: the committed nodes by path and the paths of
+	// the unmodified subtries encountered.
+	nodes *NodeSet
+	clean map[string]struct{}
 }
 
 // committers live in a global sync.Pool
@@ -69,6 +75,8 @@ func newCommitter() *committer {
 func returnCommitterToPool(h *committer) {
 	h.onleaf = nil
 	h.leafCh = nil
+	h.nodes = nil
+	h.clean = nil
 	committerPool.Put(h)
 }
 
@@ -77,7 +85,7 @@ func (c *committer) Commit(n node, db *Database) (hashNode, int, error) {
 	if db == nil {
 		return nil, 0, errors.New("no db provided")
 	}
-	h, committed, err := c.commit(n, db)
+	h, committed, err := c.commit(nil, n, db)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -85,10 +93,11 @@ func (c *committer) Commit(n node, db *Database) (hashNode, int, error) {
 }
 
 // commit collapses a node down into a hash node and inserts it into the database
-func (c *committer) commit(n node, db *Database) (node, int, error) {
+func (c *committer) commit(path []byte, n node, db *Database) (node, int, error) {
 	// if this path is clean, use available cached data
 	hash, dirty := n.cache()
 	if hash != nil && !dirty {
+		c.markClean(path)
 		return hash, 0, nil
 	}
 	// Commit children, then parent, and remove remove the dirty flag.
@@ -100,34 +109,38 @@ func (c *committer) commit(n node, db *Database) (node, int, error) {
 		// If the child is fullNode, recursively commit,
 		// otherwise it can only be hashNode or valueNode.
 		var childCommitted int
-		if _, ok := cn.Val.(*fullNode); ok {
-			childV, committed, err := c.commit(cn.Val, db)
+		switch cn.Val.(type) {
+		case *fullNode:
+			childV, committed, err := c.commit(concat(path, cn.Key...), cn.Val, db)
 			if err != nil {
 				return nil, 0, err
 			}
 			collapsed.Val, childCommitted = childV, committed
+		case hashNode:
+			c.markClean(concat(path, cn.Key...))
 		}
 		// The key needs to be copied, since we're delivering it to database
 		collapsed.Key = hexToCompact(cn.Key)
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, childCommitted + 1, nil
 		}
 		return collapsed, childCommitted, nil
 	case *fullNode:
-		hashedKids, childCommitted, err := c.commitChildren(cn, db)
+		hashedKids, childCommitted, err := c.commitChildren(path, cn, db)
 		if err != nil {
 			return nil, 0, err
 		}
 		collapsed := cn.copy()
 		collapsed.Children = hashedKids
 
-		hashedNode := c.store(collapsed, db)
+		hashedNode := c.store(path, collapsed, db)
 		if hn, ok := hashedNode.(hashNode); ok {
 			return hn, childCommitted + 1, nil
 		}
 		return collapsed, childCommitted, nil
 	case hashNode:
+		c.markClean(path)
 		return cn, 0, nil
 	default:
 		// nil, valuenode shouldn't be committed
@@ -136,7 +149,7 @@ func (c *committer) commit(n node, db *Database) (node, int, error) {
 }
 
 // commitChildren commits the children of the given fullnode
-func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, error) {
+func (c *committer) commitChildren(path []byte, n *fullNode, db *Database) ([17]node, int, error) {
 	var (
 		committed int
 		children  [17]node
@@ -150,13 +163,14 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, er
 		// Note: it's impossible that the child in range [0, 15]
 		// is a valueNode.
 		if hn, ok := child.(hashNode); ok {
+			c.markClean(concat(path, byte(i)))
 			children[i] = hn
 			continue
 		}
 		// Commit the child recursively and store the "hashed" value.
 		// Note the returned node can be some embedded nodes, so it's
 		// possible the type is not hashNode.
-		hashed, childCommitted, err := c.commit(child, db)
+		hashed, childCommitted, err := c.commit(concat(path, byte(i)), child, db)
 		if err != nil {
 			return children, 0, err
 		}
@@ -173,7 +187,7 @@ func (c *committer) commitChildren(n *fullNode, db *Database) ([17]node, int, er
 // store hashes the node n and if we have a storage layer specified, it writes
 // the key/value pair to it and tracks any node->child references as well as any
 // node->external trie references.
-func (c *committer) store(n node, db *Database) node {
+func (c *committer) store(path []byte, n node, db *Database) node {
 	// Larger nodes are replaced by their hash and stored in the database.
 	var (
 		hash, _ = n.cache()
@@ -190,6 +204,15 @@ func (c *committer) store(n node, db *Database) node {
 		// The size is used for mem tracking, does not need to be exact
 		size = estimateSize(n)
 	}
+	// Path based databases collect the nodes by path instead of inserting them,
+	// the leaf callback is still invoked if requested.
+	if c.nodes != nil {
+		blob, err := rlp.EncodeToBytes(n)
+		if err != nil {
+			panic(fmt.Sprintf("encode error: %v", err))
+		}
+		c.nodes.add(path, common.BytesToHash(hash), blob)
+	}
 	// If we're using channel-based leaf-reporting, send to channel.
 	// The leaf channel will be active only when there an active leaf-callback
 	if c.leafCh != nil {
@@ -198,7 +221,7 @@ func (c *committer) store(n node, db *Database) node {
 			hash: common.BytesToHash(hash),
 			node: n,
 		}
-	} else if db != nil {
+	} else if db != nil && db.paths == nil {
 		// No leaf-callback used, but there's still a database. Do serial
 		// insertion
 		db.lock.Lock()
@@ -217,9 +240,11 @@ func (c *committer) commitLoop(db *Database) {
 			n    = item.node
 		)
 		// We are pooling the trie nodes into an intermediate memory cache
-		db.lock.Lock()
-		db.insert(hash, size, n)
-		db.lock.Unlock()
+		if db.paths == nil {
+			db.lock.Lock()
+			db.insert(hash, size, n)
+			db.lock.Unlock()
+		}
 
 		if c.onleaf != nil {
 			switch n := n.(type) {
@@ -238,6 +263,14 @@ func (c *committer) commitLoop(db *Database) {
 	}
 }
 
+// markClean records the path of an unmodified subtrie when collecting nodes for
+// a path based database.
+func (c *committer) markClean(path []byte) {
+	if c.clean != nil {
+		c.clean[string(path)] = struct{}{}
+	}
+}
+
 func (c *committer) makeHashNode(data []byte) hashNode {
 	n := make(hashNode, c.sha.Size())
 	c.sha.Reset()
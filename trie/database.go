@@ -89,6 +89,12 @@ type Database struct {
 	preimagesSize common.StorageSize // Storage size of the preimages cache
 
 	lock sync.RWMutex
+
+	pruneLock sync.Mutex             // Serializes node flushes with online pruning deletions
+	pruneMark func(hash common.Hash) // Callback marking flushed nodes live during online pruning
+
+	paths  *pathStore // Path based node storage, nil if nodes are keyed by hash
+	binary bool       // Whether the state is stored in binary tries instead
 }
 
 // rawNode is a simple binary blob used to differentiate between collapsed trie
@@ -274,9 +280,11 @@ func expandNode(hash hashNode, n node) node {
 
 // Config defines all necessary options for database.
 type Config struct {
-	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
-	Journal   string // Journal of clean cache to survive node restarts
-	Preimages bool   // Flag whether the preimage of trie key is recorded
+	Cache        int    // Memory allowance (MB) to use for caching trie nodes in memory
+	Journal      string // Journal of clean cache to survive node restarts
+	Preimages    bool   // Flag whether the preimage of trie key is recorded
+	Scheme       string // Trie node storage scheme, hash based if empty
+	ReverseDiffs uint64 // Number of recent states the path scheme can be rolled back to
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -308,6 +316,12 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	if config != nil && config.Scheme == rawdb.PathScheme {
+		db.paths = newPathStore(diskdb, cleans, config.ReverseDiffs)
+	}
+	if config != nil && config.Scheme == rawdb.BinaryScheme {
+		db.binary = true
+	}
 	return db
 }
 
@@ -316,6 +330,76 @@ func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
 }
 
+// SetPruneMarker installs a callback invoked with the hash of every trie node
+// before it is flushed to disk, or removes the installed one if nil. It is used
+// by online pruning to track the nodes written while it runs.
+func (db *Database) SetPruneMarker(mark func(hash common.Hash)) {
+	db.pruneLock.Lock()
+	defer db.pruneLock.Unlock()
+
+	db.pruneMark = mark
+}
+
+// DeleteNodes deletes the given trie nodes from disk and from the clean cache,
+// skipping the ones reported live by keep. Node flushes are blocked during the
+// deletion, so a node marked live by a concurrent flush is never deleted.
+func (db *Database) DeleteNodes(hashes []common.Hash, keep func(hash common.Hash) bool) (int, error) {
+	db.pruneLock.Lock()
+	defer db.pruneLock.Unlock()
+
+	var (
+		batch   = db.diskdb.NewBatch()
+		deleted []common.Hash
+	)
+	for _, hash := range hashes {
+		if keep(hash) {
+			continue
+		}
+		rawdb.DeleteTrieNode(batch, hash)
+		deleted = append(deleted, hash)
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	if db.cleans != nil {
+		for _, hash := range deleted {
+			db.cleans.Del(hash[:])
+		}
+	}
+	return len(deleted), nil
+}
+
+// writeBatch flushes a batch of trie nodes to disk. If online pruning is running,
+// the nodes are marked live before being written, so they are never deleted by it.
+func (db *Database) writeBatch(batch ethdb.Batch) error {
+	db.pruneLock.Lock()
+	defer db.pruneLock.Unlock()
+
+	if db.pruneMark != nil {
+		if err := batch.Replay(pruneMarker(db.pruneMark)); err != nil {
+			return err
+		}
+	}
+	return batch.Write()
+}
+
+// pruneMarker is a batch replayer reporting the trie nodes of a batch to an online
+// pruning marker.
+type pruneMarker func(hash common.Hash)
+
+// Put marks trie nodes live, ignoring any other entries (e.g. preimages).
+func (m pruneMarker) Put(key []byte, value []byte) error {
+	if len(key) == common.HashLength {
+		m(common.BytesToHash(key))
+	}
+	return nil
+}
+
+// Delete ignores deletions, they're never part of a node flush.
+func (m pruneMarker) Delete(key []byte) error {
+	return nil
+}
+
 // insert inserts a collapsed trie node into the memory database.
 // The blob size must be specified to allow proper size tracking.
 // All nodes inserted by this function will be reference tracked
@@ -410,6 +494,10 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
 	}
+	// Path based nodes can't be retrieved by hash alone
+	if db.paths != nil {
+		return nil, errUnsupportedScheme
+	}
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
@@ -516,6 +604,10 @@ func (db *Database) Dereference(root common.Hash) {
 		log.Error("Attempted to dereference the trie cache meta root")
 		return
 	}
+	// Path based layers are released when flushed
+	if db.paths != nil {
+		return
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -612,7 +704,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 		} else {
 			rawdb.WritePreimages(batch, db.preimages)
 			if batch.ValueSize() > ethdb.IdealBatchSize {
-				if err := batch.Write(); err != nil {
+				if err := db.writeBatch(batch); err != nil {
 					return err
 				}
 				batch.Reset()
@@ -628,7 +720,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 
 		// If we exceeded the ideal batch size, commit and reset
 		if batch.ValueSize() >= ethdb.IdealBatchSize {
-			if err := batch.Write(); err != nil {
+			if err := db.writeBatch(batch); err != nil {
 				log.Error("Failed to write flush list to disk", "err", err)
 				return err
 			}
@@ -644,7 +736,7 @@ func (db *Database) Cap(limit common.StorageSize) error {
 		oldest = node.flushNext
 	}
 	// Flush out any remainder data from the last batch
-	if err := batch.Write(); err != nil {
+	if err := db.writeBatch(batch); err != nil {
 		log.Error("Failed to write flush list to disk", "err", err)
 		return err
 	}
@@ -705,11 +797,27 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 		rawdb.WritePreimages(batch, db.preimages)
 		// Since we're going to replay trie node writes into the clean cache, flush out
 		// any batched pre-images before continuing.
-		if err := batch.Write(); err != nil {
+		if err := db.writeBatch(batch); err != nil {
 			return err
 		}
 		batch.Reset()
 	}
+	// Path based databases flush all the layers below the state instead
+	if db.paths != nil {
+		if err := db.paths.cap(node, 0); err != nil {
+			log.Error("Failed to commit trie from trie database", "err", err)
+			return err
+		}
+		if db.preimages != nil {
+			db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+		}
+		logger := log.Info
+		if !report {
+			logger = log.Debug
+		}
+		logger("Persisted path trie layers", "root", node, "time", time.Since(start))
+		return nil
+	}
 	// Move the trie itself into the batch, flushing if enough data is accumulated
 	nodes, storage := len(db.dirties), db.dirtiesSize
 
@@ -719,7 +827,7 @@ func (db *Database) Commit(node common.Hash, report bool, callback func(common.H
 		return err
 	}
 	// Trie mostly committed to disk, flush any batch leftovers
-	if err := batch.Write(); err != nil {
+	if err := db.writeBatch(batch); err != nil {
 		log.Error("Failed to write trie to disk", "err", err)
 		return err
 	}
@@ -774,7 +882,7 @@ func (db *Database) commit(hash common.Hash, batch ethdb.Batch, uncacher *cleane
 		callback(hash)
 	}
 	if batch.ValueSize() >= ethdb.IdealBatchSize {
-		if err := batch.Write(); err != nil {
+		if err := db.writeBatch(batch); err != nil {
 			return err
 		}
 		db.lock.Lock()
@@ -837,6 +945,9 @@ func (c *cleaner) Delete(key []byte) error {
 // Size returns the current storage size of the memory cache in front of the
 // persistent database layer.
 func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	if db.paths != nil {
+		return db.paths.size(), db.preimagesSize
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
@@ -20,6 +20,7 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 )
 
@@ -31,3 +32,53 @@ func TestDatabaseMetarootFetch(t *testing.T) {
 		t.Fatalf("metaroot retrieval succeeded")
 	}
 }
+
+// Tests that nodes flushed while a prune marker is installed are reported to it,
+// and that only the nodes not kept are deleted.
+func TestDatabasePruneMarker(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabase(diskdb)
+
+	// Persist a first trie without any marker installed
+	stale, _ := New(common.Hash{}, db)
+	stale.Update([]byte("stale"), []byte("value"))
+	staleRoot, _, _ := stale.Commit(nil)
+	if err := db.Commit(staleRoot, false, nil); err != nil {
+		t.Fatalf("failed to commit stale trie: %v", err)
+	}
+	// Persist a second trie with the marker installed
+	marked := make(map[common.Hash]struct{})
+	db.SetPruneMarker(func(hash common.Hash) { marked[hash] = struct{}{} })
+
+	live, _ := New(common.Hash{}, db)
+	live.Update([]byte("live"), []byte("value"))
+	liveRoot, _, _ := live.Commit(nil)
+	if err := db.Commit(liveRoot, false, nil); err != nil {
+		t.Fatalf("failed to commit live trie: %v", err)
+	}
+	db.SetPruneMarker(nil)
+
+	if _, ok := marked[liveRoot]; !ok {
+		t.Fatalf("flushed root not marked")
+	}
+	if _, ok := marked[staleRoot]; ok {
+		t.Fatalf("root flushed before the marker was installed got marked")
+	}
+	keep := func(hash common.Hash) bool {
+		_, ok := marked[hash]
+		return ok
+	}
+	deleted, err := db.DeleteNodes([]common.Hash{staleRoot, liveRoot}, keep)
+	if err != nil {
+		t.Fatalf("failed to delete nodes: %v", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("deleted node count mismatch: have %d, want 1", deleted)
+	}
+	if blob := rawdb.ReadTrieNode(diskdb, staleRoot); len(blob) != 0 {
+		t.Fatalf("stale root not deleted")
+	}
+	if blob := rawdb.ReadTrieNode(diskdb, liveRoot); len(blob) == 0 {
+		t.Fatalf("marked root deleted")
+	}
+}
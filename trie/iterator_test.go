@@ -482,6 +482,10 @@ func (l *loggingDb) Compact(start []byte, limit []byte) error {
 	return l.backend.Compact(start, limit)
 }
 
+func (l *loggingDb) NewSnapshot() (ethdb.Snapshot, error) {
+	return l.backend.NewSnapshot()
+}
+
 func (l *loggingDb) Close() error {
 	return l.backend.Close()
 }
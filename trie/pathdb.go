@@ -0,0 +1,632 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// DefaultReverseDiffs is the default number of blocks the state of the path
+// based trie node storage can be rolled back.
+const DefaultReverseDiffs = 90000
+
+var (
+	// errStateUnknown is returned if the state a layer is built on or rolled back
+	// to is unknown.
+	errStateUnknown = errors.New("unknown state")
+
+	// errUnsupportedScheme is returned if an operation can't be served by the
+	// path based trie node storage.
+	errUnsupportedScheme = errors.New("not supported by the path scheme")
+)
+
+// pathNode is a trie node stored by path along with its hash. A nil blob marks
+// a deleted node.
+type pathNode struct {
+	hash common.Hash
+	blob []byte
+}
+
+// NodeSet contains the trie nodes committed by a single trie, keyed by their
+// path within the trie. It's only collected for path based trie databases.
+type NodeSet struct {
+	owner common.Hash // Account hash of a storage trie, zero for the account trie
+	nodes map[string]*pathNode
+}
+
+// NewNodeSet creates an empty node set for the trie of the given owner.
+func NewNodeSet(owner common.Hash) *NodeSet {
+	return &NodeSet{owner: owner, nodes: make(map[string]*pathNode)}
+}
+
+// Owner returns the account hash of the trie owning the nodes.
+func (set *NodeSet) Owner() common.Hash {
+	return set.owner
+}
+
+// Len returns the number of committed and deleted nodes in the set.
+func (set *NodeSet) Len() int {
+	return len(set.nodes)
+}
+
+// add inserts a committed node, or a deletion if the blob is nil.
+func (set *NodeSet) add(path []byte, hash common.Hash, blob []byte) {
+	set.nodes[string(path)] = &pathNode{hash: hash, blob: blob}
+}
+
+// MergedNodeSet groups the node sets of all tries committed for a state.
+type MergedNodeSet struct {
+	sets map[common.Hash]*NodeSet
+}
+
+// NewMergedNodeSet creates an empty merged node set.
+func NewMergedNodeSet() *MergedNodeSet {
+	return &MergedNodeSet{sets: make(map[common.Hash]*NodeSet)}
+}
+
+// Merge adds the node set of a trie. Nil sets are ignored, an owner can only be
+// merged once.
+func (set *MergedNodeSet) Merge(other *NodeSet) error {
+	if other == nil {
+		return nil
+	}
+	if _, ok := set.sets[other.owner]; ok {
+		return fmt.Errorf("duplicate trie for owner %x", other.owner)
+	}
+	set.sets[other.owner] = other
+	return nil
+}
+
+// pathTracer records the paths of the nodes a trie loaded from the database, so
+// that the nodes removed from the trie can be deleted from disk on commit.
+type pathTracer struct {
+	loaded map[string]struct{}
+}
+
+// newPathTracer creates an empty path tracer.
+func newPathTracer() *pathTracer {
+	return &pathTracer{loaded: make(map[string]struct{})}
+}
+
+// onLoad records the path of a node loaded from the database.
+func (t *pathTracer) onLoad(path []byte) {
+	t.loaded[string(path)] = struct{}{}
+}
+
+// reset forgets all recorded paths.
+func (t *pathTracer) reset() {
+	t.loaded = make(map[string]struct{})
+}
+
+// copy returns a deep copy of the tracer.
+func (t *pathTracer) copy() *pathTracer {
+	if t == nil {
+		return nil
+	}
+	loaded := make(map[string]struct{}, len(t.loaded))
+	for path := range t.loaded {
+		loaded[path] = struct{}{}
+	}
+	return &pathTracer{loaded: loaded}
+}
+
+// pathDiff is an in-memory layer of trie nodes, holding the changes of a state
+// on top of its parent state.
+type pathDiff struct {
+	root   common.Hash
+	parent common.Hash
+	nodes  map[common.Hash]map[string]*pathNode
+	size   common.StorageSize
+}
+
+// indexedNode is a node version held by one or more diff layers.
+type indexedNode struct {
+	blob []byte
+	refs int
+}
+
+// reverseDiff is the list of the node values overwritten when flushing a state
+// to disk, allowing to roll the disk back to its parent state.
+type reverseDiff struct {
+	Parent common.Hash
+	Root   common.Hash
+	Nodes  []reverseDiffNode
+}
+
+// reverseDiffNode is the previous value of a node, empty if it didn't exist.
+type reverseDiffNode struct {
+	Owner common.Hash
+	Path  []byte
+	Blob  []byte
+}
+
+// pathStore keeps the trie nodes on disk keyed by owner and path, which holds a
+// single state, and the recent states in memory as diff layers on top of it.
+// Diff layers are flushed to disk one state at a time, storing a reverse diff of
+// the overwritten nodes, so that the disk can be rolled back to a recent state.
+//
+// Nodes are looked up by owner, path and hash. Every node read from disk is
+// verified against its hash, so stale nodes are never served.
+type pathStore struct {
+	diskdb ethdb.KeyValueStore
+	cleans *fastcache.Cache
+	limit  uint64 // Number of reverse diffs to keep
+
+	diskRoot common.Hash                             // State root of the persisted nodes
+	diffs    map[common.Hash]*pathDiff               // In-memory diff layers by state root
+	index    map[string]map[common.Hash]*indexedNode // Node versions of the diff layers by owner and path
+	lock     sync.RWMutex
+}
+
+// newPathStore creates the path based node store on top of the disk database.
+func newPathStore(diskdb ethdb.KeyValueStore, cleans *fastcache.Cache, limit uint64) *pathStore {
+	if limit == 0 {
+		limit = DefaultReverseDiffs
+	}
+	return &pathStore{
+		diskdb:   diskdb,
+		cleans:   cleans,
+		limit:    limit,
+		diskRoot: diskStateRoot(diskdb),
+		diffs:    make(map[common.Hash]*pathDiff),
+		index:    make(map[string]map[common.Hash]*indexedNode),
+	}
+}
+
+// diskStateRoot derives the state root of the persisted nodes from the root node
+// of the account trie.
+func diskStateRoot(diskdb ethdb.KeyValueReader) common.Hash {
+	blob := rawdb.ReadAccountTrieNode(diskdb, nil)
+	if len(blob) == 0 {
+		return emptyRoot
+	}
+	return crypto.Keccak256Hash(blob)
+}
+
+// pathKey is the key of a node in the index and the clean cache.
+func pathKey(owner common.Hash, path []byte) []byte {
+	return append(append(make([]byte, 0, common.HashLength+len(path)), owner[:]...), path...)
+}
+
+// readDisk reads the persisted node of the given owner at the given path.
+func readDisk(db ethdb.KeyValueReader, owner common.Hash, path []byte) []byte {
+	if owner == (common.Hash{}) {
+		return rawdb.ReadAccountTrieNode(db, path)
+	}
+	return rawdb.ReadStorageTrieNode(db, owner, path)
+}
+
+// writeDisk persists the node of the given owner at the given path, deleting it
+// if the blob is empty.
+func writeDisk(db ethdb.KeyValueWriter, owner common.Hash, path []byte, blob []byte) {
+	switch {
+	case owner == (common.Hash{}) && len(blob) == 0:
+		rawdb.DeleteAccountTrieNode(db, path)
+	case owner == (common.Hash{}):
+		rawdb.WriteAccountTrieNode(db, path, blob)
+	case len(blob) == 0:
+		rawdb.DeleteStorageTrieNode(db, owner, path)
+	default:
+		rawdb.WriteStorageTrieNode(db, owner, path, blob)
+	}
+}
+
+// node retrieves the encoded node of the given owner at the given path if its
+// hash matches, or nil if it's not available.
+func (s *pathStore) node(owner common.Hash, path []byte, hash common.Hash) []byte {
+	key := pathKey(owner, path)
+
+	s.lock.RLock()
+	if versions := s.index[string(key)]; versions != nil {
+		if n := versions[hash]; n != nil {
+			s.lock.RUnlock()
+			memcacheDirtyHitMeter.Mark(1)
+			memcacheDirtyReadMeter.Mark(int64(len(n.blob)))
+			return n.blob
+		}
+	}
+	s.lock.RUnlock()
+	memcacheDirtyMissMeter.Mark(1)
+
+	if s.cleans != nil {
+		if blob := s.cleans.Get(nil, key); blob != nil && crypto.Keccak256Hash(blob) == hash {
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(blob)))
+			return blob
+		}
+	}
+	blob := readDisk(s.diskdb, owner, path)
+	if len(blob) == 0 || crypto.Keccak256Hash(blob) != hash {
+		return nil
+	}
+	if s.cleans != nil {
+		s.cleans.Set(key, blob)
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(blob)))
+	}
+	return blob
+}
+
+// update adds a diff layer holding the given nodes for the state root on top of
+// its parent state.
+func (s *pathStore) update(root, parent common.Hash, nodes *MergedNodeSet) error {
+	if parent == (common.Hash{}) {
+		parent = emptyRoot
+	}
+	// Empty transitions don't need a layer
+	if root == parent {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.diffs[root]; ok || root == s.diskRoot {
+		return nil
+	}
+	if _, ok := s.diffs[parent]; !ok && parent != s.diskRoot {
+		return fmt.Errorf("%w: parent %x of %x", errStateUnknown, parent, root)
+	}
+	diff := &pathDiff{
+		root:   root,
+		parent: parent,
+		nodes:  make(map[common.Hash]map[string]*pathNode),
+	}
+	if nodes != nil {
+		for owner, set := range nodes.sets {
+			diff.nodes[owner] = set.nodes
+			for path, n := range set.nodes {
+				diff.size += common.StorageSize(len(path) + len(n.blob))
+			}
+		}
+	}
+	// Deleting the account trie root leaves an empty state, track the removal
+	// so that the root of the persisted state can be derived.
+	if root == emptyRoot {
+		if diff.nodes[common.Hash{}] == nil {
+			diff.nodes[common.Hash{}] = make(map[string]*pathNode)
+		}
+		if _, ok := diff.nodes[common.Hash{}][""]; !ok {
+			diff.nodes[common.Hash{}][""] = &pathNode{}
+		}
+	}
+	s.diffs[root] = diff
+	s.indexDiff(diff)
+	return nil
+}
+
+// indexDiff adds the nodes of a diff layer to the index.
+func (s *pathStore) indexDiff(diff *pathDiff) {
+	for owner, nodes := range diff.nodes {
+		for path, n := range nodes {
+			if n.blob == nil {
+				continue
+			}
+			key := string(pathKey(owner, []byte(path)))
+			versions := s.index[key]
+			if versions == nil {
+				versions = make(map[common.Hash]*indexedNode)
+				s.index[key] = versions
+			}
+			if version := versions[n.hash]; version != nil {
+				version.refs++
+			} else {
+				versions[n.hash] = &indexedNode{blob: n.blob, refs: 1}
+			}
+		}
+	}
+}
+
+// unindexDiff removes the nodes of a diff layer from the index.
+func (s *pathStore) unindexDiff(diff *pathDiff) {
+	for owner, nodes := range diff.nodes {
+		for path, n := range nodes {
+			if n.blob == nil {
+				continue
+			}
+			key := string(pathKey(owner, []byte(path)))
+			versions := s.index[key]
+			if version := versions[n.hash]; version != nil {
+				if version.refs--; version.refs == 0 {
+					delete(versions, n.hash)
+				}
+			}
+			if len(versions) == 0 {
+				delete(s.index, key)
+			}
+		}
+	}
+}
+
+// available reports whether the given state can be read.
+func (s *pathStore) available(root common.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	_, ok := s.diffs[root]
+	return ok || root == s.diskRoot
+}
+
+// cap flushes the oldest diff layers below the given state root to disk, keeping
+// at most the given number of layers in memory. Layers of side chains which can
+// no longer be flushed are dropped.
+func (s *pathStore) cap(root common.Hash, layers int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if root == s.diskRoot {
+		return nil
+	}
+	var chain []*pathDiff
+	for hash := root; hash != s.diskRoot; {
+		diff := s.diffs[hash]
+		if diff == nil {
+			return fmt.Errorf("%w: %x", errStateUnknown, root)
+		}
+		chain = append(chain, diff)
+		hash = diff.parent
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	var (
+		start = time.Now()
+		count int
+	)
+	for i := len(chain) - 1; i >= layers; i-- {
+		if err := s.flush(chain[i]); err != nil {
+			return err
+		}
+		count++
+	}
+	// Drop all layers not built on top of the new disk state
+	for {
+		var dropped bool
+		for hash, diff := range s.diffs {
+			if _, ok := s.diffs[diff.parent]; ok || diff.parent == s.diskRoot {
+				continue
+			}
+			s.unindexDiff(diff)
+			delete(s.diffs, hash)
+			dropped = true
+		}
+		if !dropped {
+			break
+		}
+	}
+	log.Debug("Flushed path trie layers", "layers", count, "root", s.diskRoot, "live", len(s.diffs), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// flush writes a diff layer built on the disk state to disk, along with the
+// reverse diff rolling it back.
+func (s *pathStore) flush(diff *pathDiff) error {
+	var (
+		batch   = s.diskdb.NewBatch()
+		reverse = reverseDiff{Parent: diff.parent, Root: diff.root}
+	)
+	for owner, nodes := range diff.nodes {
+		for path, n := range nodes {
+			reverse.Nodes = append(reverse.Nodes, reverseDiffNode{
+				Owner: owner,
+				Path:  []byte(path),
+				Blob:  readDisk(s.diskdb, owner, []byte(path)),
+			})
+			writeDisk(batch, owner, []byte(path), n.blob)
+		}
+	}
+	blob, err := rlp.EncodeToBytes(&reverse)
+	if err != nil {
+		return err
+	}
+	id := rawdb.ReadReverseDiffHead(s.diskdb) + 1
+	rawdb.WriteReverseDiff(batch, id, diff.root, blob)
+	rawdb.WriteReverseDiffHead(batch, id)
+
+	// Drop the reverse diff falling out of the rollback window
+	if id > s.limit {
+		s.deleteReverseDiff(batch, id-s.limit)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if s.cleans != nil {
+		for owner, nodes := range diff.nodes {
+			for path, n := range nodes {
+				key := pathKey(owner, []byte(path))
+				if n.blob == nil {
+					s.cleans.Del(key)
+				} else {
+					s.cleans.Set(key, n.blob)
+				}
+			}
+		}
+	}
+	s.unindexDiff(diff)
+	delete(s.diffs, diff.root)
+	s.diskRoot = diff.root
+	return nil
+}
+
+// deleteReverseDiff deletes the reverse diff with the given id, keeping the root
+// lookup if it was overwritten by a later diff.
+func (s *pathStore) deleteReverseDiff(batch ethdb.KeyValueWriter, id uint64) {
+	blob := rawdb.ReadReverseDiff(s.diskdb, id)
+	if len(blob) == 0 {
+		return
+	}
+	var diff reverseDiff
+	if err := rlp.DecodeBytes(blob, &diff); err != nil {
+		log.Error("Invalid reverse diff", "id", id, "err", err)
+		return
+	}
+	if lookup := rawdb.ReadReverseDiffLookup(s.diskdb, diff.Root); lookup != nil && *lookup != id {
+		diff.Root = common.Hash{}
+	}
+	rawdb.DeleteReverseDiff(batch, id, diff.Root)
+}
+
+// recoverable reports whether the disk state can be rolled back to the given
+// state root.
+func (s *pathStore) recoverable(root common.Hash) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if root == s.diskRoot {
+		return true
+	}
+	id := rawdb.ReadReverseDiffLookup(s.diskdb, root)
+	if id == nil || *id >= rawdb.ReadReverseDiffHead(s.diskdb) {
+		return false
+	}
+	return len(rawdb.ReadReverseDiff(s.diskdb, *id+1)) > 0
+}
+
+// recover rolls the disk state back to the given state root by applying the
+// reverse diffs, dropping all diff layers.
+func (s *pathStore) recover(root common.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, diff := range s.diffs {
+		s.unindexDiff(diff)
+	}
+	s.diffs = make(map[common.Hash]*pathDiff)
+
+	start := time.Now()
+	for s.diskRoot != root {
+		id := rawdb.ReadReverseDiffHead(s.diskdb)
+		blob := rawdb.ReadReverseDiff(s.diskdb, id)
+		if len(blob) == 0 {
+			return fmt.Errorf("%w: %x", errStateUnknown, root)
+		}
+		var diff reverseDiff
+		if err := rlp.DecodeBytes(blob, &diff); err != nil {
+			return err
+		}
+		if diff.Root != s.diskRoot {
+			return fmt.Errorf("reverse diff %d mismatch: have %x, want %x", id, diff.Root, s.diskRoot)
+		}
+		batch := s.diskdb.NewBatch()
+		for _, n := range diff.Nodes {
+			writeDisk(batch, n.Owner, n.Path, n.Blob)
+			if s.cleans != nil {
+				s.cleans.Del(pathKey(n.Owner, n.Path))
+			}
+		}
+		rawdb.DeleteReverseDiff(batch, id, diff.Root)
+		rawdb.WriteReverseDiffHead(batch, id-1)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		s.diskRoot = diff.Parent
+	}
+	log.Info("Rolled back path trie state", "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// size returns the memory used by the diff layers.
+func (s *pathStore) size() common.StorageSize {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var size common.StorageSize
+	for _, diff := range s.diffs {
+		size += diff.size
+	}
+	return size
+}
+
+// Scheme returns the trie node storage scheme of the database.
+func (db *Database) Scheme() string {
+	if db.paths != nil {
+		return rawdb.PathScheme
+	}
+	if db.binary {
+		return rawdb.BinaryScheme
+	}
+	return rawdb.HashScheme
+}
+
+// Update adds the trie nodes committed for a state on top of its parent state.
+// It's only needed for path based databases, hash based ones track the nodes on
+// commit.
+func (db *Database) Update(root, parent common.Hash, nodes *MergedNodeSet) error {
+	if db.paths == nil {
+		return nil
+	}
+	return db.paths.update(root, parent, nodes)
+}
+
+// CapLayers flushes the states below the given state root to disk, keeping the
+// given number of recent states in memory. It's only needed for path based
+// databases.
+func (db *Database) CapLayers(root common.Hash, layers int) error {
+	if db.paths == nil {
+		return nil
+	}
+	if db.preimagesSize > 4*1024*1024 {
+		batch := db.diskdb.NewBatch()
+		rawdb.WritePreimages(batch, db.preimages)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+	}
+	return db.paths.cap(root, layers)
+}
+
+// Available reports whether the nodes of the given state can be read. Hash based
+// databases only check the root node.
+func (db *Database) Available(root common.Hash) bool {
+	if root == (common.Hash{}) || root == emptyRoot {
+		return true
+	}
+	if db.paths != nil {
+		return db.paths.available(root)
+	}
+	_, err := db.Node(root)
+	return err == nil
+}
+
+// Recoverable reports whether the persisted state of a path based database can
+// be rolled back to the given state root.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.paths == nil {
+		return false
+	}
+	return db.paths.recoverable(root)
+}
+
+// Recover rolls the persisted state of a path based database back to the given
+// state root, discarding all states held in memory.
+func (db *Database) Recover(root common.Hash) error {
+	if db.paths == nil {
+		return errors.New("not supported by the hash scheme")
+	}
+	return db.paths.recover(root)
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// commitPathTrie commits the trie and adds its nodes as a new state on top of
+// the parent one.
+func commitPathTrie(t *testing.T, db *Database, tr *Trie, parent common.Hash) common.Hash {
+	root, _, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit trie: %v", err)
+	}
+	nodes := NewMergedNodeSet()
+	if err := nodes.Merge(tr.CommittedNodes()); err != nil {
+		t.Fatalf("failed to merge nodes: %v", err)
+	}
+	if err := db.Update(root, parent, nodes); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	return root
+}
+
+// checkPathTrie verifies that the trie at the given root holds exactly the
+// given entries.
+func checkPathTrie(t *testing.T, db *Database, root common.Hash, entries map[string]string) {
+	tr, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open trie %x: %v", root, err)
+	}
+	for key, val := range entries {
+		have, err := tr.TryGet([]byte(key))
+		if err != nil {
+			t.Fatalf("failed to read %q: %v", key, err)
+		}
+		if !bytes.Equal(have, []byte(val)) {
+			t.Fatalf("value mismatch for %q: have %q, want %q", key, have, val)
+		}
+	}
+	var count int
+	it := NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		count++
+	}
+	if it.Err != nil {
+		t.Fatalf("failed to iterate trie: %v", it.Err)
+	}
+	if count != len(entries) {
+		t.Fatalf("entry count mismatch: have %d, want %d", count, len(entries))
+	}
+}
+
+// countPathNodes returns the number of account trie nodes stored on disk.
+func countPathNodes(db ethdb.Iteratee) int {
+	it := db.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer it.Release()
+
+	var count int
+	for it.Next() {
+		count++
+	}
+	return count
+}
+
+// Tests that states are served from the diff layers and from disk, that stale
+// states are unavailable once flushed over and that the reverse diffs roll the
+// disk back to them.
+func TestPathDatabaseRollback(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+	if db.Scheme() != rawdb.PathScheme {
+		t.Fatalf("scheme mismatch: have %s, want %s", db.Scheme(), rawdb.PathScheme)
+	}
+	// Create three consecutive states
+	var (
+		roots   []common.Hash
+		states  []map[string]string
+		entries = make(map[string]string)
+		parent  = emptyRoot
+	)
+	tr, _ := New(parent, db)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 100; j++ {
+			key, val := fmt.Sprintf("key-%d", j*(i+1)), fmt.Sprintf("val-%d-%d", i, j)
+			tr.Update([]byte(key), []byte(val))
+			entries[key] = val
+		}
+		parent = commitPathTrie(t, db, tr, parent)
+		tr, _ = New(parent, db)
+
+		state := make(map[string]string)
+		for key, val := range entries {
+			state[key] = val
+		}
+		roots, states = append(roots, parent), append(states, state)
+	}
+	// All states are served from memory, nothing is flushed yet
+	for i, root := range roots {
+		checkPathTrie(t, db, root, states[i])
+	}
+	if countPathNodes(diskdb) != 0 {
+		t.Fatalf("nodes flushed before capping")
+	}
+	// Flush all but the last state, only the latest two are available
+	if err := db.CapLayers(roots[2], 1); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if db.Available(roots[0]) {
+		t.Fatalf("flushed over state available")
+	}
+	if _, err := New(roots[0], db); err == nil {
+		t.Fatalf("flushed over state opened")
+	}
+	checkPathTrie(t, db, roots[1], states[1])
+	checkPathTrie(t, db, roots[2], states[2])
+
+	// Flush everything and roll back to the first state
+	if err := db.Commit(roots[2], false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if head := rawdb.ReadReverseDiffHead(diskdb); head != 3 {
+		t.Fatalf("reverse diff head mismatch: have %d, want 3", head)
+	}
+	if !db.Recoverable(roots[0]) {
+		t.Fatalf("state not recoverable")
+	}
+	if err := db.Recover(roots[0]); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	checkPathTrie(t, db, roots[0], states[0])
+	if db.Available(roots[2]) {
+		t.Fatalf("rolled back state available")
+	}
+	// A fresh database opened on the same disk serves the rolled back state
+	db = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+	checkPathTrie(t, db, roots[0], states[0])
+}
+
+// Tests that the nodes removed from a trie are deleted from disk, so that no
+// stale nodes are left behind.
+func TestPathDatabaseDeletion(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	tr, _ := New(emptyRoot, db)
+	for i := 0; i < 500; i++ {
+		tr.Update(crypto.Keccak256([]byte{byte(i), byte(i >> 8)}), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root := commitPathTrie(t, db, tr, emptyRoot)
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// Delete most of the entries from a reloaded trie
+	entries := make(map[string]string)
+	tr, _ = New(root, db)
+	for i := 0; i < 500; i++ {
+		key := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})
+		if i%50 == 0 {
+			entries[string(key)] = fmt.Sprintf("value-%d", i)
+			continue
+		}
+		if err := tr.TryDelete(key); err != nil {
+			t.Fatalf("failed to delete entry %d: %v", i, err)
+		}
+	}
+	root = commitPathTrie(t, db, tr, root)
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	checkPathTrie(t, db, root, entries)
+
+	// Every node left on disk must be part of the trie
+	tr, _ = New(root, db)
+	var nodes int
+	for it := tr.NodeIterator(nil); it.Next(true); {
+		if it.Hash() != (common.Hash{}) {
+			nodes++
+		}
+	}
+	if have := countPathNodes(diskdb); have != nodes {
+		t.Fatalf("stale nodes left on disk: have %d, want %d", have, nodes)
+	}
+	// Deleting the whole trie leaves an empty state
+	tr, _ = New(root, db)
+	for key := range entries {
+		tr.Delete([]byte(key))
+	}
+	root = commitPathTrie(t, db, tr, root)
+	if root != emptyRoot {
+		t.Fatalf("root mismatch: have %x, want %x", root, emptyRoot)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if have := countPathNodes(diskdb); have != 0 {
+		t.Fatalf("stale nodes left on disk: have %d, want 0", have)
+	}
+	if have := diskStateRoot(diskdb); have != emptyRoot {
+		t.Fatalf("disk root mismatch: have %x, want %x", have, emptyRoot)
+	}
+}
+
+// Tests that storage tries of different owners with the same content are kept
+// apart.
+func TestPathDatabaseOwners(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	var (
+		owners = []common.Hash{{0x01}, {0x02}}
+		nodes  = NewMergedNodeSet()
+		root   common.Hash
+	)
+	for _, owner := range owners {
+		tr, _ := NewWithOwner(owner, emptyRoot, db)
+		for i := 0; i < 50; i++ {
+			tr.Update([]byte(fmt.Sprintf("slot-%d", i)), []byte("value"))
+		}
+		root, _, _ = tr.Commit(nil)
+		if err := nodes.Merge(tr.CommittedNodes()); err != nil {
+			t.Fatalf("failed to merge nodes: %v", err)
+		}
+	}
+	// Hang the storage tries under an arbitrary account trie root
+	acc, _ := New(emptyRoot, db)
+	acc.Update([]byte("account"), root[:])
+	accRoot, _, _ := acc.Commit(nil)
+	if err := nodes.Merge(acc.CommittedNodes()); err != nil {
+		t.Fatalf("failed to merge nodes: %v", err)
+	}
+	if err := nodes.Merge(acc.CommittedNodes()); err == nil {
+		t.Fatalf("duplicate owner merged")
+	}
+	if err := db.Update(accRoot, emptyRoot, nodes); err != nil {
+		t.Fatalf("failed to update state: %v", err)
+	}
+	if err := db.Commit(accRoot, false, nil); err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	for _, owner := range owners {
+		if blob := rawdb.ReadStorageTrieNode(diskdb, owner, nil); crypto.Keccak256Hash(blob) != root {
+			t.Fatalf("storage root of %x missing", owner)
+		}
+		if _, err := NewWithOwner(owner, root, db); err != nil {
+			t.Fatalf("failed to open storage trie of %x: %v", owner, err)
+		}
+	}
+	if _, err := NewWithOwner(common.Hash{0x03}, root, db); err == nil {
+		t.Fatalf("storage trie of unknown owner opened")
+	}
+}
@@ -58,12 +58,19 @@ type LeafCallback func(paths [][]byte, hexpath []byte, leaf []byte, parent commo
 //
 // Trie is not safe for concurrent use.
 type Trie struct {
-	db   *Database
-	root node
+	db    *Database
+	root  node
+	owner common.Hash // Account hash of a storage trie, zero for the account trie
+
 	// Keep track of the number leafs which have been inserted since the last
 	// hashing operation. This number will not directly map to the number of
 	// actually unhashed nodes
 	unhashed int
+
+	// Path based databases only: the paths of the nodes loaded from the database
+	// and the nodes collected by the last commit.
+	tracer    *pathTracer
+	committed *NodeSet
 }
 
 // newFlag returns the cache flag value for a newly created node.
@@ -78,11 +85,22 @@ func (t *Trie) newFlag() nodeFlag {
 // New will panic if db is nil and returns a MissingNodeError if root does
 // not exist in the database. Accessing the trie loads nodes from db on demand.
 func New(root common.Hash, db *Database) (*Trie, error) {
+	return NewWithOwner(common.Hash{}, root, db)
+}
+
+// NewWithOwner creates a trie with an existing root node from db, owned by the
+// given account. The owner is only relevant for storage tries of path based
+// databases, where the nodes are keyed by owner and path.
+func NewWithOwner(owner common.Hash, root common.Hash, db *Database) (*Trie, error) {
 	if db == nil {
 		panic("trie.New called without a database")
 	}
 	trie := &Trie{
-		db: db,
+		db:    db,
+		owner: owner,
+	}
+	if db.paths != nil {
+		trie.tracer = newPathTracer()
 	}
 	if root != (common.Hash{}) && root != emptyRoot {
 		rootnode, err := trie.resolveHash(root[:], nil)
@@ -188,6 +206,13 @@ func (t *Trie) tryGetNode(origNode node, path []byte, pos int) (item []byte, new
 		if hash == nil {
 			return nil, origNode, 0, errors.New("non-consensus node")
 		}
+		if t.db.paths != nil {
+			blob := t.db.paths.node(t.owner, path[:pos], common.BytesToHash(hash))
+			if blob == nil {
+				return nil, origNode, 1, &MissingNodeError{NodeHash: common.BytesToHash(hash), Path: path[:pos]}
+			}
+			return blob, origNode, 1, nil
+		}
 		blob, err := t.db.Node(common.BytesToHash(hash))
 		return blob, origNode, 1, err
 	}
@@ -441,7 +466,7 @@ func (t *Trie) delete(n node, prefix, key []byte) (bool, node, error) {
 				// shortNode{..., shortNode{...}}.  Since the entry
 				// might not be loaded yet, resolve it just for this
 				// check.
-				cnode, err := t.resolve(n.Children[pos], prefix)
+				cnode, err := t.resolve(n.Children[pos], concat(prefix, byte(pos)))
 				if err != nil {
 					return false, nil, err
 				}
@@ -498,6 +523,15 @@ func (t *Trie) resolve(n node, prefix []byte) (node, error) {
 
 func (t *Trie) resolveHash(n hashNode, prefix []byte) (node, error) {
 	hash := common.BytesToHash(n)
+	if t.db.paths != nil {
+		if blob := t.db.paths.node(t.owner, prefix, hash); blob != nil {
+			if t.tracer != nil {
+				t.tracer.onLoad(prefix)
+			}
+			return mustDecodeNode(n, blob), nil
+		}
+		return nil, &MissingNodeError{NodeHash: hash, Path: prefix}
+	}
 	if node := t.db.node(hash); node != nil {
 		return node, nil
 	}
@@ -518,7 +552,13 @@ func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
 	if t.db == nil {
 		panic("commit called on trie with nil database")
 	}
+	if t.db.paths != nil {
+		t.committed = NewNodeSet(t.owner)
+	}
 	if t.root == nil {
+		if t.tracer != nil {
+			t.commitDeletions(nil, nil)
+		}
 		return emptyRoot, 0, nil
 	}
 	// Derive the hash for all dirty nodes first. We hold the assumption
@@ -531,8 +571,14 @@ func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
 	// up goroutines. This can happen e.g. if we load a trie for reading storage
 	// values, but don't write to it.
 	if _, dirty := t.root.cache(); !dirty {
+		if t.tracer != nil {
+			t.tracer.reset()
+		}
 		return rootHash, 0, nil
 	}
+	if t.committed != nil {
+		h.nodes, h.clean = t.committed, make(map[string]struct{})
+	}
 	var wg sync.WaitGroup
 	if onleaf != nil {
 		h.onleaf = onleaf
@@ -555,10 +601,40 @@ func (t *Trie) Commit(onleaf LeafCallback) (common.Hash, int, error) {
 	if err != nil {
 		return common.Hash{}, 0, err
 	}
+	if t.tracer != nil {
+		t.commitDeletions(h.nodes, h.clean)
+	}
 	t.root = newRoot
 	return rootHash, committed, nil
 }
 
+// commitDeletions adds the nodes loaded from a path based database which are no
+// longer part of the trie to the committed node set as deletions. A loaded node
+// is still live if it was rewritten or lies below an unmodified node.
+func (t *Trie) commitDeletions(written *NodeSet, clean map[string]struct{}) {
+	for path := range t.tracer.loaded {
+		if written != nil {
+			if _, ok := written.nodes[path]; ok {
+				continue
+			}
+		}
+		var live bool
+		for i := 0; i <= len(path) && !live; i++ {
+			_, live = clean[path[:i]]
+		}
+		if !live {
+			t.committed.add([]byte(path), common.Hash{}, nil)
+		}
+	}
+	t.tracer.reset()
+}
+
+// CommittedNodes returns the nodes collected by the last commit of a trie backed
+// by a path based database, or nil for hash based ones.
+func (t *Trie) CommittedNodes() *NodeSet {
+	return t.committed
+}
+
 // hashRoot calculates the root hash of the given trie
 func (t *Trie) hashRoot() (node, node, error) {
 	if t.root == nil {
@@ -576,4 +652,7 @@ func (t *Trie) hashRoot() (node, node, error) {
 func (t *Trie) Reset() {
 	t.root = nil
 	t.unhashed = 0
+	if t.tracer != nil {
+		t.tracer.reset()
+	}
 }